@@ -8,8 +8,9 @@ import (
 )
 
 type ServerConfig struct {
-	Port    int `yaml:"port"`
-	Prefork bool   `yaml:"prefork"`
+	Port                  int  `yaml:"port"`
+	Prefork               bool `yaml:"prefork"`
+	RequestTimeoutSeconds int  `yaml:"request_timeout_seconds"`
 }
 
 type DBConfig struct {
@@ -30,18 +31,120 @@ type SMTPConfig struct {
 	From     string `yaml:"from"`
 }
 
+// JWTKeyConfig is one RS256/EdDSA key. To rotate, add the new key, point
+// signing_key_id at it and keep the old one (public_key_file is enough)
+// until refresh_ttl_hours have passed.
+type JWTKeyConfig struct {
+	ID             string `yaml:"id"`
+	PrivateKeyFile string `yaml:"private_key_file"`
+	PublicKeyFile  string `yaml:"public_key_file"`
+}
+
 type JWTConfig struct {
-	AccessSecret     string `yaml:"access_secret"`
-	RefreshSecret    string `yaml:"refresh_secret"`
-	AccessTTLMinutes int    `yaml:"access_ttl_minutes"`
-	RefreshTTLHours  int    `yaml:"refresh_ttl_hours"`
+	AccessSecret     string         `yaml:"access_secret"`  // HS256, used when no keys are configured
+	RefreshSecret    string         `yaml:"refresh_secret"` // HS256, used when no keys are configured
+	AccessTTLMinutes int            `yaml:"access_ttl_minutes"`
+	RefreshTTLHours  int            `yaml:"refresh_ttl_hours"`
+	Issuer           string         `yaml:"issuer"`   // default "vestra"
+	Audience         string         `yaml:"audience"` // default "vestra-api"
+	SigningKeyID     string         `yaml:"signing_key_id"`
+	Keys             []JWTKeyConfig `yaml:"keys"`
+}
+
+type RazorpayConfig struct {
+	KeyID         string `yaml:"key_id"`
+	KeySecret     string `yaml:"key_secret"`
+	WebhookSecret string `yaml:"webhook_secret"`
+	BaseURL       string `yaml:"base_url"` // optional, defaults to the live API
+}
+
+type FakeGatewayConfig struct {
+	Secret        string `yaml:"secret"`
+	WebhookSecret string `yaml:"webhook_secret"`
+}
+
+// PaymentConfig picks the payment provider; it must be set. The fake
+// provider approves payments without taking money, so it is refused unless
+// allow_fake is set, which only development and test configs should do.
+type PaymentConfig struct {
+	Provider  string            `yaml:"provider"`   // razorpay | fake
+	AllowFake bool              `yaml:"allow_fake"` // dev/test only
+	Currency  string            `yaml:"currency"`   // store currency, defaults to INR
+	Razorpay  RazorpayConfig    `yaml:"razorpay"`
+	Fake      FakeGatewayConfig `yaml:"fake"`
+}
+
+type OTPConfig struct {
+	ExpiryMinutes         int `yaml:"expiry_minutes"`          // default 5
+	MaxAttempts           int `yaml:"max_attempts"`            // wrong guesses before lockout, default 5
+	LockoutMinutes        int `yaml:"lockout_minutes"`         // default 15
+	ResendCooldownSeconds int `yaml:"resend_cooldown_seconds"` // default 60
+	MaxSendsPerHour       int `yaml:"max_sends_per_hour"`      // per user and purpose, default 5
+}
+
+type MFAConfig struct {
+	Issuer string `yaml:"issuer"` // name shown in authenticator apps, default "Vestra"
+}
+
+// OIDCProviderConfig is one OpenID Connect login provider, e.g. Google with
+// issuer https://accounts.google.com. Endpoints come from the issuer's
+// discovery document.
+type OIDCProviderConfig struct {
+	Name         string   `yaml:"name"` // used in /auth/oidc/:provider
+	Issuer       string   `yaml:"issuer"`
+	ClientID     string   `yaml:"client_id"`
+	ClientSecret string   `yaml:"client_secret"`
+	RedirectURL  string   `yaml:"redirect_url"` // must be registered with the provider
+	Scopes       []string `yaml:"scopes"`       // default openid, email, profile
+}
+
+type AccountConfig struct {
+	DeletionGraceDays int `yaml:"deletion_grace_days"` // time to change your mind, default 14
+}
+
+type OrderConfig struct {
+	PaymentTimeoutMinutes int `yaml:"payment_timeout_minutes"` // unpaid orders are then cancelled and restocked, default 30
+}
+
+// LocalStorageConfig keeps uploads on this server's disk and serves them
+// under /media
+type LocalStorageConfig struct {
+	Dir     string `yaml:"dir"`      // default "uploads"
+	BaseURL string `yaml:"base_url"` // public origin of this server; default relative URLs
+}
+
+// S3StorageConfig is an S3 bucket or an S3-compatible one (MinIO, R2,
+// Spaces). Objects must be publicly readable, through the bucket policy or
+// the CDN at public_base_url.
+type S3StorageConfig struct {
+	Endpoint        string `yaml:"endpoint"` // default https://s3.<region>.amazonaws.com
+	Region          string `yaml:"region"`   // default us-east-1
+	Bucket          string `yaml:"bucket"`
+	AccessKeyID     string `yaml:"access_key_id"`
+	SecretAccessKey string `yaml:"secret_access_key"`
+	PathStyle       bool   `yaml:"path_style"`      // bucket in the path rather than the host, as MinIO wants
+	PublicBaseURL   string `yaml:"public_base_url"` // optional CDN in front of the bucket
+}
+
+type StorageConfig struct {
+	Provider    string             `yaml:"provider"`      // local | s3
+	MaxUploadMB int                `yaml:"max_upload_mb"` // per image, default 10
+	Local       LocalStorageConfig `yaml:"local"`
+	S3          S3StorageConfig    `yaml:"s3"`
 }
 
 type Config struct {
-	Server ServerConfig `yaml:"server"`
-	DB     DBConfig     `yaml:"db"`
-	SMTP   SMTPConfig   `yaml:"smtp"`
-	JWT    JWTConfig    `yaml:"jwt"`
+	Server  ServerConfig         `yaml:"server"`
+	DB      DBConfig             `yaml:"db"`
+	SMTP    SMTPConfig           `yaml:"smtp"`
+	JWT     JWTConfig            `yaml:"jwt"`
+	Payment PaymentConfig        `yaml:"payment"`
+	OTP     OTPConfig            `yaml:"otp"`
+	MFA     MFAConfig            `yaml:"mfa"`
+	OIDC    []OIDCProviderConfig `yaml:"oidc"`
+	Account AccountConfig        `yaml:"account"`
+	Order   OrderConfig          `yaml:"order"`
+	Storage StorageConfig        `yaml:"storage"`
 }
 
 
@@ -1,9 +1,13 @@
 package router
 
 import (
+	"strings"
+	"time"
+
 	"vestra-ecommerce/middleware"
 	"vestra-ecommerce/src/controller"
-	"vestra-ecommerce/src/repo"
+	"vestra-ecommerce/src/services"
+	constant "vestra-ecommerce/utils/constants"
 	"vestra-ecommerce/utils/jwt"
 
 	"github.com/gofiber/fiber/v2"
@@ -16,33 +20,83 @@ func Setup(
 	paymentController *controller.PaymentController,
 	addressController *controller.AddressController,
 	jwtManager *jwt.JWTManager,
-	pgRepo repo.IPgSQLRepository,
+	userStatus *services.UserStatusCache,
 	cartController *controller.CartController,
 	wishlistController *controller.WishlistController,
 	orderController *controller.OrderController,
+	roleController *controller.RoleController,
+	accountController *controller.AccountController,
+	userAdminController *controller.UserAdminController,
+	auditController *controller.AuditController,
+	taxonomyController *controller.TaxonomyController,
+	productImageController *controller.ProductImageController,
+	imageUploadLimit int,
 ) {
 
+	// Every body is held to Fiber's default limit, except image uploads,
+	// which get theirs once the admin is authenticated
+	app.Use(middleware.BodyLimit(fiber.DefaultBodyLimit, isImageUpload))
+
 	// ================= AUTH ROUTES (PUBLIC) =================
 	authGroup := app.Group("/auth")
 	authGroup.Post("/signup", auth.Signup)
 	authGroup.Post("/verify-otp", auth.VerifyOTP)
+	authGroup.Post("/resend-otp", middleware.RateLimit(5, time.Minute), auth.ResendOTP)
 	authGroup.Post("/login", auth.Login)
+	authGroup.Post("/login/2fa", middleware.RateLimit(10, time.Minute), auth.LoginMFA)
+	authGroup.Get("/oidc/providers", auth.OIDCProviders)
+	authGroup.Get("/oidc/:provider/start", middleware.RateLimit(20, time.Minute), auth.OIDCStart)
+	authGroup.Get("/oidc/:provider/callback", auth.OIDCCallback)
 	authGroup.Post("/forgot-password", auth.ForgotPassword)
 	authGroup.Post("/reset-password", auth.ResetPassword)
+	authGroup.Post("/logout", auth.Logout)
+	authGroup.Post("/logout-all", middleware.AuthMiddleware(jwtManager, userStatus), auth.LogoutAll)
 
 	app.Post("/refresh", auth.RefreshToken)
 
+	// ================= TOKEN VERIFICATION KEYS (PUBLIC) =================
+	// Plain JWKS document, not wrapped in the API response envelope
+	app.Get("/.well-known/jwks.json", func(c *fiber.Ctx) error {
+		c.Set(fiber.HeaderCacheControl, "public, max-age=300")
+		return c.JSON(jwtManager.JWKS())
+	})
+
+	// ================= PAYMENT PROVIDER WEBHOOKS (SIGNED) =================
+	app.Post("/webhooks/payments/:provider", paymentController.HandleWebhook)
+
 	// ================= PUBLIC PRODUCT ROUTES =================
 	app.Get("/products", productController.GetAllProducts)
 	app.Get("/products/search", productController.SearchProducts)
+	app.Get("/products/suggest", productController.Suggest)
 	app.Get("/products/:id", productController.GetProductByID)
+	app.Get("/categories", taxonomyController.ListCategories)
+	app.Get("/teams", taxonomyController.ListTeams)
 
 	// ================= USER ROUTES (PROTECTED) =================
-	userGroup := app.Group("/user", middleware.AuthMiddleware(jwtManager))
+	userGroup := app.Group("/user", middleware.AuthMiddleware(jwtManager, userStatus))
 
 	// Profile
 	userGroup.Get("/profile", auth.GetProfile)
 	userGroup.Put("/profile", auth.UpdateProfile)
+	userGroup.Put("/password", middleware.RateLimit(5, time.Minute), auth.ChangePassword)
+	userGroup.Post("/email", middleware.RateLimit(5, time.Minute), auth.RequestEmailChange)
+	userGroup.Post("/email/verify", auth.ConfirmEmailChange)
+
+	// Account data & deletion
+	userGroup.Get("/export", middleware.RateLimit(5, time.Minute), accountController.Export)
+	userGroup.Delete("/", accountController.ScheduleDeletion)
+	userGroup.Post("/deletion/cancel", accountController.CancelDeletion)
+
+	// Two-factor authentication
+	userGroup.Get("/2fa", auth.GetMFAStatus)
+	userGroup.Post("/2fa/setup", auth.SetupMFA)
+	userGroup.Post("/2fa/enable", auth.EnableMFA)
+	userGroup.Post("/2fa/disable", auth.DisableMFA)
+	userGroup.Post("/2fa/recovery-codes", auth.RegenerateRecoveryCodes)
+
+	// Sessions
+	userGroup.Get("/sessions", auth.GetSessions)
+	userGroup.Delete("/sessions/:id", auth.RevokeSession)
 
 	// Payments
 	userGroup.Post("/payment", paymentController.CreatePayment)
@@ -81,22 +135,78 @@ func Setup(
 	addressGroup.Delete("/:id", addressController.DeleteAddress)
 
 	// ================= ADMIN ROUTES (PROTECTED) =================
-	adminGroup := app.Group("/admin", middleware.AdminAuthMiddleware(jwtManager, pgRepo))
+	// Each route also needs its permission; see migration/rbac.go for the catalog.
+	// Changes made here are written to the audit log with the admin's details.
+	adminGroup := app.Group("/admin", middleware.AdminAuthMiddleware(jwtManager, userStatus), middleware.AuditContext())
+
+	catalogWrite := middleware.RequirePermission(constant.PERM_CATALOG_WRITE)
+	ordersRead := middleware.RequirePermission(constant.PERM_ORDERS_READ)
+	ordersUpdate := middleware.RequirePermission(constant.PERM_ORDERS_UPDATE)
+	paymentsRead := middleware.RequirePermission(constant.PERM_PAYMENTS_READ)
+	paymentsUpdate := middleware.RequirePermission(constant.PERM_PAYMENTS_UPDATE)
+	paymentsRefund := middleware.RequirePermission(constant.PERM_PAYMENTS_REFUND)
+	usersRead := middleware.RequirePermission(constant.PERM_USERS_READ)
+	usersUpdate := middleware.RequirePermission(constant.PERM_USERS_UPDATE)
+	usersBlock := middleware.RequirePermission(constant.PERM_USERS_BLOCK)
+	rolesManage := middleware.RequirePermission(constant.PERM_ROLES_MANAGE)
+	auditRead := middleware.RequirePermission(constant.PERM_AUDIT_READ)
+
+	// Audit log
+	adminGroup.Get("/audit", auditRead, auditController.ListAudit)
 
 	// Users
-	adminGroup.Put("/users/:id/block", auth.ToggleUserBlock)
+	adminGroup.Get("/users", usersRead, userAdminController.ListUsers)
+	adminGroup.Get("/users/:id", usersRead, userAdminController.GetCustomer)
+	adminGroup.Put("/users/:id/verify", usersUpdate, userAdminController.ForceVerify)
+	adminGroup.Post("/users/:id/logout", usersUpdate, userAdminController.ForceLogout)
+	adminGroup.Put("/users/:id/block", usersBlock, auth.ToggleUserBlock)
+	adminGroup.Get("/users/:id/roles", rolesManage, roleController.GetUserRoles)
+	adminGroup.Put("/users/:id/roles", rolesManage, roleController.SetUserRoles)
+
+	// Roles
+	adminGroup.Get("/permissions", rolesManage, roleController.GetPermissions)
+	adminGroup.Get("/roles", rolesManage, roleController.GetRoles)
+	adminGroup.Post("/roles", rolesManage, roleController.CreateRole)
+	adminGroup.Put("/roles/:id", rolesManage, roleController.UpdateRole)
+	adminGroup.Delete("/roles/:id", rolesManage, roleController.DeleteRole)
 
 	// Products
-	adminGroup.Post("/products", productController.CreateProduct)
-	adminGroup.Patch("/products/:id", productController.UpdateProduct)
-	adminGroup.Delete("/products/:id", productController.DeleteProduct)
+	adminGroup.Post("/products", catalogWrite, productController.CreateProduct)
+	adminGroup.Patch("/products/:id", catalogWrite, productController.UpdateProduct)
+	adminGroup.Delete("/products/:id", catalogWrite, productController.DeleteProduct)
+	adminGroup.Post("/products/:id/images", catalogWrite, middleware.BodyLimit(imageUploadLimit, nil), productImageController.UploadImage)
+	adminGroup.Put("/products/:id/images/order", catalogWrite, productImageController.ReorderImages)
+	adminGroup.Patch("/products/:id/images/:image_id", catalogWrite, productImageController.UpdateImage)
+	adminGroup.Delete("/products/:id/images/:image_id", catalogWrite, productImageController.DeleteImage)
+
+	// Categories & teams
+	adminGroup.Post("/categories", catalogWrite, taxonomyController.CreateCategory)
+	adminGroup.Put("/categories/:id", catalogWrite, taxonomyController.UpdateCategory)
+	adminGroup.Delete("/categories/:id", catalogWrite, taxonomyController.DeleteCategory)
+	adminGroup.Post("/teams", catalogWrite, taxonomyController.CreateTeam)
+	adminGroup.Put("/teams/:id", catalogWrite, taxonomyController.UpdateTeam)
+	adminGroup.Delete("/teams/:id", catalogWrite, taxonomyController.DeleteTeam)
 
 	// Orders
-	adminGroup.Get("/orders", orderController.GetAllOrders)
-	adminGroup.Put("/order/:id", orderController.UpdateOrderStatusAdmin)
+	adminGroup.Get("/orders", ordersRead, orderController.GetAllOrders)
+	adminGroup.Get("/orders/:id", ordersRead, orderController.GetOrderDetailsAdmin)
+	adminGroup.Put("/order/:id", ordersUpdate, orderController.UpdateOrderStatusAdmin)
+	adminGroup.Post("/orders/:id/refund", paymentsRefund, paymentController.RefundOrder)
 
 	// Payments
-	adminGroup.Get("/payments", paymentController.GetAllPayments)
-	adminGroup.Get("/payments/:id", paymentController.GetPaymentByIDAdmin)
-	adminGroup.Put("/payments/:id/status", paymentController.UpdatePaymentStatus) // ✅ update payment status
+	adminGroup.Get("/payments/reconciliation", paymentsRead, paymentController.GetReconciliationReport)
+	adminGroup.Get("/payments/webhooks", paymentsRead, paymentController.GetWebhookEvents)
+	adminGroup.Post("/payments/webhooks/:id/replay", paymentsUpdate, paymentController.ReplayWebhookEvent)
+	adminGroup.Get("/payments", paymentsRead, paymentController.GetAllPayments)
+	adminGroup.Get("/payments/:id", paymentsRead, paymentController.GetPaymentByIDAdmin)
+	adminGroup.Put("/payments/:id/status", paymentsUpdate, paymentController.UpdatePaymentStatus) // ✅ update payment status
+	adminGroup.Get("/payments/:id/refunds", paymentsRead, paymentController.GetPaymentRefunds)
+	adminGroup.Post("/payments/:id/refunds", paymentsRefund, paymentController.RefundPayment)
+}
+
+// isImageUpload matches POST /admin/products/:id/images
+func isImageUpload(c *fiber.Ctx) bool {
+	parts := strings.Split(strings.Trim(strings.ToLower(c.Path()), "/"), "/")
+	return c.Method() == fiber.MethodPost &&
+		len(parts) == 4 && parts[0] == "admin" && parts[1] == "products" && parts[3] == "images"
 }
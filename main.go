@@ -13,13 +13,18 @@ import (
 
 	"vestra-ecommerce/config"
 	"vestra-ecommerce/internal/router"
+	"vestra-ecommerce/middleware"
 	"vestra-ecommerce/migration"
 	"vestra-ecommerce/src/controller"
 	"vestra-ecommerce/src/repo"
 	"vestra-ecommerce/src/services"
 	database "vestra-ecommerce/utils/databases"
 	"vestra-ecommerce/utils/email"
+	"vestra-ecommerce/utils/gateway"
 	"vestra-ecommerce/utils/jwt"
+	"vestra-ecommerce/utils/money"
+	"vestra-ecommerce/utils/oidc"
+	"vestra-ecommerce/utils/storage"
 )
 
 func main() {
@@ -39,33 +44,95 @@ func main() {
 	// -------------------- 4️⃣ Email --------------------
 	email.Init(cfg.SMTP)
 
+	// Store currency: used for prices given without one and for the
+	// legacy price backfill in migrations
+	money.SetDefaultCurrency(cfg.Payment.Currency)
+
 	// -------------------- 5️⃣ Migrations --------------------
 	migration.Migrate()
 
+	// Largest product image accepted; upload bodies may be that big plus
+	// the multipart framing
+	maxImageBytes := int64(cfg.Storage.MaxUploadMB) << 20
+	if maxImageBytes <= 0 {
+		maxImageBytes = 10 << 20
+	}
+
 	// -------------------- 6️⃣ Fiber App --------------------
+	// Bodies are streamed so that each route can set its own limit; see
+	// middleware.BodyLimit
 	app := fiber.New(fiber.Config{
-		Prefork: cfg.Server.Prefork,
+		Prefork:                      cfg.Server.Prefork,
+		StreamRequestBody:            true,
+		DisablePreParseMultipartForm: true,
 	})
 
+	// Per-request deadline propagated to the repository layer
+	app.Use(middleware.RequestContext(time.Second * time.Duration(cfg.Server.RequestTimeoutSeconds)))
+
 	app.Get("/health", func(c *fiber.Ctx) error {
 		return c.SendString("OK 🚀")
 	})
 
 	// -------------------- 7️⃣ JWT Manager --------------------
-	jwtManager := jwt.NewJWTManager(
-		cfg.JWT.AccessSecret,
-		cfg.JWT.RefreshSecret,
-		time.Minute*time.Duration(cfg.JWT.AccessTTLMinutes),
-		time.Hour*time.Duration(cfg.JWT.RefreshTTLHours),
-	)
+	jwtKeys := make([]jwt.KeyConfig, 0, len(cfg.JWT.Keys))
+	for _, k := range cfg.JWT.Keys {
+		jwtKeys = append(jwtKeys, jwt.KeyConfig{
+			ID:             k.ID,
+			PrivateKeyFile: k.PrivateKeyFile,
+			PublicKeyFile:  k.PublicKeyFile,
+		})
+	}
+	jwtManager, err := jwt.NewJWTManager(jwt.Config{
+		AccessSecret:  cfg.JWT.AccessSecret,
+		RefreshSecret: cfg.JWT.RefreshSecret,
+		AccessTTL:     time.Minute * time.Duration(cfg.JWT.AccessTTLMinutes),
+		RefreshTTL:    time.Hour * time.Duration(cfg.JWT.RefreshTTLHours),
+		Issuer:        cfg.JWT.Issuer,
+		Audience:      cfg.JWT.Audience,
+		Keys:          jwtKeys,
+		SigningKeyID:  cfg.JWT.SigningKeyID,
+	})
+	if err != nil {
+		log.Fatal("❌ JWT setup failed:", err)
+	}
 
 	// -------------------- 8️⃣ Auth --------------------
-	authService := services.NewUserAuthService(pgRepo, 5)
-	authController := controller.NewUserAuthController(authService, jwtManager)
+	userStatusCache := services.NewUserStatusCache(pgRepo, 30*time.Second)
+	otpService := services.NewOTPService(pgRepo, services.OTPPolicy{
+		Expiry:          time.Minute * time.Duration(cfg.OTP.ExpiryMinutes),
+		MaxAttempts:     cfg.OTP.MaxAttempts,
+		Lockout:         time.Minute * time.Duration(cfg.OTP.LockoutMinutes),
+		ResendCooldown:  time.Second * time.Duration(cfg.OTP.ResendCooldownSeconds),
+		MaxSendsPerHour: cfg.OTP.MaxSendsPerHour,
+	})
+	authService := services.NewUserAuthService(pgRepo, otpService, userStatusCache)
+	sessionService := services.NewSessionService(pgRepo, jwtManager)
+	mfaService := services.NewMFAService(pgRepo, userStatusCache, cfg.MFA.Issuer)
+	oidcProviders, err := oidc.NewProviders(cfg.OIDC)
+	if err != nil {
+		log.Fatal("❌ OIDC setup failed:", err)
+	}
+	oidcService := services.NewOIDCService(pgRepo, oidcProviders, userStatusCache)
+	authController := controller.NewUserAuthController(authService, sessionService, mfaService, oidcService, jwtManager)
 
 	// -------------------- 9️⃣ Products --------------------
-	productService := services.NewProductService(pgRepo)
+	suggestIndex := services.NewSuggestIndex(pgRepo)
+	productService := services.NewProductService(pgRepo, suggestIndex)
 	productController := controller.NewProductController(productService)
+	taxonomyService := services.NewTaxonomyService(pgRepo)
+	taxonomyController := controller.NewTaxonomyController(taxonomyService)
+
+	// Product images live in the blob store; local files are served from here
+	blobStore, err := storage.New(cfg.Storage)
+	if err != nil {
+		log.Fatal("❌ Storage init failed:", err)
+	}
+	if local, ok := blobStore.(*storage.LocalStore); ok {
+		app.Static(storage.LocalMount, local.Root())
+	}
+	productImageService := services.NewProductImageService(pgRepo, blobStore, maxImageBytes)
+	productImageController := controller.NewProductImageController(productImageService)
 
 	// -------------------- 🔟 Cart --------------------
 	cartService := services.NewCartService(pgRepo)
@@ -75,18 +142,48 @@ func main() {
 	wishlistService := services.NewWishlistService(pgRepo)
 	wishlistController := controller.NewWishlistController(wishlistService)
 
+	// -------------------- Payments (orders refund through these) --------------------
+	paymentGateway, err := gateway.New(cfg.Payment)
+	if err != nil {
+		log.Fatal("❌ Payment gateway init failed:", err)
+	}
+	paymentService := services.NewPaymentService(pgRepo, paymentGateway)
+	paymentController := controller.NewPaymentController(paymentService)
+
 	// -------------------- 1️⃣0️⃣ Orders --------------------
-	orderService := services.NewOrderService(pgRepo)
+	orderService := services.NewOrderService(pgRepo, paymentService, time.Minute*time.Duration(cfg.Order.PaymentTimeoutMinutes))
 	orderController := controller.NewOrderController(orderService)
 
 	// -------------------- 1️⃣1️⃣ Address --------------------
 	addressService := services.NewAddressService(pgRepo)                // implement this service
 	addressController := controller.NewAddressController(addressService) // implement this controller
 
+	// Roles & permissions (admin access)
+	roleService := services.NewRoleService(pgRepo, userStatusCache)
+	roleController := controller.NewRoleController(roleService)
+
+	// Admin user management
+	userAdminService := services.NewUserAdminService(pgRepo, userStatusCache)
+	userAdminController := controller.NewUserAdminController(userAdminService)
+
+	// Audit log of admin changes (written by the services themselves)
+	auditService := services.NewAuditService(pgRepo)
+	auditController := controller.NewAuditController(auditService)
+
+	// Account export & deletion; due deletions are purged in the background
+	accountService := services.NewAccountService(pgRepo, userStatusCache, 24*time.Hour*time.Duration(cfg.Account.DeletionGraceDays))
+	accountController := controller.NewAccountController(accountService)
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	go accountService.RunPurger(workerCtx, time.Hour)
+
+	// Orders left unpaid give their stock back
+	go orderService.RunExpirer(workerCtx, 5*time.Minute)
+
+	// Search autocomplete index, rebuilt on catalog changes and every 10 minutes
+	go suggestIndex.Run(workerCtx, 10*time.Minute)
+
     
     
-    paymentService := services.NewPaymentService(pgRepo)
-    paymentController := controller.NewPaymentController(paymentService)
 	// -------------------- 1️⃣2️⃣ Routes --------------------
 	router.Setup(
 		app,
@@ -95,10 +192,17 @@ func main() {
         paymentController,
 		addressController, // <-- Add AddressController here
 		jwtManager,
-		pgRepo,
+		userStatusCache,
 		cartController,
 		wishlistController,
 		orderController,
+		roleController,
+		accountController,
+		userAdminController,
+		auditController,
+		taxonomyController,
+		productImageController,
+		int(maxImageBytes)+1<<20,
 	)
 
 	// -------------------- 1️⃣3️⃣ Graceful Shutdown --------------------
@@ -115,6 +219,7 @@ func main() {
 
 	<-quit
 	log.Println("🛑 Shutting down server...")
+	stopWorkers()
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
@@ -4,15 +4,15 @@ import (
 	"strings"
 
 	"github.com/gofiber/fiber/v2"
-	"vestra-ecommerce/src/model"
-	"vestra-ecommerce/src/repo"
+	"vestra-ecommerce/src/services"
 	constant "vestra-ecommerce/utils/constants"
 	"vestra-ecommerce/utils/jwt"
 	"vestra-ecommerce/utils/response"
 )
 
-// AdminAuthMiddleware protects admin routes
-func AdminAuthMiddleware(jwtManager *jwt.JWTManager, repo repo.IPgSQLRepository) fiber.Handler {
+// AdminAuthMiddleware protects admin routes: it admits users holding any
+// permission, RequirePermission then checks the specific one per route
+func AdminAuthMiddleware(jwtManager *jwt.JWTManager, statuses *services.UserStatusCache) fiber.Handler {
 	return func(ctx *fiber.Ctx) error {
 
 		// 1️⃣ Get Authorization header
@@ -51,44 +51,45 @@ func AdminAuthMiddleware(jwtManager *jwt.JWTManager, repo repo.IPgSQLRepository)
 			)
 		}
 
-		// 4️⃣ Extract user_id from claims
-		userID, ok := claims["user_id"].(string)
-		if !ok || userID == "" {
-			return response.Error(
-				ctx,
-				constant.UNAUTHORIZED,
-				"Invalid token claims",
-				"TOKEN_INVALID",
-				nil,
-			)
+		// 4️⃣ The subject is the user
+		userID := claims.Subject
+
+		// 5️⃣ Blocked admins and revoked tokens are out too
+		status, ok, err := checkUserStatus(ctx, statuses, userID, claims)
+		if !ok {
+			return err
 		}
 
-		// 5️⃣ Fetch user from DB
-		var user model.User
-		if err := repo.FindById(&user, userID); err != nil {
+		// 6️⃣ Check the user holds an admin role
+		if len(status.Permissions) == 0 {
 			return response.Error(
 				ctx,
-				constant.UNAUTHORIZED,
-				"User not found",
-				"USER_NOT_FOUND",
+				constant.FORBIDDEN,
+				"Admin access required",
+				"FORBIDDEN",
 				nil,
 			)
 		}
 
-		// 6️⃣ Check if role is admin
-		if user.Role != "admin" {
+		// 7️⃣ Admin access needs a session started with a second factor; users
+		// without two-factor enroll through /user/2fa and log in again
+		if !claims.MFA {
 			return response.Error(
 				ctx,
 				constant.FORBIDDEN,
-				"Admin access required",
-				"FORBIDDEN",
+				"Two-factor authentication is required for admin access",
+				constant.MFA_REQUIRED,
 				nil,
 			)
 		}
 
-		// 7️⃣ Store user info in context for later use
+		// 8️⃣ Store user info and login session in context for later use
 		ctx.Locals("user_id", userID)
-		ctx.Locals("role", user.Role)
+		if claims.SessionID != "" {
+			ctx.Locals("session_id", claims.SessionID)
+		}
+		ctx.Locals("role", status.Role)
+		ctx.Locals("permissions", status.Permissions)
 
 		return ctx.Next()
 	}
@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"vestra-ecommerce/utils/audit"
+	constant "vestra-ecommerce/utils/constants"
+)
+
+// AuditContext puts who is making the request, and from where, into the
+// request context so services can write it to the audit log. It runs after
+// AdminAuthMiddleware, which sets user_id and session_id.
+func AuditContext() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		userID, _ := ctx.Locals("user_id").(string)
+		sessionID, _ := ctx.Locals("session_id").(string)
+
+		ctx.SetUserContext(audit.WithMetadata(ctx.UserContext(), audit.Metadata{
+			ActorID:   userID,
+			ActorRole: constant.ACTOR_ADMIN,
+			SessionID: sessionID,
+			IPAddress: ctx.IP(),
+			UserAgent: ctx.Get(fiber.HeaderUserAgent),
+			Method:    ctx.Method(),
+			Path:      ctx.Path(),
+		}))
+
+		return ctx.Next()
+	}
+}
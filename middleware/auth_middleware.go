@@ -5,13 +5,15 @@ import (
 
 	"github.com/gofiber/fiber/v2"
 
+	"vestra-ecommerce/src/services"
 	constant "vestra-ecommerce/utils/constants"
 	"vestra-ecommerce/utils/jwt"
 	"vestra-ecommerce/utils/response"
 )
 
-// AuthMiddleware protects routes using JWT access token
-func AuthMiddleware(jwtManager *jwt.JWTManager) fiber.Handler {
+// AuthMiddleware protects routes using JWT access token and rejects users
+// that were blocked or whose tokens were invalidated since it was issued
+func AuthMiddleware(jwtManager *jwt.JWTManager, statuses *services.UserStatusCache) fiber.Handler {
 	return func(ctx *fiber.Ctx) error {
 
 		// 1️⃣ Get Authorization header
@@ -50,21 +52,69 @@ func AuthMiddleware(jwtManager *jwt.JWTManager) fiber.Handler {
 			)
 		}
 
-		// 4️⃣ Extract user_id from claims
-		userID, ok := claims["user_id"].(string)
-		if !ok || userID == "" {
-			return response.Error(
-				ctx,
-				constant.UNAUTHORIZED,
-				"Invalid token claims",
-				"TOKEN_INVALID",
-				nil,
-			)
+		// 4️⃣ The subject is the user
+		userID := claims.Subject
+
+		// 5️⃣ Check the account is still allowed in
+		if _, ok, err := checkUserStatus(ctx, statuses, userID, claims); !ok {
+			return err
 		}
 
-		// 5️⃣ Store user_id in context
+		// 6️⃣ Store user_id and login session in context
 		ctx.Locals("user_id", userID)
+		if claims.SessionID != "" {
+			ctx.Locals("session_id", claims.SessionID)
+		}
 
 		return ctx.Next()
 	}
 }
+
+// checkUserStatus rejects blocked or unverified users and tokens issued
+// before the user's token version was bumped. When ok is false the error
+// response has already been written and err is what the handler returns.
+func checkUserStatus(ctx *fiber.Ctx, statuses *services.UserStatusCache, userID string, claims *jwt.Claims) (status *services.UserStatus, ok bool, err error) {
+	status, err = statuses.Get(ctx.UserContext(), userID)
+	if err != nil {
+		return nil, false, response.Error(
+			ctx,
+			constant.UNAUTHORIZED,
+			"User not found",
+			"USER_NOT_FOUND",
+			nil,
+		)
+	}
+
+	if status.IsBlocked {
+		return nil, false, response.Error(
+			ctx,
+			constant.FORBIDDEN,
+			"Account is blocked",
+			constant.USER_BLOCKED,
+			nil,
+		)
+	}
+
+	if !status.IsVerified {
+		return nil, false, response.Error(
+			ctx,
+			constant.FORBIDDEN,
+			"Account is not verified",
+			constant.USER_NOT_VERIFIED,
+			nil,
+		)
+	}
+
+	// Tokens from before versioning carry none, i.e. version 0
+	if claims.TokenVersion != status.TokenVersion {
+		return nil, false, response.Error(
+			ctx,
+			constant.UNAUTHORIZED,
+			"Token has been revoked, please log in again",
+			constant.TOKEN_REVOKED,
+			nil,
+		)
+	}
+
+	return status, true, nil
+}
@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"io"
+
+	"github.com/gofiber/fiber/v2"
+
+	constant "vestra-ecommerce/utils/constants"
+	"vestra-ecommerce/utils/response"
+)
+
+// BodyLimit reads the request body, refusing it with 413 once it is longer
+// than limit bytes. The server streams request bodies (StreamRequestBody),
+// so this is what bounds how much of one is held in memory. skip, if set,
+// passes requests on unread to a later BodyLimit with a limit of its own.
+func BodyLimit(limit int, skip func(*fiber.Ctx) bool) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		if skip != nil && skip(ctx) {
+			return ctx.Next()
+		}
+
+		req := ctx.Request()
+		if req.Header.ContentLength() > limit {
+			return bodyTooLarge(ctx)
+		}
+
+		if req.IsBodyStream() {
+			body, err := io.ReadAll(io.LimitReader(ctx.Context().RequestBodyStream(), int64(limit)+1))
+			if err != nil {
+				return response.Error(
+					ctx,
+					constant.BADREQUEST,
+					"Failed to read request body",
+					constant.INVALID_REQUEST,
+					nil,
+				)
+			}
+			if len(body) > limit {
+				return bodyTooLarge(ctx)
+			}
+			req.SetBody(body)
+		}
+
+		return ctx.Next()
+	}
+}
+
+func bodyTooLarge(ctx *fiber.Ctx) error {
+	// The rest of the body is never read, so the connection can't be reused
+	ctx.Set(fiber.HeaderConnection, "close")
+	return response.Error(
+		ctx,
+		constant.PAYLOADTOOLARGE,
+		"Request body is too large",
+		constant.INVALID_REQUEST,
+		nil,
+	)
+}
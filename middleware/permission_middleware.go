@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	constant "vestra-ecommerce/utils/constants"
+	"vestra-ecommerce/utils/response"
+)
+
+// RequirePermission lets the request through only if the caller holds the
+// permission. It reads what AdminAuthMiddleware stored, so it must run after it.
+func RequirePermission(permission string) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		permissions, _ := ctx.Locals("permissions").([]string)
+
+		for _, p := range permissions {
+			if p == permission {
+				return ctx.Next()
+			}
+		}
+
+		return response.Error(
+			ctx,
+			constant.FORBIDDEN,
+			"You don't have permission to do this",
+			constant.PERMISSION_DENIED,
+			fiber.Map{"required": permission},
+		)
+	}
+}
@@ -0,0 +1,29 @@
+package middleware
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/limiter"
+
+	constant "vestra-ecommerce/utils/constants"
+	"vestra-ecommerce/utils/response"
+)
+
+// RateLimit allows max requests per client IP within window. Counters live
+// in memory, so each instance limits on its own.
+func RateLimit(max int, window time.Duration) fiber.Handler {
+	return limiter.New(limiter.Config{
+		Max:        max,
+		Expiration: window,
+		LimitReached: func(ctx *fiber.Ctx) error {
+			return response.Error(
+				ctx,
+				constant.TOOMANYREQUESTS,
+				"Too many requests, try again later",
+				constant.RATE_LIMITED,
+				nil,
+			)
+		},
+	})
+}
@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// defaultRequestTimeout applies when no timeout is configured
+const defaultRequestTimeout = 30 * time.Second
+
+// RequestContext gives every request a context with a deadline. Services
+// receive it via ctx.UserContext() and hand it to the repository, so slow
+// queries are abandoned once the request budget is spent.
+func RequestContext(timeout time.Duration) fiber.Handler {
+	if timeout <= 0 {
+		timeout = defaultRequestTimeout
+	}
+
+	return func(ctx *fiber.Ctx) error {
+		reqCtx, cancel := context.WithTimeout(ctx.UserContext(), timeout)
+		defer cancel()
+
+		ctx.SetUserContext(reqCtx)
+		return ctx.Next()
+	}
+}
@@ -0,0 +1,25 @@
+package migration
+
+import "gorm.io/gorm"
+
+// protectAuditLog makes audit_log append-only: any UPDATE, DELETE or
+// TRUNCATE fails, whoever issues it
+func protectAuditLog(db *gorm.DB) error {
+	return db.Exec(`
+		CREATE OR REPLACE FUNCTION audit_log_append_only() RETURNS trigger AS $$
+		BEGIN
+			RAISE EXCEPTION 'audit_log is append-only';
+		END;
+		$$ LANGUAGE plpgsql;
+
+		DROP TRIGGER IF EXISTS audit_log_no_change ON audit_log;
+		CREATE TRIGGER audit_log_no_change
+			BEFORE UPDATE OR DELETE ON audit_log
+			FOR EACH ROW EXECUTE FUNCTION audit_log_append_only();
+
+		DROP TRIGGER IF EXISTS audit_log_no_truncate ON audit_log;
+		CREATE TRIGGER audit_log_no_truncate
+			BEFORE TRUNCATE ON audit_log
+			FOR EACH STATEMENT EXECUTE FUNCTION audit_log_append_only();
+	`).Error
+}
@@ -1,27 +1,248 @@
 package migration
 
 import (
+	"errors"
+	"fmt"
 	"log"
+	"math"
+	"regexp"
+	"strings"
+
+	"gorm.io/gorm"
 
 	"vestra-ecommerce/src/model"
+	constant "vestra-ecommerce/utils/constants"
 	database "vestra-ecommerce/utils/databases"
+	"vestra-ecommerce/utils/money"
 )
 
+var legacySlugSeparator = regexp.MustCompile(`[^a-z0-9]+`)
+
 func Migrate() {
+	if err := prepareLegacyPayments(database.PgSQLDB); err != nil {
+		log.Fatal("❌ Migration failed:", err)
+	}
+
 	if err := database.PgSQLDB.AutoMigrate(
+		&model.Permission{},
+		&model.Role{},
 		&model.User{},
+		&model.OTPCode{},
+		&model.UserTOTP{},
+		&model.RecoveryCode{},
+		&model.UserIdentity{},
+		&model.OIDCLoginState{},
+		&model.RefreshToken{},
+		&model.Category{},
+		&model.Team{},
 		&model.Product{},
 		&model.ProductSize{},
+		&model.ProductImage{},
 		&model.Cart{},
 		&model.CartItem{},
         &model.Wishlist{},
         &model.Order{},
         &model.OrderItem{},
+        &model.OrderStatusHistory{},
         &model.UserAddress{},
         &model.Payment{},
+        &model.PaymentWebhookEvent{},
+        &model.Refund{},
+        &model.AuditLog{},
 	); err != nil {
 		log.Fatal("❌ Migration failed:", err)
 	}
 
+	if err := migrateLegacyAmounts(database.PgSQLDB); err != nil {
+		log.Fatal("❌ Migration failed:", err)
+	}
+
+	if err := dropLegacyUserOTP(database.PgSQLDB); err != nil {
+		log.Fatal("❌ Migration failed:", err)
+	}
+
+	if err := backfillLeagues(database.PgSQLDB); err != nil {
+		log.Fatal("❌ Migration failed:", err)
+	}
+
+	if err := prepareProductSearch(database.PgSQLDB); err != nil {
+		log.Fatal("❌ Migration failed:", err)
+	}
+
+	if err := seedRBAC(database.PgSQLDB); err != nil {
+		log.Fatal("❌ Migration failed:", err)
+	}
+
+	if err := protectAuditLog(database.PgSQLDB); err != nil {
+		log.Fatal("❌ Migration failed:", err)
+	}
+
 	log.Println("✅ Database migrated successfully")
 }
+
+// prepareLegacyPayments clears payment references that can't become uuid
+// foreign keys. payments.order_id / user_id used to be free text, so rows
+// pointing at malformed or missing orders are detached (set NULL) before
+// AutoMigrate converts the columns and adds the constraint.
+func prepareLegacyPayments(db *gorm.DB) error {
+	if !db.Migrator().HasTable(&model.Payment{}) {
+		return nil
+	}
+
+	columns, err := db.Migrator().ColumnTypes(&model.Payment{})
+	if err != nil {
+		return err
+	}
+
+	const uuidPattern = `^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`
+
+	for _, col := range columns {
+		if strings.EqualFold(col.DatabaseTypeName(), "uuid") {
+			continue
+		}
+
+		switch col.Name() {
+		case "order_id":
+			if err := db.Exec(`
+				UPDATE payments SET order_id = NULL
+				WHERE order_id IS NOT NULL
+				  AND (order_id !~ ? OR NOT EXISTS (SELECT 1 FROM orders o WHERE o.id::text = payments.order_id))
+			`, uuidPattern).Error; err != nil {
+				return err
+			}
+		case "user_id":
+			if err := db.Exec(
+				"UPDATE payments SET user_id = NULL WHERE user_id IS NOT NULL AND user_id !~ ?",
+				uuidPattern,
+			).Error; err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// legacyAmounts maps old whole-rupee columns to their Money column prefix
+var legacyAmounts = []struct {
+	table, column, prefix string
+}{
+	{"products", "price", "price_"},
+	{"order_items", "price", "price_"},
+	{"orders", "total", "total_"},
+	{"payments", "amount", "amount_"},
+}
+
+// migrateLegacyAmounts moves amounts stored in major units (int rupees,
+// float64 for payments) into the minor-unit Money columns in the store
+// currency, then drops the old column. Runs once per column.
+func migrateLegacyAmounts(db *gorm.DB) error {
+	currency := money.DefaultCurrency()
+	factor := math.Pow10(money.Digits(currency))
+
+	for _, legacy := range legacyAmounts {
+		if !db.Migrator().HasColumn(legacy.table, legacy.column) {
+			continue
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Exec(
+				fmt.Sprintf(
+					"UPDATE %s SET %sminor = ROUND(%s * ?)::bigint, %scurrency = ? WHERE %s IS NOT NULL",
+					legacy.table, legacy.prefix, legacy.column, legacy.prefix, legacy.column,
+				),
+				factor,
+				currency,
+			).Error; err != nil {
+				return err
+			}
+			return tx.Migrator().DropColumn(legacy.table, legacy.column)
+		})
+		if err != nil {
+			return fmt.Errorf("%s.%s: %w", legacy.table, legacy.column, err)
+		}
+
+		log.Printf("✅ Moved %s.%s to minor units (%s)", legacy.table, legacy.column, currency)
+	}
+
+	return nil
+}
+
+// dropLegacyUserOTP removes the OTP columns users had before codes moved to
+// otp_codes. Codes still pending there are lost; users request a new one.
+func dropLegacyUserOTP(db *gorm.DB) error {
+	for _, column := range []string{"otp", "otp_expiry"} {
+		if !db.Migrator().HasColumn("users", column) {
+			continue
+		}
+		if err := db.Migrator().DropColumn("users", column); err != nil {
+			return fmt.Errorf("users.%s: %w", column, err)
+		}
+	}
+	return nil
+}
+
+// backfillLeagues files products that only have a free-text league under a
+// league team of that name, creating the team when needed. Products that
+// already have a team are left alone, so this is a no-op once done.
+func backfillLeagues(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var leagues []string
+		if err := tx.Raw(`
+			SELECT DISTINCT TRIM(league) FROM products
+			WHERE team_id IS NULL AND TRIM(COALESCE(league, '')) <> ''
+		`).Scan(&leagues).Error; err != nil {
+			return err
+		}
+
+		for _, name := range leagues {
+			var team model.Team
+			if err := tx.Where("kind = ? AND LOWER(name) = LOWER(?)", constant.TEAM_LEAGUE, name).
+				First(&team).Error; err != nil {
+				if !errors.Is(err, gorm.ErrRecordNotFound) {
+					return err
+				}
+				slug, err := legacySlug(tx, name)
+				if err != nil {
+					return err
+				}
+				team = model.Team{Name: name, Slug: slug, Kind: constant.TEAM_LEAGUE}
+				if err := tx.Create(&team).Error; err != nil {
+					return err
+				}
+			}
+
+			if err := tx.Exec(
+				"UPDATE products SET team_id = ?, league = ? WHERE team_id IS NULL AND TRIM(league) = ?",
+				team.ID, team.Name, name,
+			).Error; err != nil {
+				return fmt.Errorf("league %q: %w", name, err)
+			}
+		}
+
+		if len(leagues) > 0 {
+			log.Printf("✅ Filed products under %d league(s)", len(leagues))
+		}
+		return nil
+	})
+}
+
+// legacySlug turns a league name into a slug no team is using yet
+func legacySlug(tx *gorm.DB, name string) (string, error) {
+	base := strings.Trim(legacySlugSeparator.ReplaceAllString(strings.ToLower(name), "-"), "-")
+	if base == "" {
+		base = "league"
+	}
+
+	slug := base
+	for i := 2; ; i++ {
+		var taken int64
+		if err := tx.Model(&model.Team{}).Where("slug = ?", slug).Count(&taken).Error; err != nil {
+			return "", err
+		}
+		if taken == 0 {
+			return slug, nil
+		}
+		slug = fmt.Sprintf("%s-%d", base, i)
+	}
+}
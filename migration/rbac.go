@@ -0,0 +1,65 @@
+package migration
+
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"vestra-ecommerce/src/model"
+	constant "vestra-ecommerce/utils/constants"
+)
+
+// permissionCatalog is every permission the routes check. New permissions
+// are added here; seedRBAC grants them to the admin role on the next boot.
+var permissionCatalog = []model.Permission{
+	{Name: constant.PERM_CATALOG_WRITE, Description: "Create, update and delete products"},
+	{Name: constant.PERM_ORDERS_READ, Description: "View all orders"},
+	{Name: constant.PERM_ORDERS_UPDATE, Description: "Change order status"},
+	{Name: constant.PERM_PAYMENTS_READ, Description: "View payments, refunds, webhooks and reconciliation"},
+	{Name: constant.PERM_PAYMENTS_UPDATE, Description: "Change payment status and replay webhooks"},
+	{Name: constant.PERM_PAYMENTS_REFUND, Description: "Refund payments and orders"},
+	{Name: constant.PERM_USERS_READ, Description: "List and search users and view customer details"},
+	{Name: constant.PERM_USERS_UPDATE, Description: "Verify users and log them out everywhere"},
+	{Name: constant.PERM_USERS_BLOCK, Description: "Block and unblock users"},
+	{Name: constant.PERM_AUDIT_READ, Description: "View the audit log"},
+	{Name: constant.PERM_ROLES_MANAGE, Description: "Create roles and assign them to users"},
+}
+
+// seedRBAC upserts the permission catalog, makes sure the system admin role
+// holds all of it and gives that role to users still marked role = 'admin'
+// from before roles existed.
+func seedRBAC(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, p := range permissionCatalog {
+			perm := p
+			if err := tx.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "name"}},
+				DoUpdates: clause.AssignmentColumns([]string{"description"}),
+			}).Create(&perm).Error; err != nil {
+				return err
+			}
+		}
+
+		admin := model.Role{
+			Name:        constant.ROLE_ADMIN,
+			Description: "Full access",
+			IsSystem:    true,
+		}
+		if err := tx.Where("name = ?", admin.Name).FirstOrCreate(&admin).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Exec(`
+			INSERT INTO role_permissions (role_id, permission_id)
+			SELECT ?, id FROM permissions
+			ON CONFLICT DO NOTHING
+		`, admin.ID).Error; err != nil {
+			return err
+		}
+
+		return tx.Exec(`
+			INSERT INTO user_roles (user_id, role_id)
+			SELECT id, ? FROM users WHERE role = ?
+			ON CONFLICT DO NOTHING
+		`, admin.ID, constant.ROLE_ADMIN).Error
+	})
+}
@@ -0,0 +1,44 @@
+package migration
+
+import "gorm.io/gorm"
+
+// prepareProductSearch sets up full-text and fuzzy product search:
+// products.search_vector is kept up to date by a trigger (it needs the
+// club name from teams, so it can't be a generated column), GIN indexes
+// serve @@ matches and pg_trgm similarity on names.
+//
+// Weights: A name and club, B league, C kit type, D description.
+func prepareProductSearch(db *gorm.DB) error {
+	return db.Exec(`
+		CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+		ALTER TABLE products ADD COLUMN IF NOT EXISTS search_vector tsvector;
+
+		CREATE OR REPLACE FUNCTION products_search_vector() RETURNS trigger AS $$
+		DECLARE
+			club text;
+		BEGIN
+			SELECT t.name INTO club FROM teams t WHERE t.id = NEW.team_id AND t.kind = 'club';
+			NEW.search_vector :=
+				setweight(to_tsvector('simple', coalesce(NEW.name, '')), 'A') ||
+				setweight(to_tsvector('simple', coalesce(club, '')), 'A') ||
+				setweight(to_tsvector('simple', coalesce(NEW.league, '')), 'B') ||
+				setweight(to_tsvector('simple', coalesce(NEW.kit_type, '')), 'C') ||
+				setweight(to_tsvector('simple', coalesce(NEW.description, '')), 'D');
+			RETURN NEW;
+		END;
+		$$ LANGUAGE plpgsql;
+
+		DROP TRIGGER IF EXISTS products_search_vector_update ON products;
+		CREATE TRIGGER products_search_vector_update
+			BEFORE INSERT OR UPDATE OF name, description, league, kit_type, team_id ON products
+			FOR EACH ROW EXECUTE FUNCTION products_search_vector();
+
+		UPDATE products SET name = name WHERE search_vector IS NULL;
+
+		CREATE INDEX IF NOT EXISTS idx_products_search ON products USING GIN (search_vector);
+		CREATE INDEX IF NOT EXISTS idx_products_name_trgm ON products USING GIN (name gin_trgm_ops);
+		CREATE INDEX IF NOT EXISTS idx_products_league_trgm ON products USING GIN (league gin_trgm_ops);
+		CREATE INDEX IF NOT EXISTS idx_teams_name_trgm ON teams USING GIN (name gin_trgm_ops);
+	`).Error
+}
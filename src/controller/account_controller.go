@@ -0,0 +1,156 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+
+	"vestra-ecommerce/src/services"
+	constant "vestra-ecommerce/utils/constants"
+	"vestra-ecommerce/utils/response"
+	"vestra-ecommerce/utils/utils/apperror"
+)
+
+type AccountController struct {
+	service *services.AccountService
+}
+
+func NewAccountController(service *services.AccountService) *AccountController {
+	return &AccountController{service: service}
+}
+
+/* =======================
+   EXPORT
+   ======================= */
+
+// Export downloads the user's data as a JSON document, or as a ZIP of one
+// JSON file per section with ?format=zip
+func (ac *AccountController) Export(c *fiber.Ctx) error {
+	userID, _ := c.Locals("user_id").(string)
+
+	format := c.Query("format", "json")
+	if format != "json" && format != "zip" {
+		return response.Error(
+			c,
+			constant.BADREQUEST,
+			"format must be json or zip",
+			constant.INVALID_REQUEST,
+			nil,
+		)
+	}
+
+	export, err := ac.service.Export(c.UserContext(), userID)
+	if err != nil {
+		if appErr, ok := err.(*apperror.AppError); ok {
+			return response.Error(c, appErr.Status, appErr.Message, appErr.Code, nil)
+		}
+		return response.Error(
+			c,
+			constant.INTERNALSERVERERROR,
+			"Something went wrong",
+			"",
+			err.Error(),
+		)
+	}
+
+	filename := fmt.Sprintf("vestra-export-%s", export.ExportedAt.Format("20060102-150405"))
+
+	var buf bytes.Buffer
+	if format == "zip" {
+		err = export.WriteZip(&buf)
+		c.Set(fiber.HeaderContentType, "application/zip")
+		filename += ".zip"
+	} else {
+		enc := json.NewEncoder(&buf)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(export)
+		c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSONCharsetUTF8)
+		filename += ".json"
+	}
+	if err != nil {
+		return response.Error(
+			c,
+			constant.INTERNALSERVERERROR,
+			"Failed to build export",
+			"",
+			err.Error(),
+		)
+	}
+
+	// A download, not an API response: no envelope
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="%s"`, filename))
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.Send(buf.Bytes())
+}
+
+/* =======================
+   DELETION
+   ======================= */
+
+type deleteAccountRequest struct {
+	Password string `json:"password"`
+}
+
+func (ac *AccountController) ScheduleDeletion(c *fiber.Ctx) error {
+	userID, _ := c.Locals("user_id").(string)
+
+	var req deleteAccountRequest
+	if err := c.BodyParser(&req); err != nil || req.Password == "" {
+		return response.Error(
+			c,
+			constant.BADREQUEST,
+			"password is required",
+			"",
+			nil,
+		)
+	}
+
+	scheduledAt, err := ac.service.ScheduleDeletion(c.UserContext(), userID, req.Password)
+	if err != nil {
+		if appErr, ok := err.(*apperror.AppError); ok {
+			return response.Error(c, appErr.Status, appErr.Message, appErr.Code, appErr.Details)
+		}
+		return response.Error(
+			c,
+			constant.INTERNALSERVERERROR,
+			"Something went wrong",
+			"",
+			err.Error(),
+		)
+	}
+
+	return response.Success(
+		c,
+		constant.SUCCESS,
+		"Account scheduled for deletion",
+		constant.DELETION_PENDING,
+		fiber.Map{"deletion_scheduled_at": scheduledAt},
+	)
+}
+
+func (ac *AccountController) CancelDeletion(c *fiber.Ctx) error {
+	userID, _ := c.Locals("user_id").(string)
+
+	if err := ac.service.CancelDeletion(c.UserContext(), userID); err != nil {
+		if appErr, ok := err.(*apperror.AppError); ok {
+			return response.Error(c, appErr.Status, appErr.Message, appErr.Code, nil)
+		}
+		return response.Error(
+			c,
+			constant.INTERNALSERVERERROR,
+			"Something went wrong",
+			"",
+			err.Error(),
+		)
+	}
+
+	return response.Success(
+		c,
+		constant.SUCCESS,
+		"Account deletion cancelled",
+		"",
+		nil,
+	)
+}
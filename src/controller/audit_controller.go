@@ -0,0 +1,66 @@
+package controller
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"vestra-ecommerce/src/services"
+	constant "vestra-ecommerce/utils/constants"
+	"vestra-ecommerce/utils/pagination"
+	"vestra-ecommerce/utils/response"
+	"vestra-ecommerce/utils/utils/apperror"
+)
+
+type AuditController struct {
+	service *services.AuditService
+}
+
+func NewAuditController(service *services.AuditService) *AuditController {
+	return &AuditController{service: service}
+}
+
+// ListAudit supports ?actor_id, action (exact, or a prefix such as
+// "product."), entity_type, entity_id, from, to (YYYY-MM-DD, the "to" day
+// included), sort, page and limit (50 by default)
+func (ac *AuditController) ListAudit(c *fiber.Ctx) error {
+	filter := services.AuditFilter{
+		ActorID:    c.Query("actor_id"),
+		Action:     c.Query("action"),
+		EntityType: c.Query("entity_type"),
+		EntityID:   c.Query("entity_id"),
+	}
+
+	var err error
+	if filter.From, err = queryDate(c, "from"); err != nil {
+		return badFilter(c, "from must be a YYYY-MM-DD date")
+	}
+	if filter.To, err = queryDate(c, "to"); err != nil {
+		return badFilter(c, "to must be a YYYY-MM-DD date")
+	}
+	if filter.To != nil {
+		end := filter.To.AddDate(0, 0, 1)
+		filter.To = &end
+	}
+
+	entries, meta, err := ac.service.List(c.UserContext(), filter, pagination.FromQuery(c, 50))
+	if err != nil {
+		if appErr, ok := err.(*apperror.AppError); ok {
+			return response.Error(c, appErr.Status, appErr.Message, appErr.Code, nil)
+		}
+		return response.Error(
+			c,
+			constant.INTERNALSERVERERROR,
+			"Something went wrong",
+			"",
+			err.Error(),
+		)
+	}
+
+	return response.SuccessWithMeta(
+		c,
+		constant.SUCCESS,
+		"Audit log fetched successfully",
+		"",
+		entries,
+		meta,
+	)
+}
@@ -51,7 +51,7 @@ func (cc *CartController) AddToCart(c *fiber.Ctx) error {
 		)
 	}
 
-	if err := cc.service.AddToCart(userID, req.ProductID, req.Size, req.Quantity); err != nil {
+	if err := cc.service.AddToCart(c.UserContext(), userID, req.ProductID, req.Size, req.Quantity); err != nil {
 		if appErr, ok := err.(*apperror.AppError); ok {
 			return response.Error(c, appErr.Status, appErr.Message, appErr.Code, nil)
 		}
@@ -81,7 +81,7 @@ func (cc *CartController) AddToCart(c *fiber.Ctx) error {
 func (cc *CartController) GetCart(c *fiber.Ctx) error {
 	userID := c.Locals("user_id").(string)
 
-	cart, err := cc.service.GetUserCart(userID)
+	cart, err := cc.service.GetUserCart(c.UserContext(), userID)
 	if err != nil {
 		if appErr, ok := err.(*apperror.AppError); ok {
 			return response.Error(c, appErr.Status, appErr.Message, appErr.Code, nil)
@@ -149,7 +149,7 @@ func (cc *CartController) UpdateCartItem(c *fiber.Ctx) error {
 		)
 	}
 
-	if err := cc.service.UpdateCartItem(userID, itemID, req.Size, req.Quantity); err != nil {
+	if err := cc.service.UpdateCartItem(c.UserContext(), userID, itemID, req.Size, req.Quantity); err != nil {
 		if appErr, ok := err.(*apperror.AppError); ok {
 			return response.Error(c, appErr.Status, appErr.Message, appErr.Code, nil)
 		}
@@ -188,7 +188,7 @@ func (cc *CartController) RemoveCartItem(c *fiber.Ctx) error {
 		)
 	}
 
-	if err := cc.service.RemoveCartItem(itemID); err != nil {
+	if err := cc.service.RemoveCartItem(c.UserContext(), itemID); err != nil {
 		if appErr, ok := err.(*apperror.AppError); ok {
 			return response.Error(c, appErr.Status, appErr.Message, appErr.Code, nil)
 		}
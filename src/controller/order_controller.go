@@ -3,6 +3,7 @@ package controller
 import (
 	"vestra-ecommerce/src/services"
 	constant "vestra-ecommerce/utils/constants"
+	"vestra-ecommerce/utils/pagination"
 	"vestra-ecommerce/utils/response"
 	"vestra-ecommerce/utils/utils/apperror"
 
@@ -24,10 +25,10 @@ func NewOrderController(service *services.OrderService) *OrderController {
 func (oc *OrderController) PlaceOrder(c *fiber.Ctx) error {
 	userID := c.Locals("user_id").(string)
 
-	order, err := oc.service.PlaceOrder(userID)
+	order, err := oc.service.PlaceOrder(c.UserContext(), userID)
 	if err != nil {
 		if appErr, ok := err.(*apperror.AppError); ok {
-			return response.Error(c, appErr.Status, appErr.Message, appErr.Code, nil)
+			return response.Error(c, appErr.Status, appErr.Message, appErr.Code, appErr.Details)
 		}
 
 		return response.Error(
@@ -52,11 +53,16 @@ func (oc *OrderController) PlaceOrder(c *fiber.Ctx) error {
    GET USER ORDERS
    ======================= */
 
+// Pages take ?limit, cursor and sort (created_at, total; "-" prefix for
+// descending)
 func (oc *OrderController) GetUserOrders(c *fiber.Ctx) error {
 	userID := c.Locals("user_id").(string)
 
-	orders, err := oc.service.GetOrdersByUser(userID)
+	orders, meta, err := oc.service.GetOrdersByUser(c.UserContext(), userID, pagination.FromQuery(c, pagination.DefaultLimit))
 	if err != nil {
+		if appErr, ok := err.(*apperror.AppError); ok {
+			return response.Error(c, appErr.Status, appErr.Message, appErr.Code, nil)
+		}
 		return response.Error(
 			c,
 			constant.INTERNALSERVERERROR,
@@ -66,12 +72,13 @@ func (oc *OrderController) GetUserOrders(c *fiber.Ctx) error {
 		)
 	}
 
-	return response.Success(
+	return response.SuccessWithMeta(
 		c,
 		constant.SUCCESS,
 		"Orders fetched successfully",
 		"",
 		orders,
+		meta,
 	)
 }
 
@@ -79,9 +86,13 @@ func (oc *OrderController) GetUserOrders(c *fiber.Ctx) error {
    GET ALL ORDERS (ADMIN)
    ======================= */
 
+// Pages take ?limit, page and sort (created_at, total)
 func (oc *OrderController) GetAllOrders(c *fiber.Ctx) error {
-	orders, err := oc.service.GetAllOrders()
+	orders, meta, err := oc.service.GetAllOrders(c.UserContext(), pagination.FromQuery(c, pagination.DefaultLimit))
 	if err != nil {
+		if appErr, ok := err.(*apperror.AppError); ok {
+			return response.Error(c, appErr.Status, appErr.Message, appErr.Code, nil)
+		}
 		return response.Error(
 			c,
 			constant.INTERNALSERVERERROR,
@@ -91,12 +102,13 @@ func (oc *OrderController) GetAllOrders(c *fiber.Ctx) error {
 		)
 	}
 
-	return response.Success(
+	return response.SuccessWithMeta(
 		c,
 		constant.SUCCESS,
 		"All orders fetched successfully",
 		"",
 		orders,
+		meta,
 	)
 }
 
@@ -106,6 +118,7 @@ func (oc *OrderController) GetAllOrders(c *fiber.Ctx) error {
 
 type UpdateOrderStatusRequest struct {
 	Status string `json:"status"`
+	Reason string `json:"reason"`
 }
 
 func (oc *OrderController) UpdateOrderStatus(c *fiber.Ctx) error {
@@ -131,7 +144,9 @@ func (oc *OrderController) UpdateOrderStatus(c *fiber.Ctx) error {
 		)
 	}
 
-	order, err := oc.service.UpdateOrderStatus(orderID, req.Status)
+	adminID, _ := c.Locals("user_id").(string)
+
+	order, err := oc.service.UpdateOrderStatus(c.UserContext(), adminID, orderID, req.Status, req.Reason)
 	if err != nil {
 		if appErr, ok := err.(*apperror.AppError); ok {
 			return response.Error(c, appErr.Status, appErr.Message, appErr.Code, nil)
@@ -169,7 +184,9 @@ func (oc *OrderController) UpdateOrderStatusAdmin(c *fiber.Ctx) error {
 		return response.Error(c, constant.BADREQUEST, "Invalid request body", "", nil)
 	}
 
-	order, err := oc.service.UpdateOrderStatusByID("", orderID, req.Status, true)
+	adminID, _ := c.Locals("user_id").(string)
+
+	order, err := oc.service.UpdateOrderStatusByID(c.UserContext(), adminID, orderID, req.Status, req.Reason, true)
 	if err != nil {
 		if appErr, ok := err.(*apperror.AppError); ok {
 			return response.Error(c, appErr.Status, appErr.Message, appErr.Code, nil)
@@ -209,7 +226,7 @@ func (oc *OrderController) UpdateOrderStatusUser(c *fiber.Ctx) error {
 
 	userID := c.Locals("user_id").(string)
 
-	order, err := oc.service.UpdateOrderStatusByID(userID, orderID, req.Status, false)
+	order, err := oc.service.UpdateOrderStatusByID(c.UserContext(), userID, orderID, req.Status, req.Reason, false)
 	if err != nil {
 		if appErr, ok := err.(*apperror.AppError); ok {
 			return response.Error(c, appErr.Status, appErr.Message, appErr.Code, nil)
@@ -244,7 +261,40 @@ func (oc *OrderController) GetOrderDetails(c *fiber.Ctx) error {
 
 	userID := c.Locals("user_id").(string)
 
-	order, err := oc.service.GetOrderByID(userID, orderID)
+	order, err := oc.service.GetOrderByID(c.UserContext(), userID, orderID)
+	if err != nil {
+		if appErr, ok := err.(*apperror.AppError); ok {
+			return response.Error(c, appErr.Status, appErr.Message, appErr.Code, nil)
+		}
+		return response.Error(
+			c,
+			constant.BADREQUEST,
+			"Failed to fetch order",
+			"",
+			err.Error(),
+		)
+	}
+
+	return response.Success(
+		c,
+		constant.SUCCESS,
+		"Order fetched successfully",
+		"",
+		order,
+	)
+}
+
+/* =======================
+   GET ORDER DETAILS (ADMIN)
+   ======================= */
+
+func (oc *OrderController) GetOrderDetailsAdmin(c *fiber.Ctx) error {
+	orderID := c.Params("id")
+	if orderID == "" {
+		return response.Error(c, constant.BADREQUEST, "order id is required", "", nil)
+	}
+
+	order, err := oc.service.GetOrderByIDAdmin(c.UserContext(), orderID)
 	if err != nil {
 		if appErr, ok := err.(*apperror.AppError); ok {
 			return response.Error(c, appErr.Status, appErr.Message, appErr.Code, nil)
@@ -279,7 +329,7 @@ func (oc *OrderController) DeleteOrder(c *fiber.Ctx) error {
 
 	userID := c.Locals("user_id").(string)
 
-	if err := oc.service.DeleteOrder(userID, orderID); err != nil {
+	if err := oc.service.DeleteOrder(c.UserContext(), userID, orderID); err != nil {
 		if appErr, ok := err.(*apperror.AppError); ok {
 			return response.Error(c, appErr.Status, appErr.Message, appErr.Code, nil)
 		}
@@ -311,9 +361,19 @@ func (oc *OrderController) CancelOrder(c *fiber.Ctx) error {
 		return response.Error(c, constant.BADREQUEST, "order id is required", "", nil)
 	}
 
+	// Reason is optional, so an empty body is fine
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return response.Error(c, constant.BADREQUEST, "Invalid request body", "", nil)
+		}
+	}
+
 	userID := c.Locals("user_id").(string)
 
-	order, err := oc.service.CancelOrder(userID, orderID)
+	order, err := oc.service.CancelOrder(c.UserContext(), userID, orderID, req.Reason)
 	if err != nil {
 		if appErr, ok := err.(*apperror.AppError); ok {
 			return response.Error(c, appErr.Status, appErr.Message, appErr.Code, nil)
@@ -1,10 +1,14 @@
 package controller
 
 import (
+	"net/http"
+
 	"vestra-ecommerce/src/model"
 	"vestra-ecommerce/src/services"
 	constant "vestra-ecommerce/utils/constants"
+	"vestra-ecommerce/utils/pagination"
 	"vestra-ecommerce/utils/response"
+	"vestra-ecommerce/utils/utils/apperror"
 
 	"github.com/gofiber/fiber/v2"
 )
@@ -32,8 +36,11 @@ func (pc *PaymentController) CreatePayment(c *fiber.Ctx) error {
 		)
 	}
 
-	payment, err := pc.service.CreatePayment(userID, req)
+	payment, err := pc.service.CreatePayment(c.UserContext(), userID, req)
 	if err != nil {
+		if appErr, ok := err.(*apperror.AppError); ok {
+			return response.Error(c, appErr.Status, appErr.Message, appErr.Code, nil)
+		}
 		return response.Error(
 			c,
 			constant.INTERNALSERVERERROR,
@@ -66,8 +73,13 @@ func (pc *PaymentController) VerifyPayment(c *fiber.Ctx) error {
 		)
 	}
 
-	payment, err := pc.service.VerifyPayment(req.PaymentID, req.TransactionID, req.Status)
+	userID := c.Locals("user_id").(string)
+
+	payment, err := pc.service.VerifyPayment(c.UserContext(), userID, req)
 	if err != nil {
+		if appErr, ok := err.(*apperror.AppError); ok {
+			return response.Error(c, appErr.Status, appErr.Message, appErr.Code, nil)
+		}
 		return response.Error(
 			c,
 			constant.BADREQUEST,
@@ -86,13 +98,16 @@ func (pc *PaymentController) VerifyPayment(c *fiber.Ctx) error {
 	)
 }
 
-// GET /user/payment
+// GET /user/payment?limit=&cursor=&sort= (created_at, amount)
 func (pc *PaymentController) GetUserPayments(c *fiber.Ctx) error {
 	// Get logged-in user ID from context
 	userID := c.Locals("user_id").(string)
 
-	payments, err := pc.service.GetPaymentsByUser(userID)
+	payments, meta, err := pc.service.GetPaymentsByUser(c.UserContext(), userID, pagination.FromQuery(c, pagination.DefaultLimit))
 	if err != nil {
+		if appErr, ok := err.(*apperror.AppError); ok {
+			return response.Error(c, appErr.Status, appErr.Message, appErr.Code, nil)
+		}
 		return response.Error(
 			c,
 			constant.INTERNALSERVERERROR,
@@ -102,12 +117,13 @@ func (pc *PaymentController) GetUserPayments(c *fiber.Ctx) error {
 		)
 	}
 
-	return response.Success(
+	return response.SuccessWithMeta(
 		c,
 		constant.SUCCESS,
 		"Payments fetched successfully",
 		"",
 		payments,
+		meta,
 	)
 }
 
@@ -116,7 +132,7 @@ func (pc *PaymentController) GetUserPaymentByID(c *fiber.Ctx) error {
 	userID := c.Locals("user_id").(string)
 	paymentID := c.Params("id")
 
-	payment, err := pc.service.GetPaymentByID(userID, paymentID)
+	payment, err := pc.service.GetPaymentByID(c.UserContext(), userID, paymentID)
 	if err != nil {
 		return response.Error(
 			c,
@@ -141,7 +157,7 @@ func (pc *PaymentController) CancelPayment(c *fiber.Ctx) error {
 	userID := c.Locals("user_id").(string)
 	paymentID := c.Params("id")
 
-	payment, err := pc.service.CancelPayment(userID, paymentID)
+	payment, err := pc.service.CancelPayment(c.UserContext(), userID, paymentID)
 	if err != nil {
 		return response.Error(
 			c,
@@ -165,7 +181,7 @@ func (pc *PaymentController) CancelPayment(c *fiber.Ctx) error {
 func (pc *PaymentController) GetPaymentByIDAdmin(c *fiber.Ctx) error {
 	paymentID := c.Params("id")
 
-	payment, err := pc.service.GetPaymentByIDAdmin(paymentID)
+	payment, err := pc.service.GetPaymentByIDAdmin(c.UserContext(), paymentID)
 	if err != nil {
 		return response.Error(
 			c,
@@ -203,7 +219,7 @@ func (pc *PaymentController) UpdatePaymentStatus(c *fiber.Ctx) error {
 		)
 	}
 
-	payment, err := pc.service.UpdatePaymentStatus(paymentID, req.Status)
+	payment, err := pc.service.UpdatePaymentStatus(c.UserContext(), paymentID, req.Status)
 	if err != nil {
 		return response.Error(
 			c,
@@ -222,3 +238,218 @@ func (pc *PaymentController) UpdatePaymentStatus(c *fiber.Ctx) error {
 		payment,
 	)
 }
+
+// POST /webhooks/payments/:provider
+func (pc *PaymentController) HandleWebhook(c *fiber.Ctx) error {
+	provider := c.Params("provider")
+
+	// fasthttp reuses the body buffer after the handler returns
+	payload := append([]byte(nil), c.Body()...)
+
+	headers := http.Header{}
+	for key, values := range c.GetReqHeaders() {
+		for _, v := range values {
+			headers.Add(key, v)
+		}
+	}
+
+	if err := pc.service.HandleWebhook(c.UserContext(), provider, payload, headers); err != nil {
+		if appErr, ok := err.(*apperror.AppError); ok {
+			return response.Error(c, appErr.Status, appErr.Message, appErr.Code, nil)
+		}
+		return response.Error(
+			c,
+			constant.INTERNALSERVERERROR,
+			"Failed to process webhook",
+			"",
+			err.Error(),
+		)
+	}
+
+	return response.Success(
+		c,
+		constant.SUCCESS,
+		"Webhook received",
+		"",
+		nil,
+	)
+}
+
+// GET /admin/payments/webhooks
+func (pc *PaymentController) GetWebhookEvents(c *fiber.Ctx) error {
+	events, err := pc.service.GetWebhookEvents(c.UserContext(), c.Query("status"))
+	if err != nil {
+		return response.Error(
+			c,
+			constant.INTERNALSERVERERROR,
+			"Failed to fetch webhook events",
+			"",
+			err.Error(),
+		)
+	}
+
+	return response.Success(
+		c,
+		constant.SUCCESS,
+		"Webhook events fetched successfully",
+		"",
+		events,
+	)
+}
+
+// POST /admin/payments/webhooks/:id/replay
+func (pc *PaymentController) ReplayWebhookEvent(c *fiber.Ctx) error {
+	event, err := pc.service.ReplayWebhookEvent(c.UserContext(), c.Params("id"))
+	if err != nil {
+		if appErr, ok := err.(*apperror.AppError); ok {
+			return response.Error(c, appErr.Status, appErr.Message, appErr.Code, nil)
+		}
+		return response.Error(
+			c,
+			constant.INTERNALSERVERERROR,
+			"Failed to replay webhook event",
+			"",
+			err.Error(),
+		)
+	}
+
+	return response.Success(
+		c,
+		constant.SUCCESS,
+		"Webhook event replayed",
+		"",
+		event,
+	)
+}
+
+// GET /admin/payments/reconciliation
+func (pc *PaymentController) GetReconciliationReport(c *fiber.Ctx) error {
+	rows, err := pc.service.GetReconciliationReport(c.UserContext())
+	if err != nil {
+		return response.Error(
+			c,
+			constant.INTERNALSERVERERROR,
+			"Failed to build reconciliation report",
+			"",
+			err.Error(),
+		)
+	}
+
+	return response.Success(
+		c,
+		constant.SUCCESS,
+		"Reconciliation report generated",
+		"",
+		rows,
+	)
+}
+
+// POST /admin/payments/:id/refunds
+func (pc *PaymentController) RefundPayment(c *fiber.Ctx) error {
+	var req services.RefundRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return response.Error(
+				c,
+				constant.BADREQUEST,
+				"Invalid request body",
+				"",
+				nil,
+			)
+		}
+	}
+
+	adminID, _ := c.Locals("user_id").(string)
+	actor := services.OrderActor{UserID: adminID, Role: constant.ACTOR_ADMIN}
+
+	refund, err := pc.service.RefundPayment(c.UserContext(), actor, c.Params("id"), req)
+	if err != nil {
+		if appErr, ok := err.(*apperror.AppError); ok {
+			return response.Error(c, appErr.Status, appErr.Message, appErr.Code, appErr.Details)
+		}
+		return response.Error(
+			c,
+			constant.INTERNALSERVERERROR,
+			"Failed to refund payment",
+			"",
+			err.Error(),
+		)
+	}
+
+	return response.Success(
+		c,
+		constant.CREATED,
+		"Refund initiated",
+		"",
+		refund,
+	)
+}
+
+// GET /admin/payments/:id/refunds
+func (pc *PaymentController) GetPaymentRefunds(c *fiber.Ctx) error {
+	refunds, err := pc.service.GetRefundsByPayment(c.UserContext(), c.Params("id"))
+	if err != nil {
+		if appErr, ok := err.(*apperror.AppError); ok {
+			return response.Error(c, appErr.Status, appErr.Message, appErr.Code, nil)
+		}
+		return response.Error(
+			c,
+			constant.INTERNALSERVERERROR,
+			"Failed to fetch refunds",
+			"",
+			err.Error(),
+		)
+	}
+
+	return response.Success(
+		c,
+		constant.SUCCESS,
+		"Refunds fetched successfully",
+		"",
+		refunds,
+	)
+}
+
+// POST /admin/orders/:id/refund
+// Refunds whatever is left on every captured payment of the order.
+func (pc *PaymentController) RefundOrder(c *fiber.Ctx) error {
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return response.Error(
+				c,
+				constant.BADREQUEST,
+				"Invalid request body",
+				"",
+				nil,
+			)
+		}
+	}
+
+	adminID, _ := c.Locals("user_id").(string)
+	actor := services.OrderActor{UserID: adminID, Role: constant.ACTOR_ADMIN}
+
+	refunds, err := pc.service.RefundOrder(c.UserContext(), actor, c.Params("id"), req.Reason)
+	if err != nil {
+		if appErr, ok := err.(*apperror.AppError); ok {
+			return response.Error(c, appErr.Status, appErr.Message, appErr.Code, appErr.Details)
+		}
+		return response.Error(
+			c,
+			constant.INTERNALSERVERERROR,
+			"Failed to refund order",
+			"",
+			err.Error(),
+		)
+	}
+
+	return response.Success(
+		c,
+		constant.SUCCESS,
+		"Order refund initiated",
+		"",
+		refunds,
+	)
+}
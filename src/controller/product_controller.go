@@ -5,9 +5,13 @@ import (
 	"vestra-ecommerce/src/model"
 	"vestra-ecommerce/src/services"
 	constant "vestra-ecommerce/utils/constants"
+	"vestra-ecommerce/utils/money"
+	"vestra-ecommerce/utils/pagination"
 	"vestra-ecommerce/utils/response"
+	"vestra-ecommerce/utils/utils/apperror"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
 )
 
 type ProductController struct {
@@ -22,14 +26,20 @@ func NewProductController(service *services.ProductService) *ProductController {
    REQUEST STRUCTS
    ======================= */
 
+// Prices are in minor units (paise for INR); currency defaults to the
+// store currency. With a team_id the league is taken from the team.
 type CreateProductRequest struct {
-	Name         string `json:"name"`
-	Price        int    `json:"price"`
-	ImageURL     string `json:"image_url"`
-	League       string `json:"league"`
-	KitType      string `json:"kit_type"`
-	Year         int    `json:"year"`
-	IsTopSelling bool   `json:"is_top_selling"`
+	Name         string     `json:"name"`
+	Description  string     `json:"description"`
+	Price        int64      `json:"price"`
+	Currency     string     `json:"currency"`
+	ImageURL     string     `json:"image_url"`
+	CategoryID   *uuid.UUID `json:"category_id"`
+	TeamID       *uuid.UUID `json:"team_id"`
+	League       string     `json:"league"`
+	KitType      string     `json:"kit_type"`
+	Year         int        `json:"year"`
+	IsTopSelling bool       `json:"is_top_selling"`
 	Sizes        []struct {
 		Size     string `json:"size"`
 		Quantity int    `json:"quantity"`
@@ -38,8 +48,12 @@ type CreateProductRequest struct {
 
 type UpdateProductRequest struct {
 	Name         *string `json:"name"`
-	Price        *int    `json:"price"`
+	Description  *string `json:"description"`
+	Price        *int64  `json:"price"`
+	Currency     *string `json:"currency"`
 	ImageURL     *string `json:"image_url"`
+	CategoryID   *string `json:"category_id"` // "" removes the category
+	TeamID       *string `json:"team_id"`     // "" removes the team
 	League       *string `json:"league"`
 	KitType      *string `json:"kit_type"`
 	Year         *int    `json:"year"`
@@ -83,10 +97,24 @@ func (pc *ProductController) CreateProduct(c *fiber.Ctx) error {
 		)
 	}
 
+	price := money.New(req.Price, req.Currency)
+	if err := price.Validate(); err != nil {
+		return response.Error(
+			c,
+			constant.BADREQUEST,
+			"Invalid currency",
+			"",
+			nil,
+		)
+	}
+
 	product := model.Product{
 		Name:         req.Name,
-		Price:        req.Price,
+		Description:  req.Description,
+		Price:        price,
 		ImageURL:     req.ImageURL,
+		CategoryID:   req.CategoryID,
+		TeamID:       req.TeamID,
 		League:       req.League,
 		KitType:      req.KitType,
 		Year:         req.Year,
@@ -101,8 +129,11 @@ func (pc *ProductController) CreateProduct(c *fiber.Ctx) error {
 		})
 	}
 
-	if err := pc.service.CreateProduct(&product); err != nil {
+	if err := pc.service.CreateProduct(c.UserContext(), &product); err != nil {
 		// return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		if appErr, ok := err.(*apperror.AppError); ok {
+			return response.Error(c, appErr.Status, appErr.Message, appErr.Code, nil)
+		}
 		return response.Error(
 			c,
 			constant.INTERNALSERVERERROR,
@@ -126,23 +157,50 @@ func (pc *ProductController) CreateProduct(c *fiber.Ctx) error {
    GET ALL PRODUCTS
    ======================= */
 
+// league, kit_type, year and size take several values, repeated
+// (?size=M&size=L) or comma-separated (?size=M,L); in_stock and top_selling
+// are true/false. The response carries facet counts for each of them.
+// Pages take ?limit, cursor and sort (price, created_at, name, popularity;
+// "-" prefix for descending).
 func (pc *ProductController) GetAllProducts(c *fiber.Ctx) error {
 	filter := services.ProductFilter{
-		Category: c.Query("category"),
+		Category: c.Query("category"),   // category id or slug
+		Team:     c.Query("team"),       // league or club id or slug
 		Search:   c.Query("q"),          // for name/description search
-		Size:     c.Query("size"),       // S, M, L, etc
+		League:   queryList(c, "league"),
+		KitType:  queryList(c, "kit_type"),
+		Size:     queryList(c, "size"),  // S, M, L, etc
+	}
+
+	for _, raw := range queryList(c, "year") {
+		year, err := strconv.Atoi(raw)
+		if err != nil {
+			return badFilter(c, "year must be a number")
+		}
+		filter.Year = append(filter.Year, year)
+	}
+
+	var err error
+	if filter.InStock, err = queryBool(c, "in_stock"); err != nil {
+		return badFilter(c, "in_stock must be true or false")
+	}
+	if filter.TopSelling, err = queryBool(c, "top_selling"); err != nil {
+		return badFilter(c, "top_selling must be true or false")
 	}
 
 	if minPrice := c.Query("min_price"); minPrice != "" {
-		filter.MinPrice, _ = strconv.Atoi(minPrice)
+		filter.MinPrice, _ = strconv.ParseInt(minPrice, 10, 64)
 	}
 
 	if maxPrice := c.Query("max_price"); maxPrice != "" {
-		filter.MaxPrice, _ = strconv.Atoi(maxPrice)
+		filter.MaxPrice, _ = strconv.ParseInt(maxPrice, 10, 64)
 	}
 
-	products, err := pc.service.GetAllProducts(filter)
+	listing, meta, err := pc.service.GetAllProducts(filter, pagination.FromQuery(c, pagination.DefaultLimit))
 	if err != nil {
+		if appErr, ok := err.(*apperror.AppError); ok {
+			return response.Error(c, appErr.Status, appErr.Message, appErr.Code, nil)
+		}
 		return response.Error(
 			c,
 			constant.INTERNALSERVERERROR,
@@ -152,17 +210,40 @@ func (pc *ProductController) GetAllProducts(c *fiber.Ctx) error {
 		)
 	}
 
-	return response.Success(
+	return response.SuccessWithMeta(
 		c,
 		constant.SUCCESS,
 		"Products fetched successfully",
 		"",
-		products,
+		listing,
+		meta,
 	)
 }
 
 
 
+/* =======================
+   SEARCH SUGGESTIONS
+   ======================= */
+
+// GET /products/suggest?q=&limit=
+// Served from memory so it can be called on every keystroke.
+func (pc *ProductController) Suggest(c *fiber.Ctx) error {
+	limit := c.QueryInt("limit", 8)
+	if limit < 1 || limit > 20 {
+		limit = 8
+	}
+
+	c.Set(fiber.HeaderCacheControl, "public, max-age=60")
+	return response.Success(
+		c,
+		constant.SUCCESS,
+		"Suggestions fetched successfully",
+		"",
+		pc.service.Suggest(c.Query("q"), limit),
+	)
+}
+
 /* =======================
    GET PRODUCT BY ID
    ======================= */
@@ -218,7 +299,7 @@ func (pc *ProductController) DeleteProduct(c *fiber.Ctx) error {
 		)
 	}
 
-	if err := pc.service.DeleteProduct(id); err != nil {
+	if err := pc.service.DeleteProduct(c.UserContext(), id); err != nil {
 		return response.Error(
 			c,
 			constant.INTERNALSERVERERROR,
@@ -283,8 +364,12 @@ func (pc *ProductController) UpdateProduct(c *fiber.Ctx) error {
 
 	input := services.UpdateProductInput{
 		Name:         req.Name,
+		Description:  req.Description,
 		Price:        req.Price,
+		Currency:     req.Currency,
 		ImageURL:     req.ImageURL,
+		CategoryID:   req.CategoryID,
+		TeamID:       req.TeamID,
 		League:       req.League,
 		KitType:      req.KitType,
 		Year:         req.Year,
@@ -293,9 +378,12 @@ func (pc *ProductController) UpdateProduct(c *fiber.Ctx) error {
 		Sizes:        sizes,
 	}
 
-	product, err := pc.service.UpdateProduct(id, &input)
+	product, err := pc.service.UpdateProduct(c.UserContext(), id, &input)
 	if err != nil {
 		// return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		if appErr, ok := err.(*apperror.AppError); ok {
+			return response.Error(c, appErr.Status, appErr.Message, appErr.Code, nil)
+		}
 		return response.Error(
 			c,
 			constant.INTERNALSERVERERROR,
@@ -319,13 +407,17 @@ func (pc *ProductController) UpdateProduct(c *fiber.Ctx) error {
    SEARCH PRODUCTS
    ======================= */
 
+// Pages take ?limit, page and sort (relevance by default, or any product sort)
 func (pc *ProductController) SearchProducts(c *fiber.Ctx) error {
 	query := c.Query("q")
 	league := c.Query("league")
 	kitType := c.Query("kit_type")
 
-	products, err := pc.service.SearchProducts(query, league, kitType, nil)
+	products, meta, err := pc.service.SearchProducts(query, league, kitType, nil, pagination.FromQuery(c, pagination.DefaultLimit))
 	if err != nil {
+		if appErr, ok := err.(*apperror.AppError); ok {
+			return response.Error(c, appErr.Status, appErr.Message, appErr.Code, nil)
+		}
 		return response.Error(
 			c,
 			constant.INTERNALSERVERERROR,
@@ -335,21 +427,25 @@ func (pc *ProductController) SearchProducts(c *fiber.Ctx) error {
 		)
 	}
 
-	return response.Success(
+	return response.SuccessWithMeta(
 		c,
 		constant.SUCCESS,
 		"Products fetched successfully",
 		"",
 		products,
+		meta,
 	)
 }
 
 
 
-// GET /admin/payments
+// GET /admin/payments?limit=&page=&sort= (created_at, amount)
 func (pc *PaymentController) GetAllPayments(c *fiber.Ctx) error {
-	payments, err := pc.service.GetAllPayments()
+	payments, meta, err := pc.service.GetAllPayments(c.UserContext(), pagination.FromQuery(c, pagination.DefaultLimit))
 	if err != nil {
+		if appErr, ok := err.(*apperror.AppError); ok {
+			return response.Error(c, appErr.Status, appErr.Message, appErr.Code, nil)
+		}
 		return response.Error(
 			c,
 			constant.INTERNALSERVERERROR,
@@ -359,11 +455,12 @@ func (pc *PaymentController) GetAllPayments(c *fiber.Ctx) error {
 		)
 	}
 
-	return response.Success(
+	return response.SuccessWithMeta(
 		c,
 		constant.SUCCESS,
 		"Payments fetched successfully",
 		"",
 		payments,
+		meta,
 	)
 }
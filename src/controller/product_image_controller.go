@@ -0,0 +1,171 @@
+package controller
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"vestra-ecommerce/src/services"
+	constant "vestra-ecommerce/utils/constants"
+	"vestra-ecommerce/utils/response"
+	"vestra-ecommerce/utils/utils/apperror"
+)
+
+type ProductImageController struct {
+	service *services.ProductImageService
+}
+
+func NewProductImageController(service *services.ProductImageService) *ProductImageController {
+	return &ProductImageController{service: service}
+}
+
+type ReorderImagesRequest struct {
+	ImageIDs []string `json:"image_ids"`
+}
+
+// POST /admin/products/:id/images
+// multipart/form-data: image (the file), alt_text, color
+func (ic *ProductImageController) UploadImage(c *fiber.Ctx) error {
+	file, err := c.FormFile("image")
+	if err != nil {
+		return response.Error(
+			c,
+			constant.BADREQUEST,
+			"An image file is required",
+			constant.INVALID_REQUEST,
+			nil,
+		)
+	}
+
+	upload, err := file.Open()
+	if err != nil {
+		return response.Error(
+			c,
+			constant.BADREQUEST,
+			"Failed to read image",
+			"",
+			nil,
+		)
+	}
+	defer upload.Close()
+
+	image, err := ic.service.AddImage(c.UserContext(), c.Params("id"), upload, services.ProductImageInput{
+		AltText: c.FormValue("alt_text"),
+		Color:   c.FormValue("color"),
+	})
+	if err != nil {
+		if appErr, ok := err.(*apperror.AppError); ok {
+			return response.Error(c, appErr.Status, appErr.Message, appErr.Code, appErr.Details)
+		}
+		return response.Error(
+			c,
+			constant.INTERNALSERVERERROR,
+			"Failed to upload image",
+			"",
+			err.Error(),
+		)
+	}
+
+	return response.Success(
+		c,
+		constant.CREATED,
+		"Image uploaded successfully",
+		"",
+		image,
+	)
+}
+
+// PATCH /admin/products/:id/images/:image_id
+func (ic *ProductImageController) UpdateImage(c *fiber.Ctx) error {
+	var req services.UpdateProductImageInput
+	if err := c.BodyParser(&req); err != nil {
+		return response.Error(
+			c,
+			constant.BADREQUEST,
+			"Invalid request body",
+			"",
+			nil,
+		)
+	}
+
+	image, err := ic.service.UpdateImage(c.UserContext(), c.Params("id"), c.Params("image_id"), req)
+	if err != nil {
+		if appErr, ok := err.(*apperror.AppError); ok {
+			return response.Error(c, appErr.Status, appErr.Message, appErr.Code, appErr.Details)
+		}
+		return response.Error(
+			c,
+			constant.INTERNALSERVERERROR,
+			"Failed to update image",
+			"",
+			err.Error(),
+		)
+	}
+
+	return response.Success(
+		c,
+		constant.SUCCESS,
+		"Image updated successfully",
+		"",
+		image,
+	)
+}
+
+// PUT /admin/products/:id/images/order
+// {"image_ids": [...]}, every image of the product, cover first
+func (ic *ProductImageController) ReorderImages(c *fiber.Ctx) error {
+	var req ReorderImagesRequest
+	if err := c.BodyParser(&req); err != nil {
+		return response.Error(
+			c,
+			constant.BADREQUEST,
+			"Invalid request body",
+			"",
+			nil,
+		)
+	}
+
+	images, err := ic.service.ReorderImages(c.UserContext(), c.Params("id"), req.ImageIDs)
+	if err != nil {
+		if appErr, ok := err.(*apperror.AppError); ok {
+			return response.Error(c, appErr.Status, appErr.Message, appErr.Code, appErr.Details)
+		}
+		return response.Error(
+			c,
+			constant.INTERNALSERVERERROR,
+			"Failed to reorder images",
+			"",
+			err.Error(),
+		)
+	}
+
+	return response.Success(
+		c,
+		constant.SUCCESS,
+		"Images reordered successfully",
+		"",
+		images,
+	)
+}
+
+// DELETE /admin/products/:id/images/:image_id
+func (ic *ProductImageController) DeleteImage(c *fiber.Ctx) error {
+	if err := ic.service.DeleteImage(c.UserContext(), c.Params("id"), c.Params("image_id")); err != nil {
+		if appErr, ok := err.(*apperror.AppError); ok {
+			return response.Error(c, appErr.Status, appErr.Message, appErr.Code, appErr.Details)
+		}
+		return response.Error(
+			c,
+			constant.INTERNALSERVERERROR,
+			"Failed to delete image",
+			"",
+			err.Error(),
+		)
+	}
+
+	return response.Success(
+		c,
+		constant.SUCCESS,
+		"Image deleted successfully",
+		"",
+		nil,
+	)
+}
@@ -0,0 +1,225 @@
+package controller
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"vestra-ecommerce/src/services"
+	constant "vestra-ecommerce/utils/constants"
+	"vestra-ecommerce/utils/response"
+	"vestra-ecommerce/utils/utils/apperror"
+)
+
+type RoleController struct {
+	service *services.RoleService
+}
+
+func NewRoleController(service *services.RoleService) *RoleController {
+	return &RoleController{service: service}
+}
+
+// GET /admin/permissions
+func (rc *RoleController) GetPermissions(c *fiber.Ctx) error {
+	permissions, err := rc.service.GetPermissions(c.UserContext())
+	if err != nil {
+		return response.Error(
+			c,
+			constant.INTERNALSERVERERROR,
+			"Failed to fetch permissions",
+			"",
+			err.Error(),
+		)
+	}
+
+	return response.Success(
+		c,
+		constant.SUCCESS,
+		"Permissions fetched successfully",
+		"",
+		permissions,
+	)
+}
+
+// GET /admin/roles
+func (rc *RoleController) GetRoles(c *fiber.Ctx) error {
+	roles, err := rc.service.GetRoles(c.UserContext())
+	if err != nil {
+		return response.Error(
+			c,
+			constant.INTERNALSERVERERROR,
+			"Failed to fetch roles",
+			"",
+			err.Error(),
+		)
+	}
+
+	return response.Success(
+		c,
+		constant.SUCCESS,
+		"Roles fetched successfully",
+		"",
+		roles,
+	)
+}
+
+// POST /admin/roles
+func (rc *RoleController) CreateRole(c *fiber.Ctx) error {
+	var req services.RoleInput
+	if err := c.BodyParser(&req); err != nil {
+		return response.Error(
+			c,
+			constant.BADREQUEST,
+			"Invalid request body",
+			"",
+			nil,
+		)
+	}
+
+	role, err := rc.service.CreateRole(c.UserContext(), req)
+	if err != nil {
+		if appErr, ok := err.(*apperror.AppError); ok {
+			return response.Error(c, appErr.Status, appErr.Message, appErr.Code, appErr.Details)
+		}
+		return response.Error(
+			c,
+			constant.INTERNALSERVERERROR,
+			"Failed to create role",
+			"",
+			err.Error(),
+		)
+	}
+
+	return response.Success(
+		c,
+		constant.CREATED,
+		"Role created successfully",
+		"",
+		role,
+	)
+}
+
+// PUT /admin/roles/:id
+// Replaces the description and permissions; the name can't change.
+func (rc *RoleController) UpdateRole(c *fiber.Ctx) error {
+	var req services.RoleInput
+	if err := c.BodyParser(&req); err != nil {
+		return response.Error(
+			c,
+			constant.BADREQUEST,
+			"Invalid request body",
+			"",
+			nil,
+		)
+	}
+
+	role, err := rc.service.UpdateRole(c.UserContext(), c.Params("id"), req)
+	if err != nil {
+		if appErr, ok := err.(*apperror.AppError); ok {
+			return response.Error(c, appErr.Status, appErr.Message, appErr.Code, appErr.Details)
+		}
+		return response.Error(
+			c,
+			constant.INTERNALSERVERERROR,
+			"Failed to update role",
+			"",
+			err.Error(),
+		)
+	}
+
+	return response.Success(
+		c,
+		constant.SUCCESS,
+		"Role updated successfully",
+		"",
+		role,
+	)
+}
+
+// DELETE /admin/roles/:id
+func (rc *RoleController) DeleteRole(c *fiber.Ctx) error {
+	if err := rc.service.DeleteRole(c.UserContext(), c.Params("id")); err != nil {
+		if appErr, ok := err.(*apperror.AppError); ok {
+			return response.Error(c, appErr.Status, appErr.Message, appErr.Code, appErr.Details)
+		}
+		return response.Error(
+			c,
+			constant.INTERNALSERVERERROR,
+			"Failed to delete role",
+			"",
+			err.Error(),
+		)
+	}
+
+	return response.Success(
+		c,
+		constant.SUCCESS,
+		"Role deleted successfully",
+		"",
+		nil,
+	)
+}
+
+// GET /admin/users/:id/roles
+func (rc *RoleController) GetUserRoles(c *fiber.Ctx) error {
+	roles, err := rc.service.GetUserRoles(c.UserContext(), c.Params("id"))
+	if err != nil {
+		if appErr, ok := err.(*apperror.AppError); ok {
+			return response.Error(c, appErr.Status, appErr.Message, appErr.Code, appErr.Details)
+		}
+		return response.Error(
+			c,
+			constant.INTERNALSERVERERROR,
+			"Failed to fetch user roles",
+			"",
+			err.Error(),
+		)
+	}
+
+	return response.Success(
+		c,
+		constant.SUCCESS,
+		"User roles fetched successfully",
+		"",
+		roles,
+	)
+}
+
+// PUT /admin/users/:id/roles
+// Body: {"role_ids": [...]}; replaces the user's roles, [] removes them all.
+func (rc *RoleController) SetUserRoles(c *fiber.Ctx) error {
+	var req struct {
+		RoleIDs []string `json:"role_ids"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return response.Error(
+			c,
+			constant.BADREQUEST,
+			"Invalid request body",
+			"",
+			nil,
+		)
+	}
+
+	adminID, _ := c.Locals("user_id").(string)
+
+	roles, err := rc.service.SetUserRoles(c.UserContext(), adminID, c.Params("id"), req.RoleIDs)
+	if err != nil {
+		if appErr, ok := err.(*apperror.AppError); ok {
+			return response.Error(c, appErr.Status, appErr.Message, appErr.Code, appErr.Details)
+		}
+		return response.Error(
+			c,
+			constant.INTERNALSERVERERROR,
+			"Failed to assign roles",
+			"",
+			err.Error(),
+		)
+	}
+
+	return response.Success(
+		c,
+		constant.SUCCESS,
+		"User roles updated successfully",
+		"",
+		roles,
+	)
+}
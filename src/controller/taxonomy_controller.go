@@ -0,0 +1,266 @@
+package controller
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"vestra-ecommerce/src/services"
+	constant "vestra-ecommerce/utils/constants"
+	"vestra-ecommerce/utils/response"
+	"vestra-ecommerce/utils/utils/apperror"
+)
+
+type TaxonomyController struct {
+	service *services.TaxonomyService
+}
+
+func NewTaxonomyController(service *services.TaxonomyService) *TaxonomyController {
+	return &TaxonomyController{service: service}
+}
+
+/* =======================
+   CATEGORIES
+   ======================= */
+
+// GET /categories
+func (tc *TaxonomyController) ListCategories(c *fiber.Ctx) error {
+	categories, err := tc.service.ListCategories(c.UserContext())
+	if err != nil {
+		return response.Error(
+			c,
+			constant.INTERNALSERVERERROR,
+			"Failed to fetch categories",
+			"",
+			err.Error(),
+		)
+	}
+
+	return response.Success(
+		c,
+		constant.SUCCESS,
+		"Categories fetched successfully",
+		"",
+		categories,
+	)
+}
+
+// POST /admin/categories
+func (tc *TaxonomyController) CreateCategory(c *fiber.Ctx) error {
+	var req services.CategoryInput
+	if err := c.BodyParser(&req); err != nil {
+		return response.Error(
+			c,
+			constant.BADREQUEST,
+			"Invalid request body",
+			"",
+			nil,
+		)
+	}
+
+	category, err := tc.service.CreateCategory(c.UserContext(), req)
+	if err != nil {
+		if appErr, ok := err.(*apperror.AppError); ok {
+			return response.Error(c, appErr.Status, appErr.Message, appErr.Code, appErr.Details)
+		}
+		return response.Error(
+			c,
+			constant.INTERNALSERVERERROR,
+			"Failed to create category",
+			"",
+			err.Error(),
+		)
+	}
+
+	return response.Success(
+		c,
+		constant.CREATED,
+		"Category created successfully",
+		"",
+		category,
+	)
+}
+
+// PUT /admin/categories/:id
+func (tc *TaxonomyController) UpdateCategory(c *fiber.Ctx) error {
+	var req services.CategoryInput
+	if err := c.BodyParser(&req); err != nil {
+		return response.Error(
+			c,
+			constant.BADREQUEST,
+			"Invalid request body",
+			"",
+			nil,
+		)
+	}
+
+	category, err := tc.service.UpdateCategory(c.UserContext(), c.Params("id"), req)
+	if err != nil {
+		if appErr, ok := err.(*apperror.AppError); ok {
+			return response.Error(c, appErr.Status, appErr.Message, appErr.Code, appErr.Details)
+		}
+		return response.Error(
+			c,
+			constant.INTERNALSERVERERROR,
+			"Failed to update category",
+			"",
+			err.Error(),
+		)
+	}
+
+	return response.Success(
+		c,
+		constant.SUCCESS,
+		"Category updated successfully",
+		"",
+		category,
+	)
+}
+
+// DELETE /admin/categories/:id
+func (tc *TaxonomyController) DeleteCategory(c *fiber.Ctx) error {
+	if err := tc.service.DeleteCategory(c.UserContext(), c.Params("id")); err != nil {
+		if appErr, ok := err.(*apperror.AppError); ok {
+			return response.Error(c, appErr.Status, appErr.Message, appErr.Code, appErr.Details)
+		}
+		return response.Error(
+			c,
+			constant.INTERNALSERVERERROR,
+			"Failed to delete category",
+			"",
+			err.Error(),
+		)
+	}
+
+	return response.Success(
+		c,
+		constant.SUCCESS,
+		"Category deleted successfully",
+		"",
+		nil,
+	)
+}
+
+/* =======================
+   TEAMS
+   ======================= */
+
+// GET /teams?kind=club
+// Leagues with their clubs by default; kind=club lists just the clubs.
+func (tc *TaxonomyController) ListTeams(c *fiber.Ctx) error {
+	teams, err := tc.service.ListTeams(c.UserContext(), c.Query("kind"))
+	if err != nil {
+		if appErr, ok := err.(*apperror.AppError); ok {
+			return response.Error(c, appErr.Status, appErr.Message, appErr.Code, appErr.Details)
+		}
+		return response.Error(
+			c,
+			constant.INTERNALSERVERERROR,
+			"Failed to fetch teams",
+			"",
+			err.Error(),
+		)
+	}
+
+	return response.Success(
+		c,
+		constant.SUCCESS,
+		"Teams fetched successfully",
+		"",
+		teams,
+	)
+}
+
+// POST /admin/teams
+func (tc *TaxonomyController) CreateTeam(c *fiber.Ctx) error {
+	var req services.TeamInput
+	if err := c.BodyParser(&req); err != nil {
+		return response.Error(
+			c,
+			constant.BADREQUEST,
+			"Invalid request body",
+			"",
+			nil,
+		)
+	}
+
+	team, err := tc.service.CreateTeam(c.UserContext(), req)
+	if err != nil {
+		if appErr, ok := err.(*apperror.AppError); ok {
+			return response.Error(c, appErr.Status, appErr.Message, appErr.Code, appErr.Details)
+		}
+		return response.Error(
+			c,
+			constant.INTERNALSERVERERROR,
+			"Failed to create team",
+			"",
+			err.Error(),
+		)
+	}
+
+	return response.Success(
+		c,
+		constant.CREATED,
+		"Team created successfully",
+		"",
+		team,
+	)
+}
+
+// PUT /admin/teams/:id
+func (tc *TaxonomyController) UpdateTeam(c *fiber.Ctx) error {
+	var req services.TeamInput
+	if err := c.BodyParser(&req); err != nil {
+		return response.Error(
+			c,
+			constant.BADREQUEST,
+			"Invalid request body",
+			"",
+			nil,
+		)
+	}
+
+	team, err := tc.service.UpdateTeam(c.UserContext(), c.Params("id"), req)
+	if err != nil {
+		if appErr, ok := err.(*apperror.AppError); ok {
+			return response.Error(c, appErr.Status, appErr.Message, appErr.Code, appErr.Details)
+		}
+		return response.Error(
+			c,
+			constant.INTERNALSERVERERROR,
+			"Failed to update team",
+			"",
+			err.Error(),
+		)
+	}
+
+	return response.Success(
+		c,
+		constant.SUCCESS,
+		"Team updated successfully",
+		"",
+		team,
+	)
+}
+
+// DELETE /admin/teams/:id
+func (tc *TaxonomyController) DeleteTeam(c *fiber.Ctx) error {
+	if err := tc.service.DeleteTeam(c.UserContext(), c.Params("id")); err != nil {
+		if appErr, ok := err.(*apperror.AppError); ok {
+			return response.Error(c, appErr.Status, appErr.Message, appErr.Code, appErr.Details)
+		}
+		return response.Error(
+			c,
+			constant.INTERNALSERVERERROR,
+			"Failed to delete team",
+			"",
+			err.Error(),
+		)
+	}
+
+	return response.Success(
+		c,
+		constant.SUCCESS,
+		"Team deleted successfully",
+		"",
+		nil,
+	)
+}
@@ -0,0 +1,207 @@
+package controller
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"vestra-ecommerce/src/services"
+	constant "vestra-ecommerce/utils/constants"
+	"vestra-ecommerce/utils/pagination"
+	"vestra-ecommerce/utils/response"
+	"vestra-ecommerce/utils/utils/apperror"
+)
+
+type UserAdminController struct {
+	service *services.UserAdminService
+}
+
+func NewUserAdminController(service *services.UserAdminService) *UserAdminController {
+	return &UserAdminController{service: service}
+}
+
+/* =======================
+   LIST / DETAIL
+   ======================= */
+
+// ListUsers supports ?search, role, verified, blocked, signed_up_from,
+// signed_up_to (YYYY-MM-DD, the "to" day included), sort (created_at, email,
+// name; "-" prefix for descending), page and limit
+func (uc *UserAdminController) ListUsers(c *fiber.Ctx) error {
+	filter := services.UserFilter{
+		Search: c.Query("search"),
+		Role:   c.Query("role"),
+	}
+
+	var err error
+	if filter.Verified, err = queryBool(c, "verified"); err != nil {
+		return badFilter(c, "verified must be true or false")
+	}
+	if filter.Blocked, err = queryBool(c, "blocked"); err != nil {
+		return badFilter(c, "blocked must be true or false")
+	}
+	if filter.SignedUpFrom, err = queryDate(c, "signed_up_from"); err != nil {
+		return badFilter(c, "signed_up_from must be a YYYY-MM-DD date")
+	}
+	if filter.SignedUpTo, err = queryDate(c, "signed_up_to"); err != nil {
+		return badFilter(c, "signed_up_to must be a YYYY-MM-DD date")
+	}
+	if filter.SignedUpTo != nil {
+		end := filter.SignedUpTo.AddDate(0, 0, 1)
+		filter.SignedUpTo = &end
+	}
+
+	users, meta, err := uc.service.ListUsers(c.UserContext(), filter, pagination.FromQuery(c, pagination.DefaultLimit))
+	if err != nil {
+		if appErr, ok := err.(*apperror.AppError); ok {
+			return response.Error(c, appErr.Status, appErr.Message, appErr.Code, nil)
+		}
+		return response.Error(
+			c,
+			constant.INTERNALSERVERERROR,
+			"Something went wrong",
+			"",
+			err.Error(),
+		)
+	}
+
+	return response.SuccessWithMeta(
+		c,
+		constant.SUCCESS,
+		"Users fetched successfully",
+		"",
+		users,
+		meta,
+	)
+}
+
+func (uc *UserAdminController) GetCustomer(c *fiber.Ctx) error {
+	detail, err := uc.service.GetCustomer(c.UserContext(), c.Params("id"))
+	if err != nil {
+		if appErr, ok := err.(*apperror.AppError); ok {
+			return response.Error(c, appErr.Status, appErr.Message, appErr.Code, nil)
+		}
+		return response.Error(
+			c,
+			constant.INTERNALSERVERERROR,
+			"Something went wrong",
+			"",
+			err.Error(),
+		)
+	}
+
+	return response.Success(
+		c,
+		constant.SUCCESS,
+		"Customer fetched successfully",
+		"",
+		detail,
+	)
+}
+
+/* =======================
+   ACCOUNT FIXES
+   ======================= */
+
+func (uc *UserAdminController) ForceVerify(c *fiber.Ctx) error {
+	user, err := uc.service.ForceVerify(c.UserContext(), c.Params("id"))
+	if err != nil {
+		if appErr, ok := err.(*apperror.AppError); ok {
+			return response.Error(c, appErr.Status, appErr.Message, appErr.Code, nil)
+		}
+		return response.Error(
+			c,
+			constant.INTERNALSERVERERROR,
+			"Something went wrong",
+			"",
+			err.Error(),
+		)
+	}
+
+	return response.Success(
+		c,
+		constant.SUCCESS,
+		"User verified",
+		"",
+		user,
+	)
+}
+
+func (uc *UserAdminController) ForceLogout(c *fiber.Ctx) error {
+	if err := uc.service.ForceLogout(c.UserContext(), c.Params("id")); err != nil {
+		if appErr, ok := err.(*apperror.AppError); ok {
+			return response.Error(c, appErr.Status, appErr.Message, appErr.Code, nil)
+		}
+		return response.Error(
+			c,
+			constant.INTERNALSERVERERROR,
+			"Something went wrong",
+			"",
+			err.Error(),
+		)
+	}
+
+	return response.Success(
+		c,
+		constant.SUCCESS,
+		"User logged out everywhere",
+		"",
+		nil,
+	)
+}
+
+/* =======================
+   QUERY HELPERS
+   ======================= */
+
+// queryBool reads an optional true/false query parameter
+func queryBool(c *fiber.Ctx, key string) (*bool, error) {
+	raw := c.Query(key)
+	if raw == "" {
+		return nil, nil
+	}
+	v, err := strconv.ParseBool(raw)
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// queryDate reads an optional YYYY-MM-DD query parameter
+func queryDate(c *fiber.Ctx, key string) (*time.Time, error) {
+	raw := c.Query(key)
+	if raw == "" {
+		return nil, nil
+	}
+	v, err := time.Parse("2006-01-02", raw)
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// queryList reads a query parameter that may be repeated or hold
+// comma-separated values; blanks are dropped
+func queryList(c *fiber.Ctx, key string) []string {
+	var values []string
+	for _, raw := range c.Context().QueryArgs().PeekMulti(key) {
+		for _, v := range strings.Split(string(raw), ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				values = append(values, v)
+			}
+		}
+	}
+	return values
+}
+
+func badFilter(c *fiber.Ctx, msg string) error {
+	return response.Error(
+		c,
+		constant.BADREQUEST,
+		msg,
+		constant.INVALID_REQUEST,
+		nil,
+	)
+}
@@ -2,9 +2,11 @@ package controller
 
 import (
 	"log"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 
+	"vestra-ecommerce/src/model"
 	"vestra-ecommerce/src/services"
 	constant "vestra-ecommerce/utils/constants"
 	"vestra-ecommerce/utils/jwt"
@@ -12,15 +14,39 @@ import (
 	"vestra-ecommerce/utils/utils/apperror"
 )
 
+// mfaChallengeTTL is how long a user has to enter their two-factor code
+// after the password step
+const mfaChallengeTTL = 5 * time.Minute
+
 type UserAuthController struct {
-	authService *services.UserAuthService
-	jwtManager  *jwt.JWTManager
+	authService    *services.UserAuthService
+	sessionService *services.SessionService
+	mfaService     *services.MFAService
+	oidcService    *services.OIDCService
+	jwtManager     *jwt.JWTManager
 }
 
-func NewUserAuthController(service *services.UserAuthService, manager *jwt.JWTManager) *UserAuthController {
+func NewUserAuthController(
+	service *services.UserAuthService,
+	sessions *services.SessionService,
+	mfa *services.MFAService,
+	oidc *services.OIDCService,
+	manager *jwt.JWTManager,
+) *UserAuthController {
 	return &UserAuthController{
-		authService: service,
-		jwtManager:  manager,
+		authService:    service,
+		sessionService: sessions,
+		mfaService:     mfa,
+		oidcService:    oidc,
+		jwtManager:     manager,
+	}
+}
+
+// deviceInfo captures where a session is started or refreshed from
+func deviceInfo(ctx *fiber.Ctx) services.DeviceInfo {
+	return services.DeviceInfo{
+		UserAgent: ctx.Get(fiber.HeaderUserAgent),
+		IPAddress: ctx.IP(),
 	}
 }
 
@@ -91,7 +117,7 @@ func (c *UserAuthController) VerifyOTP(ctx *fiber.Ctx) error {
 
 	if err := c.authService.VerifyOTP(req.Email, req.OTP); err != nil {
 		if appErr, ok := err.(*apperror.AppError); ok {
-			return response.Error(ctx, appErr.Status, appErr.Message, appErr.Code, nil)
+			return response.Error(ctx, appErr.Status, appErr.Message, appErr.Code, appErr.Details)
 		}
 		return response.Error(
 			ctx,
@@ -111,6 +137,60 @@ func (c *UserAuthController) VerifyOTP(ctx *fiber.Ctx) error {
 	)
 }
 
+// ------------------ Resend OTP ------------------
+
+type resendOTPRequest struct {
+	Email   string `json:"email"`
+	Purpose string `json:"purpose"` // signup (default) or password_reset
+}
+
+func (c *UserAuthController) ResendOTP(ctx *fiber.Ctx) error {
+	var req resendOTPRequest
+	if err := ctx.BodyParser(&req); err != nil {
+		return response.Error(
+			ctx,
+			constant.BADREQUEST,
+			"Invalid request body",
+			"",
+			nil,
+		)
+	}
+
+	if req.Email == "" {
+		return response.Error(
+			ctx,
+			constant.BADREQUEST,
+			"Email is required",
+			"",
+			nil,
+		)
+	}
+	if req.Purpose == "" {
+		req.Purpose = constant.OTP_SIGNUP
+	}
+
+	if err := c.authService.ResendOTP(req.Email, req.Purpose); err != nil {
+		if appErr, ok := err.(*apperror.AppError); ok {
+			return response.Error(ctx, appErr.Status, appErr.Message, appErr.Code, appErr.Details)
+		}
+		return response.Error(
+			ctx,
+			constant.INTERNALSERVERERROR,
+			"Something went wrong",
+			"",
+			err.Error(),
+		)
+	}
+
+	return response.Success(
+		ctx,
+		constant.SUCCESS,
+		"If the email is registered, a new OTP was sent",
+		"",
+		nil,
+	)
+}
+
 // ------------------ Login ------------------
 
 type loginRequest struct {
@@ -147,23 +227,55 @@ func (c *UserAuthController) Login(ctx *fiber.Ctx) error {
 		)
 	}
 
-	accessToken, err := c.jwtManager.GenerateAccessToken(user.ID.String())
+	return c.completeLogin(ctx, user)
+}
+
+// completeLogin finishes a first-factor login (password or OIDC). Two-factor
+// users only get a challenge token here; the session starts in LoginMFA once
+// the code checks out.
+func (c *UserAuthController) completeLogin(ctx *fiber.Ctx, user *model.User) error {
+	mfaEnabled, err := c.mfaService.IsEnabled(ctx.UserContext(), user.ID)
 	if err != nil {
 		return response.Error(
 			ctx,
 			constant.INTERNALSERVERERROR,
-			"Failed to generate access token",
+			"Something went wrong",
 			"",
 			err.Error(),
 		)
 	}
 
-	refreshToken, err := c.jwtManager.GenerateRefreshToken(user.ID.String())
+	if mfaEnabled {
+		challenge, err := c.jwtManager.GenerateChallengeToken(user.ID.String(), mfaChallengeTTL)
+		if err != nil {
+			return response.Error(
+				ctx,
+				constant.INTERNALSERVERERROR,
+				"Failed to generate tokens",
+				"",
+				err.Error(),
+			)
+		}
+
+		return response.Success(
+			ctx,
+			constant.SUCCESS,
+			"Two-factor code required",
+			constant.MFA_REQUIRED,
+			fiber.Map{
+				"mfa_required":    true,
+				"challenge_token": challenge,
+				"expires_in":      int(mfaChallengeTTL.Seconds()),
+			},
+		)
+	}
+
+	tokens, err := c.sessionService.StartSession(ctx.UserContext(), user, deviceInfo(ctx), false)
 	if err != nil {
 		return response.Error(
 			ctx,
 			constant.INTERNALSERVERERROR,
-			"Failed to generate refresh token",
+			"Failed to generate tokens",
 			"",
 			err.Error(),
 		)
@@ -174,23 +286,21 @@ func (c *UserAuthController) Login(ctx *fiber.Ctx) error {
 		constant.SUCCESS,
 		"Login successful",
 		"",
-		fiber.Map{
-			"access_token":  accessToken,
-			"refresh_token": refreshToken,
-		},
+		tokens,
 	)
 }
 
-// ------------------ Refresh Token ------------------
+// ------------------ Login: Two-Factor Step ------------------
 
-type refreshRequest struct {
-	RefreshToken string `json:"refresh_token"`
+type loginMFARequest struct {
+	ChallengeToken string `json:"challenge_token"`
+	Code           string `json:"code"`          // from the authenticator app
+	RecoveryCode   string `json:"recovery_code"` // instead of code
 }
 
-func (c *UserAuthController) RefreshToken(ctx *fiber.Ctx) error {
-	var req refreshRequest
+func (c *UserAuthController) LoginMFA(ctx *fiber.Ctx) error {
+	var req loginMFARequest
 	if err := ctx.BodyParser(&req); err != nil {
-		log.Println("RefreshToken BodyParser error:", err)
 		return response.Error(
 			ctx,
 			constant.BADREQUEST,
@@ -200,34 +310,57 @@ func (c *UserAuthController) RefreshToken(ctx *fiber.Ctx) error {
 		)
 	}
 
-	claims, err := c.jwtManager.ValidateRefreshToken(req.RefreshToken)
+	userID, err := c.jwtManager.ValidateChallengeToken(req.ChallengeToken)
 	if err != nil {
 		return response.Error(
 			ctx,
 			constant.UNAUTHORIZED,
-			"Invalid or expired refresh token",
-			"",
+			"Invalid or expired challenge, please log in again",
+			constant.TOKEN_INVALID,
 			nil,
 		)
 	}
 
-	userID, ok := claims["user_id"].(string)
-	if !ok || userID == "" {
+	if err := c.mfaService.VerifyLogin(ctx.UserContext(), userID, req.Code, req.RecoveryCode); err != nil {
+		if appErr, ok := err.(*apperror.AppError); ok {
+			return response.Error(ctx, appErr.Status, appErr.Message, appErr.Code, appErr.Details)
+		}
+		return response.Error(
+			ctx,
+			constant.INTERNALSERVERERROR,
+			"Something went wrong",
+			"",
+			err.Error(),
+		)
+	}
+
+	// The account may have changed since the password step
+	user, err := c.authService.GetByID(userID)
+	if err != nil {
 		return response.Error(
 			ctx,
 			constant.UNAUTHORIZED,
-			"Invalid token claims",
-			"",
+			"Invalid or expired challenge, please log in again",
+			constant.TOKEN_INVALID,
+			nil,
+		)
+	}
+	if user.IsBlocked {
+		return response.Error(
+			ctx,
+			constant.FORBIDDEN,
+			"Account is blocked",
+			constant.USER_BLOCKED,
 			nil,
 		)
 	}
 
-	accessToken, err := c.jwtManager.GenerateAccessToken(userID)
+	tokens, err := c.sessionService.StartSession(ctx.UserContext(), user, deviceInfo(ctx), true)
 	if err != nil {
 		return response.Error(
 			ctx,
 			constant.INTERNALSERVERERROR,
-			"Failed to generate access token",
+			"Failed to generate tokens",
 			"",
 			err.Error(),
 		)
@@ -236,35 +369,32 @@ func (c *UserAuthController) RefreshToken(ctx *fiber.Ctx) error {
 	return response.Success(
 		ctx,
 		constant.SUCCESS,
-		"Access token refreshed",
+		"Login successful",
 		"",
-		fiber.Map{
-			"access_token": accessToken,
-		},
+		tokens,
 	)
 }
 
-type forgotPasswordRequest struct {
-	Email string `json:"email"`
-}
+// ------------------ Login: OpenID Connect ------------------
 
-func (c *UserAuthController) ForgotPassword(ctx *fiber.Ctx) error {
-	var req forgotPasswordRequest
-	if err := ctx.BodyParser(&req); err != nil {
-		return response.Error(
-			ctx,
-			constant.BADREQUEST,
-			"Invalid request body",
-			"",
-			nil,
-		)
-	}
+func (c *UserAuthController) OIDCProviders(ctx *fiber.Ctx) error {
+	return response.Success(
+		ctx,
+		constant.SUCCESS,
+		"Sign-in providers fetched",
+		"",
+		fiber.Map{"providers": c.oidcService.Providers()},
+	)
+}
 
-	if err := c.authService.ForgotPassword(req.Email); err != nil {
+// OIDCStart returns the provider's sign-in URL, or redirects straight to it
+// with ?redirect=true
+func (c *UserAuthController) OIDCStart(ctx *fiber.Ctx) error {
+	authURL, err := c.oidcService.StartLogin(ctx.UserContext(), ctx.Params("provider"))
+	if err != nil {
 		if appErr, ok := err.(*apperror.AppError); ok {
 			return response.Error(ctx, appErr.Status, appErr.Message, appErr.Code, nil)
 		}
-
 		return response.Error(
 			ctx,
 			constant.INTERNALSERVERERROR,
@@ -274,53 +404,47 @@ func (c *UserAuthController) ForgotPassword(ctx *fiber.Ctx) error {
 		)
 	}
 
+	if ctx.QueryBool("redirect") {
+		return ctx.Redirect(authURL, fiber.StatusFound)
+	}
+
 	return response.Success(
 		ctx,
 		constant.SUCCESS,
-		"If email exists, OTP sent to the inbox",
+		"Continue sign-in with the provider",
 		"",
-		nil,
+		fiber.Map{"authorization_url": authURL},
 	)
 }
 
-type resetPasswordRequest struct {
-	Email       string `json:"email"`
-	OTP         string `json:"otp"`
-	NewPassword string `json:"new_password"`
-}
-
-func (c *UserAuthController) ResetPassword(ctx *fiber.Ctx) error {
-	var req resetPasswordRequest
-
-	if err := ctx.BodyParser(&req); err != nil {
+// OIDCCallback is the redirect URL registered with the provider
+func (c *UserAuthController) OIDCCallback(ctx *fiber.Ctx) error {
+	if providerErr := ctx.Query("error"); providerErr != "" {
 		return response.Error(
 			ctx,
 			constant.BADREQUEST,
-			"Invalid request body",
-			"",
-			nil,
+			"Sign-in with provider was cancelled or failed",
+			constant.OIDC_FAILED,
+			fiber.Map{"error": providerErr, "description": ctx.Query("error_description")},
 		)
 	}
 
-	if req.Email == "" || req.OTP == "" || req.NewPassword == "" {
+	code, state := ctx.Query("code"), ctx.Query("state")
+	if code == "" || state == "" {
 		return response.Error(
 			ctx,
 			constant.BADREQUEST,
-			"All fields are required",
-			"",
+			"code and state are required",
+			constant.OIDC_FAILED,
 			nil,
 		)
 	}
 
-	if err := c.authService.ResetPassword(
-		req.Email,
-		req.OTP,
-		req.NewPassword,
-	); err != nil {
+	user, err := c.oidcService.CompleteLogin(ctx.UserContext(), ctx.Params("provider"), code, state)
+	if err != nil {
 		if appErr, ok := err.(*apperror.AppError); ok {
 			return response.Error(ctx, appErr.Status, appErr.Message, appErr.Code, nil)
 		}
-
 		return response.Error(
 			ctx,
 			constant.INTERNALSERVERERROR,
@@ -330,92 +454,92 @@ func (c *UserAuthController) ResetPassword(ctx *fiber.Ctx) error {
 		)
 	}
 
-	return response.Success(
-		ctx,
-		constant.SUCCESS,
-		"Password reset successfully",
-		"",
-		nil,
-	)
+	return c.completeLogin(ctx, user)
 }
 
-func (c *UserAuthController) GetProfile(ctx *fiber.Ctx) error {
-	// Get user_id from middleware
-	userID := ctx.Locals("user_id")
-	if userID == nil {
+// ------------------ Refresh Token ------------------
+
+type refreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+func (c *UserAuthController) RefreshToken(ctx *fiber.Ctx) error {
+	var req refreshRequest
+	if err := ctx.BodyParser(&req); err != nil {
+		log.Println("RefreshToken BodyParser error:", err)
 		return response.Error(
 			ctx,
-			constant.UNAUTHORIZED,
-			"Unauthorized",
+			constant.BADREQUEST,
+			"Invalid request payload",
 			"",
 			nil,
 		)
 	}
 
-	// Call service to fetch user
-	user, err := c.authService.GetProfile(userID.(string))
+	// The old refresh token is spent; clients must store the new one
+	tokens, err := c.sessionService.Rotate(ctx.UserContext(), req.RefreshToken, deviceInfo(ctx))
 	if err != nil {
 		if appErr, ok := err.(*apperror.AppError); ok {
 			return response.Error(ctx, appErr.Status, appErr.Message, appErr.Code, nil)
 		}
-
 		return response.Error(
 			ctx,
-			constant.INTERNALSERVERERROR,
-			"Something went wrong",
+			constant.UNAUTHORIZED,
+			"Invalid or expired refresh token",
 			"",
-			err.Error(),
+			nil,
 		)
 	}
 
 	return response.Success(
 		ctx,
 		constant.SUCCESS,
-		"Profile fetched successfully",
+		"Access token refreshed",
 		"",
-		user,
+		tokens,
 	)
 }
 
-type updateProfileRequest struct {
-	Name string `json:"name"` // only name is allowed
-}
+// ------------------ Logout ------------------
 
-func (c *UserAuthController) UpdateProfile(ctx *fiber.Ctx) error {
-	var req updateProfileRequest
-	if err := ctx.BodyParser(&req); err != nil {
+func (c *UserAuthController) Logout(ctx *fiber.Ctx) error {
+	var req refreshRequest
+	if err := ctx.BodyParser(&req); err != nil || req.RefreshToken == "" {
 		return response.Error(
 			ctx,
 			constant.BADREQUEST,
-			"Invalid request body",
+			"refresh_token is required",
 			"",
 			nil,
 		)
 	}
 
-	if req.Name == "" {
+	if err := c.sessionService.Logout(ctx.UserContext(), req.RefreshToken); err != nil {
+		if appErr, ok := err.(*apperror.AppError); ok {
+			return response.Error(ctx, appErr.Status, appErr.Message, appErr.Code, nil)
+		}
 		return response.Error(
 			ctx,
-			constant.BADREQUEST,
-			"Name is required",
+			constant.INTERNALSERVERERROR,
+			"Something went wrong",
 			"",
-			nil,
+			err.Error(),
 		)
 	}
 
-	userID := ctx.Locals("user_id")
-	if userID == nil {
-		return response.Error(
-			ctx,
-			constant.UNAUTHORIZED,
-			"Unauthorized",
-			"",
-			nil,
-		)
-	}
+	return response.Success(
+		ctx,
+		constant.SUCCESS,
+		"Logged out",
+		"",
+		nil,
+	)
+}
 
-	user, err := c.authService.UpdateProfile(userID.(string), req.Name)
-	if err != nil {
+func (c *UserAuthController) LogoutAll(ctx *fiber.Ctx) error {
+	userID, _ := ctx.Locals("user_id").(string)
+
+	if err := c.sessionService.LogoutAll(ctx.UserContext(), userID); err != nil {
 		if appErr, ok := err.(*apperror.AppError); ok {
 			return response.Error(ctx, appErr.Status, appErr.Message, appErr.Code, nil)
 		}
@@ -431,60 +555,19 @@ func (c *UserAuthController) UpdateProfile(ctx *fiber.Ctx) error {
 	return response.Success(
 		ctx,
 		constant.SUCCESS,
-		"Profile updated successfully",
+		"Logged out of all sessions",
 		"",
-		user,
+		nil,
 	)
 }
 
-func (c *UserAuthController) ToggleUserBlock(ctx *fiber.Ctx) error {
-	// 1️⃣ Get current user ID from JWT
-	currentUserID := ctx.Locals("user_id")
-	if currentUserID == nil {
-		return response.Error(
-			ctx,
-			constant.UNAUTHORIZED,
-			"Unauthorized",
-			"",
-			nil,
-		)
-	}
-
-	// 2️⃣ Check if current user is ADMIN
-	currentUser, err := c.authService.GetByID(currentUserID.(string))
-	if err != nil {
-		return response.Error(
-			ctx,
-			constant.UNAUTHORIZED,
-			"Unauthorized",
-			"",
-			nil,
-		)
-	}
-	if currentUser.Role != "admin" {
-		return response.Error(
-			ctx,
-			constant.FORBIDDEN,
-			"Admin access required",
-			"",
-			nil,
-		)
-	}
+// ------------------ Sessions ------------------
 
-	// 3️⃣ Get target user ID from URL
-	targetID := ctx.Params("id")
-	if targetID == "" {
-		return response.Error(
-			ctx,
-			constant.BADREQUEST,
-			"User ID required",
-			"",
-			nil,
-		)
-	}
+func (c *UserAuthController) GetSessions(ctx *fiber.Ctx) error {
+	userID, _ := ctx.Locals("user_id").(string)
+	sessionID, _ := ctx.Locals("session_id").(string)
 
-	// 4️⃣ Call service to toggle is_blocked
-	updatedUser, err := c.authService.ToggleUserBlock(targetID)
+	sessions, err := c.sessionService.GetSessions(ctx.UserContext(), userID, sessionID)
 	if err != nil {
 		if appErr, ok := err.(*apperror.AppError); ok {
 			return response.Error(ctx, appErr.Status, appErr.Message, appErr.Code, nil)
@@ -492,8 +575,8 @@ func (c *UserAuthController) ToggleUserBlock(ctx *fiber.Ctx) error {
 		return response.Error(
 			ctx,
 			constant.INTERNALSERVERERROR,
-			"wdhb",
 			"Something went wrong",
+			"",
 			err.Error(),
 		)
 	}
@@ -501,8 +584,623 @@ func (c *UserAuthController) ToggleUserBlock(ctx *fiber.Ctx) error {
 	return response.Success(
 		ctx,
 		constant.SUCCESS,
-		"User block status toggled",
+		"Sessions fetched successfully",
 		"",
-		updatedUser,
+		sessions,
+	)
+}
+
+func (c *UserAuthController) RevokeSession(ctx *fiber.Ctx) error {
+	userID, _ := ctx.Locals("user_id").(string)
+
+	if err := c.sessionService.RevokeSession(ctx.UserContext(), userID, ctx.Params("id")); err != nil {
+		if appErr, ok := err.(*apperror.AppError); ok {
+			return response.Error(ctx, appErr.Status, appErr.Message, appErr.Code, nil)
+		}
+		return response.Error(
+			ctx,
+			constant.INTERNALSERVERERROR,
+			"Something went wrong",
+			"",
+			err.Error(),
+		)
+	}
+
+	return response.Success(
+		ctx,
+		constant.SUCCESS,
+		"Session revoked",
+		"",
+		nil,
+	)
+}
+
+type forgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+func (c *UserAuthController) ForgotPassword(ctx *fiber.Ctx) error {
+	var req forgotPasswordRequest
+	if err := ctx.BodyParser(&req); err != nil {
+		return response.Error(
+			ctx,
+			constant.BADREQUEST,
+			"Invalid request body",
+			"",
+			nil,
+		)
+	}
+
+	if err := c.authService.ForgotPassword(req.Email); err != nil {
+		if appErr, ok := err.(*apperror.AppError); ok {
+			return response.Error(ctx, appErr.Status, appErr.Message, appErr.Code, nil)
+		}
+
+		return response.Error(
+			ctx,
+			constant.INTERNALSERVERERROR,
+			"Something went wrong",
+			"",
+			err.Error(),
+		)
+	}
+
+	return response.Success(
+		ctx,
+		constant.SUCCESS,
+		"If email exists, OTP sent to the inbox",
+		"",
+		nil,
+	)
+}
+
+type resetPasswordRequest struct {
+	Email       string `json:"email"`
+	OTP         string `json:"otp"`
+	NewPassword string `json:"new_password"`
+}
+
+func (c *UserAuthController) ResetPassword(ctx *fiber.Ctx) error {
+	var req resetPasswordRequest
+
+	if err := ctx.BodyParser(&req); err != nil {
+		return response.Error(
+			ctx,
+			constant.BADREQUEST,
+			"Invalid request body",
+			"",
+			nil,
+		)
+	}
+
+	if req.Email == "" || req.OTP == "" || req.NewPassword == "" {
+		return response.Error(
+			ctx,
+			constant.BADREQUEST,
+			"All fields are required",
+			"",
+			nil,
+		)
+	}
+
+	if err := c.authService.ResetPassword(
+		req.Email,
+		req.OTP,
+		req.NewPassword,
+	); err != nil {
+		if appErr, ok := err.(*apperror.AppError); ok {
+			return response.Error(ctx, appErr.Status, appErr.Message, appErr.Code, appErr.Details)
+		}
+
+		return response.Error(
+			ctx,
+			constant.INTERNALSERVERERROR,
+			"Something went wrong",
+			"",
+			err.Error(),
+		)
+	}
+
+	return response.Success(
+		ctx,
+		constant.SUCCESS,
+		"Password reset successfully",
+		"",
+		nil,
+	)
+}
+
+func (c *UserAuthController) GetProfile(ctx *fiber.Ctx) error {
+	// Get user_id from middleware
+	userID := ctx.Locals("user_id")
+	if userID == nil {
+		return response.Error(
+			ctx,
+			constant.UNAUTHORIZED,
+			"Unauthorized",
+			"",
+			nil,
+		)
+	}
+
+	// Call service to fetch user
+	user, err := c.authService.GetProfile(userID.(string))
+	if err != nil {
+		if appErr, ok := err.(*apperror.AppError); ok {
+			return response.Error(ctx, appErr.Status, appErr.Message, appErr.Code, nil)
+		}
+
+		return response.Error(
+			ctx,
+			constant.INTERNALSERVERERROR,
+			"Something went wrong",
+			"",
+			err.Error(),
+		)
+	}
+
+	return response.Success(
+		ctx,
+		constant.SUCCESS,
+		"Profile fetched successfully",
+		"",
+		user,
+	)
+}
+
+type updateProfileRequest struct {
+	Name string `json:"name"` // only name is allowed
+}
+
+func (c *UserAuthController) UpdateProfile(ctx *fiber.Ctx) error {
+	var req updateProfileRequest
+	if err := ctx.BodyParser(&req); err != nil {
+		return response.Error(
+			ctx,
+			constant.BADREQUEST,
+			"Invalid request body",
+			"",
+			nil,
+		)
+	}
+
+	if req.Name == "" {
+		return response.Error(
+			ctx,
+			constant.BADREQUEST,
+			"Name is required",
+			"",
+			nil,
+		)
+	}
+
+	userID := ctx.Locals("user_id")
+	if userID == nil {
+		return response.Error(
+			ctx,
+			constant.UNAUTHORIZED,
+			"Unauthorized",
+			"",
+			nil,
+		)
+	}
+
+	user, err := c.authService.UpdateProfile(userID.(string), req.Name)
+	if err != nil {
+		if appErr, ok := err.(*apperror.AppError); ok {
+			return response.Error(ctx, appErr.Status, appErr.Message, appErr.Code, nil)
+		}
+		return response.Error(
+			ctx,
+			constant.INTERNALSERVERERROR,
+			"Something went wrong",
+			"",
+			err.Error(),
+		)
+	}
+
+	return response.Success(
+		ctx,
+		constant.SUCCESS,
+		"Profile updated successfully",
+		"",
+		user,
+	)
+}
+
+// ------------------ Password & Email Change ------------------
+
+type changePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+// ChangePassword logs out every other session and hands the caller new
+// tokens for theirs
+func (c *UserAuthController) ChangePassword(ctx *fiber.Ctx) error {
+	userID, _ := ctx.Locals("user_id").(string)
+	sessionID, _ := ctx.Locals("session_id").(string)
+
+	var req changePasswordRequest
+	if err := ctx.BodyParser(&req); err != nil {
+		return response.Error(
+			ctx,
+			constant.BADREQUEST,
+			"Invalid request body",
+			"",
+			nil,
+		)
+	}
+
+	if req.CurrentPassword == "" || req.NewPassword == "" {
+		return response.Error(
+			ctx,
+			constant.BADREQUEST,
+			"All fields are required",
+			"",
+			nil,
+		)
+	}
+
+	if err := c.authService.ChangePassword(ctx.UserContext(), userID, sessionID, req.CurrentPassword, req.NewPassword); err != nil {
+		if appErr, ok := err.(*apperror.AppError); ok {
+			return response.Error(ctx, appErr.Status, appErr.Message, appErr.Code, nil)
+		}
+		return response.Error(
+			ctx,
+			constant.INTERNALSERVERERROR,
+			"Something went wrong",
+			"",
+			err.Error(),
+		)
+	}
+
+	// Tokens without a session can't be carried over
+	if sessionID == "" {
+		return response.Success(
+			ctx,
+			constant.SUCCESS,
+			"Password changed, please log in again",
+			"",
+			nil,
+		)
+	}
+
+	tokens, err := c.sessionService.Reissue(ctx.UserContext(), userID, sessionID, deviceInfo(ctx))
+	if err != nil {
+		return response.Success(
+			ctx,
+			constant.SUCCESS,
+			"Password changed, please log in again",
+			"",
+			nil,
+		)
+	}
+
+	return response.Success(
+		ctx,
+		constant.SUCCESS,
+		"Password changed successfully",
+		"",
+		tokens,
+	)
+}
+
+type changeEmailRequest struct {
+	NewEmail string `json:"new_email"`
+	Password string `json:"password"`
+}
+
+func (c *UserAuthController) RequestEmailChange(ctx *fiber.Ctx) error {
+	userID, _ := ctx.Locals("user_id").(string)
+
+	var req changeEmailRequest
+	if err := ctx.BodyParser(&req); err != nil {
+		return response.Error(
+			ctx,
+			constant.BADREQUEST,
+			"Invalid request body",
+			"",
+			nil,
+		)
+	}
+
+	if req.NewEmail == "" || req.Password == "" {
+		return response.Error(
+			ctx,
+			constant.BADREQUEST,
+			"All fields are required",
+			"",
+			nil,
+		)
+	}
+
+	if err := c.authService.RequestEmailChange(ctx.UserContext(), userID, req.Password, req.NewEmail); err != nil {
+		if appErr, ok := err.(*apperror.AppError); ok {
+			return response.Error(ctx, appErr.Status, appErr.Message, appErr.Code, appErr.Details)
+		}
+		return response.Error(
+			ctx,
+			constant.INTERNALSERVERERROR,
+			"Something went wrong",
+			"",
+			err.Error(),
+		)
+	}
+
+	return response.Success(
+		ctx,
+		constant.SUCCESS,
+		"OTP sent to the new email address",
+		"",
+		nil,
+	)
+}
+
+type confirmEmailRequest struct {
+	OTP string `json:"otp"`
+}
+
+func (c *UserAuthController) ConfirmEmailChange(ctx *fiber.Ctx) error {
+	userID, _ := ctx.Locals("user_id").(string)
+
+	var req confirmEmailRequest
+	if err := ctx.BodyParser(&req); err != nil {
+		return response.Error(
+			ctx,
+			constant.BADREQUEST,
+			"Invalid request body",
+			"",
+			nil,
+		)
+	}
+
+	user, err := c.authService.ConfirmEmailChange(ctx.UserContext(), userID, req.OTP)
+	if err != nil {
+		if appErr, ok := err.(*apperror.AppError); ok {
+			return response.Error(ctx, appErr.Status, appErr.Message, appErr.Code, appErr.Details)
+		}
+		return response.Error(
+			ctx,
+			constant.INTERNALSERVERERROR,
+			"Something went wrong",
+			"",
+			err.Error(),
+		)
+	}
+
+	return response.Success(
+		ctx,
+		constant.SUCCESS,
+		"Email changed successfully",
+		"",
+		user,
+	)
+}
+
+func (c *UserAuthController) ToggleUserBlock(ctx *fiber.Ctx) error {
+	// 1️⃣ Get current user ID from JWT
+	currentUserID := ctx.Locals("user_id")
+	if currentUserID == nil {
+		return response.Error(
+			ctx,
+			constant.UNAUTHORIZED,
+			"Unauthorized",
+			"",
+			nil,
+		)
+	}
+
+	// 2️⃣ Get target user ID from URL (users:block checked by the router)
+	targetID := ctx.Params("id")
+	if targetID == "" {
+		return response.Error(
+			ctx,
+			constant.BADREQUEST,
+			"User ID required",
+			"",
+			nil,
+		)
+	}
+
+	// 3️⃣ Call service to toggle is_blocked
+	updatedUser, err := c.authService.ToggleUserBlock(ctx.UserContext(), targetID)
+	if err != nil {
+		if appErr, ok := err.(*apperror.AppError); ok {
+			return response.Error(ctx, appErr.Status, appErr.Message, appErr.Code, nil)
+		}
+		return response.Error(
+			ctx,
+			constant.INTERNALSERVERERROR,
+			"wdhb",
+			"Something went wrong",
+			err.Error(),
+		)
+	}
+
+	return response.Success(
+		ctx,
+		constant.SUCCESS,
+		"User block status toggled",
+		"",
+		updatedUser,
+	)
+}
+
+// ------------------ Two-Factor Management ------------------
+
+type mfaCodeRequest struct {
+	Code string `json:"code"`
+}
+
+type disableMFARequest struct {
+	Password string `json:"password"`
+	Code     string `json:"code"` // app or recovery code
+}
+
+// GET /user/2fa
+func (c *UserAuthController) GetMFAStatus(ctx *fiber.Ctx) error {
+	userID, _ := ctx.Locals("user_id").(string)
+
+	status, err := c.mfaService.GetStatus(ctx.UserContext(), userID)
+	if err != nil {
+		if appErr, ok := err.(*apperror.AppError); ok {
+			return response.Error(ctx, appErr.Status, appErr.Message, appErr.Code, nil)
+		}
+		return response.Error(
+			ctx,
+			constant.INTERNALSERVERERROR,
+			"Something went wrong",
+			"",
+			err.Error(),
+		)
+	}
+
+	return response.Success(
+		ctx,
+		constant.SUCCESS,
+		"Two-factor status fetched",
+		"",
+		status,
+	)
+}
+
+// POST /user/2fa/setup
+func (c *UserAuthController) SetupMFA(ctx *fiber.Ctx) error {
+	userID, _ := ctx.Locals("user_id").(string)
+
+	setup, err := c.mfaService.Setup(ctx.UserContext(), userID)
+	if err != nil {
+		if appErr, ok := err.(*apperror.AppError); ok {
+			return response.Error(ctx, appErr.Status, appErr.Message, appErr.Code, nil)
+		}
+		return response.Error(
+			ctx,
+			constant.INTERNALSERVERERROR,
+			"Something went wrong",
+			"",
+			err.Error(),
+		)
+	}
+
+	return response.Success(
+		ctx,
+		constant.SUCCESS,
+		"Scan the QR code, then confirm with a code from the app",
+		"",
+		setup,
+	)
+}
+
+// POST /user/2fa/enable
+func (c *UserAuthController) EnableMFA(ctx *fiber.Ctx) error {
+	var req mfaCodeRequest
+	if err := ctx.BodyParser(&req); err != nil {
+		return response.Error(
+			ctx,
+			constant.BADREQUEST,
+			"Invalid request body",
+			"",
+			nil,
+		)
+	}
+
+	userID, _ := ctx.Locals("user_id").(string)
+
+	codes, err := c.mfaService.Enable(ctx.UserContext(), userID, req.Code)
+	if err != nil {
+		if appErr, ok := err.(*apperror.AppError); ok {
+			return response.Error(ctx, appErr.Status, appErr.Message, appErr.Code, appErr.Details)
+		}
+		return response.Error(
+			ctx,
+			constant.INTERNALSERVERERROR,
+			"Something went wrong",
+			"",
+			err.Error(),
+		)
+	}
+
+	return response.Success(
+		ctx,
+		constant.SUCCESS,
+		"Two-factor authentication enabled. Store the recovery codes safely, they won't be shown again",
+		"",
+		fiber.Map{"recovery_codes": codes},
+	)
+}
+
+// POST /user/2fa/disable
+func (c *UserAuthController) DisableMFA(ctx *fiber.Ctx) error {
+	var req disableMFARequest
+	if err := ctx.BodyParser(&req); err != nil {
+		return response.Error(
+			ctx,
+			constant.BADREQUEST,
+			"Invalid request body",
+			"",
+			nil,
+		)
+	}
+
+	userID, _ := ctx.Locals("user_id").(string)
+
+	if err := c.mfaService.Disable(ctx.UserContext(), userID, req.Password, req.Code); err != nil {
+		if appErr, ok := err.(*apperror.AppError); ok {
+			return response.Error(ctx, appErr.Status, appErr.Message, appErr.Code, appErr.Details)
+		}
+		return response.Error(
+			ctx,
+			constant.INTERNALSERVERERROR,
+			"Something went wrong",
+			"",
+			err.Error(),
+		)
+	}
+
+	return response.Success(
+		ctx,
+		constant.SUCCESS,
+		"Two-factor authentication disabled",
+		"",
+		nil,
+	)
+}
+
+// POST /user/2fa/recovery-codes
+func (c *UserAuthController) RegenerateRecoveryCodes(ctx *fiber.Ctx) error {
+	var req mfaCodeRequest
+	if err := ctx.BodyParser(&req); err != nil {
+		return response.Error(
+			ctx,
+			constant.BADREQUEST,
+			"Invalid request body",
+			"",
+			nil,
+		)
+	}
+
+	userID, _ := ctx.Locals("user_id").(string)
+
+	codes, err := c.mfaService.RegenerateRecoveryCodes(ctx.UserContext(), userID, req.Code)
+	if err != nil {
+		if appErr, ok := err.(*apperror.AppError); ok {
+			return response.Error(ctx, appErr.Status, appErr.Message, appErr.Code, appErr.Details)
+		}
+		return response.Error(
+			ctx,
+			constant.INTERNALSERVERERROR,
+			"Something went wrong",
+			"",
+			err.Error(),
+		)
+	}
+
+	return response.Success(
+		ctx,
+		constant.SUCCESS,
+		"New recovery codes generated, the old ones no longer work",
+		"",
+		fiber.Map{"recovery_codes": codes},
 	)
 }
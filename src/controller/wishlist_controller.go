@@ -3,6 +3,7 @@ package controller
 import (
 	"vestra-ecommerce/src/services"
 	constant "vestra-ecommerce/utils/constants"
+	"vestra-ecommerce/utils/pagination"
 	"vestra-ecommerce/utils/response"
 	"vestra-ecommerce/utils/utils/apperror"
 
@@ -82,11 +83,16 @@ func (wc *WishlistController) AddToWishlist(c *fiber.Ctx) error {
    GET WISHLIST
    ======================= */
 
+// Pages take ?limit, cursor and sort (created_at, price, name; "-" prefix
+// for descending)
 func (wc *WishlistController) GetWishlist(c *fiber.Ctx) error {
 	userID := c.Locals("user_id").(string)
 
-	items, err := wc.service.GetWishlist(userID)
+	items, meta, err := wc.service.GetWishlist(userID, pagination.FromQuery(c, pagination.DefaultLimit))
 	if err != nil {
+		if appErr, ok := err.(*apperror.AppError); ok {
+			return response.Error(c, appErr.Status, appErr.Message, appErr.Code, nil)
+		}
 		return response.Error(
 			c,
 			constant.INTERNALSERVERERROR,
@@ -96,12 +102,13 @@ func (wc *WishlistController) GetWishlist(c *fiber.Ctx) error {
 		)
 	}
 
-	return response.Success(
+	return response.SuccessWithMeta(
 		c,
 		constant.SUCCESS,
 		"Wishlist fetched successfully",
 		"",
 		items,
+		meta,
 	)
 }
 
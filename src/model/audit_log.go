@@ -0,0 +1,40 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// AuditLog records one administrative change: who made it, to what, and
+// which fields went from what to what. Rows are only ever inserted; the
+// database refuses updates and deletes (see migration/audit.go).
+type AuditLog struct {
+	ID         uuid.UUID       `gorm:"type:uuid;primaryKey" json:"id"`
+	ActorID    *uuid.UUID      `gorm:"type:uuid;index" json:"actor_id"` // nil for system changes
+	ActorRole  string          `json:"actor_role"`                      // admin, system
+	Action     string          `gorm:"not null;index" json:"action"`    // e.g. product.update
+	EntityType string          `gorm:"not null;index:idx_audit_entity" json:"entity_type"`
+	EntityID   string          `gorm:"not null;index:idx_audit_entity" json:"entity_id"`
+	Before     json.RawMessage `gorm:"type:jsonb" json:"before,omitempty"`
+	After      json.RawMessage `gorm:"type:jsonb" json:"after,omitempty"`
+	SessionID  string          `json:"session_id,omitempty"`
+	IPAddress  string          `gorm:"size:64" json:"ip_address,omitempty"`
+	UserAgent  string          `json:"user_agent,omitempty"`
+	Method     string          `gorm:"size:10" json:"method,omitempty"`
+	Path       string          `json:"path,omitempty"`
+	CreatedAt  time.Time       `gorm:"index" json:"created_at"`
+}
+
+func (AuditLog) TableName() string {
+	return "audit_log"
+}
+
+func (a *AuditLog) BeforeCreate(tx *gorm.DB) (err error) {
+	if a.ID == uuid.Nil {
+		a.ID = uuid.New()
+	}
+	return
+}
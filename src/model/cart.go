@@ -3,6 +3,8 @@ package model
 import (
 	"time"
 
+	"vestra-ecommerce/utils/money"
+
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
@@ -13,6 +15,9 @@ type Cart struct {
 	Items     []CartItem `gorm:"foreignKey:CartID;constraint:OnDelete:CASCADE"`
 	CreatedAt time.Time
 	UpdatedAt time.Time
+
+	// Total is computed from the items on read
+	Total money.Money `gorm:"-"`
 }
 
 func (c *Cart) BeforeCreate(tx *gorm.DB) (err error) {
@@ -3,6 +3,8 @@ package model
 import (
 	"time"
 
+	"vestra-ecommerce/utils/money"
+
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
@@ -16,6 +18,9 @@ type CartItem struct {
 	CreatedAt time.Time
 	UpdatedAt time.Time
 	Product   Product `gorm:"foreignKey:ProductID"`
+
+	// LineTotal is Product.Price * Quantity, computed on read
+	LineTotal money.Money `gorm:"-"`
 }
 
 func (ci *CartItem) BeforeCreate(tx *gorm.DB) (err error) {
@@ -0,0 +1,29 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Category groups products (e.g. Jerseys > Retro). Categories nest to any
+// depth; filtering by one includes everything under it.
+type Category struct {
+	ID          uuid.UUID  `gorm:"type:uuid;primaryKey" json:"id"`
+	Name        string     `gorm:"size:100;not null" json:"name"`
+	Slug        string     `gorm:"size:120;uniqueIndex;not null" json:"slug"`
+	Description string     `json:"description"`
+	ParentID    *uuid.UUID `gorm:"type:uuid;index" json:"parent_id"`
+	Parent      *Category  `gorm:"foreignKey:ParentID;constraint:OnDelete:RESTRICT" json:"-"`
+	Children    []Category `gorm:"-" json:"children,omitempty"` // filled when listing the tree
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+func (c *Category) BeforeCreate(tx *gorm.DB) (err error) {
+	if c.ID == uuid.Nil {
+		c.ID = uuid.New()
+	}
+	return
+}
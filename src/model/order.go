@@ -3,6 +3,8 @@ package model
 import (
 	"time"
 
+	"vestra-ecommerce/utils/money"
+
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
@@ -10,10 +12,13 @@ import (
 type Order struct {
 	ID        uuid.UUID   `gorm:"type:uuid;primaryKey" json:"id"`
 	UserID    uuid.UUID   `gorm:"type:uuid" json:"user_id"`
-	Total     int         `json:"total"`
+	Total     money.Money `gorm:"embedded;embeddedPrefix:total_" json:"total"`
 	Status    string      `json:"status"`
 	Items     []OrderItem `gorm:"foreignKey:OrderID;constraint:OnDelete:CASCADE" json:"items"`
 	CreatedAt time.Time   `json:"CreatedAt"`
+
+	StatusHistory []OrderStatusHistory `gorm:"foreignKey:OrderID;constraint:OnDelete:CASCADE" json:"status_history,omitempty"`
+	Payments      []Payment            `gorm:"foreignKey:OrderID;constraint:OnDelete:RESTRICT" json:"payments,omitempty"`
 }
 
 func (o *Order) BeforeCreate(tx *gorm.DB) (err error) {
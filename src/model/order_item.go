@@ -1,18 +1,19 @@
 package model
 
 import (
+	"vestra-ecommerce/utils/money"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
 type OrderItem struct {
-	ID        uuid.UUID `gorm:"type:uuid;primaryKey" json:"id"`
-	OrderID   uuid.UUID `gorm:"type:uuid" json:"order_id"`
-	ProductID uuid.UUID `gorm:"type:uuid" json:"product_id"`
-	Size      string    `json:"size"`
-	Quantity  int       `json:"quantity"`
-	Price     int       `json:"price"`
+	ID        uuid.UUID   `gorm:"type:uuid;primaryKey" json:"id"`
+	OrderID   uuid.UUID   `gorm:"type:uuid" json:"order_id"`
+	ProductID uuid.UUID   `gorm:"type:uuid" json:"product_id"`
+	Size      string      `json:"size"`
+	Quantity  int         `json:"quantity"`
+	Price     money.Money `gorm:"embedded;embeddedPrefix:price_" json:"price"` // unit price at order time
 
 	// 🔹 This tells GORM the relation
 	Product Product `gorm:"foreignKey:ProductID" json:"product"`
@@ -0,0 +1,31 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// OrderStatusHistory records every status change of an order
+type OrderStatusHistory struct {
+	ID         uuid.UUID  `gorm:"type:uuid;primaryKey" json:"id"`
+	OrderID    uuid.UUID  `gorm:"type:uuid;not null;index" json:"order_id"`
+	FromStatus string     `json:"from_status"`
+	ToStatus   string     `gorm:"not null" json:"to_status"`
+	ChangedBy  *uuid.UUID `gorm:"type:uuid" json:"changed_by"` // nil for system changes
+	ActorRole  string     `json:"actor_role"`                  // user, admin, system
+	Reason     string     `json:"reason"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+func (OrderStatusHistory) TableName() string {
+	return "order_status_history"
+}
+
+func (h *OrderStatusHistory) BeforeCreate(tx *gorm.DB) (err error) {
+	if h.ID == uuid.Nil {
+		h.ID = uuid.New()
+	}
+	return
+}
@@ -0,0 +1,35 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// OTPCode is the current one-time code of a user for one purpose (signup,
+// password_reset). Each purpose has its own row, so flows don't overwrite
+// each other's codes; issuing a new code replaces the row's code.
+type OTPCode struct {
+	ID              uuid.UUID  `gorm:"type:uuid;primaryKey" json:"id"`
+	UserID          uuid.UUID  `gorm:"type:uuid;not null;uniqueIndex:idx_otp_user_purpose" json:"user_id"`
+	Purpose         string     `gorm:"size:32;not null;uniqueIndex:idx_otp_user_purpose" json:"purpose"`
+	CodeHash        string     `gorm:"not null" json:"-"`
+	ExpiresAt       time.Time  `gorm:"not null" json:"expires_at"`
+	ConsumedAt      *time.Time `json:"consumed_at"`
+	Attempts        int        `gorm:"not null;default:0" json:"attempts"` // failed guesses on the current code
+	LockedUntil     *time.Time `json:"locked_until"`
+	LastSentAt      time.Time  `json:"last_sent_at"`
+	SendCount       int        `gorm:"not null;default:0" json:"send_count"` // codes sent since SendWindowStart
+	SendWindowStart time.Time  `json:"send_window_start"`
+	User            User       `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+func (o *OTPCode) BeforeCreate(tx *gorm.DB) (err error) {
+	if o.ID == uuid.Nil {
+		o.ID = uuid.New()
+	}
+	return
+}
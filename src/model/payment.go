@@ -1,21 +1,36 @@
 package model
 
-import "time"
+import (
+	"time"
+
+	"vestra-ecommerce/utils/money"
+
+	"github.com/google/uuid"
+)
 
 type Payment struct {
-	ID            string    `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
-	UserID        string    `json:"user_id"`
-	OrderID       string    `json:"order_id"`
-	Amount        float64   `json:"amount"`
-	PaymentMethod string    `json:"payment_method"`
-	Status        string    `json:"status"`         // pending, completed, failed
-	TransactionID string    `json:"transaction_id"` // <--- add this
-	CreatedAt     time.Time `json:"created_at"`
-	UpdatedAt     time.Time `json:"updated_at"`
+	ID            string      `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	UserID        uuid.UUID   `json:"user_id" gorm:"type:uuid;index"`
+	OrderID       uuid.UUID   `json:"order_id" gorm:"type:uuid;index"`
+	Amount        money.Money `json:"amount" gorm:"embedded;embeddedPrefix:amount_"` // always the order total, set server-side
+	PaymentMethod string      `json:"payment_method"`
+	Status        string      `json:"status"`         // PENDING, PAID, FAILED, CANCELLED, REFUND_PENDING, PARTIALLY_REFUNDED, REFUNDED
+	TransactionID string      `json:"transaction_id"` // provider payment ID once verified
+
+	// Provider side of the payment (see utils/gateway)
+	Provider         string `json:"provider"`
+	ProviderIntentID string `json:"provider_intent_id" gorm:"index"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	Refunds []Refund `gorm:"foreignKey:PaymentID;constraint:OnDelete:RESTRICT" json:"refunds,omitempty"`
+
+	// Checkout carries the provider's client data on creation only
+	Checkout map[string]string `json:"checkout,omitempty" gorm:"-"`
 }
 
 type PaymentRequest struct {
-	OrderID       string  `json:"order_id"`
-	Amount        float64 `json:"amount"`
-	PaymentMethod string  `json:"payment_method"` // e.g., card, upi, paypal
+	OrderID       string `json:"order_id"`
+	PaymentMethod string `json:"payment_method"` // e.g., card, upi, paypal
 }
@@ -0,0 +1,32 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// PaymentWebhookEvent stores every verified provider notification as
+// received, so duplicates can be dropped and events replayed later.
+type PaymentWebhookEvent struct {
+	ID          uuid.UUID  `gorm:"type:uuid;primaryKey" json:"id"`
+	Provider    string     `gorm:"not null;uniqueIndex:idx_webhook_provider_event" json:"provider"`
+	EventID     string     `gorm:"not null;uniqueIndex:idx_webhook_provider_event" json:"event_id"`
+	EventType   string     `json:"event_type"`
+	Payload     string     `gorm:"type:text" json:"payload"`
+	Status      string     `gorm:"index" json:"status"` // RECEIVED, PROCESSED, IGNORED, FAILED
+	Error       string     `json:"error,omitempty"`
+	PaymentID   string     `json:"payment_id,omitempty"`
+	Attempts    int        `json:"attempts"`
+	ProcessedAt *time.Time `json:"processed_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+func (e *PaymentWebhookEvent) BeforeCreate(tx *gorm.DB) (err error) {
+	if e.ID == uuid.Nil {
+		e.ID = uuid.New()
+	}
+	return
+}
@@ -3,24 +3,32 @@ package model
 import (
 	"time"
 
+	"vestra-ecommerce/utils/money"
+
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
 type Product struct {
-	ID           uuid.UUID     `gorm:"type:uuid;primaryKey" json:"id"`
-	Name         string        `json:"name"`
-	Price        int           `json:"price"`
-	ImageURL     string        `json:"image_url"`
-	League       string        `json:"league"`
-	KitType      string        `json:"kit_type"`
-	Year         int           `json:"year"`
-	IsTopSelling bool          `json:"is_top_selling"`
-	IsActive     bool          `gorm:"default:true" json:"is_active"`
+	ID           uuid.UUID   `gorm:"type:uuid;primaryKey" json:"id"`
+	Name         string      `json:"name"`
+	Description  string      `json:"description"`
+	Price        money.Money `gorm:"embedded;embeddedPrefix:price_" json:"price"`
+	ImageURL     string      `json:"image_url"` // the first gallery image, if any
+	CategoryID   *uuid.UUID  `gorm:"type:uuid;index" json:"category_id"`
+	Category     *Category   `gorm:"constraint:OnDelete:SET NULL" json:"category,omitempty"`
+	TeamID       *uuid.UUID  `gorm:"type:uuid;index" json:"team_id"`
+	Team         *Team       `gorm:"constraint:OnDelete:SET NULL" json:"team,omitempty"`
+	League       string      `json:"league"` // the team's league name, kept for older clients
+	KitType      string      `json:"kit_type"`
+	Year         int         `json:"year"`
+	IsTopSelling bool        `json:"is_top_selling"`
+	IsActive     bool        `gorm:"default:true" json:"is_active"`
 	CreatedAt    time.Time
 	UpdatedAt    time.Time
 	DeletedAt    gorm.DeletedAt `gorm:"index" json:"-"` // <-- soft delete
 	Sizes        []ProductSize  `gorm:"foreignKey:ProductID;constraint:OnDelete:CASCADE"`
+	Images       []ProductImage `gorm:"foreignKey:ProductID;constraint:OnDelete:CASCADE" json:"images,omitempty"` // loaded for a single product
 }
 
 // BeforeCreate auto-generates UUID
@@ -0,0 +1,36 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ProductImage is one picture in a product's gallery, shown in Position
+// order. Color ties it to one colourway of the product ("" for all).
+// Thumbnails maps a size name (small, medium, large) to the URL of a
+// resized JPEG copy.
+type ProductImage struct {
+	ID          uuid.UUID         `gorm:"type:uuid;primaryKey" json:"id"`
+	ProductID   uuid.UUID         `gorm:"type:uuid;not null;index" json:"product_id"`
+	Position    int               `gorm:"not null;default:0" json:"position"`
+	AltText     string            `gorm:"size:255" json:"alt_text"`
+	Color       string            `gorm:"size:50;index" json:"color"`
+	URL         string            `gorm:"not null" json:"url"`
+	ContentType string            `gorm:"size:50" json:"content_type"`
+	Width       int               `json:"width"`
+	Height      int               `json:"height"`
+	Bytes       int64             `json:"bytes"`
+	Thumbnails  map[string]string `gorm:"type:jsonb;serializer:json" json:"thumbnails"`
+	StorageKeys []string          `gorm:"type:jsonb;serializer:json" json:"-"` // original and thumbnails, removed with the image
+	CreatedAt   time.Time         `json:"created_at"`
+	UpdatedAt   time.Time         `json:"updated_at"`
+}
+
+func (i *ProductImage) BeforeCreate(tx *gorm.DB) (err error) {
+	if i.ID == uuid.Nil {
+		i.ID = uuid.New()
+	}
+	return
+}
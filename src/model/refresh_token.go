@@ -0,0 +1,35 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// RefreshToken is one issued refresh token. Tokens are rotated on every
+// refresh; all tokens descending from one login share a FamilyID, which is
+// the session the user sees and can revoke. Only a hash of the token is
+// stored.
+type RefreshToken struct {
+	ID            uuid.UUID  `gorm:"type:uuid;primaryKey" json:"id"` // the token's jti
+	UserID        uuid.UUID  `gorm:"type:uuid;not null;index" json:"user_id"`
+	FamilyID      uuid.UUID  `gorm:"type:uuid;not null;index" json:"family_id"`
+	ParentID      *uuid.UUID `gorm:"type:uuid" json:"parent_id"`
+	TokenHash     string     `gorm:"size:64;not null;uniqueIndex" json:"-"`
+	UserAgent     string     `json:"user_agent"`
+	IPAddress     string     `gorm:"size:64" json:"ip_address"`
+	MFA           bool       `gorm:"not null;default:false" json:"mfa"` // session was started with a second factor
+	ExpiresAt     time.Time  `gorm:"not null" json:"expires_at"`
+	UsedAt        *time.Time `json:"used_at"` // set when rotated
+	RevokedAt     *time.Time `gorm:"index" json:"revoked_at"`
+	RevokedReason string     `json:"revoked_reason,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+func (t *RefreshToken) BeforeCreate(tx *gorm.DB) (err error) {
+	if t.ID == uuid.Nil {
+		t.ID = uuid.New()
+	}
+	return
+}
@@ -0,0 +1,33 @@
+package model
+
+import (
+	"time"
+
+	"vestra-ecommerce/utils/money"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Refund returns all or part of a captured payment through its provider
+type Refund struct {
+	ID               uuid.UUID   `gorm:"type:uuid;primaryKey" json:"id"`
+	PaymentID        string      `gorm:"type:uuid;not null;index" json:"payment_id"`
+	OrderID          uuid.UUID   `gorm:"type:uuid;index" json:"order_id"`
+	Amount           money.Money `gorm:"embedded;embeddedPrefix:amount_" json:"amount"`
+	Reason           string      `json:"reason"`
+	Status           string      `gorm:"index" json:"status"` // REFUND_PENDING, REFUNDED, FAILED
+	ProviderRefundID string      `gorm:"index" json:"provider_refund_id"`
+	Error            string      `json:"error,omitempty"`
+	InitiatedBy      *uuid.UUID  `gorm:"type:uuid" json:"initiated_by"` // nil for automatic refunds
+	ActorRole        string      `json:"actor_role"`                    // admin, system
+	CreatedAt        time.Time   `json:"created_at"`
+	UpdatedAt        time.Time   `json:"updated_at"`
+}
+
+func (r *Refund) BeforeCreate(tx *gorm.DB) (err error) {
+	if r.ID == uuid.Nil {
+		r.ID = uuid.New()
+	}
+	return
+}
@@ -0,0 +1,30 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Team is a league or a club. Clubs belong to a league through ParentID;
+// leagues have no parent.
+type Team struct {
+	ID        uuid.UUID  `gorm:"type:uuid;primaryKey" json:"id"`
+	Name      string     `gorm:"size:100;not null" json:"name"`
+	Slug      string     `gorm:"size:120;uniqueIndex;not null" json:"slug"`
+	Kind      string     `gorm:"size:20;not null;index" json:"kind"` // league, club
+	Country   string     `gorm:"size:60" json:"country"`
+	ParentID  *uuid.UUID `gorm:"type:uuid;index" json:"parent_id"`
+	Parent    *Team      `gorm:"foreignKey:ParentID;constraint:OnDelete:RESTRICT" json:"-"`
+	Clubs     []Team     `gorm:"-" json:"clubs,omitempty"` // filled when listing leagues
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+func (t *Team) BeforeCreate(tx *gorm.DB) (err error) {
+	if t.ID == uuid.Nil {
+		t.ID = uuid.New()
+	}
+	return
+}
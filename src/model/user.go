@@ -15,16 +15,31 @@ type User struct {
 	Name  string `json:"name" validate:"required,min=2,max=100"`
 	Email string `json:"email" validate:"required,email" gorm:"uniqueIndex"`
 
-	Password string `json:"-" validate:"required,min=8"`
+	// PendingEmail is the address an email change is waiting to verify;
+	// Email only changes once the OTP sent there is confirmed
+	PendingEmail *string `json:"-"`
 
-	Role string `json:"role" gorm:"default:user"`
+	Password string `json:"-" validate:"required,min=8"`
 
-	OTP       string    `json:"-" gorm:"size:255"`
-	OTPExpiry time.Time `json:"-"`
+	// Role is "admin" while the user holds any RBAC role, "user" otherwise;
+	// what they may do comes from Roles
+	Role  string `json:"role" gorm:"default:user"`
+	Roles []Role `json:"roles,omitempty" gorm:"many2many:user_roles;constraint:OnDelete:CASCADE"`
 
 	IsVerified bool `json:"is_verified" gorm:"default:false"`
 	IsBlocked  bool `json:"is_blocked" gorm:"default:false"`
 
+	// TokenVersion is embedded in access tokens; bumping it (block, password
+	// reset) invalidates every token issued before
+	TokenVersion int `json:"-" gorm:"not null;default:0"`
+
+	// DeletionScheduledAt is when a requested account deletion runs; the
+	// user can cancel until then. AnonymizedAt is set once it ran: the row
+	// stays so orders and payments keep their user, but holds no personal
+	// data any more.
+	DeletionScheduledAt *time.Time `json:"deletion_scheduled_at,omitempty" gorm:"index"`
+	AnonymizedAt        *time.Time `json:"-"`
+
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
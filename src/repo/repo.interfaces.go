@@ -1,6 +1,8 @@
 package repo
 
 import (
+	"context"
+
 	"gorm.io/gorm"
 )
 
@@ -23,4 +25,13 @@ type IPgSQLRepository interface {
 	Exec(sql string, values ...interface{}) *gorm.DB
 	FindByIdWithPreload(obj interface{}, id interface{}, preloads ...string) error
 	FindWhereWithPreload(obj interface{}, query string, args []interface{}, preloads ...string) error
+	// FindPage is FindWhereWithPreload sorted by order and cut to limit rows after offset.
+	FindPage(obj interface{}, query string, args []interface{}, order string, limit, offset int, preloads ...string) error
+	// Count counts the rows of model's table matching query (soft-deleted rows excluded).
+	Count(model interface{}, query string, args []interface{}) (int64, error)
+
+	// WithContext binds every subsequent call to ctx (deadline, cancellation).
+	WithContext(ctx context.Context) IPgSQLRepository
+	// WithTransaction runs fn atomically; txRepo is bound to the transaction.
+	WithTransaction(ctx context.Context, fn func(txRepo IPgSQLRepository) error) error
 }
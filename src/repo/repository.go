@@ -1,6 +1,7 @@
 package repo
 
 import (
+	"context"
 	"errors"
 	"reflect"
 	database "vestra-ecommerce/utils/databases"
@@ -8,7 +9,9 @@ import (
 	"gorm.io/gorm"
 )
 
-type PgSQLRepository struct{}
+type PgSQLRepository struct {
+	db *gorm.DB
+}
 
 var IPgSQLRepo IPgSQLRepository
 
@@ -24,24 +27,49 @@ func GetPgSQLRepository() IPgSQLRepository {
 	return IPgSQLRepo
 }
 
+// conn returns the handle this repository is bound to. Repositories handed
+// out by WithContext / WithTransaction carry their own session; the shared
+// one falls back to the global connection.
+func (r *PgSQLRepository) conn() *gorm.DB {
+	if r.db != nil {
+		return r.db
+	}
+	return database.PgSQLDB
+}
+
+// WithContext returns a repository whose queries observe ctx, so request
+// deadlines and cancellation reach the database driver.
+func (r *PgSQLRepository) WithContext(ctx context.Context) IPgSQLRepository {
+	return &PgSQLRepository{db: r.conn().WithContext(ctx)}
+}
+
+// WithTransaction runs fn inside a single database transaction bound to ctx.
+// Every call made through txRepo joins that transaction; returning an error
+// from fn (or ctx being cancelled) rolls everything back. Calling it on a
+// repository that is already inside a transaction nests a savepoint.
+func (r *PgSQLRepository) WithTransaction(ctx context.Context, fn func(txRepo IPgSQLRepository) error) error {
+	return r.conn().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return fn(&PgSQLRepository{db: tx})
+	})
+}
 
 // Insert data
 func (r *PgSQLRepository) Insert(req interface{}) error {
-	if err := database.PgSQLDB.Debug().Create(req).Error; err != nil {
+	if err := r.conn().Debug().Create(req).Error; err != nil {
 		return err
 	}
 	return nil
 }
 
 func (r *PgSQLRepository) Save(req interface{}) error {
-	if err := database.PgSQLDB.Debug().Save(req).Error; err != nil {
+	if err := r.conn().Debug().Save(req).Error; err != nil {
 		return err
 	}
 	return nil
 }
 
 func (r *PgSQLRepository) InsertAndReturnID(req interface{}) (uint, error) {
-	if err := database.PgSQLDB.Create(req).Error; err != nil {
+	if err := r.conn().Create(req).Error; err != nil {
 		return 0, err
 	}
 
@@ -55,77 +83,77 @@ func (r *PgSQLRepository) InsertAndReturnID(req interface{}) (uint, error) {
 }
 
 func (r *PgSQLRepository) FindById(obj interface{}, id interface{}) error {
-	if err := database.PgSQLDB.Debug().Where("id = ?", id).First(obj).Error; err != nil {
+	if err := r.conn().Debug().Where("id = ?", id).First(obj).Error; err != nil {
 		return err
 	}
 	return nil
 }
 
 func (r *PgSQLRepository) FindAll(obj interface{}) error {
-	if err := database.PgSQLDB.Debug().Find(obj).Error; err != nil {
+	if err := r.conn().Debug().Find(obj).Error; err != nil {
 		return err
 	}
 	return nil
 }
 
 func (r *PgSQLRepository) FindOneWhere(out interface{}, query string, args ...interface{}) error {
-	return database.PgSQLDB.Debug().Where(query, args...).First(out).Error
+	return r.conn().Debug().Where(query, args...).First(out).Error
 }
 
 func (r *PgSQLRepository) FindAllWhere(obj interface{}, query interface{}, args ...interface{}) error {
-	if err := database.PgSQLDB.Debug().Where(query, args...).Find(obj).Error; err != nil {
+	if err := r.conn().Debug().Where(query, args...).Find(obj).Error; err != nil {
 		return err
 	}
 	return nil
 }
 
 func (r *PgSQLRepository) Update(obj interface{}, id interface{}, update interface{}) error {
-	if err := database.PgSQLDB.Debug().Where("id = ?", id).First(obj).Updates(update).Error; err != nil {
+	if err := r.conn().Debug().Where("id = ?", id).First(obj).Updates(update).Error; err != nil {
 		return err
 	}
 	return nil
 }
 
 func (r *PgSQLRepository) UpdateByFields(obj interface{}, id interface{}, fields map[string]interface{}) error {
-	if err := database.PgSQLDB.Debug().Model(obj).Where("id = ?", id).Updates(fields).Error; err != nil {
+	if err := r.conn().Debug().Model(obj).Where("id = ?", id).Updates(fields).Error; err != nil {
 		return err
 	}
 	return nil
 }
 
 func (r *PgSQLRepository) Delete(obj interface{}, id interface{}) error {
-	if err := database.PgSQLDB.Debug().Where("id = ?", id).Delete(obj).Error; err != nil {
+	if err := r.conn().Debug().Where("id = ?", id).Delete(obj).Error; err != nil {
 		return err
 	}
 	return nil
 }
 
 func (r *PgSQLRepository) HardDelete(obj interface{}) error {
-	if err := database.PgSQLDB.Unscoped().Delete(obj).Error; err != nil {
+	if err := r.conn().Unscoped().Delete(obj).Error; err != nil {
 		return err
 	}
 	return nil
 }
 
 func (r *PgSQLRepository) FindDistinct(obj interface{}, field string, query interface{}, args ...interface{}) error {
-	if err := database.PgSQLDB.Debug().Model(obj).Distinct(field).Where(query, args...).Find(obj).Error; err != nil {
+	if err := r.conn().Debug().Model(obj).Distinct(field).Where(query, args...).Find(obj).Error; err != nil {
 		return err
 	}
 	return nil
 }
 
 func (r *PgSQLRepository) Raw(query string, args ...interface{}) *gorm.DB {
-	return database.PgSQLDB.Raw(query, args...)
+	return r.conn().Raw(query, args...)
 }
 
 
 func (r *PgSQLRepository) Exec(sql string, values ...interface{}) *gorm.DB {
-	return database.PgSQLDB.Exec(sql, values...)
+	return r.conn().Exec(sql, values...)
 }
 
 
 func (r *PgSQLRepository) FindByIdWithPreload(obj interface{}, id interface{}, preloads ...string) error {
-	db := database.PgSQLDB
+	db := r.conn()
 	for _, preload := range preloads {
 		db = db.Preload(preload)
 	}
@@ -133,9 +161,23 @@ func (r *PgSQLRepository) FindByIdWithPreload(obj interface{}, id interface{}, p
 }
 
 func (r *PgSQLRepository) FindWhereWithPreload(obj interface{}, query string, args []interface{}, preloads ...string) error {
-	db := database.PgSQLDB
+	db := r.conn()
 	for _, preload := range preloads {
 		db = db.Preload(preload)
 	}
 	return db.Where(query, args...).Find(obj).Error
 }
+
+func (r *PgSQLRepository) FindPage(obj interface{}, query string, args []interface{}, order string, limit, offset int, preloads ...string) error {
+	db := r.conn()
+	for _, preload := range preloads {
+		db = db.Preload(preload)
+	}
+	return db.Where(query, args...).Order(order).Limit(limit).Offset(offset).Find(obj).Error
+}
+
+func (r *PgSQLRepository) Count(model interface{}, query string, args []interface{}) (int64, error) {
+	var count int64
+	err := r.conn().Model(model).Where(query, args...).Count(&count).Error
+	return count, err
+}
@@ -0,0 +1,316 @@
+package services
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+
+	"vestra-ecommerce/src/model"
+	"vestra-ecommerce/src/repo"
+	constant "vestra-ecommerce/utils/constants"
+	"vestra-ecommerce/utils/oidc"
+	"vestra-ecommerce/utils/utils/apperror"
+)
+
+// AccountService covers what a customer can do with their account as a
+// whole: download their data and delete it. Deletion is scheduled with a
+// grace period, then the user row is anonymised rather than removed so
+// orders and payments stay intact for accounting.
+type AccountService struct {
+	repo     repo.IPgSQLRepository
+	statuses *UserStatusCache
+	grace    time.Duration
+}
+
+func NewAccountService(repo repo.IPgSQLRepository, statuses *UserStatusCache, grace time.Duration) *AccountService {
+	if grace <= 0 {
+		grace = 14 * 24 * time.Hour
+	}
+	return &AccountService{repo: repo, statuses: statuses, grace: grace}
+}
+
+// AccountExport is everything we hold about a user
+type AccountExport struct {
+	ExportedAt time.Time           `json:"exported_at"`
+	Profile    model.User          `json:"profile"`
+	Addresses  []model.UserAddress `json:"addresses"`
+	Orders     []model.Order       `json:"orders"`
+	Payments   []model.Payment     `json:"payments"`
+	Wishlist   []model.Wishlist    `json:"wishlist"`
+}
+
+/* =======================
+   EXPORT
+   ======================= */
+
+// Export gathers the user's profile, addresses, orders, payments and
+// wishlist
+func (s *AccountService) Export(ctx context.Context, userID string) (*AccountExport, error) {
+	uID, err := uuid.Parse(userID)
+	if err != nil {
+		return nil, apperror.New(
+			constant.BADREQUEST,
+			"",
+			"Invalid user ID",
+		)
+	}
+
+	db := s.repo.WithContext(ctx)
+	export := &AccountExport{
+		ExportedAt: time.Now(),
+		Addresses:  []model.UserAddress{},
+		Orders:     []model.Order{},
+		Payments:   []model.Payment{},
+		Wishlist:   []model.Wishlist{},
+	}
+
+	if err := db.FindByIdWithPreload(&export.Profile, uID, "Roles"); err != nil {
+		return nil, apperror.New(
+			constant.NOTFOUND,
+			"",
+			"User not found",
+		)
+	}
+
+	if err := db.FindAllWhere(&export.Addresses, "user_id = ?", uID.String()); err != nil {
+		return nil, apperror.ErrInternal
+	}
+	if err := db.FindWhereWithPreload(&export.Orders, "user_id = ?", []interface{}{uID}, "Items.Product", "StatusHistory"); err != nil {
+		return nil, apperror.ErrInternal
+	}
+	if err := db.FindWhereWithPreload(&export.Payments, "user_id = ?", []interface{}{uID}, "Refunds"); err != nil {
+		return nil, apperror.ErrInternal
+	}
+	if err := db.FindWhereWithPreload(&export.Wishlist, "user_id = ?", []interface{}{uID}, "Product"); err != nil {
+		return nil, apperror.ErrInternal
+	}
+
+	return export, nil
+}
+
+// WriteZip writes the export as a ZIP archive with one JSON file per section
+func (e *AccountExport) WriteZip(w io.Writer) error {
+	zw := zip.NewWriter(w)
+
+	files := []struct {
+		name string
+		data interface{}
+	}{
+		{"profile.json", e.Profile},
+		{"addresses.json", e.Addresses},
+		{"orders.json", e.Orders},
+		{"payments.json", e.Payments},
+		{"wishlist.json", e.Wishlist},
+	}
+
+	for _, f := range files {
+		fw, err := zw.CreateHeader(&zip.FileHeader{
+			Name:     f.name,
+			Method:   zip.Deflate,
+			Modified: e.ExportedAt,
+		})
+		if err != nil {
+			return err
+		}
+		enc := json.NewEncoder(fw)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(f.data); err != nil {
+			return err
+		}
+	}
+
+	return zw.Close()
+}
+
+/* =======================
+   DELETION
+   ======================= */
+
+// ScheduleDeletion asks for the account to be deleted once the grace
+// period is over and returns when that will be
+func (s *AccountService) ScheduleDeletion(ctx context.Context, userID, password string) (time.Time, error) {
+	db := s.repo.WithContext(ctx)
+
+	var user model.User
+	if err := db.FindById(&user, userID); err != nil {
+		return time.Time{}, apperror.New(
+			constant.NOTFOUND,
+			"",
+			"User not found",
+		)
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
+		return time.Time{}, apperror.New(
+			constant.BADREQUEST,
+			constant.WRONG_PASSWORD,
+			"Password is incorrect",
+		)
+	}
+
+	if user.DeletionScheduledAt != nil {
+		return time.Time{}, apperror.New(
+			constant.CONFLICT,
+			constant.DELETION_PENDING,
+			"Account deletion is already scheduled",
+		).WithDetails(map[string]interface{}{"deletion_scheduled_at": user.DeletionScheduledAt})
+	}
+
+	// Staff accounts go through role removal first, so nobody deletes
+	// their way out of being the last admin
+	var roles int64
+	if err := db.Raw("SELECT COUNT(*) FROM user_roles WHERE user_id = ?", user.ID).Scan(&roles).Error; err != nil {
+		return time.Time{}, apperror.ErrInternal
+	}
+	if roles > 0 {
+		return time.Time{}, apperror.New(
+			constant.FORBIDDEN,
+			constant.PERMISSION_DENIED,
+			"Accounts with admin roles can't be deleted, ask for the roles to be removed first",
+		)
+	}
+
+	scheduledAt := time.Now().Add(s.grace)
+	if err := db.UpdateByFields(&model.User{}, user.ID, map[string]interface{}{
+		"deletion_scheduled_at": scheduledAt,
+	}); err != nil {
+		return time.Time{}, apperror.ErrInternal
+	}
+
+	return scheduledAt, nil
+}
+
+// CancelDeletion keeps the account after all
+func (s *AccountService) CancelDeletion(ctx context.Context, userID string) error {
+	res := s.repo.WithContext(ctx).Exec(
+		"UPDATE users SET deletion_scheduled_at = NULL WHERE id = ? AND deletion_scheduled_at IS NOT NULL",
+		userID,
+	)
+	if res.Error != nil {
+		return apperror.ErrInternal
+	}
+	if res.RowsAffected == 0 {
+		return apperror.New(
+			constant.BADREQUEST,
+			"",
+			"No account deletion is scheduled",
+		)
+	}
+	return nil
+}
+
+// PurgeDue anonymises every account whose grace period is over and returns
+// how many it did
+func (s *AccountService) PurgeDue(ctx context.Context) (int, error) {
+	var ids []uuid.UUID
+	if err := s.repo.WithContext(ctx).Raw(
+		"SELECT id FROM users WHERE deletion_scheduled_at <= ? AND anonymized_at IS NULL",
+		time.Now(),
+	).Scan(&ids).Error; err != nil {
+		return 0, err
+	}
+
+	done := 0
+	for _, id := range ids {
+		if err := s.anonymize(ctx, id); err != nil {
+			log.Printf("account deletion: user %s: %v", id, err)
+			continue
+		}
+		done++
+	}
+	return done, nil
+}
+
+// RunPurger calls PurgeDue every interval until ctx is done
+func (s *AccountService) RunPurger(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if n, err := s.PurgeDue(ctx); err != nil {
+			log.Printf("account deletion: %v", err)
+		} else if n > 0 {
+			log.Printf("account deletion: anonymised %d account(s)", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// anonymize strips the user row of personal data, drops everything that
+// only matters to a live account and cuts off all sessions. Orders and
+// payments are left pointing at the anonymised row.
+func (s *AccountService) anonymize(ctx context.Context, userID uuid.UUID) error {
+	// Nobody will ever know this password; the account is blocked anyway
+	password, err := oidc.RandomString(32)
+	if err != nil {
+		return err
+	}
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	err = s.repo.WithTransaction(ctx, func(tx repo.IPgSQLRepository) error {
+		now := time.Now()
+
+		// Re-checked under the lock: the user may have cancelled meanwhile
+		res := tx.Exec(`
+			UPDATE users SET
+				name = 'Deleted user',
+				email = ?,
+				pending_email = NULL,
+				password = ?,
+				role = 'user',
+				is_blocked = TRUE,
+				token_version = token_version + 1,
+				deletion_scheduled_at = NULL,
+				anonymized_at = ?
+			WHERE id = ? AND deletion_scheduled_at <= ? AND anonymized_at IS NULL`,
+			"deleted-"+userID.String()+"@deleted.invalid",
+			string(hashed),
+			now,
+			userID,
+			now,
+		)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return nil
+		}
+
+		for _, stmt := range []string{
+			"DELETE FROM user_addresses WHERE user_id = ?",
+			"DELETE FROM wishlists WHERE user_id = ?",
+			"DELETE FROM carts WHERE user_id = ?",
+			"DELETE FROM otp_codes WHERE user_id = ?",
+			"DELETE FROM user_totp WHERE user_id = ?",
+			"DELETE FROM recovery_codes WHERE user_id = ?",
+			"DELETE FROM user_identities WHERE user_id = ?",
+			"DELETE FROM user_roles WHERE user_id = ?",
+		} {
+			if err := tx.Exec(stmt, userID).Error; err != nil {
+				return err
+			}
+		}
+
+		return revokeUserSessions(tx, userID, revokeAccountDeleted)
+	})
+	if err != nil {
+		return err
+	}
+
+	s.statuses.Invalidate(userID.String())
+	return nil
+}
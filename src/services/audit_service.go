@@ -0,0 +1,160 @@
+package services
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"vestra-ecommerce/src/model"
+	"vestra-ecommerce/src/repo"
+	"vestra-ecommerce/utils/audit"
+	constant "vestra-ecommerce/utils/constants"
+	"vestra-ecommerce/utils/pagination"
+	"vestra-ecommerce/utils/utils/apperror"
+)
+
+// AuditEntry is one change to record. Before and After are snapshots of
+// the entity (structs or maps); only the fields that differ are stored.
+type AuditEntry struct {
+	Action     string
+	EntityType string
+	EntityID   string
+	Before     interface{}
+	After      interface{}
+}
+
+// recordAudit appends entry to the audit log with the actor and request
+// details found in ctx. Pass the transaction making the change as db so
+// the change and its record commit together.
+func recordAudit(ctx context.Context, db repo.IPgSQLRepository, entry AuditEntry) error {
+	before, after, err := audit.Diff(entry.Before, entry.After)
+	if err != nil {
+		return err
+	}
+
+	meta := audit.FromContext(ctx)
+	row := model.AuditLog{
+		ActorRole:  constant.ACTOR_SYSTEM,
+		Action:     entry.Action,
+		EntityType: entry.EntityType,
+		EntityID:   entry.EntityID,
+		Before:     before,
+		After:      after,
+		SessionID:  meta.SessionID,
+		IPAddress:  meta.IPAddress,
+		UserAgent:  meta.UserAgent,
+		Method:     meta.Method,
+		Path:       meta.Path,
+	}
+	if actorID, err := uuid.Parse(meta.ActorID); err == nil {
+		row.ActorID = &actorID
+		row.ActorRole = meta.ActorRole
+	}
+
+	return db.Insert(&row)
+}
+
+// recordAuditAfter is recordAudit for changes already committed outside a
+// transaction: the change stands either way, so a failed write is logged
+func recordAuditAfter(ctx context.Context, db repo.IPgSQLRepository, entry AuditEntry) {
+	if err := recordAudit(ctx, db.WithContext(ctx), entry); err != nil {
+		log.Printf("audit: %s %s %s not recorded: %v", entry.Action, entry.EntityType, entry.EntityID, err)
+	}
+}
+
+/* =======================
+   QUERY
+   ======================= */
+
+type AuditService struct {
+	repo repo.IPgSQLRepository
+}
+
+func NewAuditService(repo repo.IPgSQLRepository) *AuditService {
+	return &AuditService{repo: repo}
+}
+
+// AuditFilter narrows the audit log. Zero fields don't filter.
+type AuditFilter struct {
+	ActorID    string
+	Action     string // exact, or a prefix ending in "." such as "product."
+	EntityType string
+	EntityID   string
+	From       *time.Time
+	To         *time.Time
+}
+
+// auditSorts are the fields the audit log can be sorted by
+var auditSorts = map[string]string{
+	"created_at": "created_at",
+}
+
+// List returns a numbered page of the audit log, newest first by default
+func (s *AuditService) List(ctx context.Context, f AuditFilter, page pagination.Params) ([]model.AuditLog, *pagination.Meta, error) {
+	sortBy, err := pageSort(page, auditSorts, "-created_at")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	where := []string{"1=1"}
+	args := []interface{}{}
+
+	if f.ActorID != "" {
+		actorID, err := uuid.Parse(f.ActorID)
+		if err != nil {
+			return nil, nil, apperror.New(
+				constant.BADREQUEST,
+				constant.INVALID_REQUEST,
+				"Invalid actor ID",
+			)
+		}
+		where = append(where, "actor_id = ?")
+		args = append(args, actorID)
+	}
+	if f.Action != "" {
+		if strings.HasSuffix(f.Action, ".") {
+			where = append(where, "action LIKE ?")
+			args = append(args, escapeLike(f.Action)+"%")
+		} else {
+			where = append(where, "action = ?")
+			args = append(args, f.Action)
+		}
+	}
+	if f.EntityType != "" {
+		where = append(where, "entity_type = ?")
+		args = append(args, f.EntityType)
+	}
+	if f.EntityID != "" {
+		where = append(where, "entity_id = ?")
+		args = append(args, f.EntityID)
+	}
+	if f.From != nil {
+		where = append(where, "created_at >= ?")
+		args = append(args, *f.From)
+	}
+	if f.To != nil {
+		where = append(where, "created_at < ?")
+		args = append(args, *f.To)
+	}
+
+	db := s.repo.WithContext(ctx)
+	cond := strings.Join(where, " AND ")
+
+	var total int64
+	if err := db.Raw("SELECT COUNT(*) FROM audit_log WHERE "+cond, args...).Scan(&total).Error; err != nil {
+		return nil, nil, apperror.ErrInternal
+	}
+
+	entries := []model.AuditLog{}
+	if err := db.Raw(
+		"SELECT * FROM audit_log WHERE "+cond+" ORDER BY "+sortBy.OrderBy("id")+" LIMIT ? OFFSET ?",
+		append(args, page.Limit, page.Offset())...,
+	).Scan(&entries).Error; err != nil {
+		return nil, nil, apperror.ErrInternal
+	}
+
+	return entries, pagination.OffsetMeta(page, sortBy, total), nil
+}
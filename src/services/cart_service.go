@@ -1,11 +1,14 @@
 package services
 
 import (
+	"context"
+
 	"github.com/google/uuid"
 
 	"vestra-ecommerce/src/model"
 	"vestra-ecommerce/src/repo"
 	constant "vestra-ecommerce/utils/constants"
+	"vestra-ecommerce/utils/money"
 	"vestra-ecommerce/utils/utils/apperror"
 )
 
@@ -18,6 +21,7 @@ func NewCartService(repo repo.IPgSQLRepository) *CartService {
 }
 
 func (s *CartService) AddToCart(
+	ctx context.Context,
 	userID string,
 	productID string,
 	size string,
@@ -43,53 +47,56 @@ func (s *CartService) AddToCart(
 		)
 	}
 
-	// ---------- Get or Create Cart ----------
-	var cart model.Cart
-	err = s.repo.FindOneWhere(&cart, "user_id = ?", uID)
-	if err != nil {
-		cart = model.Cart{UserID: uID}
-		if err := s.repo.Insert(&cart); err != nil {
-			return apperror.ErrInternal
+	// ---------- Get or Create Cart, then upsert item atomically ----------
+	return s.repo.WithTransaction(ctx, func(tx repo.IPgSQLRepository) error {
+		var cart model.Cart
+		if err := tx.FindOneWhere(&cart, "user_id = ?", uID); err != nil {
+			cart = model.Cart{UserID: uID}
+			if err := tx.Insert(&cart); err != nil {
+				return apperror.ErrInternal
+			}
 		}
-	}
 
-	// ---------- Check if item exists ----------
-	var item model.CartItem
-	err = s.repo.FindOneWhere(
-		&item,
-		"cart_id = ? AND product_id = ? AND size = ?",
-		cart.ID,
-		pID,
-		size,
-	)
-
-	if err == nil {
-		// Increase quantity
-		return s.repo.UpdateByFields(
-			&model.CartItem{},
-			item.ID,
-			map[string]interface{}{
-				"quantity": item.Quantity + quantity,
-			},
+		// ---------- Check if item exists ----------
+		var item model.CartItem
+		err := tx.FindOneWhere(
+			&item,
+			"cart_id = ? AND product_id = ? AND size = ?",
+			cart.ID,
+			pID,
+			size,
 		)
-	}
 
-	// ---------- Add new item ----------
-	cartItem := model.CartItem{
-		CartID:    cart.ID,
-		ProductID: pID,
-		Size:      size,
-		Quantity:  quantity,
-	}
+		if err == nil {
+			// Increase quantity
+			return tx.UpdateByFields(
+				&model.CartItem{},
+				item.ID,
+				map[string]interface{}{
+					"quantity": item.Quantity + quantity,
+				},
+			)
+		}
 
-	if err := s.repo.Insert(&cartItem); err != nil {
-		return apperror.ErrInternal
-	}
+		// ---------- Add new item ----------
+		cartItem := model.CartItem{
+			CartID:    cart.ID,
+			ProductID: pID,
+			Size:      size,
+			Quantity:  quantity,
+		}
 
-	return nil
+		if err := tx.Insert(&cartItem); err != nil {
+			return apperror.ErrInternal
+		}
+
+		return nil
+	})
 }
 
-func (s *CartService) GetUserCart(userID string) (*model.Cart, error) {
+func (s *CartService) GetUserCart(ctx context.Context, userID string) (*model.Cart, error) {
+
+	db := s.repo.WithContext(ctx)
 
 	uID, err := uuid.Parse(userID)
 	if err != nil {
@@ -101,10 +108,10 @@ func (s *CartService) GetUserCart(userID string) (*model.Cart, error) {
 	}
 
 	var cart model.Cart
-	err = s.repo.Raw(
+	err = db.Raw(
 		"SELECT * FROM carts WHERE user_id = ?",
 		uID,
-	).Preload("Items").First(&cart).Error
+	).Preload("Items.Product").First(&cart).Error
 
 	if err != nil {
 		return nil, apperror.New(
@@ -114,16 +121,51 @@ func (s *CartService) GetUserCart(userID string) (*model.Cart, error) {
 		)
 	}
 
+	cart.Total, err = priceCartItems(cart.Items)
+	if err != nil {
+		return nil, err
+	}
+
 	return &cart, nil
 }
 
+// priceCartItems fills each item's LineTotal and returns the cart total.
+// Items must have Product loaded.
+func priceCartItems(items []model.CartItem) (money.Money, error) {
+	currency := money.DefaultCurrency()
+	if len(items) > 0 {
+		currency = items[0].Product.Price.Currency
+	}
+
+	total := money.Zero(currency)
+	for i := range items {
+		line, err := items[i].Product.Price.Mul(int64(items[i].Quantity))
+		if err == nil {
+			total, err = total.Add(line)
+		}
+		if err != nil {
+			return money.Money{}, apperror.New(
+				constant.BADREQUEST,
+				constant.INVALID_AMOUNT,
+				"Cart items cannot be priced together",
+			).WithDetails(err.Error())
+		}
+		items[i].LineTotal = line
+	}
+
+	return total, nil
+}
+
 func (s *CartService) UpdateCartItem(
+	ctx context.Context,
 	userID string,
 	itemID string,
 	size *string,
 	quantity *int,
 ) error {
 
+	db := s.repo.WithContext(ctx)
+
 	uID, err := uuid.Parse(userID)
 	if err != nil {
 		return apperror.ErrUnauthorized
@@ -140,7 +182,7 @@ func (s *CartService) UpdateCartItem(
 
 	// 1️⃣ Get cart for user
 	var cart model.Cart
-	if err := s.repo.FindOneWhere(&cart, "user_id = ?", uID); err != nil {
+	if err := db.FindOneWhere(&cart, "user_id = ?", uID); err != nil {
 		return apperror.New(
 			constant.NOTFOUND,
 			"",
@@ -150,7 +192,7 @@ func (s *CartService) UpdateCartItem(
 
 	// 2️⃣ Get item & verify ownership
 	var item model.CartItem
-	if err := s.repo.FindOneWhere(
+	if err := db.FindOneWhere(
 		&item,
 		"id = ? AND cart_id = ?",
 		iID,
@@ -189,11 +231,13 @@ func (s *CartService) UpdateCartItem(
 		)
 	}
 
-	return s.repo.UpdateByFields(&model.CartItem{}, item.ID, updates)
+	return db.UpdateByFields(&model.CartItem{}, item.ID, updates)
 }
 
 // RemoveCartItem deletes a cart item by its ID
-func (s *CartService) RemoveCartItem(cartItemID string) error {
+func (s *CartService) RemoveCartItem(ctx context.Context, cartItemID string) error {
+	db := s.repo.WithContext(ctx)
+
 	itemUUID, err := uuid.Parse(cartItemID)
 	if err != nil {
 		return apperror.New(
@@ -204,7 +248,7 @@ func (s *CartService) RemoveCartItem(cartItemID string) error {
 	}
 
 	var item model.CartItem
-	err = s.repo.FindById(&item, itemUUID)
+	err = db.FindById(&item, itemUUID)
 	if err != nil {
 		return apperror.New(
 			constant.NOTFOUND,
@@ -213,7 +257,7 @@ func (s *CartService) RemoveCartItem(cartItemID string) error {
 		)
 	}
 
-	if err := s.repo.Delete(&item, item.ID); err != nil {
+	if err := db.Delete(&item, item.ID); err != nil {
 		return apperror.New(
 			constant.INTERNALSERVERERROR,
 			"",
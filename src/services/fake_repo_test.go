@@ -0,0 +1,424 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/callbacks"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/logger"
+	"gorm.io/gorm/schema"
+
+	"vestra-ecommerce/src/model"
+	"vestra-ecommerce/src/repo"
+)
+
+var errFakeUnsupported = errors.New("fakeRepo: not supported")
+
+// fakeRepo is an in-memory repo.IPgSQLRepository holding the tables the
+// service tests touch. Typed calls work on the maps directly; Raw and Exec
+// go through a gorm handle whose driver hands the SQL to execSQL, which
+// knows the handful of statements the services issue.
+type fakeRepo struct {
+	data *fakeTables
+	db   *gorm.DB
+}
+
+type fakeTables struct {
+	users       map[uuid.UUID]model.User
+	identities  map[uuid.UUID]model.UserIdentity
+	loginStates map[uuid.UUID]model.OIDCLoginState
+	revoked     map[uuid.UUID]string // user ID -> reason their sessions were revoked
+}
+
+var _ repo.IPgSQLRepository = (*fakeRepo)(nil)
+
+func newFakeRepo(t *testing.T) *fakeRepo {
+	t.Helper()
+
+	r := &fakeRepo{data: &fakeTables{
+		users:       map[uuid.UUID]model.User{},
+		identities:  map[uuid.UUID]model.UserIdentity{},
+		loginStates: map[uuid.UUID]model.OIDCLoginState{},
+		revoked:     map[uuid.UUID]string{},
+	}}
+
+	pool := sql.OpenDB(fakeConnector{repo: r})
+	t.Cleanup(func() { pool.Close() })
+
+	db, err := gorm.Open(fakeDialector{pool: pool}, &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("open fake db: %v", err)
+	}
+	r.db = db
+
+	return r
+}
+
+func (t *fakeTables) clone() *fakeTables {
+	c := &fakeTables{
+		users:       make(map[uuid.UUID]model.User, len(t.users)),
+		identities:  make(map[uuid.UUID]model.UserIdentity, len(t.identities)),
+		loginStates: make(map[uuid.UUID]model.OIDCLoginState, len(t.loginStates)),
+		revoked:     make(map[uuid.UUID]string, len(t.revoked)),
+	}
+	for k, v := range t.users {
+		c.users[k] = v
+	}
+	for k, v := range t.identities {
+		c.identities[k] = v
+	}
+	for k, v := range t.loginStates {
+		c.loginStates[k] = v
+	}
+	for k, v := range t.revoked {
+		c.revoked[k] = v
+	}
+	return c
+}
+
+/* ======================= TYPED CALLS ======================= */
+
+func (r *fakeRepo) WithContext(ctx context.Context) repo.IPgSQLRepository {
+	return r
+}
+
+// WithTransaction restores the tables when fn fails
+func (r *fakeRepo) WithTransaction(ctx context.Context, fn func(txRepo repo.IPgSQLRepository) error) error {
+	snapshot := r.data.clone()
+	if err := fn(r); err != nil {
+		*r.data = *snapshot
+		return err
+	}
+	return nil
+}
+
+func (r *fakeRepo) Insert(req interface{}) error {
+	now := time.Now()
+
+	switch v := req.(type) {
+	case *model.User:
+		v.BeforeCreate(nil)
+		if err := v.BeforeSave(nil); err != nil {
+			return err
+		}
+		for _, u := range r.data.users {
+			if strings.EqualFold(u.Email, v.Email) {
+				return gorm.ErrDuplicatedKey
+			}
+		}
+		v.CreatedAt, v.UpdatedAt = now, now
+		r.data.users[v.ID] = *v
+	case *model.UserIdentity:
+		v.BeforeCreate(nil)
+		for _, i := range r.data.identities {
+			if i.Provider == v.Provider && i.Subject == v.Subject {
+				return gorm.ErrDuplicatedKey
+			}
+		}
+		v.CreatedAt = now
+		r.data.identities[v.ID] = *v
+	case *model.OIDCLoginState:
+		v.BeforeCreate(nil)
+		v.CreatedAt = now
+		r.data.loginStates[v.ID] = *v
+	default:
+		return fmt.Errorf("%w: insert %T", errFakeUnsupported, req)
+	}
+	return nil
+}
+
+func (r *fakeRepo) FindById(obj interface{}, id interface{}) error {
+	uid, err := fakeUUID(id)
+	if err != nil {
+		return gorm.ErrRecordNotFound
+	}
+
+	switch v := obj.(type) {
+	case *model.User:
+		u, ok := r.data.users[uid]
+		if !ok {
+			return gorm.ErrRecordNotFound
+		}
+		*v = u
+	default:
+		return fmt.Errorf("%w: find %T", errFakeUnsupported, obj)
+	}
+	return nil
+}
+
+func (r *fakeRepo) FindOneWhere(out interface{}, query string, args ...interface{}) error {
+	switch v := out.(type) {
+	case *model.UserIdentity:
+		if query == "provider = ? AND subject = ?" {
+			for _, i := range r.data.identities {
+				if i.Provider == args[0] && i.Subject == args[1] {
+					*v = i
+					return nil
+				}
+			}
+			return gorm.ErrRecordNotFound
+		}
+	case *model.User:
+		if query == "LOWER(email) = ?" {
+			for _, u := range r.data.users {
+				if strings.ToLower(u.Email) == args[0] {
+					*v = u
+					return nil
+				}
+			}
+			return gorm.ErrRecordNotFound
+		}
+	}
+	return fmt.Errorf("%w: %T where %q", errFakeUnsupported, out, query)
+}
+
+func (r *fakeRepo) UpdateByFields(obj interface{}, id interface{}, fields map[string]interface{}) error {
+	uid, err := fakeUUID(id)
+	if err != nil {
+		return gorm.ErrRecordNotFound
+	}
+
+	switch obj.(type) {
+	case *model.UserIdentity:
+		i, ok := r.data.identities[uid]
+		if !ok {
+			return gorm.ErrRecordNotFound
+		}
+		for field, value := range fields {
+			switch field {
+			case "email":
+				i.Email = value.(string)
+			case "last_login_at":
+				i.LastLoginAt = value.(time.Time)
+			default:
+				return fmt.Errorf("%w: update user_identities.%s", errFakeUnsupported, field)
+			}
+		}
+		r.data.identities[uid] = i
+	default:
+		return fmt.Errorf("%w: update %T", errFakeUnsupported, obj)
+	}
+	return nil
+}
+
+func (r *fakeRepo) Update(obj interface{}, id interface{}, update interface{}) error {
+	return errFakeUnsupported
+}
+
+func (r *fakeRepo) Delete(obj interface{}, id interface{}) error {
+	return errFakeUnsupported
+}
+
+func (r *fakeRepo) HardDelete(obj interface{}) error {
+	return errFakeUnsupported
+}
+
+func (r *fakeRepo) FindAll(obj interface{}) error {
+	return errFakeUnsupported
+}
+
+func (r *fakeRepo) FindAllWhere(obj interface{}, query interface{}, args ...interface{}) error {
+	return errFakeUnsupported
+}
+
+func (r *fakeRepo) InsertAndReturnID(req interface{}) (uint, error) {
+	return 0, errFakeUnsupported
+}
+
+func (r *fakeRepo) FindDistinct(obj interface{}, field string, query interface{}, args ...interface{}) error {
+	return errFakeUnsupported
+}
+
+func (r *fakeRepo) Save(req interface{}) error {
+	return errFakeUnsupported
+}
+
+func (r *fakeRepo) FindByIdWithPreload(obj interface{}, id interface{}, preloads ...string) error {
+	return errFakeUnsupported
+}
+
+func (r *fakeRepo) FindWhereWithPreload(obj interface{}, query string, args []interface{}, preloads ...string) error {
+	return errFakeUnsupported
+}
+
+func (r *fakeRepo) FindPage(obj interface{}, query string, args []interface{}, order string, limit, offset int, preloads ...string) error {
+	return errFakeUnsupported
+}
+
+func (r *fakeRepo) Count(model interface{}, query string, args []interface{}) (int64, error) {
+	return 0, errFakeUnsupported
+}
+
+/* ======================= RAW SQL ======================= */
+
+func (r *fakeRepo) Raw(sql string, values ...interface{}) *gorm.DB {
+	return r.db.Raw(sql, values...)
+}
+
+func (r *fakeRepo) Exec(sql string, values ...interface{}) *gorm.DB {
+	return r.db.Exec(sql, values...)
+}
+
+// execSQL runs one raw statement against the tables
+func (r *fakeRepo) execSQL(query string, args []driver.NamedValue) (columns []string, rows [][]driver.Value, affected int64, err error) {
+	q := strings.Join(strings.Fields(query), " ")
+	arg := func(i int) interface{} { return args[i].Value }
+
+	switch {
+	case strings.HasPrefix(q, "DELETE FROM oidc_login_states WHERE expires_at < ?"):
+		for id, s := range r.data.loginStates {
+			if s.ExpiresAt.Before(arg(0).(time.Time)) {
+				delete(r.data.loginStates, id)
+				affected++
+			}
+		}
+
+	case strings.HasPrefix(q, "DELETE FROM oidc_login_states WHERE state_hash = ? AND provider = ? RETURNING *"):
+		columns = []string{"id", "state_hash", "provider", "nonce", "code_verifier", "expires_at", "created_at"}
+		for id, s := range r.data.loginStates {
+			if s.StateHash == arg(0) && s.Provider == arg(1) {
+				delete(r.data.loginStates, id)
+				rows = append(rows, []driver.Value{
+					s.ID.String(), s.StateHash, s.Provider, s.Nonce, s.CodeVerifier, s.ExpiresAt, s.CreatedAt,
+				})
+				affected++
+			}
+		}
+
+	case strings.HasPrefix(q, "UPDATE users SET is_verified = ?, password = ?, pending_email = NULL, token_version = token_version + 1 WHERE id = ?"):
+		id, err := fakeUUID(arg(2))
+		if err != nil {
+			return nil, nil, 0, err
+		}
+		if u, ok := r.data.users[id]; ok {
+			u.IsVerified = arg(0).(bool)
+			u.Password = arg(1).(string)
+			u.PendingEmail = nil
+			u.TokenVersion++
+			r.data.users[id] = u
+			affected++
+		}
+
+	case strings.HasPrefix(q, "UPDATE refresh_tokens SET revoked_at = ?, revoked_reason = ? WHERE user_id = ? AND revoked_at IS NULL"):
+		id, err := fakeUUID(arg(2))
+		if err != nil {
+			return nil, nil, 0, err
+		}
+		r.data.revoked[id] = arg(1).(string)
+
+	case strings.HasPrefix(q, "SELECT EXISTS (SELECT 1 FROM users WHERE id = ?)"):
+		id, err := fakeUUID(arg(0))
+		if err != nil {
+			return nil, nil, 0, err
+		}
+		_, ok := r.data.users[id]
+		columns, rows = []string{"exists"}, [][]driver.Value{{ok}}
+
+	case strings.HasPrefix(q, "SELECT DISTINCT p.name FROM permissions p"):
+		columns = []string{"name"} // no roles are seeded
+
+	default:
+		return nil, nil, 0, fmt.Errorf("%w: %s", errFakeUnsupported, q)
+	}
+
+	return columns, rows, affected, nil
+}
+
+func fakeUUID(id interface{}) (uuid.UUID, error) {
+	switch v := id.(type) {
+	case uuid.UUID:
+		return v, nil
+	case string:
+		return uuid.Parse(v)
+	}
+	return uuid.Nil, fmt.Errorf("%w: id %T", errFakeUnsupported, id)
+}
+
+/* ======================= DRIVER ======================= */
+
+// fakeConnector is a database/sql driver whose every connection executes
+// against the repo's tables
+type fakeConnector struct {
+	repo *fakeRepo
+}
+
+func (c fakeConnector) Connect(context.Context) (driver.Conn, error) { return fakeConn(c), nil }
+func (c fakeConnector) Driver() driver.Driver                        { return c }
+func (c fakeConnector) Open(string) (driver.Conn, error)             { return fakeConn(c), nil }
+
+type fakeConn struct {
+	repo *fakeRepo
+}
+
+func (c fakeConn) Prepare(string) (driver.Stmt, error) { return nil, errFakeUnsupported }
+func (c fakeConn) Close() error                        { return nil }
+func (c fakeConn) Begin() (driver.Tx, error)           { return nil, errFakeUnsupported }
+
+func (c fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	_, _, affected, err := c.repo.execSQL(query, args)
+	if err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(affected), nil
+}
+
+func (c fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	columns, rows, _, err := c.repo.execSQL(query, args)
+	if err != nil {
+		return nil, err
+	}
+	return &fakeRows{columns: columns, rows: rows}, nil
+}
+
+type fakeRows struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+// fakeDialector lets gorm build statements for the fake driver
+type fakeDialector struct {
+	pool gorm.ConnPool
+}
+
+func (d fakeDialector) Name() string { return "fake" }
+
+func (d fakeDialector) Initialize(db *gorm.DB) error {
+	callbacks.RegisterDefaultCallbacks(db, &callbacks.Config{})
+	db.ConnPool = d.pool
+	return nil
+}
+
+func (d fakeDialector) Migrator(*gorm.DB) gorm.Migrator             { return nil }
+func (d fakeDialector) DataTypeOf(*schema.Field) string             { return "" }
+func (d fakeDialector) QuoteTo(w clause.Writer, s string)           { w.WriteString(s) }
+func (d fakeDialector) Explain(sql string, _ ...interface{}) string { return sql }
+
+func (d fakeDialector) DefaultValueOf(*schema.Field) clause.Expression {
+	return clause.Expr{SQL: "DEFAULT"}
+}
+
+func (d fakeDialector) BindVarTo(w clause.Writer, _ *gorm.Statement, _ interface{}) {
+	w.WriteByte('?')
+}
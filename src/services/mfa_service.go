@@ -0,0 +1,402 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+
+	"vestra-ecommerce/src/model"
+	"vestra-ecommerce/src/repo"
+	constant "vestra-ecommerce/utils/constants"
+	"vestra-ecommerce/utils/totp"
+	"vestra-ecommerce/utils/utils/apperror"
+)
+
+const (
+	recoveryCodeCount = 10
+	maxMFAAttempts    = 5
+	mfaLockout        = 15 * time.Minute
+)
+
+// MFAService manages TOTP two-factor authentication. Users holding any admin
+// permission must have it on: AdminAuthMiddleware only admits sessions
+// started with a second factor, and such users can't turn it off.
+type MFAService struct {
+	repo     repo.IPgSQLRepository
+	statuses *UserStatusCache
+	issuer   string
+}
+
+func NewMFAService(repo repo.IPgSQLRepository, statuses *UserStatusCache, issuer string) *MFAService {
+	if issuer == "" {
+		issuer = "Vestra"
+	}
+	return &MFAService{repo: repo, statuses: statuses, issuer: issuer}
+}
+
+// MFAStatus is what a user sees about their own two-factor setup
+type MFAStatus struct {
+	Enabled           bool `json:"enabled"`
+	Required          bool `json:"required"` // holds admin permissions
+	RecoveryCodesLeft int  `json:"recovery_codes_left"`
+}
+
+// TOTPSetup is returned once when enrolling; the URI is rendered as a QR code
+type TOTPSetup struct {
+	Secret     string `json:"secret"`
+	OTPAuthURL string `json:"otpauth_url"`
+}
+
+func (s *MFAService) GetStatus(ctx context.Context, userID string) (*MFAStatus, error) {
+	id, err := uuid.Parse(userID)
+	if err != nil {
+		return nil, apperror.New(constant.BADREQUEST, "", "Invalid user ID")
+	}
+
+	enabled, err := s.IsEnabled(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	required, err := s.isRequired(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var left int64
+	if err := s.repo.WithContext(ctx).Raw(
+		"SELECT COUNT(*) FROM recovery_codes WHERE user_id = ? AND used_at IS NULL", id,
+	).Scan(&left).Error; err != nil {
+		return nil, apperror.ErrInternal
+	}
+
+	return &MFAStatus{Enabled: enabled, Required: required, RecoveryCodesLeft: int(left)}, nil
+}
+
+// IsEnabled reports whether logging in needs a second factor
+func (s *MFAService) IsEnabled(ctx context.Context, userID uuid.UUID) (bool, error) {
+	var count int64
+	if err := s.repo.WithContext(ctx).Raw(
+		"SELECT COUNT(*) FROM user_totp WHERE user_id = ? AND enabled_at IS NOT NULL", userID,
+	).Scan(&count).Error; err != nil {
+		return false, apperror.ErrInternal
+	}
+	return count > 0, nil
+}
+
+// Setup starts enrollment with a new secret. Two-factor stays off until the
+// user proves their app works through Enable.
+func (s *MFAService) Setup(ctx context.Context, userID string) (*TOTPSetup, error) {
+	var user model.User
+	if err := s.repo.WithContext(ctx).FindById(&user, userID); err != nil {
+		return nil, apperror.New(constant.NOTFOUND, "", "User not found")
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, apperror.ErrInternal
+	}
+
+	err = s.repo.WithTransaction(ctx, func(tx repo.IPgSQLRepository) error {
+		var current model.UserTOTP
+		if err := tx.Raw(
+			"SELECT * FROM user_totp WHERE user_id = ? FOR UPDATE", user.ID,
+		).Scan(&current).Error; err != nil {
+			return err
+		}
+
+		if current.UserID == uuid.Nil {
+			return tx.Insert(&model.UserTOTP{UserID: user.ID, Secret: secret})
+		}
+		if current.EnabledAt != nil {
+			return apperror.New(
+				constant.CONFLICT,
+				"",
+				"Two-factor authentication is already enabled",
+			)
+		}
+		return tx.Exec(
+			"UPDATE user_totp SET secret = ?, last_counter = 0, updated_at = ? WHERE user_id = ?",
+			secret, time.Now(), user.ID,
+		).Error
+	})
+	if err != nil {
+		if appErr, ok := err.(*apperror.AppError); ok {
+			return nil, appErr
+		}
+		return nil, apperror.ErrInternal
+	}
+
+	return &TOTPSetup{
+		Secret:     secret,
+		OTPAuthURL: totp.ProvisioningURI(s.issuer, user.Email, secret),
+	}, nil
+}
+
+// Enable turns two-factor on after checking a code from the app and returns
+// a fresh set of recovery codes, shown to the user only this once
+func (s *MFAService) Enable(ctx context.Context, userID, code string) ([]string, error) {
+	var codes []string
+
+	err := s.withTOTP(ctx, userID, func(tx repo.IPgSQLRepository, current *model.UserTOTP) error {
+		if current.EnabledAt != nil {
+			return apperror.New(
+				constant.CONFLICT,
+				"",
+				"Two-factor authentication is already enabled",
+			)
+		}
+
+		if err := s.checkCode(tx, current, code, ""); err != nil {
+			return err
+		}
+
+		if err := tx.Exec(
+			"UPDATE user_totp SET enabled_at = ? WHERE user_id = ?", time.Now(), current.UserID,
+		).Error; err != nil {
+			return err
+		}
+
+		var err error
+		codes, err = replaceRecoveryCodes(tx, current.UserID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// Disable turns two-factor off. It needs the password and an app or
+// recovery code, and is refused while the user holds admin permissions.
+func (s *MFAService) Disable(ctx context.Context, userID, password, code string) error {
+	required, err := s.isRequired(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if required {
+		return apperror.New(
+			constant.FORBIDDEN,
+			constant.MFA_REQUIRED,
+			"Two-factor authentication is required for admin accounts",
+		)
+	}
+
+	var user model.User
+	if err := s.repo.WithContext(ctx).FindById(&user, userID); err != nil {
+		return apperror.New(constant.NOTFOUND, "", "User not found")
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
+		return apperror.New(constant.UNAUTHORIZED, "", "Invalid password")
+	}
+
+	return s.withTOTP(ctx, userID, func(tx repo.IPgSQLRepository, current *model.UserTOTP) error {
+		if current.EnabledAt == nil {
+			return apperror.New(
+				constant.BADREQUEST,
+				"",
+				"Two-factor authentication is not enabled",
+			)
+		}
+
+		if err := s.checkCode(tx, current, code, code); err != nil {
+			return err
+		}
+
+		if err := tx.Exec("DELETE FROM recovery_codes WHERE user_id = ?", current.UserID).Error; err != nil {
+			return err
+		}
+		return tx.Exec("DELETE FROM user_totp WHERE user_id = ?", current.UserID).Error
+	})
+}
+
+// RegenerateRecoveryCodes replaces every recovery code after checking an
+// app code
+func (s *MFAService) RegenerateRecoveryCodes(ctx context.Context, userID, code string) ([]string, error) {
+	var codes []string
+
+	err := s.withTOTP(ctx, userID, func(tx repo.IPgSQLRepository, current *model.UserTOTP) error {
+		if current.EnabledAt == nil {
+			return apperror.New(
+				constant.BADREQUEST,
+				"",
+				"Two-factor authentication is not enabled",
+			)
+		}
+
+		if err := s.checkCode(tx, current, code, ""); err != nil {
+			return err
+		}
+
+		var err error
+		codes, err = replaceRecoveryCodes(tx, current.UserID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// VerifyLogin is the second login step: an app code or an unused recovery
+// code. Wrong guesses count towards a lockout.
+func (s *MFAService) VerifyLogin(ctx context.Context, userID, code, recoveryCode string) error {
+	return s.withTOTP(ctx, userID, func(tx repo.IPgSQLRepository, current *model.UserTOTP) error {
+		if current.EnabledAt == nil {
+			return apperror.New(
+				constant.BADREQUEST,
+				"",
+				"Two-factor authentication is not enabled",
+			)
+		}
+		return s.checkCode(tx, current, code, recoveryCode)
+	})
+}
+
+// withTOTP runs fn with the user's enrollment row locked. Failed guesses
+// recorded by checkCode must survive the error they cause, so the
+// transaction commits and the error is returned afterwards.
+func (s *MFAService) withTOTP(
+	ctx context.Context,
+	userID string,
+	fn func(tx repo.IPgSQLRepository, current *model.UserTOTP) error,
+) error {
+	var result error
+
+	err := s.repo.WithTransaction(ctx, func(tx repo.IPgSQLRepository) error {
+		var current model.UserTOTP
+		if err := tx.Raw(
+			"SELECT * FROM user_totp WHERE user_id = ? FOR UPDATE", userID,
+		).Scan(&current).Error; err != nil {
+			return err
+		}
+		if current.UserID == uuid.Nil {
+			result = apperror.New(
+				constant.BADREQUEST,
+				"",
+				"Two-factor authentication is not set up",
+			)
+			return nil
+		}
+
+		result = fn(tx, &current)
+		if _, ok := result.(*apperror.AppError); ok {
+			return nil
+		}
+		return result
+	})
+	if err != nil {
+		return apperror.ErrInternal
+	}
+
+	return result
+}
+
+// checkCode accepts a TOTP code (each time step once) or, when
+// recoveryCode is set, an unused recovery code, which is then spent
+func (s *MFAService) checkCode(tx repo.IPgSQLRepository, current *model.UserTOTP, code, recoveryCode string) error {
+	now := time.Now()
+
+	if current.LockedUntil != nil && now.Before(*current.LockedUntil) {
+		return otpLocked(*current.LockedUntil)
+	}
+
+	if counter, ok := totp.Validate(current.Secret, strings.TrimSpace(code), now); ok && counter > current.LastCounter {
+		return tx.Exec(
+			"UPDATE user_totp SET last_counter = ?, failed_attempts = 0, locked_until = NULL WHERE user_id = ?",
+			counter, current.UserID,
+		).Error
+	}
+
+	if recoveryCode != "" {
+		res := tx.Exec(
+			"UPDATE recovery_codes SET used_at = ? WHERE user_id = ? AND code_hash = ? AND used_at IS NULL",
+			now, current.UserID, hashToken(normalizeRecoveryCode(recoveryCode)),
+		)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected > 0 {
+			return tx.Exec(
+				"UPDATE user_totp SET failed_attempts = 0, locked_until = NULL WHERE user_id = ?",
+				current.UserID,
+			).Error
+		}
+	}
+
+	attempts := current.FailedAttempts + 1
+	if attempts >= maxMFAAttempts {
+		lockedUntil := now.Add(mfaLockout)
+		if err := tx.Exec(
+			"UPDATE user_totp SET failed_attempts = 0, locked_until = ? WHERE user_id = ?",
+			lockedUntil, current.UserID,
+		).Error; err != nil {
+			return err
+		}
+		return otpLocked(lockedUntil)
+	}
+
+	if err := tx.Exec(
+		"UPDATE user_totp SET failed_attempts = ? WHERE user_id = ?", attempts, current.UserID,
+	).Error; err != nil {
+		return err
+	}
+	return apperror.New(
+		constant.UNAUTHORIZED,
+		constant.OTP_INVALID,
+		"Invalid two-factor code",
+	).WithDetails(map[string]interface{}{
+		"attempts_remaining": maxMFAAttempts - attempts,
+	})
+}
+
+func (s *MFAService) isRequired(ctx context.Context, userID string) (bool, error) {
+	status, err := s.statuses.Get(ctx, userID)
+	if err != nil {
+		return false, apperror.New(constant.NOTFOUND, "", "User not found")
+	}
+	return len(status.Permissions) > 0, nil
+}
+
+// replaceRecoveryCodes drops the user's recovery codes and returns a new set
+// in plain text
+func replaceRecoveryCodes(tx repo.IPgSQLRepository, userID uuid.UUID) ([]string, error) {
+	if err := tx.Exec("DELETE FROM recovery_codes WHERE user_id = ?", userID).Error; err != nil {
+		return nil, err
+	}
+
+	encoding := base32.StdEncoding.WithPadding(base32.NoPadding)
+	codes := make([]string, 0, recoveryCodeCount)
+
+	for i := 0; i < recoveryCodeCount; i++ {
+		raw := make([]byte, 6)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, err
+		}
+		plain := strings.ToLower(encoding.EncodeToString(raw)) // 10 chars
+		code := plain[:5] + "-" + plain[5:]
+
+		if err := tx.Insert(&model.RecoveryCode{
+			UserID:   userID,
+			CodeHash: hashToken(normalizeRecoveryCode(code)),
+		}); err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+
+	return codes, nil
+}
+
+// normalizeRecoveryCode accepts codes typed with or without the dash and in
+// any case
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+}
@@ -0,0 +1,283 @@
+package services
+
+import (
+	"context"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+
+	"vestra-ecommerce/src/model"
+	"vestra-ecommerce/src/repo"
+	constant "vestra-ecommerce/utils/constants"
+	"vestra-ecommerce/utils/oidc"
+	"vestra-ecommerce/utils/utils/apperror"
+)
+
+// oidcStateTTL is how long a user has to come back from the provider
+const oidcStateTTL = 10 * time.Minute
+
+// OIDCService signs users in through OpenID Connect providers using the
+// authorization code flow with PKCE. Provider accounts are linked to local
+// users by subject, or on first use by verified email.
+type OIDCService struct {
+	repo      repo.IPgSQLRepository
+	providers map[string]*oidc.Provider
+	statuses  *UserStatusCache
+}
+
+func NewOIDCService(repo repo.IPgSQLRepository, providers map[string]*oidc.Provider, statuses *UserStatusCache) *OIDCService {
+	return &OIDCService{repo: repo, providers: providers, statuses: statuses}
+}
+
+// Providers lists the configured provider names
+func (s *OIDCService) Providers() []string {
+	names := make([]string, 0, len(s.providers))
+	for name := range s.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// StartLogin records a new login attempt and returns the provider URL to
+// send the user to
+func (s *OIDCService) StartLogin(ctx context.Context, providerName string) (string, error) {
+	provider, err := s.provider(providerName)
+	if err != nil {
+		return "", err
+	}
+
+	state, err := oidc.RandomString(32)
+	if err != nil {
+		return "", apperror.ErrInternal
+	}
+	nonce, err := oidc.RandomString(32)
+	if err != nil {
+		return "", apperror.ErrInternal
+	}
+	verifier, err := oidc.RandomString(32)
+	if err != nil {
+		return "", apperror.ErrInternal
+	}
+
+	authURL, err := provider.AuthCodeURL(ctx, state, nonce, oidc.CodeChallenge(verifier))
+	if err != nil {
+		log.Printf("oidc %s: %v", provider.Name(), err)
+		return "", apperror.New(
+			constant.BADGATEWAY,
+			constant.OIDC_FAILED,
+			"Sign-in provider is unavailable",
+		)
+	}
+
+	db := s.repo.WithContext(ctx)
+
+	// Abandoned attempts are cleared as new ones come in
+	if err := db.Exec("DELETE FROM oidc_login_states WHERE expires_at < ?", time.Now()).Error; err != nil {
+		return "", apperror.ErrInternal
+	}
+
+	if err := db.Insert(&model.OIDCLoginState{
+		StateHash:    hashToken(state),
+		Provider:     provider.Name(),
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ExpiresAt:    time.Now().Add(oidcStateTTL),
+	}); err != nil {
+		return "", apperror.ErrInternal
+	}
+
+	return authURL, nil
+}
+
+// CompleteLogin handles the provider's callback: it checks state, exchanges
+// the code, verifies the ID token and returns the linked local user
+func (s *OIDCService) CompleteLogin(ctx context.Context, providerName, code, state string) (*model.User, error) {
+	provider, err := s.provider(providerName)
+	if err != nil {
+		return nil, err
+	}
+
+	// Each state is good for one callback
+	var login model.OIDCLoginState
+	res := s.repo.WithContext(ctx).Raw(
+		"DELETE FROM oidc_login_states WHERE state_hash = ? AND provider = ? RETURNING *",
+		hashToken(state), provider.Name(),
+	).Scan(&login)
+	if res.Error != nil {
+		return nil, apperror.ErrInternal
+	}
+	if res.RowsAffected == 0 || time.Now().After(login.ExpiresAt) {
+		return nil, apperror.New(
+			constant.BADREQUEST,
+			constant.OIDC_FAILED,
+			"Sign-in attempt expired, please try again",
+		)
+	}
+
+	tokens, err := provider.Exchange(ctx, code, login.CodeVerifier)
+	if err != nil {
+		log.Printf("oidc %s: %v", provider.Name(), err)
+		return nil, apperror.New(
+			constant.BADREQUEST,
+			constant.OIDC_FAILED,
+			"Sign-in with provider failed",
+		)
+	}
+
+	identity, err := provider.VerifyIDToken(ctx, tokens.IDToken, login.Nonce)
+	if err != nil {
+		log.Printf("oidc %s: %v", provider.Name(), err)
+		return nil, apperror.New(
+			constant.UNAUTHORIZED,
+			constant.OIDC_FAILED,
+			"Sign-in with provider failed",
+		)
+	}
+
+	user, err := s.linkUser(ctx, provider.Name(), identity)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.IsBlocked {
+		return nil, apperror.New(
+			constant.FORBIDDEN,
+			constant.USER_BLOCKED,
+			"Account is blocked",
+		)
+	}
+
+	return user, nil
+}
+
+// linkUser finds the user behind a provider identity. Unknown identities
+// are linked to the user with the same email, or get a new user, but only
+// if the provider verified the email.
+func (s *OIDCService) linkUser(ctx context.Context, providerName string, identity *oidc.Identity) (*model.User, error) {
+	var user model.User
+	verifiedNow := false
+
+	err := s.repo.WithTransaction(ctx, func(tx repo.IPgSQLRepository) error {
+		now := time.Now()
+
+		var link model.UserIdentity
+		if err := tx.FindOneWhere(&link, "provider = ? AND subject = ?", providerName, identity.Subject); err == nil {
+			if err := tx.UpdateByFields(&model.UserIdentity{}, link.ID, map[string]interface{}{
+				"email":         identity.Email,
+				"last_login_at": now,
+			}); err != nil {
+				return err
+			}
+			return tx.FindById(&user, link.UserID)
+		}
+
+		if identity.Email == "" || !identity.EmailVerified {
+			return apperror.New(
+				constant.BADREQUEST,
+				constant.EMAIL_UNVERIFIED,
+				"The provider hasn't verified this email address",
+			)
+		}
+
+		err := tx.FindOneWhere(&user, "LOWER(email) = ?", identity.Email)
+		switch {
+		case err == nil && !user.IsVerified:
+			// The provider proved the address, which is what the OTP is for.
+			// Whoever signed up with it never did, so the password they
+			// chose (and anything issued to them) must not outlive the link.
+			password, err := randomPasswordHash()
+			if err != nil {
+				return err
+			}
+			if err := tx.Exec(
+				"UPDATE users SET is_verified = ?, password = ?, pending_email = NULL, token_version = token_version + 1 WHERE id = ?",
+				true,
+				password,
+				user.ID,
+			).Error; err != nil {
+				return err
+			}
+			if err := revokeUserSessions(tx, user.ID, revokeAccountLinked); err != nil {
+				return err
+			}
+			user.IsVerified = true
+			user.Password = password
+			user.PendingEmail = nil
+			user.TokenVersion++
+			verifiedNow = true
+		case err != nil:
+			// Nobody knows this password; a real one can be set with
+			// forgot-password
+			password, err := randomPasswordHash()
+			if err != nil {
+				return err
+			}
+			name := strings.TrimSpace(identity.Name)
+			if name == "" {
+				name = strings.Split(identity.Email, "@")[0]
+			}
+			user = model.User{
+				ID:         uuid.New(),
+				Name:       name,
+				Email:      identity.Email,
+				Password:   password,
+				Role:       "user",
+				IsVerified: true,
+			}
+			if err := tx.Insert(&user); err != nil {
+				return err
+			}
+		}
+
+		return tx.Insert(&model.UserIdentity{
+			UserID:      user.ID,
+			Provider:    providerName,
+			Subject:     identity.Subject,
+			Email:       identity.Email,
+			LastLoginAt: now,
+		})
+	})
+	if err != nil {
+		if appErr, ok := err.(*apperror.AppError); ok {
+			return nil, appErr
+		}
+		return nil, apperror.ErrInternal
+	}
+
+	if verifiedNow {
+		s.statuses.Invalidate(user.ID.String())
+	}
+
+	return &user, nil
+}
+
+// randomPasswordHash is the password of an account nobody knows the
+// password of
+func randomPasswordHash() (string, error) {
+	password, err := oidc.RandomString(32)
+	if err != nil {
+		return "", err
+	}
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hashed), nil
+}
+
+func (s *OIDCService) provider(name string) (*oidc.Provider, error) {
+	provider, ok := s.providers[strings.ToLower(name)]
+	if !ok {
+		return nil, apperror.New(
+			constant.NOTFOUND,
+			"",
+			"Unknown sign-in provider",
+		)
+	}
+	return provider, nil
+}
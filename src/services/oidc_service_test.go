@@ -0,0 +1,292 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+
+	"vestra-ecommerce/config"
+	"vestra-ecommerce/src/model"
+	constant "vestra-ecommerce/utils/constants"
+	"vestra-ecommerce/utils/oidc"
+	"vestra-ecommerce/utils/utils/apperror"
+)
+
+const testEmail = "victim@example.com"
+
+func newOIDCTestService(t *testing.T) (*OIDCService, *fakeRepo) {
+	t.Helper()
+
+	stub, err := oidc.NewStubProvider("vestra", "stub-secret")
+	if err != nil {
+		t.Fatalf("stub provider: %v", err)
+	}
+	srv := httptest.NewServer(stub)
+	t.Cleanup(srv.Close)
+
+	provider := oidc.NewProvider(config.OIDCProviderConfig{
+		Name:         "stub",
+		Issuer:       srv.URL,
+		ClientID:     "vestra",
+		ClientSecret: "stub-secret",
+		RedirectURL:  "http://shop.test/auth/oidc/stub/callback",
+	})
+
+	db := newFakeRepo(t)
+	providers := map[string]*oidc.Provider{provider.Name(): provider}
+	return NewOIDCService(db, providers, NewUserStatusCache(db, time.Minute)), db
+}
+
+// signInAtStub starts a login and lets the stub sign in as email, returning
+// the code and state it redirects back with
+func signInAtStub(t *testing.T, svc *OIDCService, email string, emailVerified bool) (code, state string) {
+	t.Helper()
+
+	authURL, err := svc.StartLogin(context.Background(), "stub")
+	if err != nil {
+		t.Fatalf("StartLogin: %v", err)
+	}
+
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatalf("auth URL: %v", err)
+	}
+	q := u.Query()
+	q.Set("login_hint", email)
+	if !emailVerified {
+		q.Set("email_verified", "false")
+	}
+	u.RawQuery = q.Encode()
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(u.String())
+	if err != nil {
+		t.Fatalf("authorize: %v", err)
+	}
+	resp.Body.Close()
+
+	callback, err := resp.Location()
+	if err != nil {
+		t.Fatalf("authorize: status %d, no redirect: %v", resp.StatusCode, err)
+	}
+	return callback.Query().Get("code"), callback.Query().Get("state")
+}
+
+func seedUser(t *testing.T, db *fakeRepo, user model.User) model.User {
+	t.Helper()
+	if err := db.Insert(&user); err != nil {
+		t.Fatalf("seed user: %v", err)
+	}
+	return user
+}
+
+func TestOIDCCompleteLogin(t *testing.T) {
+	pending := "elsewhere@example.com"
+
+	tests := []struct {
+		name          string
+		emailVerified bool
+		seed          func(t *testing.T, db *fakeRepo) uuid.UUID // returns the user expected to sign in
+		tamper        func(db *fakeRepo, code, state *string)
+		wantStatus    int
+		wantCode      string
+		check         func(t *testing.T, db *fakeRepo, user *model.User)
+	}{
+		{
+			name:          "state mismatch",
+			emailVerified: true,
+			tamper: func(db *fakeRepo, code, state *string) {
+				*state += "x"
+			},
+			wantStatus: constant.BADREQUEST,
+			wantCode:   constant.OIDC_FAILED,
+		},
+		{
+			name:          "state used twice",
+			emailVerified: true,
+			tamper: func(db *fakeRepo, code, state *string) {
+				for id := range db.data.loginStates {
+					delete(db.data.loginStates, id)
+				}
+			},
+			wantStatus: constant.BADREQUEST,
+			wantCode:   constant.OIDC_FAILED,
+		},
+		{
+			name:          "PKCE verifier mismatch",
+			emailVerified: true,
+			tamper: func(db *fakeRepo, code, state *string) {
+				for id, s := range db.data.loginStates {
+					s.CodeVerifier = "not-the-verifier-the-challenge-was-made-from"
+					db.data.loginStates[id] = s
+				}
+			},
+			wantStatus: constant.BADREQUEST,
+			wantCode:   constant.OIDC_FAILED,
+		},
+		{
+			name:          "unverified provider email",
+			emailVerified: false,
+			seed: func(t *testing.T, db *fakeRepo) uuid.UUID {
+				return seedUser(t, db, model.User{Name: "Victim", Email: testEmail, Password: "victim-password", IsVerified: true}).ID
+			},
+			wantStatus: constant.BADREQUEST,
+			wantCode:   constant.EMAIL_UNVERIFIED,
+			check: func(t *testing.T, db *fakeRepo, _ *model.User) {
+				if len(db.data.identities) != 0 {
+					t.Errorf("identity linked for an unverified email")
+				}
+			},
+		},
+		{
+			name:          "new user",
+			emailVerified: true,
+			check: func(t *testing.T, db *fakeRepo, user *model.User) {
+				if len(db.data.users) != 1 {
+					t.Fatalf("users = %d, want 1", len(db.data.users))
+				}
+				if user.Email != testEmail || !user.IsVerified || user.Role != "user" {
+					t.Errorf("user = %s verified=%v role=%s", user.Email, user.IsVerified, user.Role)
+				}
+				if _, err := bcrypt.Cost([]byte(db.data.users[user.ID].Password)); err != nil {
+					t.Errorf("password is not a bcrypt hash")
+				}
+			},
+		},
+		{
+			name:          "existing unverified user",
+			emailVerified: true,
+			seed: func(t *testing.T, db *fakeRepo) uuid.UUID {
+				return seedUser(t, db, model.User{
+					Name:         "Attacker",
+					Email:        testEmail,
+					PendingEmail: &pending,
+					Password:     "attacker-password",
+					TokenVersion: 3,
+				}).ID
+			},
+			check: func(t *testing.T, db *fakeRepo, user *model.User) {
+				stored := db.data.users[user.ID]
+				if !stored.IsVerified {
+					t.Errorf("user not verified")
+				}
+				if bcrypt.CompareHashAndPassword([]byte(stored.Password), []byte("attacker-password")) == nil {
+					t.Errorf("the password chosen at sign-up still works")
+				}
+				if stored.PendingEmail != nil {
+					t.Errorf("pending email change kept")
+				}
+				if stored.TokenVersion != 4 {
+					t.Errorf("token version = %d, want 4", stored.TokenVersion)
+				}
+				if db.data.revoked[user.ID] != revokeAccountLinked {
+					t.Errorf("sessions revoked = %q, want %q", db.data.revoked[user.ID], revokeAccountLinked)
+				}
+			},
+		},
+		{
+			name:          "existing verified user",
+			emailVerified: true,
+			seed: func(t *testing.T, db *fakeRepo) uuid.UUID {
+				return seedUser(t, db, model.User{Name: "Victim", Email: testEmail, Password: "victim-password", IsVerified: true}).ID
+			},
+			check: func(t *testing.T, db *fakeRepo, user *model.User) {
+				stored := db.data.users[user.ID]
+				if bcrypt.CompareHashAndPassword([]byte(stored.Password), []byte("victim-password")) != nil {
+					t.Errorf("password of a verified account changed")
+				}
+				if _, ok := db.data.revoked[user.ID]; ok {
+					t.Errorf("sessions of a verified account revoked")
+				}
+			},
+		},
+		{
+			name:          "existing linked user",
+			emailVerified: true,
+			seed: func(t *testing.T, db *fakeRepo) uuid.UUID {
+				// Linked by subject under an address the user has since changed
+				user := seedUser(t, db, model.User{Name: "Victim", Email: "old@example.com", Password: "victim-password", IsVerified: true})
+				if err := db.Insert(&model.UserIdentity{
+					UserID:   user.ID,
+					Provider: "stub",
+					Subject:  "stub|" + testEmail,
+					Email:    "old@example.com",
+				}); err != nil {
+					t.Fatalf("seed identity: %v", err)
+				}
+				return user.ID
+			},
+			check: func(t *testing.T, db *fakeRepo, user *model.User) {
+				if len(db.data.users) != 1 || len(db.data.identities) != 1 {
+					t.Fatalf("users = %d, identities = %d, want 1 and 1", len(db.data.users), len(db.data.identities))
+				}
+				for _, identity := range db.data.identities {
+					if identity.Email != testEmail || identity.LastLoginAt.IsZero() {
+						t.Errorf("identity email = %s, last login = %v", identity.Email, identity.LastLoginAt)
+					}
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc, db := newOIDCTestService(t)
+
+			var wantID uuid.UUID
+			if tt.seed != nil {
+				wantID = tt.seed(t, db)
+			}
+
+			code, state := signInAtStub(t, svc, testEmail, tt.emailVerified)
+			if tt.tamper != nil {
+				tt.tamper(db, &code, &state)
+			}
+
+			user, err := svc.CompleteLogin(context.Background(), "stub", code, state)
+
+			if tt.wantCode != "" {
+				appErr, ok := err.(*apperror.AppError)
+				if !ok {
+					t.Fatalf("err = %v, want an AppError", err)
+				}
+				if appErr.Status != tt.wantStatus || appErr.Code != tt.wantCode {
+					t.Fatalf("err = %d %s, want %d %s", appErr.Status, appErr.Code, tt.wantStatus, tt.wantCode)
+				}
+				if tt.check != nil {
+					tt.check(t, db, nil)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("CompleteLogin: %v", err)
+			}
+			if wantID != uuid.Nil && user.ID != wantID {
+				t.Errorf("signed in as %s, want %s", user.ID, wantID)
+			}
+
+			linked := false
+			for _, identity := range db.data.identities {
+				if identity.UserID == user.ID && identity.Provider == "stub" && identity.Subject == "stub|"+testEmail {
+					linked = true
+				}
+			}
+			if !linked {
+				t.Errorf("provider identity not linked to the user")
+			}
+
+			if tt.check != nil {
+				tt.check(t, db, user)
+			}
+		})
+	}
+}
@@ -1,27 +1,57 @@
 package services
 
 import (
+	"context"
+	"log"
+	"sort"
+	"time"
+
 	"vestra-ecommerce/src/model"
 	"vestra-ecommerce/src/repo"
 	constant "vestra-ecommerce/utils/constants"
+	"vestra-ecommerce/utils/pagination"
 	"vestra-ecommerce/utils/utils/apperror"
 
 	"github.com/google/uuid"
 )
 
 type OrderService struct {
-	repo repo.IPgSQLRepository
+	repo     repo.IPgSQLRepository
+	payments *PaymentService // refunds paid orders on cancellation
+
+	// paymentTimeout is how long an order holds its stock waiting for payment
+	paymentTimeout time.Duration
 }
 
-func NewOrderService(repo repo.IPgSQLRepository) *OrderService {
-	return &OrderService{repo: repo}
+func NewOrderService(repo repo.IPgSQLRepository, payments *PaymentService, paymentTimeout time.Duration) *OrderService {
+	if paymentTimeout <= 0 {
+		paymentTimeout = 30 * time.Minute
+	}
+	return &OrderService{repo: repo, payments: payments, paymentTimeout: paymentTimeout}
 }
 
 /* =======================
    PLACE ORDER
    ======================= */
 
-func (s *OrderService) PlaceOrder(userID string) (*model.Order, error) {
+// StockShortage describes a cart line that cannot be fulfilled
+type StockShortage struct {
+	ProductID   uuid.UUID `json:"product_id"`
+	ProductName string    `json:"product_name"`
+	Size        string    `json:"size"`
+	Requested   int       `json:"requested"`
+	Available   int       `json:"available"`
+}
+
+// stockKey groups cart lines that draw from the same product_sizes row
+type stockKey struct {
+	ProductID uuid.UUID
+	Size      string
+}
+
+func (s *OrderService) PlaceOrder(ctx context.Context, userID string) (*model.Order, error) {
+	db := s.repo.WithContext(ctx)
+
 	uID, err := uuid.Parse(userID)
 	if err != nil {
 		return nil, apperror.New(
@@ -32,7 +62,7 @@ func (s *OrderService) PlaceOrder(userID string) (*model.Order, error) {
 	}
 
 	var cart model.Cart
-	if err := s.repo.FindOneWhere(&cart, "user_id = ?", uID); err != nil {
+	if err := db.FindOneWhere(&cart, "user_id = ?", uID); err != nil {
 		return nil, apperror.New(
 			constant.NOTFOUND,
 			"",
@@ -40,69 +70,203 @@ func (s *OrderService) PlaceOrder(userID string) (*model.Order, error) {
 		)
 	}
 
-	var cartItems []model.CartItem
-	if err := s.repo.FindWhereWithPreload(&cartItems, "cart_id = ?", []interface{}{cart.ID}, "Product"); err != nil {
-		return nil, apperror.New(
-			constant.INTERNALSERVERERROR,
-			"",
-			"Failed to fetch cart items",
-		)
-	}
+	var orderID uuid.UUID
 
-	if len(cartItems) == 0 {
-		return nil, apperror.New(
-			constant.BADREQUEST,
-			"",
-			"Cart is empty",
-		)
-	}
+	// Stock check, decrement, order creation and cart clearing either all
+	// happen or none of them do.
+	err = s.repo.WithTransaction(ctx, func(tx repo.IPgSQLRepository) error {
+		var cartItems []model.CartItem
+		if err := tx.FindWhereWithPreload(&cartItems, "cart_id = ?", []interface{}{cart.ID}, "Product"); err != nil {
+			return apperror.New(
+				constant.INTERNALSERVERERROR,
+				"",
+				"Failed to fetch cart items",
+			)
+		}
 
-	total := 0
-	for _, item := range cartItems {
-		total += item.Product.Price * item.Quantity
-	}
+		if len(cartItems) == 0 {
+			return apperror.New(
+				constant.BADREQUEST,
+				"",
+				"Cart is empty",
+			)
+		}
 
-	order := model.Order{
-		UserID: uID,
-		Total:  total,
-		Status: constant.PLACED,
-	}
+		// Merge lines for the same product/size so each stock row is
+		// checked against the full requested quantity
+		requested := map[stockKey]int{}
+		names := map[stockKey]string{}
+		keys := []stockKey{}
+		for _, item := range cartItems {
+			key := stockKey{ProductID: item.ProductID, Size: item.Size}
+			if _, ok := requested[key]; !ok {
+				keys = append(keys, key)
+			}
+			requested[key] += item.Quantity
+			names[key] = item.Product.Name
+		}
 
-	if err := s.repo.Insert(&order); err != nil {
-		return nil, apperror.New(
-			constant.INTERNALSERVERERROR,
-			"",
-			"Failed to create order",
-		)
-	}
+		// Lock rows in a stable order so concurrent checkouts can't deadlock
+		sort.Slice(keys, func(i, j int) bool {
+			if keys[i].ProductID != keys[j].ProductID {
+				return keys[i].ProductID.String() < keys[j].ProductID.String()
+			}
+			return keys[i].Size < keys[j].Size
+		})
+
+		stock := map[stockKey]model.ProductSize{}
+		shortages := []StockShortage{}
+		for _, key := range keys {
+			var size model.ProductSize
+			res := tx.Raw(
+				"SELECT * FROM product_sizes WHERE product_id = ? AND size = ? FOR UPDATE",
+				key.ProductID,
+				key.Size,
+			).Scan(&size)
+			if res.Error != nil {
+				return apperror.New(
+					constant.INTERNALSERVERERROR,
+					"",
+					"Failed to check stock",
+				)
+			}
+
+			available := 0
+			if res.RowsAffected > 0 {
+				available = size.Quantity
+			}
+
+			if available < requested[key] {
+				shortages = append(shortages, StockShortage{
+					ProductID:   key.ProductID,
+					ProductName: names[key],
+					Size:        key.Size,
+					Requested:   requested[key],
+					Available:   available,
+				})
+				continue
+			}
+			stock[key] = size
+		}
+
+		// Inactive or deleted products can't be bought regardless of stock
+		for _, item := range cartItems {
+			key := stockKey{ProductID: item.ProductID, Size: item.Size}
+			if _, ok := stock[key]; !ok {
+				continue
+			}
+			if item.Product.ID == uuid.Nil || !item.Product.IsActive {
+				delete(stock, key)
+				shortages = append(shortages, StockShortage{
+					ProductID:   key.ProductID,
+					ProductName: names[key],
+					Size:        key.Size,
+					Requested:   requested[key],
+					Available:   0,
+				})
+			}
+		}
+
+		if len(shortages) > 0 {
+			return apperror.New(
+				constant.CONFLICT,
+				constant.INSUFFICIENT_STOCK,
+				"Insufficient stock for some items",
+			).WithDetails(shortages)
+		}
+
+		for _, key := range keys {
+			if err := tx.Exec(
+				"UPDATE product_sizes SET quantity = quantity - ?, updated_at = ? WHERE id = ?",
+				requested[key],
+				time.Now(),
+				stock[key].ID,
+			).Error; err != nil {
+				return apperror.New(
+					constant.INTERNALSERVERERROR,
+					"",
+					"Failed to reserve stock",
+				)
+			}
+		}
+
+		total, err := priceCartItems(cartItems)
+		if err != nil {
+			return err
+		}
 
-	for _, item := range cartItems {
-		orderItem := model.OrderItem{
-			OrderID:   order.ID,
-			ProductID: item.ProductID,
-			Size:      item.Size,
-			Quantity:  item.Quantity,
-			Price:     item.Product.Price,
+		// Stock is held while the order waits for its payment; a PAID
+		// payment moves it to PLACED (see settlePayment)
+		order := model.Order{
+			UserID: uID,
+			Total:  total,
+			Status: constant.PENDING_PAYMENT,
 		}
-		if err := s.repo.Insert(&orderItem); err != nil {
-			return nil, apperror.New(
+
+		if err := tx.Insert(&order); err != nil {
+			return apperror.New(
 				constant.INTERNALSERVERERROR,
 				"",
-				"Failed to create order items",
+				"Failed to create order",
+			)
+		}
+
+		for _, item := range cartItems {
+			orderItem := model.OrderItem{
+				OrderID:   order.ID,
+				ProductID: item.ProductID,
+				Size:      item.Size,
+				Quantity:  item.Quantity,
+				Price:     item.Product.Price,
+			}
+			if err := tx.Insert(&orderItem); err != nil {
+				return apperror.New(
+					constant.INTERNALSERVERERROR,
+					"",
+					"Failed to create order items",
+				)
+			}
+		}
+
+		if err := recordOrderStatus(
+			tx,
+			order.ID,
+			"",
+			order.Status,
+			OrderActor{UserID: userID, Role: constant.ACTOR_USER},
+			"Order placed",
+		); err != nil {
+			return apperror.New(
+				constant.INTERNALSERVERERROR,
+				"",
+				"Failed to record order status history",
 			)
 		}
-	}
 
-	if err := s.repo.Exec("DELETE FROM cart_items WHERE cart_id = ?", cart.ID).Error; err != nil {
+		if err := tx.Exec("DELETE FROM cart_items WHERE cart_id = ?", cart.ID).Error; err != nil {
+			return apperror.New(
+				constant.INTERNALSERVERERROR,
+				"",
+				"Failed to clear cart",
+			)
+		}
+
+		orderID = order.ID
+		return nil
+	})
+	if err != nil {
+		if appErr, ok := err.(*apperror.AppError); ok {
+			return nil, appErr
+		}
 		return nil, apperror.New(
 			constant.INTERNALSERVERERROR,
 			"",
-			"Failed to clear cart",
+			"Failed to place order",
 		)
 	}
 
 	var fullOrder model.Order
-	if err := s.repo.FindByIdWithPreload(&fullOrder, order.ID, "Items.Product"); err != nil {
+	if err := db.FindByIdWithPreload(&fullOrder, orderID, "Items.Product"); err != nil {
 		return nil, apperror.New(
 			constant.INTERNALSERVERERROR,
 			"",
@@ -117,45 +281,91 @@ func (s *OrderService) PlaceOrder(userID string) (*model.Order, error) {
    GET ORDERS
    ======================= */
 
-func (s *OrderService) GetOrdersByUser(userID string) ([]model.Order, error) {
+// orderSorts are the fields order lists can be sorted by
+var orderSorts = map[string]string{
+	"created_at": "created_at",
+	"total":      "total_minor",
+}
+
+// GetOrdersByUser returns a page of the user's orders, newest first by
+// default. Pages continue from a cursor.
+func (s *OrderService) GetOrdersByUser(ctx context.Context, userID string, page pagination.Params) ([]model.Order, *pagination.Meta, error) {
+	db := s.repo.WithContext(ctx)
+
 	uID, err := uuid.Parse(userID)
 	if err != nil {
-		return nil, apperror.New(
+		return nil, nil, apperror.New(
 			constant.BADREQUEST,
 			"",
 			"Invalid user ID",
 		)
 	}
 
-	var orders []model.Order
-	if err := s.repo.FindWhereWithPreload(&orders, "user_id = ?", []interface{}{uID}, "Items.Product"); err != nil {
-		return nil, apperror.New(
+	sortBy, err := pageSort(page, orderSorts, "-created_at")
+	if err != nil {
+		return nil, nil, err
+	}
+	query, args, err := afterCursor(db, page, sortBy, "orders", "user_id = ?", []interface{}{uID})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	orders := []model.Order{}
+	if err := db.FindPage(&orders, query, args, sortBy.OrderBy("id"), page.Limit+1, 0, "Items.Product"); err != nil {
+		return nil, nil, apperror.New(
 			constant.INTERNALSERVERERROR,
 			"",
 			"Failed to fetch user orders",
 		)
 	}
 
-	return orders, nil
+	meta := pagination.CursorMeta(page, sortBy, len(orders), func() string {
+		return orders[page.Limit-1].ID.String()
+	})
+	if meta.HasMore {
+		orders = orders[:page.Limit]
+	}
+	return orders, meta, nil
 }
 
-func (s *OrderService) GetAllOrders() ([]model.Order, error) {
-	var orders []model.Order
-	if err := s.repo.FindWhereWithPreload(&orders, "1=1", []interface{}{}, "Items.Product"); err != nil {
-		return nil, apperror.New(
+// GetAllOrders returns a numbered page of every order for the admin grid
+func (s *OrderService) GetAllOrders(ctx context.Context, page pagination.Params) ([]model.Order, *pagination.Meta, error) {
+	db := s.repo.WithContext(ctx)
+
+	sortBy, err := pageSort(page, orderSorts, "-created_at")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	total, err := db.Count(&model.Order{}, "1=1", []interface{}{})
+	if err != nil {
+		return nil, nil, apperror.New(
+			constant.INTERNALSERVERERROR,
+			"",
+			"Failed to fetch all orders",
+		)
+	}
+
+	orders := []model.Order{}
+	if err := db.FindPage(&orders, "1=1", []interface{}{}, sortBy.OrderBy("id"), page.Limit, page.Offset(), "Items.Product", "StatusHistory"); err != nil {
+		return nil, nil, apperror.New(
 			constant.INTERNALSERVERERROR,
 			"",
 			"Failed to fetch all orders",
 		)
 	}
-	return orders, nil
+
+	for i := range orders {
+		sortStatusHistory(&orders[i])
+	}
+	return orders, pagination.OffsetMeta(page, sortBy, total), nil
 }
 
 /* =======================
    GET ORDER BY ID
    ======================= */
 
-func (s *OrderService) GetOrderByID(userID, orderID string) (*model.Order, error) {
+func (s *OrderService) GetOrderByID(ctx context.Context, userID, orderID string) (*model.Order, error) {
 	uID, err := uuid.Parse(userID)
 	if err != nil {
 		return nil, apperror.New(
@@ -165,6 +375,26 @@ func (s *OrderService) GetOrderByID(userID, orderID string) (*model.Order, error
 		)
 	}
 
+	order, err := s.GetOrderByIDAdmin(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+
+	if order.UserID != uID {
+		return nil, apperror.New(
+			constant.UNAUTHORIZED,
+			"",
+			"Not authorized to view this order",
+		)
+	}
+
+	return order, nil
+}
+
+// GetOrderByIDAdmin loads any order with its items and status history
+func (s *OrderService) GetOrderByIDAdmin(ctx context.Context, orderID string) (*model.Order, error) {
+	db := s.repo.WithContext(ctx)
+
 	oID, err := uuid.Parse(orderID)
 	if err != nil {
 		return nil, apperror.New(
@@ -175,7 +405,7 @@ func (s *OrderService) GetOrderByID(userID, orderID string) (*model.Order, error
 	}
 
 	var order model.Order
-	if err := s.repo.FindByIdWithPreload(&order, oID, "Items.Product"); err != nil {
+	if err := db.FindByIdWithPreload(&order, oID, "Items.Product", "StatusHistory"); err != nil {
 		return nil, apperror.New(
 			constant.NOTFOUND,
 			"",
@@ -183,14 +413,7 @@ func (s *OrderService) GetOrderByID(userID, orderID string) (*model.Order, error
 		)
 	}
 
-	if order.UserID != uID {
-		return nil, apperror.New(
-            constant.UNAUTHORIZED, 
-            "", 
-            "Not authorized to view this order",
-        )
-	}
-
+	sortStatusHistory(&order)
 	return &order, nil
 }
 
@@ -198,194 +421,203 @@ func (s *OrderService) GetOrderByID(userID, orderID string) (*model.Order, error
    UPDATE ORDER STATUS
    ======================= */
 
-func (s *OrderService) UpdateOrderStatus(orderID, status string) (*model.Order, error) {
-	oID, err := uuid.Parse(orderID)
-	if err != nil {
-		return nil, apperror.New(
-            constant.BADREQUEST, 
-            "", 
-            "Invalid order ID",
-        )
-	}
-
-	validStatuses := map[string]bool{constant.PLACED: true, constant.SHIPPED: true, constant.DELIVERED: true, constant.CANCELLED: true}
-	if !validStatuses[status] {
-		return nil, apperror.New(
-            constant.BADREQUEST,
-             "",
-              "Invalid order status",
-            )
-	}
-
-	var order model.Order
-	if err := s.repo.FindById(&order, oID); err != nil {
-		return nil, apperror.New(
-            constant.NOTFOUND,
-             "", 
-             "Order not found",
-            )
-	}
-
-	if err := s.repo.UpdateByFields(&order, oID, map[string]interface{}{"status": status}); err != nil {
-		return nil, apperror.New(
-            constant.INTERNALSERVERERROR,
-             "",
-              "Failed to update order status",
-            )
-	}
-
-	if err := s.repo.FindByIdWithPreload(&order, oID, "Items.Product"); err != nil {
-		return nil, apperror.New(
-            constant.INTERNALSERVERERROR, 
-            "", 
-            "Failed to reload order",
-        )
-	}
-
-	return &order, nil
+// UpdateOrderStatus changes an order's status on behalf of an admin
+func (s *OrderService) UpdateOrderStatus(ctx context.Context, adminID, orderID, status, reason string) (*model.Order, error) {
+	return s.UpdateOrderStatusByID(ctx, adminID, orderID, status, reason, true)
 }
 
 /* =======================
    CANCEL ORDER
    ======================= */
 
-func (s *OrderService) CancelOrder(userID, orderID string) (*model.Order, error) {
-	uID, err := uuid.Parse(userID)
-	if err != nil {
-		return nil, apperror.New(
-            constant.BADREQUEST,
-             "",
-              "Invalid user ID",
-            )
-	}
-
-	oID, err := uuid.Parse(orderID)
-	if err != nil {
-		return nil, apperror.New(
-            constant.BADREQUEST, 
-            "", 
-            "Invalid order ID",
-        )
-	}
+func (s *OrderService) CancelOrder(ctx context.Context, userID, orderID, reason string) (*model.Order, error) {
+	return s.UpdateOrderStatusByID(ctx, userID, orderID, constant.CANCELLED, reason, false)
+}
 
-	var order model.Order
-	if err := s.repo.FindById(&order, oID); err != nil {
-		return nil, apperror.New(
-            constant.NOTFOUND,
-             "", 
-             "Order not found",
-            )
-	}
+/* =======================
+   EXPIRE UNPAID ORDERS
+   ======================= */
 
-	if order.UserID != uID {
-		return nil, apperror.New(
-            constant.UNAUTHORIZED, 
-            "", 
-            "Not authorized to cancel this order",
-        )
+// ExpireUnpaid cancels orders that have waited for payment longer than the
+// payment timeout, which puts their stock back, and returns how many it
+// did. An order whose customer started a payment recently is left alone;
+// one captured after all is refunded when it settles.
+func (s *OrderService) ExpireUnpaid(ctx context.Context) (int, error) {
+	cutoff := time.Now().Add(-s.paymentTimeout)
+
+	var ids []uuid.UUID
+	if err := s.repo.WithContext(ctx).Raw(`
+		SELECT o.id FROM orders o
+		WHERE o.status = ? AND o.created_at <= ?
+		  AND NOT EXISTS (
+			SELECT 1 FROM payments p
+			WHERE p.order_id = o.id AND p.status = ? AND p.created_at > ?
+		  )
+	`, constant.PENDING_PAYMENT, cutoff, constant.PENDING, cutoff).Scan(&ids).Error; err != nil {
+		return 0, err
+	}
+
+	done := 0
+	for _, id := range ids {
+		err := s.repo.WithTransaction(ctx, func(tx repo.IPgSQLRepository) error {
+			var order model.Order
+			if err := tx.FindById(&order, id); err != nil {
+				return err
+			}
+			// Paid or cancelled since we looked
+			if order.Status != constant.PENDING_PAYMENT {
+				return nil
+			}
+			return transitionOrder(
+				tx,
+				&order,
+				constant.CANCELLED,
+				OrderActor{Role: constant.ACTOR_SYSTEM},
+				"Payment not received in time",
+			)
+		})
+		if err != nil {
+			log.Printf("order expiry: order %s: %v", id, err)
+			continue
+		}
+		done++
 	}
+	return done, nil
+}
 
-	if order.Status != constant.PLACED {
-		return nil, apperror.New(
-            constant.BADREQUEST, 
-            "",
-             "Only placed orders can be cancelled",
-            
-            )
-	}
+// RunExpirer calls ExpireUnpaid every interval until ctx is done
+func (s *OrderService) RunExpirer(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
 
-	if err := s.repo.UpdateByFields(&order, oID, map[string]interface{}{"status": constant.CANCELLED}); err != nil {
-		return nil, apperror.New(
-            constant.INTERNALSERVERERROR, 
-            "", 
-            "Failed to cancel order",
-        )
-	}
+	for {
+		if n, err := s.ExpireUnpaid(ctx); err != nil {
+			log.Printf("order expiry: %v", err)
+		} else if n > 0 {
+			log.Printf("order expiry: cancelled %d unpaid order(s)", n)
+		}
 
-	if err := s.repo.FindByIdWithPreload(&order, oID, "Items.Product"); err != nil {
-		return nil, apperror.New(
-            constant.INTERNALSERVERERROR,
-             "",
-              "Failed to reload order",
-            )
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
 	}
-
-	return &order, nil
 }
 
 /* =======================
    DELETE ORDER
    ======================= */
 
-func (s *OrderService) DeleteOrder(userID, orderID string) error {
+func (s *OrderService) DeleteOrder(ctx context.Context, userID, orderID string) error {
+	db := s.repo.WithContext(ctx)
+
 	uID, err := uuid.Parse(userID)
 	if err != nil {
 		return apperror.New(
-            constant.BADREQUEST, 
-            "",
-             "Invalid user ID",
-            )
+			constant.BADREQUEST,
+			"",
+			"Invalid user ID",
+		)
 	}
 
 	oID, err := uuid.Parse(orderID)
 	if err != nil {
 		return apperror.New(
-            constant.BADREQUEST, 
-            "", 
-            "Invalid order ID",
-        )
+			constant.BADREQUEST,
+			"",
+			"Invalid order ID",
+		)
 	}
 
 	var order model.Order
-	if err := s.repo.FindById(&order, oID); err != nil {
+	if err := db.FindById(&order, oID); err != nil {
 		return apperror.New(
-            constant.NOTFOUND,
-             "", 
-             "Order not found",
-            )
+			constant.NOTFOUND,
+			"",
+			"Order not found",
+		)
 	}
 
 	if order.UserID != uID {
 		return apperror.New(
-            constant.UNAUTHORIZED, 
-            "", 
-            "Not authorized to delete this order",
-        )
+			constant.UNAUTHORIZED,
+			"",
+			"Not authorized to delete this order",
+		)
 	}
 
-	if order.Status != constant.PLACED && order.Status != constant.CANCELLED {
+	if !userCancellable[order.Status] && order.Status != constant.CANCELLED {
 		return apperror.New(
-            constant.BADREQUEST,
-             "",
-              "Order cannot be deleted at this stage",
-            )
+			constant.BADREQUEST,
+			"",
+			"Order cannot be deleted at this stage",
+		)
 	}
 
-	if err := s.repo.Exec("DELETE FROM order_items WHERE order_id = ?", oID).Error; err != nil {
-		return apperror.New(
-            constant.INTERNALSERVERERROR,
-             "",
-              "Failed to delete order items",
-            )
+	// Payments are kept for accounting, so their orders stay too
+	var paymentCount int64
+	if err := db.Raw("SELECT COUNT(*) FROM payments WHERE order_id = ?", oID).Scan(&paymentCount).Error; err != nil {
+		return apperror.ErrInternal
 	}
-
-	if err := s.repo.Delete(&model.Order{}, oID); err != nil {
+	if paymentCount > 0 {
 		return apperror.New(
-            constant.INTERNALSERVERERROR, 
-            "", 
-            "Failed to delete order",
-        )
+			constant.BADREQUEST,
+			"",
+			"Orders with payments cannot be deleted",
+		)
 	}
 
-	return nil
-}
+	// Items and order go together or not at all
+	return s.repo.WithTransaction(ctx, func(tx repo.IPgSQLRepository) error {
+		// Cancelled orders already gave their stock back
+		if order.Status != constant.CANCELLED {
+			if err := restockOrderItems(tx, oID); err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Exec("DELETE FROM order_items WHERE order_id = ?", oID).Error; err != nil {
+			return apperror.New(
+				constant.INTERNALSERVERERROR,
+				"",
+				"Failed to delete order items",
+			)
+		}
 
+		if err := tx.Exec("DELETE FROM order_status_history WHERE order_id = ?", oID).Error; err != nil {
+			return apperror.New(
+				constant.INTERNALSERVERERROR,
+				"",
+				"Failed to delete order history",
+			)
+		}
+
+		if err := tx.Delete(&model.Order{}, oID); err != nil {
+			return apperror.New(
+				constant.INTERNALSERVERERROR,
+				"",
+				"Failed to delete order",
+			)
+		}
 
+		return nil
+	})
+}
 
+/* =======================
+   UPDATE ORDER STATUS BY ID
+   ======================= */
+
+// UpdateOrderStatusByID moves an order along its lifecycle. Admins may make
+// any legal transition; users may only cancel their own orders while they
+// are still PENDING_PAYMENT or PLACED.
 func (s *OrderService) UpdateOrderStatusByID(
+	ctx context.Context,
 	userID string,
 	orderID string,
 	status string,
+	reason string,
 	isAdmin bool,
 ) (*model.Order, error) {
 
@@ -400,14 +632,7 @@ func (s *OrderService) UpdateOrderStatusByID(
 	}
 
 	// Validate status
-	validStatuses := map[string]bool{
-		constant.PLACED:    true,
-		constant.SHIPPED:   true,
-		constant.DELIVERED: true,
-		constant.CANCELLED: true,
-	}
-
-	if !validStatuses[status] {
+	if !IsValidOrderStatus(status) {
 		return nil, apperror.New(
 			constant.BADREQUEST,
 			"",
@@ -415,66 +640,92 @@ func (s *OrderService) UpdateOrderStatusByID(
 		)
 	}
 
-	// Fetch order
-	var order model.Order
-	if err := s.repo.FindByIdWithPreload(&order, oID, "Items.Product"); err != nil {
+	if refundOrderStatuses[status] {
 		return nil, apperror.New(
-			constant.NOTFOUND,
+			constant.BADREQUEST,
 			"",
-			"Order not found",
+			"Refund statuses are set by refunds, use the refund endpoints",
 		)
 	}
 
-	// USER restrictions
+	actor := OrderActor{UserID: userID, Role: constant.ACTOR_ADMIN}
 	if !isAdmin {
-		uID, err := uuid.Parse(userID)
-		if err != nil {
-			return nil, apperror.New(
-				constant.BADREQUEST,
+		actor.Role = constant.ACTOR_USER
+	}
+
+	err = s.repo.WithTransaction(ctx, func(tx repo.IPgSQLRepository) error {
+		// Fetch order
+		var order model.Order
+		if err := tx.FindById(&order, oID); err != nil {
+			return apperror.New(
+				constant.NOTFOUND,
 				"",
-				"Invalid user id",
+				"Order not found",
 			)
 		}
 
-		if order.UserID != uID {
-			return nil, apperror.New(
-				constant.FORBIDDEN,
-				"",
-				"You are not allowed to update this order",
-			)
+		// USER restrictions
+		if !isAdmin {
+			uID, err := uuid.Parse(userID)
+			if err != nil {
+				return apperror.New(
+					constant.BADREQUEST,
+					"",
+					"Invalid user id",
+				)
+			}
+
+			if order.UserID != uID {
+				return apperror.New(
+					constant.FORBIDDEN,
+					"",
+					"You are not allowed to update this order",
+				)
+			}
+
+			// Users can ONLY cancel, and only before packing
+			if status != constant.CANCELLED {
+				return apperror.New(
+					constant.FORBIDDEN,
+					"",
+					"Users can only cancel orders",
+				)
+			}
+
+			if !userCancellable[order.Status] {
+				return apperror.New(
+					constant.BADREQUEST,
+					"",
+					"Order can no longer be cancelled",
+				)
+			}
 		}
 
-		// Users can ONLY cancel
-		if status != constant.CANCELLED {
-			return nil, apperror.New(
-				constant.FORBIDDEN,
-				"",
-				"Users can only cancel orders",
-			)
+		from := order.Status
+		if err := transitionOrder(tx, &order, status, actor, reason); err != nil {
+			return err
 		}
-	}
 
-	// Update status
-	if err := s.repo.UpdateByFields(
-		&model.Order{},
-		oID,
-		map[string]interface{}{"status": status},
-	); err != nil {
-		return nil, apperror.New(
-			constant.INTERNALSERVERERROR,
-			"",
-			"Failed to update order status",
-		)
+		if !isAdmin {
+			return nil
+		}
+		return recordAudit(ctx, tx, AuditEntry{
+			Action:     constant.AUDIT_ORDER_STATUS,
+			EntityType: constant.ENTITY_ORDER,
+			EntityID:   order.ID.String(),
+			Before:     map[string]interface{}{"status": from},
+			After:      map[string]interface{}{"status": status, "reason": reason},
+		})
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	// Reload updated order
-	if err := s.repo.FindByIdWithPreload(&order, oID, "Items.Product"); err != nil {
-		return nil, apperror.New(
-			constant.INTERNALSERVERERROR,
-			"",
-			"Failed to load updated order",
-		)
+	// Give the money back once the cancellation is committed
+	if status == constant.CANCELLED && s.payments != nil {
+		s.payments.refundCancelledOrder(ctx, oID, reason)
 	}
 
-	return &order, nil
+	// Reload updated order
+	return s.GetOrderByIDAdmin(ctx, orderID)
 }
@@ -0,0 +1,192 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/google/uuid"
+
+	"vestra-ecommerce/src/model"
+	"vestra-ecommerce/src/repo"
+	constant "vestra-ecommerce/utils/constants"
+	"vestra-ecommerce/utils/utils/apperror"
+)
+
+/* =======================
+   ORDER LIFECYCLE
+   ======================= */
+
+// orderTransitions is the single source of truth for legal status changes:
+//
+//	PENDING_PAYMENT → PLACED → PACKED → SHIPPED → OUT_FOR_DELIVERY → DELIVERED
+//
+// Orders can be CANCELLED until they ship and RETURNED once they have shipped.
+// A paid CANCELLED or RETURNED order goes through REFUND_PENDING to REFUNDED
+// while its money is returned; otherwise CANCELLED and RETURNED are terminal.
+var orderTransitions = map[string][]string{
+	constant.PENDING_PAYMENT:  {constant.PLACED, constant.CANCELLED},
+	constant.PLACED:           {constant.PACKED, constant.CANCELLED},
+	constant.PACKED:           {constant.SHIPPED, constant.CANCELLED},
+	constant.SHIPPED:          {constant.OUT_FOR_DELIVERY, constant.DELIVERED, constant.RETURNED},
+	constant.OUT_FOR_DELIVERY: {constant.DELIVERED, constant.RETURNED},
+	constant.DELIVERED:        {constant.RETURNED},
+	constant.CANCELLED:        {constant.REFUND_PENDING},
+	constant.RETURNED:         {constant.REFUND_PENDING},
+	constant.REFUND_PENDING:   {constant.REFUNDED},
+	constant.REFUNDED:         {},
+}
+
+// refundOrderStatuses are driven by the refund flow only and can't be set
+// through the order status endpoints.
+var refundOrderStatuses = map[string]bool{
+	constant.REFUND_PENDING: true,
+	constant.REFUNDED:       true,
+}
+
+// userCancellable lists the statuses from which customers may cancel on
+// their own; later stages need an admin.
+var userCancellable = map[string]bool{
+	constant.PENDING_PAYMENT: true,
+	constant.PLACED:          true,
+}
+
+// IsValidOrderStatus reports whether status is part of the lifecycle
+func IsValidOrderStatus(status string) bool {
+	_, ok := orderTransitions[status]
+	return ok
+}
+
+// CanTransitionOrder reports whether an order may move from one status to another
+func CanTransitionOrder(from, to string) bool {
+	for _, next := range orderTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// OrderActor identifies who is changing an order
+type OrderActor struct {
+	UserID string
+	Role   string // constant.ACTOR_USER, ACTOR_ADMIN or ACTOR_SYSTEM
+}
+
+func (a OrderActor) userUUID() *uuid.UUID {
+	id, err := uuid.Parse(a.UserID)
+	if err != nil {
+		return nil
+	}
+	return &id
+}
+
+// recordOrderStatus appends a history row; from is empty for new orders
+func recordOrderStatus(tx repo.IPgSQLRepository, orderID uuid.UUID, from, to string, actor OrderActor, reason string) error {
+	entry := model.OrderStatusHistory{
+		OrderID:    orderID,
+		FromStatus: from,
+		ToStatus:   to,
+		ChangedBy:  actor.userUUID(),
+		ActorRole:  actor.Role,
+		Reason:     reason,
+	}
+	return tx.Insert(&entry)
+}
+
+// transitionOrder moves order to status inside tx, enforcing the lifecycle,
+// recording history and releasing reserved stock when an order is cancelled.
+// The status column is only updated if it still holds the status we read, so
+// two concurrent transitions can't both succeed.
+func transitionOrder(tx repo.IPgSQLRepository, order *model.Order, to string, actor OrderActor, reason string) error {
+	if !IsValidOrderStatus(to) {
+		return apperror.New(
+			constant.BADREQUEST,
+			"",
+			"Invalid order status",
+		)
+	}
+
+	if !CanTransitionOrder(order.Status, to) {
+		return apperror.New(
+			constant.CONFLICT,
+			constant.INVALID_STATUS_TRANSITION,
+			fmt.Sprintf("Cannot change order status from %s to %s", order.Status, to),
+		)
+	}
+
+	res := tx.Exec(
+		"UPDATE orders SET status = ? WHERE id = ? AND status = ?",
+		to,
+		order.ID,
+		order.Status,
+	)
+	if res.Error != nil {
+		return apperror.New(
+			constant.INTERNALSERVERERROR,
+			"",
+			"Failed to update order status",
+		)
+	}
+	if res.RowsAffected == 0 {
+		return apperror.New(
+			constant.CONFLICT,
+			constant.INVALID_STATUS_TRANSITION,
+			"Order status was changed concurrently, please retry",
+		)
+	}
+
+	if to == constant.CANCELLED {
+		if err := restockOrderItems(tx, order.ID); err != nil {
+			return err
+		}
+	}
+
+	if err := recordOrderStatus(tx, order.ID, order.Status, to, actor, reason); err != nil {
+		return apperror.New(
+			constant.INTERNALSERVERERROR,
+			"",
+			"Failed to record order status history",
+		)
+	}
+
+	order.Status = to
+	return nil
+}
+
+// restockOrderItems puts the quantities of an order back on the shelf
+func restockOrderItems(tx repo.IPgSQLRepository, orderID uuid.UUID) error {
+	var items []model.OrderItem
+	if err := tx.FindAllWhere(&items, "order_id = ?", orderID); err != nil {
+		return apperror.New(
+			constant.INTERNALSERVERERROR,
+			"",
+			"Failed to load order items",
+		)
+	}
+
+	for _, item := range items {
+		if err := tx.Exec(
+			"UPDATE product_sizes SET quantity = quantity + ? WHERE product_id = ? AND size = ?",
+			item.Quantity,
+			item.ProductID,
+			item.Size,
+		).Error; err != nil {
+			return apperror.New(
+				constant.INTERNALSERVERERROR,
+				"",
+				"Failed to release stock",
+			)
+		}
+	}
+
+	return nil
+}
+
+// sortStatusHistory orders history oldest first
+func sortStatusHistory(orders ...*model.Order) {
+	for _, o := range orders {
+		sort.SliceStable(o.StatusHistory, func(i, j int) bool {
+			return o.StatusHistory[i].CreatedAt.Before(o.StatusHistory[j].CreatedAt)
+		})
+	}
+}
@@ -0,0 +1,250 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"vestra-ecommerce/src/model"
+	"vestra-ecommerce/src/repo"
+	constant "vestra-ecommerce/utils/constants"
+	"vestra-ecommerce/utils/utils/apperror"
+)
+
+var allOrderStatuses = []string{
+	constant.PENDING_PAYMENT,
+	constant.PLACED,
+	constant.PACKED,
+	constant.SHIPPED,
+	constant.OUT_FOR_DELIVERY,
+	constant.DELIVERED,
+	constant.CANCELLED,
+	constant.RETURNED,
+	constant.REFUND_PENDING,
+	constant.REFUNDED,
+}
+
+// orderStore holds a single order for the status endpoints; anything else
+// they might call panics on the nil embedded repository
+type orderStore struct {
+	repo.IPgSQLRepository
+	order   model.Order
+	history []model.OrderStatusHistory
+}
+
+func (s *orderStore) WithContext(context.Context) repo.IPgSQLRepository { return s }
+
+func (s *orderStore) WithTransaction(ctx context.Context, fn func(repo.IPgSQLRepository) error) error {
+	saved := *s
+	if err := fn(s); err != nil {
+		*s = saved
+		return err
+	}
+	return nil
+}
+
+func (s *orderStore) FindById(obj interface{}, id interface{}) error {
+	*obj.(*model.Order) = s.order
+	return nil
+}
+
+func (s *orderStore) FindByIdWithPreload(obj interface{}, id interface{}, preloads ...string) error {
+	return s.FindById(obj, id)
+}
+
+func (s *orderStore) FindAllWhere(obj interface{}, query interface{}, args ...interface{}) error {
+	return nil
+}
+
+func (s *orderStore) Exec(sql string, values ...interface{}) *gorm.DB {
+	// UPDATE orders SET status = ? WHERE id = ? AND status = ?
+	if values[2] != s.order.Status {
+		return &gorm.DB{}
+	}
+	s.order.Status = values[0].(string)
+	return &gorm.DB{RowsAffected: 1}
+}
+
+func (s *orderStore) Insert(req interface{}) error {
+	s.history = append(s.history, *req.(*model.OrderStatusHistory))
+	return nil
+}
+
+func TestOrderLifecycle(t *testing.T) {
+	tests := []struct {
+		name     string
+		from, to string
+		want     bool
+	}{
+		{"pay", constant.PENDING_PAYMENT, constant.PLACED, true},
+		{"pack", constant.PLACED, constant.PACKED, true},
+		{"ship", constant.PACKED, constant.SHIPPED, true},
+		{"hand to courier", constant.SHIPPED, constant.OUT_FOR_DELIVERY, true},
+		{"deliver", constant.OUT_FOR_DELIVERY, constant.DELIVERED, true},
+		{"deliver without courier step", constant.SHIPPED, constant.DELIVERED, true},
+		{"cancel unpaid", constant.PENDING_PAYMENT, constant.CANCELLED, true},
+		{"cancel packed", constant.PACKED, constant.CANCELLED, true},
+		{"cancel shipped", constant.SHIPPED, constant.CANCELLED, false},
+		{"cancel out for delivery", constant.OUT_FOR_DELIVERY, constant.CANCELLED, false},
+		{"cancel delivered", constant.DELIVERED, constant.CANCELLED, false},
+		{"return delivered", constant.DELIVERED, constant.RETURNED, true},
+		{"return in transit", constant.OUT_FOR_DELIVERY, constant.RETURNED, true},
+		{"return before shipping", constant.PACKED, constant.RETURNED, false},
+		{"ship unpaid", constant.PENDING_PAYMENT, constant.SHIPPED, false},
+		{"skip packing", constant.PLACED, constant.SHIPPED, false},
+		{"unship", constant.SHIPPED, constant.PACKED, false},
+		{"undeliver", constant.DELIVERED, constant.SHIPPED, false},
+		{"refund cancelled", constant.CANCELLED, constant.REFUND_PENDING, true},
+		{"refund returned", constant.RETURNED, constant.REFUND_PENDING, true},
+		{"finish refund", constant.REFUND_PENDING, constant.REFUNDED, true},
+		{"refund without pending", constant.CANCELLED, constant.REFUNDED, false},
+		{"refund delivered", constant.DELIVERED, constant.REFUND_PENDING, false},
+		{"reopen cancelled", constant.CANCELLED, constant.PLACED, false},
+		{"same status", constant.PLACED, constant.PLACED, false},
+		{"unknown source", "LOST", constant.PLACED, false},
+		{"lower case", "placed", "packed", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CanTransitionOrder(tt.from, tt.to); got != tt.want {
+				t.Errorf("CanTransitionOrder(%s, %s) = %v, want %v", tt.from, tt.to, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTerminalOrderStatuses(t *testing.T) {
+	for _, to := range allOrderStatuses {
+		if CanTransitionOrder(constant.REFUNDED, to) {
+			t.Errorf("refunded order can move to %s", to)
+		}
+	}
+
+	// Cancelled and returned orders only move on to give the money back
+	for _, from := range []string{constant.CANCELLED, constant.RETURNED} {
+		for _, to := range allOrderStatuses {
+			if CanTransitionOrder(from, to) && !refundOrderStatuses[to] {
+				t.Errorf("%s order can move to %s", from, to)
+			}
+		}
+	}
+}
+
+func TestAdminCannotSetRefundStatuses(t *testing.T) {
+	for _, status := range []string{constant.REFUND_PENDING, constant.REFUNDED} {
+		t.Run(status, func(t *testing.T) {
+			store := &orderStore{order: model.Order{ID: uuid.New(), UserID: uuid.New(), Status: constant.CANCELLED}}
+			svc := &OrderService{repo: store}
+
+			_, err := svc.UpdateOrderStatus(context.Background(), uuid.NewString(), store.order.ID.String(), status, "")
+
+			appErr, ok := err.(*apperror.AppError)
+			if !ok || appErr.Status != constant.BADREQUEST {
+				t.Fatalf("err = %v, want 400", err)
+			}
+			if store.order.Status != constant.CANCELLED || len(store.history) != 0 {
+				t.Errorf("order moved to %s", store.order.Status)
+			}
+		})
+	}
+}
+
+func TestCustomerCancel(t *testing.T) {
+	owner := uuid.New()
+
+	for _, from := range allOrderStatuses {
+		t.Run(from, func(t *testing.T) {
+			store := &orderStore{order: model.Order{ID: uuid.New(), UserID: owner, Status: from}}
+			svc := &OrderService{repo: store}
+
+			order, err := svc.CancelOrder(context.Background(), owner.String(), store.order.ID.String(), "changed my mind")
+
+			if from == constant.PENDING_PAYMENT || from == constant.PLACED {
+				if err != nil {
+					t.Fatalf("CancelOrder: %v", err)
+				}
+				if order.Status != constant.CANCELLED || len(store.history) != 1 {
+					t.Errorf("status = %s with %d history rows, want CANCELLED with 1", order.Status, len(store.history))
+				}
+				if h := store.history[0]; h.FromStatus != from || h.ActorRole != constant.ACTOR_USER {
+					t.Errorf("history = %s by %s, want %s by %s", h.FromStatus, h.ActorRole, from, constant.ACTOR_USER)
+				}
+				return
+			}
+
+			if _, ok := err.(*apperror.AppError); !ok {
+				t.Fatalf("err = %v, want an AppError", err)
+			}
+			if store.order.Status != from || len(store.history) != 0 {
+				t.Errorf("order moved to %s, want it left at %s", store.order.Status, from)
+			}
+		})
+	}
+}
+
+func TestCustomerStatusRestrictions(t *testing.T) {
+	owner := uuid.New()
+
+	tests := []struct {
+		name   string
+		userID string
+		status string
+	}{
+		{"other customer cancels", uuid.NewString(), constant.CANCELLED},
+		{"owner marks paid", owner.String(), constant.PLACED},
+		{"owner marks delivered", owner.String(), constant.DELIVERED},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &orderStore{order: model.Order{ID: uuid.New(), UserID: owner, Status: constant.PLACED}}
+			svc := &OrderService{repo: store}
+
+			_, err := svc.UpdateOrderStatusByID(context.Background(), tt.userID, store.order.ID.String(), tt.status, "", false)
+
+			appErr, ok := err.(*apperror.AppError)
+			if !ok || appErr.Status != constant.FORBIDDEN {
+				t.Fatalf("err = %v, want 403", err)
+			}
+			if store.order.Status != constant.PLACED {
+				t.Errorf("order moved to %s", store.order.Status)
+			}
+		})
+	}
+}
+
+func TestTransitionOrderRejects(t *testing.T) {
+	tests := []struct {
+		name       string
+		from, to   string
+		wantStatus int
+		wantCode   string
+	}{
+		{"unknown status", constant.PLACED, "LOST", constant.BADREQUEST, ""},
+		{"skips a stage", constant.PLACED, constant.SHIPPED, constant.CONFLICT, constant.INVALID_STATUS_TRANSITION},
+		{"cancel after shipping", constant.SHIPPED, constant.CANCELLED, constant.CONFLICT, constant.INVALID_STATUS_TRANSITION},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order := &model.Order{Status: tt.from}
+
+			// Rejected before the database is touched, so no repository is needed
+			err := transitionOrder(nil, order, tt.to, OrderActor{Role: constant.ACTOR_ADMIN}, "")
+
+			appErr, ok := err.(*apperror.AppError)
+			if !ok {
+				t.Fatalf("err = %v, want an AppError", err)
+			}
+			if appErr.Status != tt.wantStatus || appErr.Code != tt.wantCode {
+				t.Errorf("err = %d %q, want %d %q", appErr.Status, appErr.Code, tt.wantStatus, tt.wantCode)
+			}
+			if order.Status != tt.from {
+				t.Errorf("status = %s, want it left at %s", order.Status, tt.from)
+			}
+		})
+	}
+}
@@ -0,0 +1,220 @@
+package services
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/google/uuid"
+
+	"vestra-ecommerce/src/model"
+	"vestra-ecommerce/src/repo"
+	constant "vestra-ecommerce/utils/constants"
+	"vestra-ecommerce/utils/otp"
+	"vestra-ecommerce/utils/utils/apperror"
+)
+
+// OTPPolicy bounds how codes are sent and guessed. Zero fields take the
+// defaults below.
+type OTPPolicy struct {
+	Expiry          time.Duration
+	MaxAttempts     int           // wrong guesses before the code is locked
+	Lockout         time.Duration // how long a locked user waits
+	ResendCooldown  time.Duration // minimum gap between two codes
+	MaxSendsPerHour int
+}
+
+type OTPService struct {
+	repo   repo.IPgSQLRepository
+	policy OTPPolicy
+}
+
+func NewOTPService(repo repo.IPgSQLRepository, policy OTPPolicy) *OTPService {
+	if policy.Expiry <= 0 {
+		policy.Expiry = otp.OTPValidity
+	}
+	if policy.MaxAttempts <= 0 {
+		policy.MaxAttempts = 5
+	}
+	if policy.Lockout <= 0 {
+		policy.Lockout = 15 * time.Minute
+	}
+	if policy.ResendCooldown <= 0 {
+		policy.ResendCooldown = time.Minute
+	}
+	if policy.MaxSendsPerHour <= 0 {
+		policy.MaxSendsPerHour = 5
+	}
+	return &OTPService{repo: repo, policy: policy}
+}
+
+// Issue creates a fresh code for the user and purpose, replacing any earlier
+// one, and returns it in plain text for the caller to deliver. It refuses
+// while the user is locked out, within the resend cooldown or over the
+// hourly send limit.
+func (s *OTPService) Issue(ctx context.Context, userID uuid.UUID, purpose string) (string, error) {
+	code := otp.Generate()
+	hash, err := otp.HashOTP(code)
+	if err != nil {
+		return "", apperror.ErrInternal
+	}
+
+	err = s.repo.WithTransaction(ctx, func(tx repo.IPgSQLRepository) error {
+		now := time.Now()
+
+		var current model.OTPCode
+		if err := tx.Raw(
+			"SELECT * FROM otp_codes WHERE user_id = ? AND purpose = ? FOR UPDATE",
+			userID, purpose,
+		).Scan(&current).Error; err != nil {
+			return err
+		}
+
+		if current.ID == uuid.Nil {
+			return tx.Insert(&model.OTPCode{
+				UserID:          userID,
+				Purpose:         purpose,
+				CodeHash:        hash,
+				ExpiresAt:       now.Add(s.policy.Expiry),
+				LastSentAt:      now,
+				SendCount:       1,
+				SendWindowStart: now,
+			})
+		}
+
+		if current.LockedUntil != nil && now.Before(*current.LockedUntil) {
+			return otpLocked(*current.LockedUntil)
+		}
+
+		if wait := current.LastSentAt.Add(s.policy.ResendCooldown).Sub(now); wait > 0 {
+			return apperror.New(
+				constant.TOOMANYREQUESTS,
+				constant.OTP_COOLDOWN,
+				"Please wait before requesting another code",
+			).WithDetails(map[string]interface{}{"retry_after_seconds": secondsCeil(wait)})
+		}
+
+		windowStart, sends := current.SendWindowStart, current.SendCount
+		if now.Sub(windowStart) >= time.Hour {
+			windowStart, sends = now, 0
+		}
+		if sends >= s.policy.MaxSendsPerHour {
+			return apperror.New(
+				constant.TOOMANYREQUESTS,
+				constant.RATE_LIMITED,
+				"Too many codes requested, try again later",
+			).WithDetails(map[string]interface{}{
+				"retry_after_seconds": secondsCeil(windowStart.Add(time.Hour).Sub(now)),
+			})
+		}
+
+		return tx.UpdateByFields(&model.OTPCode{}, current.ID, map[string]interface{}{
+			"code_hash":         hash,
+			"expires_at":        now.Add(s.policy.Expiry),
+			"consumed_at":       nil,
+			"attempts":          0,
+			"locked_until":      nil,
+			"last_sent_at":      now,
+			"send_count":        sends + 1,
+			"send_window_start": windowStart,
+		})
+	})
+	if err != nil {
+		if appErr, ok := err.(*apperror.AppError); ok {
+			return "", appErr
+		}
+		return "", apperror.ErrInternal
+	}
+
+	return code, nil
+}
+
+// Verify checks a code and consumes it on success. Every wrong guess counts;
+// reaching MaxAttempts locks the user out for the lockout period and burns
+// the code, so a new one has to be requested afterwards.
+func (s *OTPService) Verify(ctx context.Context, userID uuid.UUID, purpose, code string) error {
+	// The outcome is decided inside the transaction, but a failed guess must
+	// still commit its attempt count, so the transaction itself succeeds
+	var result error
+
+	err := s.repo.WithTransaction(ctx, func(tx repo.IPgSQLRepository) error {
+		now := time.Now()
+
+		var current model.OTPCode
+		if err := tx.Raw(
+			"SELECT * FROM otp_codes WHERE user_id = ? AND purpose = ? FOR UPDATE",
+			userID, purpose,
+		).Scan(&current).Error; err != nil {
+			return err
+		}
+
+		if current.ID == uuid.Nil {
+			result = apperror.New(
+				constant.BADREQUEST,
+				constant.OTP_INVALID,
+				"Invalid OTP",
+			)
+			return nil
+		}
+
+		if current.LockedUntil != nil && now.Before(*current.LockedUntil) {
+			result = otpLocked(*current.LockedUntil)
+			return nil
+		}
+
+		if current.ConsumedAt != nil || now.After(current.ExpiresAt) {
+			result = apperror.New(
+				constant.BADREQUEST,
+				constant.OTP_EXPIRED,
+				"OTP expired, please request a new one",
+			)
+			return nil
+		}
+
+		if err := otp.VerifyOTP(current.CodeHash, code, current.ExpiresAt); err != nil {
+			attempts := current.Attempts + 1
+			updates := map[string]interface{}{"attempts": attempts}
+
+			if attempts >= s.policy.MaxAttempts {
+				lockedUntil := now.Add(s.policy.Lockout)
+				updates["locked_until"] = lockedUntil
+				updates["expires_at"] = now
+				result = otpLocked(lockedUntil)
+			} else {
+				result = apperror.New(
+					constant.BADREQUEST,
+					constant.OTP_INVALID,
+					"Invalid OTP",
+				).WithDetails(map[string]interface{}{
+					"attempts_remaining": s.policy.MaxAttempts - attempts,
+				})
+			}
+
+			return tx.UpdateByFields(&model.OTPCode{}, current.ID, updates)
+		}
+
+		return tx.UpdateByFields(&model.OTPCode{}, current.ID, map[string]interface{}{
+			"consumed_at": now,
+			"attempts":    0,
+		})
+	})
+	if err != nil {
+		return apperror.ErrInternal
+	}
+
+	return result
+}
+
+func otpLocked(until time.Time) *apperror.AppError {
+	return apperror.New(
+		constant.TOOMANYREQUESTS,
+		constant.OTP_LOCKED,
+		"Too many wrong codes, try again later",
+	).WithDetails(map[string]interface{}{
+		"retry_after_seconds": secondsCeil(time.Until(until)),
+	})
+}
+
+func secondsCeil(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
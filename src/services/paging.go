@@ -0,0 +1,66 @@
+package services
+
+import (
+	"sort"
+	"strings"
+
+	"vestra-ecommerce/src/repo"
+	constant "vestra-ecommerce/utils/constants"
+	"vestra-ecommerce/utils/pagination"
+	"vestra-ecommerce/utils/utils/apperror"
+)
+
+// pageSort resolves the sort a page asks for against a list's whitelist
+func pageSort(page pagination.Params, allowed map[string]string, def string) (pagination.Sort, error) {
+	s, err := pagination.ParseSort(page.Sort, allowed, def)
+	if err != nil {
+		fields := make([]string, 0, len(allowed))
+		for field := range allowed {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+		return s, apperror.New(
+			constant.BADREQUEST,
+			constant.INVALID_REQUEST,
+			"sort must be one of "+strings.Join(fields, ", ")+" (prefix - for descending)",
+		)
+	}
+	return s, nil
+}
+
+// afterCursor narrows where to the rows of table after the page's cursor,
+// if any. A cursor whose row has since been deleted can't be continued
+// from, so it is rejected like a malformed one.
+func afterCursor(db repo.IPgSQLRepository, page pagination.Params, s pagination.Sort, table, where string, args []interface{}) (string, []interface{}, error) {
+	invalid := apperror.New(
+		constant.BADREQUEST,
+		constant.INVALID_REQUEST,
+		"Invalid or expired cursor; start again from the first page",
+	)
+
+	id, err := s.CursorKey(page)
+	if err != nil {
+		return "", nil, invalid
+	}
+	if id == "" {
+		return where, args, nil
+	}
+
+	var exists bool
+	if err := db.Raw("SELECT EXISTS (SELECT 1 FROM "+table+" WHERE id = ?)", id).Scan(&exists).Error; err != nil {
+		return "", nil, apperror.New(
+			constant.INTERNALSERVERERROR,
+			"",
+			"Failed to read page cursor",
+		)
+	}
+	if !exists {
+		return "", nil, invalid
+	}
+
+	where, args, err = s.After(page, table, "id", where, args)
+	if err != nil {
+		return "", nil, invalid
+	}
+	return where, args, nil
+}
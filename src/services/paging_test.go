@@ -0,0 +1,57 @@
+package services
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"vestra-ecommerce/src/model"
+	constant "vestra-ecommerce/utils/constants"
+	"vestra-ecommerce/utils/pagination"
+	"vestra-ecommerce/utils/utils/apperror"
+)
+
+func TestAfterCursor(t *testing.T) {
+	db := newFakeRepo(t)
+	user := seedUser(t, db, model.User{Name: "Cursor", Email: "cursor@example.com"})
+
+	sortBy := pagination.Sort{Field: "created_at", Expr: "created_at", Desc: true}
+	cursor := func(key string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(sortBy.String() + "|" + key))
+	}
+
+	tests := []struct {
+		name       string
+		cursor     string
+		wantStatus int
+	}{
+		{"first page", "", 0},
+		{"row still there", cursor(user.ID.String()), 0},
+		{"row deleted", cursor(uuid.NewString()), constant.BADREQUEST},
+		{"key not a uuid", cursor("1 OR 1=1"), constant.BADREQUEST},
+		{"garbage", "%%%", constant.BADREQUEST},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page := pagination.Params{Limit: 20, Cursor: tt.cursor}
+			where, _, err := afterCursor(db, page, sortBy, "users", "TRUE", nil)
+
+			if tt.wantStatus == 0 {
+				if err != nil {
+					t.Fatalf("afterCursor: %v", err)
+				}
+				if (tt.cursor == "") != (where == "TRUE") {
+					t.Errorf("where = %q", where)
+				}
+				return
+			}
+
+			appErr, ok := err.(*apperror.AppError)
+			if !ok || appErr.Status != tt.wantStatus {
+				t.Fatalf("err = %v, want %d", err, tt.wantStatus)
+			}
+		})
+	}
+}
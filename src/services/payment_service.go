@@ -1,30 +1,40 @@
 package services
 
 import (
+	"context"
+	"errors"
 	"time"
 
 	"vestra-ecommerce/src/model"
 	"vestra-ecommerce/src/repo"
 	constant "vestra-ecommerce/utils/constants"
+	"vestra-ecommerce/utils/gateway"
+	"vestra-ecommerce/utils/money"
+	"vestra-ecommerce/utils/pagination"
 	"vestra-ecommerce/utils/utils/apperror"
+
+	"github.com/google/uuid"
 )
 
 type PaymentService struct {
-	repo repo.IPgSQLRepository
+	repo    repo.IPgSQLRepository
+	gateway gateway.PaymentGateway
 }
 
-func NewPaymentService(repo repo.IPgSQLRepository) *PaymentService {
-	return &PaymentService{repo: repo}
+func NewPaymentService(repo repo.IPgSQLRepository, gw gateway.PaymentGateway) *PaymentService {
+	return &PaymentService{repo: repo, gateway: gw}
 }
 
 /* =======================
    DTOs
    ======================= */
 
+// VerifyPaymentRequest is what the client got back from the provider
+// checkout. The resulting status is decided by the provider, not the client.
 type VerifyPaymentRequest struct {
 	PaymentID     string `json:"payment_id" validate:"required"`
-	TransactionID string `json:"transaction_id" validate:"required"`
-	Status        string `json:"status" validate:"required"`
+	TransactionID string `json:"transaction_id" validate:"required"` // provider payment ID
+	Signature     string `json:"signature" validate:"required"`
 }
 
 /* =======================
@@ -32,21 +42,130 @@ type VerifyPaymentRequest struct {
    ======================= */
 
 func (s *PaymentService) CreatePayment(
+	ctx context.Context,
 	userID string,
 	req model.PaymentRequest,
 ) (*model.Payment, error) {
 
+	db := s.repo.WithContext(ctx)
+
+	uID, err := uuid.Parse(userID)
+	if err != nil {
+		return nil, apperror.New(
+			constant.BADREQUEST,
+			"",
+			"Invalid user ID",
+		)
+	}
+
+	oID, err := uuid.Parse(req.OrderID)
+	if err != nil {
+		return nil, apperror.New(
+			constant.BADREQUEST,
+			"",
+			"Invalid order ID",
+		)
+	}
+
 	payment := &model.Payment{
-		UserID:        userID,
-		OrderID:       req.OrderID,
-		Amount:        req.Amount,
+		UserID:        uID,
 		PaymentMethod: req.PaymentMethod,
 		Status:        constant.PENDING,
+		Provider:      s.gateway.Name(),
 		CreatedAt:     time.Now(),
 		UpdatedAt:     time.Now(),
 	}
 
-	if err := s.repo.Insert(payment); err != nil {
+	// The order stays locked until the payment row exists, so concurrent
+	// requests can't both see no payment in progress and open two intents
+	// that could both be captured
+	err = s.repo.WithTransaction(ctx, func(tx repo.IPgSQLRepository) error {
+		var order model.Order
+		res := tx.Raw("SELECT * FROM orders WHERE id = ? FOR UPDATE", oID).Scan(&order)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 || order.UserID != uID {
+			return apperror.New(
+				constant.NOTFOUND,
+				"",
+				"Order not found",
+			)
+		}
+
+		if order.Status != constant.PENDING_PAYMENT {
+			return apperror.New(
+				constant.BADREQUEST,
+				"",
+				"Order is not awaiting payment",
+			)
+		}
+
+		if !order.Total.IsPositive() {
+			return apperror.New(
+				constant.BADREQUEST,
+				"",
+				"Order total must be greater than zero",
+			)
+		}
+
+		var inProgress int64
+		if err := tx.Raw(
+			"SELECT COUNT(*) FROM payments WHERE order_id = ? AND status = ?",
+			order.ID,
+			constant.PENDING,
+		).Scan(&inProgress).Error; err != nil {
+			return err
+		}
+		if inProgress > 0 {
+			return apperror.New(
+				constant.CONFLICT,
+				constant.PAYMENT_IN_PROGRESS,
+				"A payment for this order is already in progress; complete or cancel it first",
+			)
+		}
+
+		// The amount always comes from the order, never from the client
+		payment.OrderID = order.ID
+		payment.Amount = order.Total
+
+		return tx.Insert(payment)
+	})
+	if err != nil {
+		if appErr, ok := err.(*apperror.AppError); ok {
+			return nil, appErr
+		}
+		return nil, apperror.New(
+			constant.INTERNALSERVERERROR,
+			"",
+			"Failed to create payment",
+		)
+	}
+
+	intent, err := s.gateway.CreateIntent(ctx, gateway.IntentRequest{
+		Reference: payment.ID,
+		Amount:    payment.Amount.Amount,
+		Currency:  payment.Amount.Currency,
+		Notes: map[string]string{
+			"order_id": payment.OrderID.String(),
+			"user_id":  userID,
+		},
+	})
+	if err != nil {
+		_ = db.UpdateByFields(&model.Payment{}, payment.ID, map[string]interface{}{
+			"status":     constant.FAILED,
+			"updated_at": time.Now(),
+		})
+		return nil, apperror.New(
+			constant.BADGATEWAY,
+			"",
+			"Payment provider unavailable",
+		)
+	}
+
+	if err := db.UpdateByFields(&model.Payment{}, payment.ID, map[string]interface{}{
+		"provider_intent_id": intent.ID,
+	}); err != nil {
 		return nil, apperror.New(
 			constant.INTERNALSERVERERROR,
 			"",
@@ -54,6 +173,9 @@ func (s *PaymentService) CreatePayment(
 		)
 	}
 
+	payment.ProviderIntentID = intent.ID
+	payment.Checkout = intent.ClientData
+
 	return payment, nil
 }
 
@@ -61,15 +183,24 @@ func (s *PaymentService) CreatePayment(
    VERIFY PAYMENT
    ======================= */
 
+// VerifyPayment confirms a checkout with the provider and records the
+// provider's verdict. Verifying an already settled payment is a no-op.
 func (s *PaymentService) VerifyPayment(
-	paymentID,
-	transactionID,
-	status string,
+	ctx context.Context,
+	userID string,
+	req VerifyPaymentRequest,
 ) (*model.Payment, error) {
 
+	db := s.repo.WithContext(ctx)
+
 	var payment model.Payment
 
-	if err := s.repo.FindById(&payment, paymentID); err != nil {
+	if err := db.FindOneWhere(
+		&payment,
+		"id = ? AND user_id = ?",
+		req.PaymentID,
+		userID,
+	); err != nil {
 		return nil, apperror.New(
 			constant.NOTFOUND,
 			"",
@@ -77,66 +208,162 @@ func (s *PaymentService) VerifyPayment(
 		)
 	}
 
-	// Only allow valid statuses
-	switch status {
-	case constant.PAID, constant.FAILED:
-	default:
+	if payment.Status == constant.PAID {
+		return &payment, nil
+	}
+
+	if payment.Status != constant.PENDING {
 		return nil, apperror.New(
 			constant.BADREQUEST,
 			"",
-			"Invalid payment status",
+			"Payment is not awaiting verification",
+		)
+	}
+
+	if req.TransactionID == "" || req.Signature == "" {
+		return nil, apperror.New(
+			constant.BADREQUEST,
+			"",
+			"transaction_id and signature are required",
 		)
 	}
 
-	updates := map[string]interface{}{
-		"status":         status,
-		"transaction_id": transactionID,
-		"updated_at":     time.Now(),
+	result, err := s.gateway.Verify(ctx, gateway.VerifyRequest{
+		IntentID:          payment.ProviderIntentID,
+		ProviderPaymentID: req.TransactionID,
+		Signature:         req.Signature,
+	})
+	if err != nil {
+		if errors.Is(err, gateway.ErrInvalidSignature) || errors.Is(err, gateway.ErrIntentMismatch) {
+			return nil, apperror.New(
+				constant.BADREQUEST,
+				"",
+				"Payment verification failed",
+			)
+		}
+		return nil, apperror.New(
+			constant.BADGATEWAY,
+			"",
+			"Payment provider unavailable",
+		)
 	}
 
-	if err := s.repo.UpdateByFields(&model.Payment{}, paymentID, updates); err != nil {
+	expected := payment.Amount
+	if !matchesAmount(expected, result.Amount, result.Currency) {
 		return nil, apperror.New(
-			constant.INTERNALSERVERERROR,
+			constant.CONFLICT,
 			"",
-			"Failed to verify payment",
+			"Paid amount does not match payment",
 		)
 	}
 
+	// Razorpay-style providers authorize first; we capture immediately
+	if result.Status == gateway.StatusAuthorized {
+		result, err = s.gateway.Capture(ctx, result.ProviderPaymentID, expected.Amount, expected.Currency)
+		if err != nil {
+			return nil, apperror.New(
+				constant.BADGATEWAY,
+				"",
+				"Failed to capture payment",
+			)
+		}
+	}
+
+	status := paymentStatusFromGateway(result.Status)
+	if status != constant.PENDING {
+		if _, err := s.settlePayment(ctx, &payment, status, result.ProviderPaymentID); err != nil {
+			return nil, apperror.New(
+				constant.INTERNALSERVERERROR,
+				"",
+				"Failed to verify payment",
+			)
+		}
+	}
+
 	// Reload
-	if err := s.repo.FindById(&payment, paymentID); err != nil {
+	if err := db.FindById(&payment, payment.ID); err != nil {
 		return nil, apperror.ErrInternal
 	}
 
 	return &payment, nil
 }
 
+// paymentStatusFromGateway maps a provider status to our payment status
+func paymentStatusFromGateway(status gateway.Status) string {
+	switch status {
+	case gateway.StatusCaptured:
+		return constant.PAID
+	case gateway.StatusFailed:
+		return constant.FAILED
+	default:
+		return constant.PENDING
+	}
+}
+
+// matchesAmount compares a provider amount (minor units) with ours; an
+// empty provider currency is taken to be ours
+func matchesAmount(expected money.Money, amount int64, currency string) bool {
+	if currency == "" {
+		currency = expected.Currency
+	}
+	return expected.Equal(money.New(amount, currency))
+}
+
 /* =======================
    USER PAYMENTS
    ======================= */
 
-func (s *PaymentService) GetPaymentsByUser(userID string) ([]model.Payment, error) {
-	var payments []model.Payment
+// paymentSorts are the fields payment lists can be sorted by
+var paymentSorts = map[string]string{
+	"created_at": "created_at",
+	"amount":     "amount_minor",
+}
 
-	if err := s.repo.FindAllWhere(&payments, "user_id = ?", userID); err != nil {
-		return nil, apperror.ErrInternal
+// GetPaymentsByUser returns a page of the user's payments, newest first by
+// default. Pages continue from a cursor.
+func (s *PaymentService) GetPaymentsByUser(ctx context.Context, userID string, page pagination.Params) ([]model.Payment, *pagination.Meta, error) {
+	db := s.repo.WithContext(ctx)
+
+	sortBy, err := pageSort(page, paymentSorts, "-created_at")
+	if err != nil {
+		return nil, nil, err
+	}
+	query, args, err := afterCursor(db, page, sortBy, "payments", "user_id = ?", []interface{}{userID})
+	if err != nil {
+		return nil, nil, err
 	}
 
-	return payments, nil
+	payments := []model.Payment{}
+
+	if err := db.FindPage(&payments, query, args, sortBy.OrderBy("id"), page.Limit+1, 0); err != nil {
+		return nil, nil, apperror.ErrInternal
+	}
+
+	meta := pagination.CursorMeta(page, sortBy, len(payments), func() string {
+		return payments[page.Limit-1].ID
+	})
+	if meta.HasMore {
+		payments = payments[:page.Limit]
+	}
+	return payments, meta, nil
 }
 
 func (s *PaymentService) GetPaymentByID(
+	ctx context.Context,
 	userID,
 	paymentID string,
 ) (*model.Payment, error) {
 
+	db := s.repo.WithContext(ctx)
+
 	var payment model.Payment
 
-	if err := s.repo.FindOneWhere(
+	if err := db.FindWhereWithPreload(
 		&payment,
 		"id = ? AND user_id = ?",
-		paymentID,
-		userID,
-	); err != nil {
+		[]interface{}{paymentID, userID},
+		"Refunds",
+	); err != nil || payment.ID == "" {
 		return nil, apperror.New(
 			constant.NOTFOUND,
 			"",
@@ -151,14 +378,21 @@ func (s *PaymentService) GetPaymentByID(
    CANCEL PAYMENT
    ======================= */
 
+// CancelPayment abandons a pending payment so the order can be paid again.
+// Providers such as Razorpay can't close an order, so the intent stays
+// recorded on the cancelled payment: a capture that still arrives for it
+// is matched by the webhook and flagged for reconciliation.
 func (s *PaymentService) CancelPayment(
+	ctx context.Context,
 	userID,
 	paymentID string,
 ) (*model.Payment, error) {
 
+	db := s.repo.WithContext(ctx)
+
 	var payment model.Payment
 
-	if err := s.repo.FindOneWhere(
+	if err := db.FindOneWhere(
 		&payment,
 		"id = ? AND user_id = ?",
 		paymentID,
@@ -171,25 +405,29 @@ func (s *PaymentService) CancelPayment(
 		)
 	}
 
-	if payment.Status != constant.PENDING {
+	// Only a payment that is still pending when the row is written; a
+	// verify or webhook may have settled it since it was read
+	res := db.Exec(
+		"UPDATE payments SET status = ?, updated_at = ? WHERE id = ? AND user_id = ? AND status = ?",
+		constant.CANCELLED,
+		time.Now(),
+		payment.ID,
+		userID,
+		constant.PENDING,
+	)
+	if res.Error != nil {
+		return nil, apperror.ErrInternal
+	}
+	if res.RowsAffected == 0 {
 		return nil, apperror.New(
-			constant.BADREQUEST,
+			constant.CONFLICT,
 			"",
 			"Only pending payments can be cancelled",
 		)
 	}
 
-	updates := map[string]interface{}{
-		"status":     constant.CANCELLED,
-		"updated_at": time.Now(),
-	}
-
-	if err := s.repo.UpdateByFields(&model.Payment{}, paymentID, updates); err != nil {
-		return nil, apperror.ErrInternal
-	}
-
 	// Reload
-	if err := s.repo.FindById(&payment, paymentID); err != nil {
+	if err := db.FindById(&payment, paymentID); err != nil {
 		return nil, apperror.ErrInternal
 	}
 
@@ -200,23 +438,39 @@ func (s *PaymentService) CancelPayment(
    ADMIN
    ======================= */
 
-func (s *PaymentService) GetAllPayments() ([]model.Payment, error) {
-	var payments []model.Payment
+// GetAllPayments returns a numbered page of every payment for the admin grid
+func (s *PaymentService) GetAllPayments(ctx context.Context, page pagination.Params) ([]model.Payment, *pagination.Meta, error) {
+	db := s.repo.WithContext(ctx)
 
-	if err := s.repo.FindAll(&payments); err != nil {
-		return nil, apperror.ErrInternal
+	sortBy, err := pageSort(page, paymentSorts, "-created_at")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	total, err := db.Count(&model.Payment{}, "1=1", []interface{}{})
+	if err != nil {
+		return nil, nil, apperror.ErrInternal
 	}
 
-	return payments, nil
+	payments := []model.Payment{}
+
+	if err := db.FindPage(&payments, "1=1", []interface{}{}, sortBy.OrderBy("id"), page.Limit, page.Offset()); err != nil {
+		return nil, nil, apperror.ErrInternal
+	}
+
+	return payments, pagination.OffsetMeta(page, sortBy, total), nil
 }
 
 func (s *PaymentService) GetPaymentByIDAdmin(
+	ctx context.Context,
 	paymentID string,
 ) (*model.Payment, error) {
 
+	db := s.repo.WithContext(ctx)
+
 	var payment model.Payment
 
-	if err := s.repo.FindById(&payment, paymentID); err != nil {
+	if err := db.FindByIdWithPreload(&payment, paymentID, "Refunds"); err != nil {
 		return nil, apperror.New(
 			constant.NOTFOUND,
 			"",
@@ -227,18 +481,104 @@ func (s *PaymentService) GetPaymentByIDAdmin(
 	return &payment, nil
 }
 
+/* =======================
+   RECONCILIATION
+   ======================= */
+
+// ReconciliationRow is an order whose settled payments don't add up.
+// Amounts are in minor units of Currency.
+type ReconciliationRow struct {
+	OrderID        uuid.UUID `json:"order_id"`
+	UserID         uuid.UUID `json:"user_id"`
+	OrderStatus    string    `json:"order_status"`
+	Currency       string    `json:"currency"`
+	OrderTotal     int64     `json:"order_total"`
+	ExpectedPaid   int64     `json:"expected_paid"` // net of refunds
+	PaidAmount     int64     `json:"paid_amount"`   // captured, before refunds
+	RefundedAmount int64     `json:"refunded_amount"`
+	Difference     int64     `json:"difference"` // paid - refunded - expected
+	PaidPayments   int       `json:"paid_payments"`
+	FailedEvents   int       `json:"failed_events"` // webhooks that couldn't be applied, e.g. stray captures
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// GetReconciliationReport lists orders whose captured payments, net of
+// refunds, differ from what they should have collected: the full total
+// (less deliberate partial refunds) once past payment, nothing while still
+// awaiting payment or once cancelled or refunded. Orders with FAILED
+// webhook events are listed too, since a capture for a payment that was no
+// longer pending never reaches the totals.
+func (s *PaymentService) GetReconciliationReport(ctx context.Context) ([]ReconciliationRow, error) {
+	db := s.repo.WithContext(ctx)
+
+	rows := []ReconciliationRow{}
+	err := db.Raw(`
+		SELECT *, paid_amount - refunded_amount - expected_paid AS difference
+		FROM (
+			SELECT
+				o.id AS order_id,
+				o.user_id,
+				o.status AS order_status,
+				o.total_currency AS currency,
+				o.total_minor AS order_total,
+				CASE WHEN o.status IN ? THEN 0 ELSE o.total_minor - COALESCE(r.refunded, 0) END AS expected_paid,
+				COALESCE(p.paid, 0) AS paid_amount,
+				COALESCE(r.refunded, 0) AS refunded_amount,
+				COALESCE(p.paid_payments, 0) AS paid_payments,
+				COALESCE(p.currency_mismatch, FALSE) AS currency_mismatch,
+				COALESCE(e.failed_events, 0) AS failed_events,
+				o.created_at
+			FROM orders o
+			LEFT JOIN LATERAL (
+				SELECT
+					SUM(amount_minor) AS paid,
+					COUNT(*) AS paid_payments,
+					BOOL_OR(amount_currency <> o.total_currency) AS currency_mismatch
+				FROM payments
+				WHERE order_id = o.id AND status IN ?
+			) p ON TRUE
+			LEFT JOIN LATERAL (
+				SELECT SUM(amount_minor) AS refunded
+				FROM refunds
+				WHERE order_id = o.id AND status = ?
+			) r ON TRUE
+			LEFT JOIN LATERAL (
+				SELECT COUNT(*) AS failed_events
+				FROM payment_webhook_events we
+				JOIN payments wp ON wp.id::text = we.payment_id
+				WHERE wp.order_id = o.id AND we.status = ?
+			) e ON TRUE
+		) totals
+		WHERE paid_amount - refunded_amount <> expected_paid OR currency_mismatch OR failed_events > 0
+		ORDER BY created_at DESC
+	`,
+		[]string{constant.PENDING_PAYMENT, constant.CANCELLED, constant.REFUND_PENDING, constant.REFUNDED},
+		[]string{constant.PAID, constant.PARTIALLY_REFUNDED, constant.REFUND_PENDING, constant.REFUNDED},
+		constant.REFUNDED,
+		constant.FAILED,
+	).Scan(&rows).Error
+	if err != nil {
+		return nil, apperror.ErrInternal
+	}
+
+	return rows, nil
+}
+
 /* =======================
    ADMIN UPDATE STATUS
    ======================= */
 
 func (s *PaymentService) UpdatePaymentStatus(
+	ctx context.Context,
 	paymentID string,
 	status string,
 ) (*model.Payment, error) {
 
+	db := s.repo.WithContext(ctx)
+
 	var payment model.Payment
 
-	if err := s.repo.FindById(&payment, paymentID); err != nil {
+	if err := db.FindById(&payment, paymentID); err != nil {
 		return nil, apperror.New(
 			constant.NOTFOUND,
 			"",
@@ -246,8 +586,16 @@ func (s *PaymentService) UpdatePaymentStatus(
 		)
 	}
 
+	// Money only moves on the provider's word; admins can just close out
+	// payments that never completed.
 	switch status {
-	case constant.PENDING, constant.PAID, constant.FAILED, constant.CANCELLED:
+	case constant.FAILED, constant.CANCELLED:
+	case constant.PAID:
+		return nil, apperror.New(
+			constant.BADREQUEST,
+			"",
+			"Payments can only be marked PAID by the payment provider",
+		)
 	default:
 		return nil, apperror.New(
 			constant.BADREQUEST,
@@ -256,18 +604,41 @@ func (s *PaymentService) UpdatePaymentStatus(
 		)
 	}
 
-	if err := s.repo.UpdateByFields(
-		&model.Payment{},
-		paymentID,
-		map[string]interface{}{
-			"status":     status,
-			"updated_at": time.Now(),
-		},
-	); err != nil {
+	if payment.Status != constant.PENDING {
+		return nil, apperror.New(
+			constant.BADREQUEST,
+			"",
+			"Only pending payments can be updated",
+		)
+	}
+
+	from := payment.Status
+
+	err := s.repo.WithTransaction(ctx, func(tx repo.IPgSQLRepository) error {
+		if err := tx.UpdateByFields(
+			&model.Payment{},
+			paymentID,
+			map[string]interface{}{
+				"status":     status,
+				"updated_at": time.Now(),
+			},
+		); err != nil {
+			return err
+		}
+
+		return recordAudit(ctx, tx, AuditEntry{
+			Action:     constant.AUDIT_PAYMENT_STATUS,
+			EntityType: constant.ENTITY_PAYMENT,
+			EntityID:   payment.ID,
+			Before:     map[string]interface{}{"status": from},
+			After:      map[string]interface{}{"status": status},
+		})
+	})
+	if err != nil {
 		return nil, apperror.ErrInternal
 	}
 
-	if err := s.repo.FindById(&payment, paymentID); err != nil {
+	if err := db.FindById(&payment, paymentID); err != nil {
 		return nil, apperror.ErrInternal
 	}
 
@@ -0,0 +1,320 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"vestra-ecommerce/src/model"
+	"vestra-ecommerce/src/repo"
+	constant "vestra-ecommerce/utils/constants"
+	"vestra-ecommerce/utils/gateway"
+	"vestra-ecommerce/utils/utils/apperror"
+)
+
+/* =======================
+   WEBHOOKS
+   ======================= */
+
+// HandleWebhook verifies, stores and applies a provider notification.
+// Deliveries are deduplicated on (provider, event ID); an event that was
+// already applied is acknowledged without touching payments again.
+func (s *PaymentService) HandleWebhook(
+	ctx context.Context,
+	provider string,
+	payload []byte,
+	headers http.Header,
+) error {
+
+	db := s.repo.WithContext(ctx)
+
+	if provider != s.gateway.Name() {
+		return apperror.New(
+			constant.NOTFOUND,
+			"",
+			"Unknown payment provider",
+		)
+	}
+
+	eventID, err := s.gateway.VerifyWebhook(payload, headers)
+	if err != nil {
+		return apperror.New(
+			constant.UNAUTHORIZED,
+			"",
+			"Invalid webhook signature",
+		)
+	}
+
+	var event model.PaymentWebhookEvent
+	err = db.FindOneWhere(&event, "provider = ? AND event_id = ?", provider, eventID)
+	if err != nil {
+		event = model.PaymentWebhookEvent{
+			Provider: provider,
+			EventID:  eventID,
+			Payload:  string(payload),
+			Status:   constant.RECEIVED,
+		}
+		if insertErr := db.Insert(&event); insertErr != nil {
+			// Lost a race with a concurrent delivery of the same event
+			if err := db.FindOneWhere(&event, "provider = ? AND event_id = ?", provider, eventID); err != nil {
+				return apperror.ErrInternal
+			}
+		}
+	}
+
+	if event.Status == constant.PROCESSED || event.Status == constant.IGNORED {
+		return nil
+	}
+
+	return s.processWebhookEvent(ctx, &event)
+}
+
+// ReplayWebhookEvent re-applies a stored event. The signature was checked
+// when the event arrived, so only the payload is needed.
+func (s *PaymentService) ReplayWebhookEvent(ctx context.Context, id string) (*model.PaymentWebhookEvent, error) {
+	db := s.repo.WithContext(ctx)
+
+	var event model.PaymentWebhookEvent
+	if err := db.FindById(&event, id); err != nil {
+		return nil, apperror.New(
+			constant.NOTFOUND,
+			"",
+			"Webhook event not found",
+		)
+	}
+
+	if event.Provider != s.gateway.Name() {
+		return nil, apperror.New(
+			constant.BADREQUEST,
+			"",
+			"Event belongs to an inactive payment provider",
+		)
+	}
+
+	if err := s.processWebhookEvent(ctx, &event); err != nil {
+		return nil, err
+	}
+
+	if err := db.FindById(&event, id); err != nil {
+		return nil, apperror.ErrInternal
+	}
+
+	return &event, nil
+}
+
+// GetWebhookEvents lists stored events, optionally filtered by status
+func (s *PaymentService) GetWebhookEvents(ctx context.Context, status string) ([]model.PaymentWebhookEvent, error) {
+	db := s.repo.WithContext(ctx)
+
+	var events []model.PaymentWebhookEvent
+	query := "1 = 1"
+	args := []interface{}{}
+	if status != "" {
+		query += " AND status = ?"
+		args = append(args, status)
+	}
+
+	if err := db.Raw(
+		"SELECT * FROM payment_webhook_events WHERE "+query+" ORDER BY created_at DESC",
+		args...,
+	).Scan(&events).Error; err != nil {
+		return nil, apperror.ErrInternal
+	}
+
+	return events, nil
+}
+
+// processWebhookEvent applies a stored event and records the outcome on it.
+// Only infrastructure failures are returned, so the provider retries those;
+// events that can never apply are marked and acknowledged.
+func (s *PaymentService) processWebhookEvent(ctx context.Context, event *model.PaymentWebhookEvent) error {
+	db := s.repo.WithContext(ctx)
+
+	status, paymentID, note, procErr := s.applyWebhookEvent(ctx, event)
+	if procErr != nil {
+		status = constant.FAILED
+		note = procErr.Error()
+	}
+
+	updates := map[string]interface{}{
+		"status":     status,
+		"error":      note,
+		"attempts":   event.Attempts + 1,
+		"updated_at": time.Now(),
+	}
+	if paymentID != "" {
+		updates["payment_id"] = paymentID
+	}
+	if procErr == nil {
+		updates["processed_at"] = time.Now()
+	}
+
+	if err := db.UpdateByFields(&model.PaymentWebhookEvent{}, event.ID, updates); err != nil {
+		return apperror.ErrInternal
+	}
+
+	if procErr != nil {
+		return apperror.New(
+			constant.INTERNALSERVERERROR,
+			"",
+			"Failed to process webhook event",
+		)
+	}
+
+	return nil
+}
+
+// applyWebhookEvent returns the event's resulting status, the payment it
+// touched and a note for the admin listing.
+func (s *PaymentService) applyWebhookEvent(
+	ctx context.Context,
+	event *model.PaymentWebhookEvent,
+) (status string, paymentID string, note string, err error) {
+
+	db := s.repo.WithContext(ctx)
+
+	parsed, err := s.gateway.ParseWebhook([]byte(event.Payload))
+	if err != nil {
+		if errors.Is(err, gateway.ErrUnsupportedEvent) {
+			return constant.IGNORED, "", "unsupported event type", nil
+		}
+		return constant.IGNORED, "", "unparseable payload: " + err.Error(), nil
+	}
+
+	if parsed.Type != "" && event.EventType == "" {
+		_ = db.UpdateByFields(&model.PaymentWebhookEvent{}, event.ID, map[string]interface{}{
+			"event_type": parsed.Type,
+		})
+	}
+
+	if parsed.Refund != nil {
+		return s.applyRefundEvent(ctx, parsed)
+	}
+
+	// An empty ID must not match, e.g. legacy payments without an intent
+	var match []string
+	args := []interface{}{event.Provider}
+	if parsed.IntentID != "" {
+		match = append(match, "provider_intent_id = ?")
+		args = append(args, parsed.IntentID)
+	}
+	if parsed.ProviderPaymentID != "" {
+		match = append(match, "transaction_id = ?")
+		args = append(args, parsed.ProviderPaymentID)
+	}
+	if len(match) == 0 {
+		return constant.IGNORED, "", "event names no payment", nil
+	}
+
+	var payment model.Payment
+	if err := db.FindOneWhere(
+		&payment,
+		"provider = ? AND ("+strings.Join(match, " OR ")+")",
+		args...,
+	); err != nil {
+		return constant.IGNORED, "", "no matching payment", nil
+	}
+
+	newStatus := paymentStatusFromGateway(parsed.Status)
+	if newStatus == constant.PENDING {
+		return constant.IGNORED, payment.ID, "no status change", nil
+	}
+
+	if newStatus == constant.PAID && !matchesAmount(payment.Amount, parsed.Amount, parsed.Currency) {
+		return constant.FAILED, payment.ID, "amount does not match payment", nil
+	}
+
+	settled, err := s.settlePayment(ctx, &payment, newStatus, parsed.ProviderPaymentID)
+	if err != nil {
+		return "", payment.ID, "", err
+	}
+
+	// Money captured for a payment we already gave up on (cancelled by the
+	// customer, failed) is neither placed nor refunded automatically; the
+	// FAILED event shows up in the reconciliation report for an admin
+	if !settled && newStatus == constant.PAID {
+		if err := db.FindById(&payment, payment.ID); err != nil {
+			return "", payment.ID, "", err
+		}
+		if payment.Status == constant.CANCELLED || payment.Status == constant.FAILED {
+			return constant.FAILED, payment.ID, "captured for non-pending payment (" + payment.Status + ")", nil
+		}
+	}
+
+	return constant.PROCESSED, payment.ID, "", nil
+}
+
+// settlePayment moves a PENDING payment to PAID or FAILED and advances the
+// linked order, all in one transaction, and reports whether it did.
+// Payments that are no longer pending are left alone, which makes verify
+// calls and webhook retries idempotent.
+func (s *PaymentService) settlePayment(
+	ctx context.Context,
+	payment *model.Payment,
+	status string,
+	providerPaymentID string,
+) (bool, error) {
+
+	settled := false
+	err := s.repo.WithTransaction(ctx, func(tx repo.IPgSQLRepository) error {
+		res := tx.Exec(
+			"UPDATE payments SET status = ?, transaction_id = ?, updated_at = ? WHERE id = ? AND status = ?",
+			status,
+			providerPaymentID,
+			time.Now(),
+			payment.ID,
+			constant.PENDING,
+		)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return nil
+		}
+		settled = true
+		if status != constant.PAID {
+			return nil
+		}
+
+		return advanceOrderOnPayment(tx, payment.OrderID)
+	})
+	if err != nil || status != constant.PAID {
+		return settled, err
+	}
+
+	// Money that arrives for an order cancelled mid-checkout goes straight back
+	var order model.Order
+	if err := s.repo.WithContext(ctx).FindById(&order, payment.OrderID); err == nil && order.Status == constant.CANCELLED {
+		s.refundCancelledOrder(ctx, order.ID, "Payment received after cancellation")
+	}
+
+	return settled, nil
+}
+
+// advanceOrderOnPayment places an order that was waiting for its payment
+func advanceOrderOnPayment(tx repo.IPgSQLRepository, orderID uuid.UUID) error {
+	if orderID == uuid.Nil {
+		return nil
+	}
+
+	var order model.Order
+	if err := tx.FindById(&order, orderID); err != nil {
+		return nil
+	}
+
+	if order.Status != constant.PENDING_PAYMENT {
+		return nil
+	}
+
+	return transitionOrder(
+		tx,
+		&order,
+		constant.PLACED,
+		OrderActor{Role: constant.ACTOR_SYSTEM},
+		"Payment received",
+	)
+}
@@ -0,0 +1,194 @@
+package services
+
+import (
+	"strings"
+
+	"vestra-ecommerce/src/model"
+)
+
+// Facets of the product listing
+const (
+	facetLeague     = "league"
+	facetKitType    = "kit_type"
+	facetYear       = "year"
+	facetSize       = "size"
+	facetInStock    = "in_stock"
+	facetTopSelling = "top_selling"
+	facetPrice      = "price"
+)
+
+// inStockSQL is true for products with any size left
+const inStockSQL = "EXISTS (SELECT 1 FROM product_sizes ps WHERE ps.product_id = products.id AND ps.quantity > 0)"
+
+// FacetBucket is one value of a facet and how many products have it
+type FacetBucket struct {
+	Value string `json:"value"`
+	Count int64  `json:"count"`
+}
+
+// PriceRange is the cheapest and dearest price in minor units
+type PriceRange struct {
+	Min int64 `json:"min"`
+	Max int64 `json:"max"`
+}
+
+// ProductFacets counts products per value of each filterable field. Each
+// facet applies every filter but its own, so picking "Premier League"
+// still shows how many La Liga products a second pick would add.
+type ProductFacets struct {
+	League     []FacetBucket `json:"league"`
+	KitType    []FacetBucket `json:"kit_type"`
+	Year       []FacetBucket `json:"year"`
+	Size       []FacetBucket `json:"size"`
+	InStock    []FacetBucket `json:"in_stock"`
+	TopSelling []FacetBucket `json:"top_selling"`
+	Price      PriceRange    `json:"price"`
+}
+
+// ProductListing is the product list with its facets
+type ProductListing struct {
+	Products []model.Product `json:"products"`
+	Facets   ProductFacets   `json:"facets"`
+}
+
+// productCondition is one filter as SQL on products, tagged with the facet
+// it narrows ("" for filters without a facet)
+type productCondition struct {
+	facet string
+	sql   string
+	args  []interface{}
+}
+
+func (f ProductFilter) conditions() []productCondition {
+	var conds []productCondition
+	add := func(facet, sql string, args ...interface{}) {
+		conds = append(conds, productCondition{facet: facet, sql: sql, args: args})
+	}
+
+	if f.Category != "" {
+		add("", `category_id IN (
+			WITH RECURSIVE tree AS (
+				SELECT id FROM categories WHERE id::text = ? OR slug = ?
+				UNION ALL
+				SELECT c.id FROM categories c JOIN tree ON c.parent_id = tree.id
+			)
+			SELECT id FROM tree
+		)`, f.Category, f.Category)
+	}
+	if f.Team != "" {
+		add("", `team_id IN (
+			SELECT t.id FROM teams t
+			LEFT JOIN teams l ON l.id = t.parent_id
+			WHERE t.id::text = ? OR t.slug = ? OR l.id::text = ? OR l.slug = ?
+		)`, f.Team, f.Team, f.Team, f.Team)
+	}
+	if tsQuery := prefixTSQuery(f.Search); tsQuery != "" {
+		// Full-text match, or a close spelling of the name (see product_search.go)
+		add("", "(search_vector @@ to_tsquery('simple', ?) OR ? <% name)", tsQuery, f.Search)
+	}
+	if len(f.League) > 0 {
+		add(facetLeague, "league IN ?", f.League)
+	}
+	if len(f.KitType) > 0 {
+		add(facetKitType, "kit_type IN ?", f.KitType)
+	}
+	if len(f.Year) > 0 {
+		add(facetYear, "year IN ?", f.Year)
+	}
+	if len(f.Size) > 0 {
+		add(facetSize, "id IN (SELECT product_id FROM product_sizes WHERE size IN ?)", f.Size)
+	}
+	if f.InStock != nil {
+		if *f.InStock {
+			add(facetInStock, inStockSQL)
+		} else {
+			add(facetInStock, "NOT "+inStockSQL)
+		}
+	}
+	if f.TopSelling != nil {
+		add(facetTopSelling, "is_top_selling = ?", *f.TopSelling)
+	}
+	if f.MinPrice > 0 {
+		add(facetPrice, "price_minor >= ?", f.MinPrice)
+	}
+	if f.MaxPrice > 0 {
+		add(facetPrice, "price_minor <= ?", f.MaxPrice)
+	}
+
+	return conds
+}
+
+// joinConditions ANDs the conditions, leaving out those of facet except
+func joinConditions(conds []productCondition, except string) (string, []interface{}) {
+	where := []string{"1 = 1"}
+	args := []interface{}{}
+	for _, c := range conds {
+		if except != "" && c.facet == except {
+			continue
+		}
+		where = append(where, c.sql)
+		args = append(args, c.args...)
+	}
+	return strings.Join(where, " AND "), args
+}
+
+// productFacets counts each facet against the filters of all the others
+func (s *ProductService) productFacets(conds []productCondition) (ProductFacets, error) {
+	facets := ProductFacets{}
+
+	// selectors pick each facet's value from a products row; NULL means
+	// the product has none and isn't counted
+	selectors := []struct {
+		facet   string
+		value   string
+		buckets *[]FacetBucket
+	}{
+		{facetLeague, "NULLIF(league, '')", &facets.League},
+		{facetKitType, "NULLIF(kit_type, '')", &facets.KitType},
+		{facetYear, "NULLIF(year, 0)::text", &facets.Year},
+		{facetInStock, "(" + inStockSQL + ")::text", &facets.InStock},
+		{facetTopSelling, "is_top_selling::text", &facets.TopSelling},
+	}
+
+	for _, sel := range selectors {
+		where, args := joinConditions(conds, sel.facet)
+		*sel.buckets = []FacetBucket{}
+		if err := s.repo.Raw(`
+			SELECT value, COUNT(*) AS count
+			FROM (
+				SELECT `+sel.value+` AS value
+				FROM products
+				WHERE deleted_at IS NULL AND `+where+`
+			) f
+			WHERE value IS NOT NULL
+			GROUP BY value
+			ORDER BY count DESC, value
+		`, args...).Scan(sel.buckets).Error; err != nil {
+			return facets, err
+		}
+	}
+
+	where, args := joinConditions(conds, facetSize)
+	facets.Size = []FacetBucket{}
+	if err := s.repo.Raw(`
+		SELECT ps.size AS value, COUNT(DISTINCT ps.product_id) AS count
+		FROM product_sizes ps
+		WHERE ps.product_id IN (SELECT id FROM products WHERE deleted_at IS NULL AND `+where+`)
+		GROUP BY ps.size
+		ORDER BY count DESC, value
+	`, args...).Scan(&facets.Size).Error; err != nil {
+		return facets, err
+	}
+
+	where, args = joinConditions(conds, facetPrice)
+	if err := s.repo.Raw(`
+		SELECT COALESCE(MIN(price_minor), 0) AS min, COALESCE(MAX(price_minor), 0) AS max
+		FROM products
+		WHERE deleted_at IS NULL AND `+where,
+		args...,
+	).Scan(&facets.Price).Error; err != nil {
+		return facets, err
+	}
+
+	return facets, nil
+}
@@ -0,0 +1,492 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"vestra-ecommerce/src/model"
+	"vestra-ecommerce/src/repo"
+	constant "vestra-ecommerce/utils/constants"
+	"vestra-ecommerce/utils/imaging"
+	"vestra-ecommerce/utils/storage"
+	"vestra-ecommerce/utils/utils/apperror"
+)
+
+// thumbnailSizes are the widths every upload is resized to, by size name.
+// Images narrower than a size are re-encoded at their own width.
+var thumbnailSizes = []struct {
+	name  string
+	width int
+}{
+	{"small", 160},
+	{"medium", 480},
+	{"large", 1024},
+}
+
+const thumbnailQuality = 85
+
+// ProductImageService manages product galleries: uploads go to the blob
+// store with their thumbnails, the rows keep order, alt text and colour
+type ProductImageService struct {
+	repo     repo.IPgSQLRepository
+	store    storage.BlobStore
+	maxBytes int64
+}
+
+func NewProductImageService(repo repo.IPgSQLRepository, store storage.BlobStore, maxBytes int64) *ProductImageService {
+	return &ProductImageService{repo: repo, store: store, maxBytes: maxBytes}
+}
+
+// ProductImageInput describes an uploaded image
+type ProductImageInput struct {
+	AltText string
+	Color   string // colourway shown, "" for all
+}
+
+// UpdateProductImageInput changes an image's details; nil fields are kept
+type UpdateProductImageInput struct {
+	AltText *string `json:"alt_text"`
+	Color   *string `json:"color"`
+}
+
+/* =======================
+   UPLOAD
+   ======================= */
+
+// AddImage stores an uploaded image and its thumbnails and appends it to
+// the product's gallery. The type is sniffed from the content; only JPEG,
+// PNG and GIF are taken.
+func (s *ProductImageService) AddImage(ctx context.Context, productID string, upload io.Reader, input ProductImageInput) (*model.ProductImage, error) {
+	pID, err := parseProductID(productID)
+	if err != nil {
+		return nil, err
+	}
+
+	var product model.Product
+	if err := s.repo.WithContext(ctx).FindById(&product, pID); err != nil {
+		return nil, apperror.New(
+			constant.NOTFOUND,
+			"",
+			"Product not found",
+		)
+	}
+
+	image := model.ProductImage{ID: uuid.New(), ProductID: pID}
+	if err := applyImageInput(&image, &input.AltText, &input.Color); err != nil {
+		return nil, err
+	}
+
+	data, err := io.ReadAll(io.LimitReader(upload, s.maxBytes+1))
+	if err != nil {
+		return nil, apperror.New(
+			constant.BADREQUEST,
+			"",
+			"Failed to read image",
+		)
+	}
+	if int64(len(data)) > s.maxBytes {
+		return nil, apperror.New(
+			constant.PAYLOADTOOLARGE,
+			constant.IMAGE_TOO_LARGE,
+			fmt.Sprintf("Images can be at most %d MB", s.maxBytes>>20),
+		)
+	}
+
+	contentType, ext, err := imaging.Sniff(data)
+	if err != nil {
+		return nil, apperror.New(
+			constant.UNSUPPORTEDMEDIATYPE,
+			constant.IMAGE_UNSUPPORTED,
+			"Images must be JPEG, PNG or GIF",
+		)
+	}
+	decoded, err := imaging.Decode(data)
+	if errors.Is(err, imaging.ErrTooLarge) {
+		return nil, apperror.New(
+			constant.PAYLOADTOOLARGE,
+			constant.IMAGE_TOO_LARGE,
+			fmt.Sprintf("Images can be at most %d megapixels", imaging.MaxPixels/1_000_000),
+		)
+	}
+	if err != nil {
+		return nil, apperror.New(
+			constant.UNSUPPORTEDMEDIATYPE,
+			constant.IMAGE_UNSUPPORTED,
+			"Image could not be read",
+		)
+	}
+
+	image.ContentType = contentType
+	image.Width = decoded.Bounds().Dx()
+	image.Height = decoded.Bounds().Dy()
+	image.Bytes = int64(len(data))
+	image.Thumbnails = map[string]string{}
+
+	dir := "products/" + pID.String() + "/" + image.ID.String()
+	if err := s.putBlob(ctx, &image, dir+"/original."+ext, data, contentType); err != nil {
+		return nil, apperror.ErrInternal
+	}
+	image.URL = s.store.URL(image.StorageKeys[0])
+
+	// Converted once for all sizes rather than by each Thumbnail call
+	pixels := imaging.ToRGBA(decoded)
+	for _, size := range thumbnailSizes {
+		thumb, err := imaging.EncodeJPEG(imaging.Thumbnail(pixels, size.width), thumbnailQuality)
+		if err == nil {
+			err = s.putBlob(ctx, &image, dir+"/"+size.name+".jpg", thumb, "image/jpeg")
+		}
+		if err != nil {
+			s.removeBlobs(ctx, image.StorageKeys)
+			return nil, apperror.ErrInternal
+		}
+		image.Thumbnails[size.name] = s.store.URL(dir + "/" + size.name + ".jpg")
+	}
+
+	err = s.repo.WithTransaction(ctx, func(tx repo.IPgSQLRepository) error {
+		if err := lockProduct(tx, pID); err != nil {
+			return err
+		}
+
+		count, err := tx.Count(&model.ProductImage{}, "product_id = ?", []interface{}{pID})
+		if err != nil {
+			return err
+		}
+		image.Position = int(count)
+
+		if err := tx.Insert(&image); err != nil {
+			return err
+		}
+		if err := syncCoverImage(tx, pID, ""); err != nil {
+			return err
+		}
+		return recordAudit(ctx, tx, AuditEntry{
+			Action:     constant.AUDIT_IMAGE_CREATE,
+			EntityType: constant.ENTITY_IMAGE,
+			EntityID:   image.ID.String(),
+			After:      image,
+		})
+	})
+	if err != nil {
+		s.removeBlobs(ctx, image.StorageKeys)
+		return nil, apperror.ErrInternal
+	}
+
+	return &image, nil
+}
+
+/* =======================
+   UPDATE / REORDER
+   ======================= */
+
+func (s *ProductImageService) UpdateImage(ctx context.Context, productID, imageID string, input UpdateProductImageInput) (*model.ProductImage, error) {
+	pID, err := parseProductID(productID)
+	if err != nil {
+		return nil, err
+	}
+
+	var image *model.ProductImage
+
+	err = s.repo.WithTransaction(ctx, func(tx repo.IPgSQLRepository) error {
+		var err error
+		if image, err = findProductImage(tx, pID, imageID); err != nil {
+			return err
+		}
+		before := *image
+
+		if err := applyImageInput(image, input.AltText, input.Color); err != nil {
+			return err
+		}
+
+		if err := tx.UpdateByFields(&model.ProductImage{}, image.ID, map[string]interface{}{
+			"alt_text": image.AltText,
+			"color":    image.Color,
+		}); err != nil {
+			return err
+		}
+		return recordAudit(ctx, tx, AuditEntry{
+			Action:     constant.AUDIT_IMAGE_UPDATE,
+			EntityType: constant.ENTITY_IMAGE,
+			EntityID:   image.ID.String(),
+			Before:     before,
+			After:      *image,
+		})
+	})
+	if err != nil {
+		if appErr, ok := err.(*apperror.AppError); ok {
+			return nil, appErr
+		}
+		return nil, apperror.ErrInternal
+	}
+
+	return image, nil
+}
+
+// ReorderImages puts the gallery in the order of imageIDs, which must list
+// every image of the product exactly once. The first becomes the cover.
+func (s *ProductImageService) ReorderImages(ctx context.Context, productID string, imageIDs []string) ([]model.ProductImage, error) {
+	pID, err := parseProductID(productID)
+	if err != nil {
+		return nil, err
+	}
+
+	var images []model.ProductImage
+
+	err = s.repo.WithTransaction(ctx, func(tx repo.IPgSQLRepository) error {
+		if err := lockProduct(tx, pID); err != nil {
+			return err
+		}
+		if err := tx.FindAllWhere(&images, "product_id = ?", pID); err != nil {
+			return err
+		}
+
+		byID := make(map[string]*model.ProductImage, len(images))
+		before := make(map[string]int, len(images))
+		for i := range images {
+			byID[images[i].ID.String()] = &images[i]
+			before[images[i].ID.String()] = images[i].Position
+		}
+
+		invalid := apperror.New(
+			constant.BADREQUEST,
+			constant.INVALID_REQUEST,
+			"image_ids must list each of the product's images once",
+		)
+		if len(imageIDs) != len(images) {
+			return invalid
+		}
+		after := make(map[string]int, len(images))
+		for position, raw := range imageIDs {
+			id, err := uuid.Parse(raw)
+			if err != nil {
+				return invalid
+			}
+			image, ok := byID[id.String()]
+			if !ok {
+				return invalid
+			}
+			if _, seen := after[id.String()]; seen {
+				return invalid
+			}
+			after[id.String()] = position
+			image.Position = position
+		}
+
+		for i := range images {
+			if images[i].Position == before[images[i].ID.String()] {
+				continue
+			}
+			if err := tx.UpdateByFields(&model.ProductImage{}, images[i].ID, map[string]interface{}{
+				"position": images[i].Position,
+			}); err != nil {
+				return err
+			}
+		}
+
+		if err := syncCoverImage(tx, pID, ""); err != nil {
+			return err
+		}
+		return recordAudit(ctx, tx, AuditEntry{
+			Action:     constant.AUDIT_IMAGE_REORDER,
+			EntityType: constant.ENTITY_PRODUCT,
+			EntityID:   pID.String(),
+			Before:     map[string]interface{}{"positions": before},
+			After:      map[string]interface{}{"positions": after},
+		})
+	})
+	if err != nil {
+		if appErr, ok := err.(*apperror.AppError); ok {
+			return nil, appErr
+		}
+		return nil, apperror.ErrInternal
+	}
+
+	sortImages(images)
+	return images, nil
+}
+
+/* =======================
+   DELETE
+   ======================= */
+
+// DeleteImage removes an image from the gallery, closing the gap it leaves,
+// and then its files
+func (s *ProductImageService) DeleteImage(ctx context.Context, productID, imageID string) error {
+	pID, err := parseProductID(productID)
+	if err != nil {
+		return err
+	}
+
+	var image *model.ProductImage
+
+	err = s.repo.WithTransaction(ctx, func(tx repo.IPgSQLRepository) error {
+		if err := lockProduct(tx, pID); err != nil {
+			return err
+		}
+		var err error
+		if image, err = findProductImage(tx, pID, imageID); err != nil {
+			return err
+		}
+
+		if err := tx.Delete(&model.ProductImage{}, image.ID); err != nil {
+			return err
+		}
+		if err := tx.Exec(
+			"UPDATE product_images SET position = position - 1 WHERE product_id = ? AND position > ?",
+			image.ProductID, image.Position,
+		).Error; err != nil {
+			return err
+		}
+		if err := syncCoverImage(tx, image.ProductID, image.URL); err != nil {
+			return err
+		}
+		return recordAudit(ctx, tx, AuditEntry{
+			Action:     constant.AUDIT_IMAGE_DELETE,
+			EntityType: constant.ENTITY_IMAGE,
+			EntityID:   image.ID.String(),
+			Before:     *image,
+		})
+	})
+	if err != nil {
+		if appErr, ok := err.(*apperror.AppError); ok {
+			return appErr
+		}
+		return apperror.ErrInternal
+	}
+
+	s.removeBlobs(ctx, image.StorageKeys)
+	return nil
+}
+
+/* =======================
+   HELPERS
+   ======================= */
+
+// applyImageInput trims and checks the given details onto image; nil
+// fields are left alone
+func applyImageInput(image *model.ProductImage, altText, color *string) error {
+	if altText != nil {
+		image.AltText = strings.TrimSpace(*altText)
+		if len(image.AltText) > 255 {
+			return apperror.New(
+				constant.BADREQUEST,
+				constant.INVALID_REQUEST,
+				"alt_text can be at most 255 characters",
+			)
+		}
+	}
+	if color != nil {
+		image.Color = strings.TrimSpace(*color)
+		if len(image.Color) > 50 {
+			return apperror.New(
+				constant.BADREQUEST,
+				constant.INVALID_REQUEST,
+				"color can be at most 50 characters",
+			)
+		}
+	}
+	return nil
+}
+
+func parseProductID(productID string) (uuid.UUID, error) {
+	pID, err := uuid.Parse(productID)
+	if err != nil {
+		return uuid.Nil, apperror.New(
+			constant.BADREQUEST,
+			"",
+			"Invalid product ID",
+		)
+	}
+	return pID, nil
+}
+
+// findProductImage loads an image, making sure it belongs to the product
+func findProductImage(tx repo.IPgSQLRepository, pID uuid.UUID, imageID string) (*model.ProductImage, error) {
+	iID, err := uuid.Parse(imageID)
+	if err != nil {
+		return nil, apperror.New(
+			constant.BADREQUEST,
+			"",
+			"Invalid image ID",
+		)
+	}
+
+	var image model.ProductImage
+	if err := tx.FindOneWhere(&image, "id = ? AND product_id = ?", iID, pID); err != nil {
+		return nil, apperror.New(
+			constant.NOTFOUND,
+			"",
+			"Image not found",
+		)
+	}
+	return &image, nil
+}
+
+// lockProduct holds the product row for the rest of the transaction, so
+// concurrent gallery changes don't hand out the same position
+func lockProduct(tx repo.IPgSQLRepository, productID uuid.UUID) error {
+	var locked []uuid.UUID
+	if err := tx.Raw(
+		"SELECT id FROM products WHERE id = ? AND deleted_at IS NULL FOR UPDATE",
+		productID,
+	).Scan(&locked).Error; err != nil {
+		return err
+	}
+	if len(locked) == 0 {
+		return apperror.New(
+			constant.NOTFOUND,
+			"",
+			"Product not found",
+		)
+	}
+	return nil
+}
+
+// syncCoverImage points the product's ImageURL at its first gallery image,
+// which lists and older clients show. Once the gallery is empty an
+// ImageURL still pointing at removed is cleared; one typed in is kept.
+func syncCoverImage(tx repo.IPgSQLRepository, productID uuid.UUID, removed string) error {
+	return tx.Exec(`
+		UPDATE products SET image_url = COALESCE(
+			(SELECT url FROM product_images WHERE product_id = ? ORDER BY position, created_at LIMIT 1),
+			NULLIF(image_url, ?),
+			''
+		)
+		WHERE id = ?
+	`, productID, removed, productID).Error
+}
+
+// sortImages puts a gallery in display order
+func sortImages(images []model.ProductImage) {
+	sort.Slice(images, func(i, j int) bool {
+		return images[i].Position < images[j].Position
+	})
+}
+
+// putBlob stores one file of image, noting its key for cleanup
+func (s *ProductImageService) putBlob(ctx context.Context, image *model.ProductImage, key string, data []byte, contentType string) error {
+	if err := s.store.Put(ctx, key, data, contentType); err != nil {
+		log.Printf("storage: %s %s not stored: %v", s.store.Name(), key, err)
+		return err
+	}
+	image.StorageKeys = append(image.StorageKeys, key)
+	return nil
+}
+
+// removeBlobs deletes stored files even if the request has ended, logging
+// failures: the image is already out of the gallery, so a leftover file
+// only takes up space
+func (s *ProductImageService) removeBlobs(ctx context.Context, keys []string) {
+	ctx = context.WithoutCancel(ctx)
+	for _, key := range keys {
+		if err := s.store.Delete(ctx, key); err != nil {
+			log.Printf("storage: %s %s not removed: %v", s.store.Name(), key, err)
+		}
+	}
+}
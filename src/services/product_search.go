@@ -0,0 +1,261 @@
+package services
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"vestra-ecommerce/src/model"
+	constant "vestra-ecommerce/utils/constants"
+	"vestra-ecommerce/utils/pagination"
+	"vestra-ecommerce/utils/utils/apperror"
+)
+
+// searchSorts are the product sorts plus relevance, the default, which is
+// always best match first
+var searchSorts = func() map[string]string {
+	sorts := map[string]string{"relevance": "rank"}
+	for field, expr := range productSorts {
+		sorts[field] = expr
+	}
+	return sorts
+}()
+
+// Search match kinds
+const (
+	matchFullText = "fulltext"
+	matchFuzzy    = "fuzzy"
+)
+
+// ts_headline options; matches are wrapped in <mark> for the client to style
+const (
+	nameHeadlineOptions    = "StartSel=<mark>, StopSel=</mark>, HighlightAll=true"
+	snippetHeadlineOptions = "StartSel=<mark>, StopSel=</mark>, MaxFragments=2, MaxWords=20, MinWords=5"
+)
+
+var searchWord = regexp.MustCompile(`[\p{L}\p{N}]+`)
+
+// htmlEscapeSQL wraps a text expression so it comes back escaped the way
+// html.EscapeString would. Product text is escaped before ts_headline adds
+// its <mark> tags, so clients can render the highlights as HTML.
+func htmlEscapeSQL(expr string) string {
+	return `replace(replace(replace(replace(replace(` + expr +
+		`, '&', '&amp;'), '<', '&lt;'), '>', '&gt;'), '"', '&#34;'), '''', '&#39;')`
+}
+
+// ProductSearchHit is a product with how well it matched. NameHighlight and
+// Snippet are HTML-escaped and carry the matched words in <mark> tags.
+type ProductSearchHit struct {
+	model.Product
+	Rank          float64 `json:"rank"`
+	Match         string  `json:"match,omitempty"` // fulltext, fuzzy
+	NameHighlight string  `json:"name_highlight,omitempty"`
+	Snippet       string  `json:"snippet,omitempty"`
+}
+
+// searchRow is one ranked id from the search queries
+type searchRow struct {
+	ID            uuid.UUID
+	Rank          float64
+	NameHighlight string
+	Snippet       string
+}
+
+// prefixTSQuery turns free text into a tsquery where every word must match
+// as a prefix ("barca" finds "barcelona"). Empty when there are no words.
+func prefixTSQuery(text string) string {
+	words := searchWord.FindAllString(strings.ToLower(text), -1)
+	for i, w := range words {
+		words[i] = w + ":*"
+	}
+	return strings.Join(words, " & ")
+}
+
+/* =======================
+   SEARCH PRODUCTS
+   ======================= */
+
+// SearchProducts ranks products by full-text match over name, club, league,
+// kit type and description. When nothing matches it falls back to trigram
+// similarity on the name, league and club so misspellings still find
+// something. Without search words it lists the filtered products, newest
+// first unless another sort is asked for. Results come in numbered pages.
+func (s *ProductService) SearchProducts(
+	query string,
+	league string,
+	kitType string,
+	year *int,
+	page pagination.Params,
+) ([]ProductSearchHit, *pagination.Meta, error) {
+
+	sortBy, err := pageSort(page, searchSorts, "-relevance")
+	if err != nil {
+		return nil, nil, err
+	}
+	if sortBy.Field == "relevance" {
+		sortBy.Desc = true
+	}
+
+	filter := ""
+	args := []interface{}{}
+
+	if league != "" {
+		filter += " AND products.league = ?"
+		args = append(args, league)
+	}
+
+	if kitType != "" {
+		filter += " AND products.kit_type = ?"
+		args = append(args, kitType)
+	}
+
+	if year != nil {
+		filter += " AND products.year = ?"
+		args = append(args, *year)
+	}
+
+	// one extra row tells whether another page follows
+	pageArgs := []interface{}{page.Limit + 1, page.Offset()}
+
+	var rows []searchRow
+	match := matchFullText
+
+	tsQuery := prefixTSQuery(query)
+	if tsQuery == "" {
+		match = ""
+		if sortBy.Field == "relevance" {
+			sortBy, _ = pageSort(pagination.Params{}, productSorts, "-created_at")
+		}
+		if err := s.repo.Raw(`
+			SELECT products.id, 0 AS rank
+			FROM products
+			WHERE products.deleted_at IS NULL`+filter+`
+			ORDER BY `+sortBy.OrderBy("products.id")+`
+			LIMIT ? OFFSET ?
+		`, append(args, pageArgs...)...).Scan(&rows).Error; err != nil {
+			return nil, nil, apperror.New(
+				constant.INTERNALSERVERERROR,
+				"",
+				"Failed to fetch products",
+			)
+		}
+	} else {
+		fullTextArgs := append([]interface{}{nameHeadlineOptions, snippetHeadlineOptions, tsQuery}, args...)
+		if err := s.repo.Raw(`
+			SELECT products.id,
+				ts_rank_cd(products.search_vector, q.query) AS rank,
+				ts_headline('simple', `+htmlEscapeSQL("products.name")+`, q.query, ?) AS name_highlight,
+				ts_headline('simple', `+htmlEscapeSQL("coalesce(products.description, '')")+`, q.query, ?) AS snippet
+			FROM products, to_tsquery('simple', ?) AS q(query)
+			WHERE products.deleted_at IS NULL AND products.search_vector @@ q.query`+filter+`
+			ORDER BY `+sortBy.OrderBy("products.id")+`
+			LIMIT ? OFFSET ?
+		`, append(fullTextArgs, pageArgs...)...).Scan(&rows).Error; err != nil {
+			return nil, nil, apperror.New(
+				constant.INTERNALSERVERERROR,
+				"",
+				"Failed to search products",
+			)
+		}
+
+		fallback := len(rows) == 0
+		if fallback && page.Page > 1 {
+			// paging past the last full-text hit isn't the same as having none
+			if err := s.repo.Raw(`
+				SELECT NOT EXISTS (
+					SELECT 1 FROM products
+					WHERE products.deleted_at IS NULL AND products.search_vector @@ to_tsquery('simple', ?)`+filter+`
+				)
+			`, append([]interface{}{tsQuery}, args...)...).Scan(&fallback).Error; err != nil {
+				return nil, nil, apperror.New(
+					constant.INTERNALSERVERERROR,
+					"",
+					"Failed to search products",
+				)
+			}
+		}
+
+		if fallback {
+			match = matchFuzzy
+			text := strings.Join(searchWord.FindAllString(query, -1), " ")
+			fuzzyArgs := append([]interface{}{text, text, text, text, text, text}, args...)
+			if err := s.repo.Raw(`
+				SELECT products.id,
+					GREATEST(
+						word_similarity(?, products.name),
+						word_similarity(?, coalesce(products.league, '')),
+						word_similarity(?, coalesce(t.name, ''))
+					) AS rank,
+					`+htmlEscapeSQL("products.name")+` AS name_highlight,
+					`+htmlEscapeSQL("left(coalesce(products.description, ''), 160)")+` AS snippet
+				FROM products
+				LEFT JOIN teams t ON t.id = products.team_id
+				WHERE products.deleted_at IS NULL
+					AND (? <% products.name OR ? <% products.league OR ? <% t.name)`+filter+`
+				ORDER BY `+sortBy.OrderBy("products.id")+`
+				LIMIT ? OFFSET ?
+			`, append(fuzzyArgs, pageArgs...)...).Scan(&rows).Error; err != nil {
+				return nil, nil, apperror.New(
+					constant.INTERNALSERVERERROR,
+					"",
+					"Failed to search products",
+				)
+			}
+		}
+	}
+
+	meta := pagination.PageMeta(page, sortBy, len(rows))
+	if meta.HasMore {
+		rows = rows[:page.Limit]
+	}
+
+	hits, err := s.searchHits(rows, match)
+	if err != nil {
+		return nil, nil, err
+	}
+	return hits, meta, nil
+}
+
+// searchHits loads the ranked products with their relations, keeping the
+// rank order
+func (s *ProductService) searchHits(rows []searchRow, match string) ([]ProductSearchHit, error) {
+	hits := []ProductSearchHit{}
+	if len(rows) == 0 {
+		return hits, nil
+	}
+
+	ids := make([]uuid.UUID, 0, len(rows))
+	for _, r := range rows {
+		ids = append(ids, r.ID)
+	}
+
+	var products []model.Product
+	if err := s.repo.FindWhereWithPreload(&products, "id IN ?", []interface{}{ids}, productPreloads...); err != nil {
+		return nil, apperror.New(
+			constant.INTERNALSERVERERROR,
+			"",
+			"Failed to fetch products",
+		)
+	}
+
+	byID := make(map[uuid.UUID]model.Product, len(products))
+	for _, p := range products {
+		byID[p.ID] = p
+	}
+
+	for _, r := range rows {
+		product, ok := byID[r.ID]
+		if !ok {
+			continue
+		}
+		hits = append(hits, ProductSearchHit{
+			Product:       product,
+			Rank:          r.Rank,
+			Match:         match,
+			NameHighlight: r.NameHighlight,
+			Snippet:       r.Snippet,
+		})
+	}
+	return hits, nil
+}
@@ -0,0 +1,38 @@
+package services
+
+import (
+	"html"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// sqlReplace matches one replace(..., 'from', 'to') step; a quote inside a
+// literal is doubled
+var sqlReplace = regexp.MustCompile(`, '((?:[^']|'')*)', '((?:[^']|'')*)'\)`)
+
+func TestHTMLEscapeSQL(t *testing.T) {
+	sql := htmlEscapeSQL("products.name")
+	if !strings.Contains(sql, "(products.name,") {
+		t.Fatalf("expression not wrapped: %s", sql)
+	}
+
+	// run the replace() calls in the order Postgres evaluates them
+	steps := sqlReplace.FindAllStringSubmatch(sql, -1)
+	unquote := func(s string) string { return strings.ReplaceAll(s, "''", "'") }
+
+	for _, in := range []string{
+		"Barça Home 23/24",
+		`<script>alert("x")</script>`,
+		"Tom & Jerry's <b>kit</b>",
+		"&lt;already escaped&gt;",
+	} {
+		got := in
+		for _, step := range steps {
+			got = strings.ReplaceAll(got, unquote(step[1]), unquote(step[2]))
+		}
+		if want := html.EscapeString(in); got != want {
+			t.Errorf("escape(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -1,18 +1,40 @@
 package services
 
 import (
+	"context"
+
+	"github.com/google/uuid"
+
 	"vestra-ecommerce/src/model"
 	"vestra-ecommerce/src/repo"
 	constant "vestra-ecommerce/utils/constants"
+	"vestra-ecommerce/utils/money"
+	"vestra-ecommerce/utils/pagination"
 	"vestra-ecommerce/utils/utils/apperror"
 )
 
 type ProductService struct {
-	repo repo.IPgSQLRepository
+	repo    repo.IPgSQLRepository
+	suggest *SuggestIndex
 }
 
-func NewProductService(repo repo.IPgSQLRepository) *ProductService {
-	return &ProductService{repo: repo}
+func NewProductService(repo repo.IPgSQLRepository, suggest *SuggestIndex) *ProductService {
+	return &ProductService{repo: repo, suggest: suggest}
+}
+
+// productPreloads are the relations returned with every product
+var productPreloads = []string{"Sizes", "Category", "Team"}
+
+// productSorts are the fields product lists can be sorted by. Popularity is
+// units sold, as in the suggestion index.
+var productSorts = map[string]string{
+	"price":      "products.price_minor",
+	"created_at": "products.created_at",
+	"name":       "products.name",
+	"popularity": `COALESCE((
+		SELECT SUM(oi.quantity) FROM order_items oi JOIN orders o ON o.id = oi.order_id
+		WHERE oi.product_id = products.id AND o.status <> '` + constant.CANCELLED + `'
+	), 0)`,
 }
 
 /* =======================
@@ -25,10 +47,16 @@ type UpdateProductSizeInput struct {
 	Quantity int
 }
 
+// CategoryID and TeamID clear the field when set to "". League is only
+// taken when the product has no team; otherwise it follows the team.
 type UpdateProductInput struct {
 	Name         *string
-	Price        *int
+	Description  *string
+	Price        *int64 // minor units
+	Currency     *string
 	ImageURL     *string
+	CategoryID   *string
+	TeamID       *string
 	League       *string
 	KitType      *string
 	Year         *int
@@ -38,12 +66,21 @@ type UpdateProductInput struct {
 }
 
 
+// Category and Team take an ID or slug and include what is filed below
+// them: subcategories, or a league's clubs. A list filter matches any of
+// its values; nil and zero fields don't filter.
 type ProductFilter struct {
-	Category string
-	MinPrice int
-	MaxPrice int
-	Search   string
-	Size     string
+	Category   string
+	Team       string
+	League     []string
+	KitType    []string
+	Year       []int
+	Size       []string
+	InStock    *bool
+	TopSelling *bool
+	MinPrice   int64 // minor units
+	MaxPrice   int64
+	Search     string
 }
 
 
@@ -51,7 +88,7 @@ type ProductFilter struct {
    CREATE PRODUCT
    ======================= */
 
-func (s *ProductService) CreateProduct(product *model.Product) error {
+func (s *ProductService) CreateProduct(ctx context.Context, product *model.Product) error {
 	if product == nil {
 		return apperror.New(
 			constant.BADREQUEST,
@@ -60,6 +97,10 @@ func (s *ProductService) CreateProduct(product *model.Product) error {
 		)
 	}
 
+	if err := fileProduct(s.repo, product); err != nil {
+		return err
+	}
+
 	if err := s.repo.Insert(product); err != nil {
 		return apperror.New(
 			constant.INTERNALSERVERERROR,
@@ -68,6 +109,14 @@ func (s *ProductService) CreateProduct(product *model.Product) error {
 		)
 	}
 
+	recordAuditAfter(ctx, s.repo, AuditEntry{
+		Action:     constant.AUDIT_PRODUCT_CREATE,
+		EntityType: constant.ENTITY_PRODUCT,
+		EntityID:   product.ID.String(),
+		After:      product,
+	})
+	s.suggest.Refresh()
+
 	return nil
 }
 
@@ -75,70 +124,67 @@ func (s *ProductService) CreateProduct(product *model.Product) error {
    GET PRODUCTS
    ======================= */
 
-func (s *ProductService) GetAllProducts(filter ProductFilter) ([]model.Product, error) {
-	var products []model.Product
-
-	query := "1 = 1"
-	args := []interface{}{}
-
-	if filter.Category != "" {
-		query += " AND category = ?"
-		args = append(args, filter.Category)
-	}
-
-	if filter.MinPrice > 0 {
-		query += " AND price >= ?"
-		args = append(args, filter.MinPrice)
+// GetAllProducts lists a page of the products matching filter together with
+// facet counts over all of them (see product_facets.go). Pages continue from
+// a cursor.
+func (s *ProductService) GetAllProducts(filter ProductFilter, page pagination.Params) (*ProductListing, *pagination.Meta, error) {
+	sortBy, err := pageSort(page, productSorts, "-created_at")
+	if err != nil {
+		return nil, nil, err
 	}
 
-	if filter.MaxPrice > 0 {
-		query += " AND price <= ?"
-		args = append(args, filter.MaxPrice)
+	conditions := filter.conditions()
+	query, args := joinConditions(conditions, "")
+	pageQuery, pageArgs, err := afterCursor(s.repo, page, sortBy, "products", query, args)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	if filter.Search != "" {
-		query += " AND (name ILIKE ? OR description ILIKE ?)"
-		search := "%" + filter.Search + "%"
-		args = append(args, search, search)
+	listing := &ProductListing{Products: []model.Product{}}
+	err = s.repo.FindPage(&listing.Products, pageQuery, pageArgs, sortBy.OrderBy("id"), page.Limit+1, 0, productPreloads...)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	if filter.Size != "" {
-		query += `
-			AND id IN (
-				SELECT product_id
-				FROM product_sizes
-				WHERE size = ?
-			)
-		`
-		args = append(args, filter.Size)
+	meta := pagination.CursorMeta(page, sortBy, len(listing.Products), func() string {
+		return listing.Products[page.Limit-1].ID.String()
+	})
+	if meta.HasMore {
+		listing.Products = listing.Products[:page.Limit]
 	}
 
-	err := s.repo.FindWhereWithPreload(&products, query, args, "Sizes")
-	if err != nil {
-		return nil, err
+	if listing.Facets, err = s.productFacets(conditions); err != nil {
+		return nil, nil, err
 	}
 
-	return products, nil
+	return listing, meta, nil
 }
 
 
+// GetProductByID returns a product with its image gallery in order
 func (s *ProductService) GetProductByID(id string) (*model.Product, error) {
 	var product model.Product
-	if err := s.repo.FindByIdWithPreload(&product, id, "Sizes"); err != nil {
+	if err := s.repo.FindByIdWithPreload(&product, id, append(productPreloads, "Images")...); err != nil {
 		return nil, apperror.New(
 			constant.NOTFOUND,
 			"",
 			"Product not found",
 		)
 	}
+	sortImages(product.Images)
 	return &product, nil
 }
 
+// Suggest autocompletes the search box from the in-memory index
+func (s *ProductService) Suggest(q string, limit int) []Suggestion {
+	return s.suggest.Suggest(q, limit)
+}
+
 /* =======================
    DELETE PRODUCT
    ======================= */
 
-func (s *ProductService) DeleteProduct(id string) error {
+func (s *ProductService) DeleteProduct(ctx context.Context, id string) error {
 	var product model.Product
 	if err := s.repo.FindById(&product, id); err != nil {
 		return apperror.New(
@@ -154,6 +200,15 @@ func (s *ProductService) DeleteProduct(id string) error {
 			"Failed to delete product",
 		)
 	}
+
+	recordAuditAfter(ctx, s.repo, AuditEntry{
+		Action:     constant.AUDIT_PRODUCT_DELETE,
+		EntityType: constant.ENTITY_PRODUCT,
+		EntityID:   product.ID.String(),
+		Before:     product,
+	})
+	s.suggest.Refresh()
+
 	return nil
 }
 
@@ -161,9 +216,9 @@ func (s *ProductService) DeleteProduct(id string) error {
    UPDATE PRODUCT
    ======================= */
 
-func (s *ProductService) UpdateProduct(id string, input *UpdateProductInput) (*model.Product, error) {
+func (s *ProductService) UpdateProduct(ctx context.Context, id string, input *UpdateProductInput) (*model.Product, error) {
 	var product model.Product
-	if err := s.repo.FindByIdWithPreload(&product, id, "Sizes"); err != nil {
+	if err := s.repo.FindByIdWithPreload(&product, id, productPreloads...); err != nil {
 		return nil, apperror.New(
 			constant.NOTFOUND,
 			"",
@@ -171,18 +226,81 @@ func (s *ProductService) UpdateProduct(id string, input *UpdateProductInput) (*m
 		)
 	}
 
+	// Snapshot for the audit log; the reload below reuses product
+	before := product
+	before.Sizes = append([]model.ProductSize(nil), product.Sizes...)
+
 	updates := map[string]interface{}{}
 
 	if input.Name != nil {
 		updates["name"] = *input.Name
 	}
+	if input.Description != nil {
+		updates["description"] = *input.Description
+	}
 	if input.Price != nil {
-		updates["price"] = *input.Price
+		if *input.Price <= 0 {
+			return nil, apperror.New(
+				constant.BADREQUEST,
+				"",
+				"Price must be greater than zero",
+			)
+		}
+		updates["price_minor"] = *input.Price
+	}
+	if input.Currency != nil {
+		price := money.New(product.Price.Amount, *input.Currency)
+		if err := price.Validate(); err != nil {
+			return nil, apperror.New(
+				constant.BADREQUEST,
+				"",
+				"Invalid currency",
+			)
+		}
+		updates["price_currency"] = price.Currency
 	}
 	if input.ImageURL != nil {
 		updates["image_url"] = *input.ImageURL
 	}
-	if input.League != nil {
+	if input.CategoryID != nil {
+		updates["category_id"] = nil
+		if *input.CategoryID != "" {
+			categoryID, err := uuid.Parse(*input.CategoryID)
+			if err != nil {
+				return nil, apperror.New(
+					constant.BADREQUEST,
+					constant.INVALID_REQUEST,
+					"Invalid category ID",
+				)
+			}
+			if err := fileProduct(s.repo, &model.Product{CategoryID: &categoryID}); err != nil {
+				return nil, err
+			}
+			updates["category_id"] = categoryID
+		}
+	}
+	hasTeam := product.TeamID != nil
+	if input.TeamID != nil {
+		updates["team_id"] = nil
+		hasTeam = *input.TeamID != ""
+		if hasTeam {
+			teamID, err := uuid.Parse(*input.TeamID)
+			if err != nil {
+				return nil, apperror.New(
+					constant.BADREQUEST,
+					constant.INVALID_REQUEST,
+					"Invalid team ID",
+				)
+			}
+			league, err := teamLeague(s.repo, teamID)
+			if err != nil {
+				return nil, err
+			}
+			updates["team_id"] = teamID
+			updates["league"] = league
+		}
+	}
+	if input.League != nil && !hasTeam {
 		updates["league"] = *input.League
 	}
 	if input.KitType != nil {
@@ -243,7 +361,7 @@ func (s *ProductService) UpdateProduct(id string, input *UpdateProductInput) (*m
 	}
 
 	// Reload updated product
-	if err := s.repo.FindByIdWithPreload(&product, id, "Sizes"); err != nil {
+	if err := s.repo.FindByIdWithPreload(&product, id, productPreloads...); err != nil {
 		return nil, apperror.New(
 			constant.INTERNALSERVERERROR,
 			"",
@@ -251,51 +369,38 @@ func (s *ProductService) UpdateProduct(id string, input *UpdateProductInput) (*m
 		)
 	}
 
+	recordAuditAfter(ctx, s.repo, AuditEntry{
+		Action:     constant.AUDIT_PRODUCT_UPDATE,
+		EntityType: constant.ENTITY_PRODUCT,
+		EntityID:   product.ID.String(),
+		Before:     before,
+		After:      product,
+	})
+	s.suggest.Refresh()
+
 	return &product, nil
 }
 
-/* =======================
-   SEARCH PRODUCTS
-   ======================= */
-func (s *ProductService) SearchProducts(
-	query string,
-	league string,
-	kitType string,
-	year *int,
-) ([]model.Product, error) {
-
-	var products []model.Product
-
-	dbQuery := "1 = 1"
-	args := []interface{}{}
-
-	if query != "" {
-		dbQuery += " AND name ILIKE ?"
-		args = append(args, "%"+query+"%")
-	}
-
-	if league != "" {
-		dbQuery += " AND league = ?"
-		args = append(args, league)
-	}
-
-	if kitType != "" {
-		dbQuery += " AND kit_type = ?"
-		args = append(args, kitType)
-	}
-
-	if year != nil {
-		dbQuery += " AND year = ?"
-		args = append(args, *year)
+// fileProduct checks the product's category and team exist and copies the
+// team's league name onto it
+func fileProduct(db repo.IPgSQLRepository, product *model.Product) error {
+	if product.CategoryID != nil {
+		var category model.Category
+		if err := db.FindById(&category, *product.CategoryID); err != nil {
+			return apperror.New(
+				constant.BADREQUEST,
+				constant.INVALID_REQUEST,
+				"Category not found",
+			)
+		}
 	}
 
-	if err := s.repo.FindWhereWithPreload(&products, dbQuery, args, "Sizes"); err != nil {
-		return nil, apperror.New(
-			constant.INTERNALSERVERERROR,
-			"",
-			"Failed to fetch products",
-		)
+	if product.TeamID != nil {
+		league, err := teamLeague(db, *product.TeamID)
+		if err != nil {
+			return err
+		}
+		product.League = league
 	}
-
-	return products, nil
+	return nil
 }
@@ -0,0 +1,465 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"vestra-ecommerce/src/model"
+	"vestra-ecommerce/src/repo"
+	constant "vestra-ecommerce/utils/constants"
+	"vestra-ecommerce/utils/gateway"
+	"vestra-ecommerce/utils/money"
+	"vestra-ecommerce/utils/utils/apperror"
+)
+
+/* =======================
+   REFUNDS
+   ======================= */
+
+// RefundRequest asks for money back on a payment. Amount is in minor units
+// of the payment currency; 0 refunds whatever is still refundable.
+type RefundRequest struct {
+	Amount int64  `json:"amount"`
+	Reason string `json:"reason"`
+}
+
+// refundablePaymentStatuses hold captured money that can still go back
+var refundablePaymentStatuses = []string{
+	constant.PAID,
+	constant.PARTIALLY_REFUNDED,
+	constant.REFUND_PENDING,
+}
+
+// RefundPayment refunds all or part of a captured payment through its
+// provider. The refund row is written and the payment and order marked
+// REFUND_PENDING before the provider is called, so a crash in between
+// leaves a visible pending refund rather than lost money. Likewise the
+// refund is only marked FAILED when the provider refused it; if the call
+// timed out it may still have gone through, so it stays pending until the
+// provider's webhook settles it.
+func (s *PaymentService) RefundPayment(
+	ctx context.Context,
+	actor OrderActor,
+	paymentID string,
+	req RefundRequest,
+) (*model.Refund, error) {
+
+	if _, err := uuid.Parse(paymentID); err != nil {
+		return nil, apperror.New(
+			constant.BADREQUEST,
+			"",
+			"Invalid payment ID",
+		)
+	}
+
+	if req.Amount < 0 {
+		return nil, apperror.New(
+			constant.BADREQUEST,
+			constant.INVALID_AMOUNT,
+			"Refund amount cannot be negative",
+		)
+	}
+
+	var refund model.Refund
+	var payment model.Payment
+
+	err := s.repo.WithTransaction(ctx, func(tx repo.IPgSQLRepository) error {
+		res := tx.Raw("SELECT * FROM payments WHERE id = ? FOR UPDATE", paymentID).Scan(&payment)
+		if res.Error != nil {
+			return apperror.ErrInternal
+		}
+		if res.RowsAffected == 0 {
+			return apperror.New(
+				constant.NOTFOUND,
+				"",
+				"Payment not found",
+			)
+		}
+
+		if !isRefundablePayment(payment.Status) || payment.TransactionID == "" {
+			return apperror.New(
+				constant.BADREQUEST,
+				"",
+				"Only captured payments can be refunded",
+			)
+		}
+
+		remaining, err := refundableBalance(tx, &payment)
+		if err != nil {
+			return err
+		}
+
+		amount := remaining
+		if req.Amount > 0 {
+			amount = money.New(req.Amount, payment.Amount.Currency)
+		}
+		if !amount.IsPositive() || amount.Amount > remaining.Amount {
+			return apperror.New(
+				constant.BADREQUEST,
+				constant.INVALID_AMOUNT,
+				"Refund amount exceeds the refundable balance",
+			).WithDetails(map[string]interface{}{"refundable": remaining})
+		}
+
+		refund = model.Refund{
+			PaymentID:   payment.ID,
+			OrderID:     payment.OrderID,
+			Amount:      amount,
+			Reason:      req.Reason,
+			Status:      constant.REFUND_PENDING,
+			InitiatedBy: actor.userUUID(),
+			ActorRole:   actor.Role,
+		}
+		if err := tx.Insert(&refund); err != nil {
+			return apperror.New(
+				constant.INTERNALSERVERERROR,
+				"",
+				"Failed to create refund",
+			)
+		}
+
+		return syncRefundStatus(tx, payment.ID, payment.OrderID, actor, req.Reason)
+	})
+	if err != nil {
+		if appErr, ok := err.(*apperror.AppError); ok {
+			return nil, appErr
+		}
+		return nil, apperror.ErrInternal
+	}
+
+	result, gwErr := s.gateway.Refund(ctx, gateway.RefundRequest{
+		ProviderPaymentID: payment.TransactionID,
+		Amount:            refund.Amount.Amount,
+		Currency:          refund.Amount.Currency,
+		Reference:         refund.ID.String(),
+		Reason:            req.Reason,
+	})
+	switch {
+	case errors.Is(gwErr, gateway.ErrRejected):
+		if err := s.finishRefund(ctx, refund.ID, constant.FAILED, "", gwErr.Error()); err != nil {
+			return nil, apperror.ErrInternal
+		}
+		return nil, apperror.New(
+			constant.BADGATEWAY,
+			"",
+			"Refund was rejected by the payment provider",
+		)
+	case gwErr != nil:
+		// Sending it again could refund twice; note the error and wait
+		log.Printf("refund %s: no answer from payment provider: %v", refund.ID, gwErr)
+		if err := s.finishRefund(ctx, refund.ID, constant.REFUND_PENDING, "", gwErr.Error()); err != nil {
+			return nil, apperror.ErrInternal
+		}
+	default:
+		if err := s.finishRefund(ctx, refund.ID, refundStatusFromGateway(result.Status), result.ID, ""); err != nil {
+			return nil, apperror.ErrInternal
+		}
+	}
+
+	if err := s.repo.WithContext(ctx).FindById(&refund, refund.ID); err != nil {
+		return nil, apperror.ErrInternal
+	}
+
+	return &refund, nil
+}
+
+// RefundOrder refunds the remaining balance of every captured payment of an
+// order, e.g. after it was cancelled. Payments with nothing left to refund
+// are skipped.
+func (s *PaymentService) RefundOrder(
+	ctx context.Context,
+	actor OrderActor,
+	orderID string,
+	reason string,
+) ([]model.Refund, error) {
+
+	db := s.repo.WithContext(ctx)
+
+	oID, err := uuid.Parse(orderID)
+	if err != nil {
+		return nil, apperror.New(
+			constant.BADREQUEST,
+			"",
+			"Invalid order ID",
+		)
+	}
+
+	var payments []model.Payment
+	if err := db.FindAllWhere(
+		&payments,
+		"order_id = ? AND status IN ?",
+		oID,
+		refundablePaymentStatuses,
+	); err != nil {
+		return nil, apperror.ErrInternal
+	}
+
+	refunds := []model.Refund{}
+	for i := range payments {
+		remaining, err := refundableBalance(db, &payments[i])
+		if err != nil {
+			return refunds, err
+		}
+		if !remaining.IsPositive() {
+			continue
+		}
+
+		refund, err := s.RefundPayment(ctx, actor, payments[i].ID, RefundRequest{Reason: reason})
+		if err != nil {
+			return refunds, err
+		}
+		refunds = append(refunds, *refund)
+	}
+
+	return refunds, nil
+}
+
+// GetRefundsByPayment lists the refunds of a payment, newest first
+func (s *PaymentService) GetRefundsByPayment(ctx context.Context, paymentID string) ([]model.Refund, error) {
+	db := s.repo.WithContext(ctx)
+
+	if _, err := uuid.Parse(paymentID); err != nil {
+		return nil, apperror.New(
+			constant.BADREQUEST,
+			"",
+			"Invalid payment ID",
+		)
+	}
+
+	refunds := []model.Refund{}
+	if err := db.Raw(
+		"SELECT * FROM refunds WHERE payment_id = ? ORDER BY created_at DESC",
+		paymentID,
+	).Scan(&refunds).Error; err != nil {
+		return nil, apperror.ErrInternal
+	}
+
+	return refunds, nil
+}
+
+// finishRefund records the provider's answer for a pending refund. Refunds
+// that already reached a final state are left alone, so webhook retries
+// and late synchronous answers are harmless.
+func (s *PaymentService) finishRefund(
+	ctx context.Context,
+	refundID uuid.UUID,
+	status string,
+	providerRefundID string,
+	errMsg string,
+) error {
+
+	return s.repo.WithTransaction(ctx, func(tx repo.IPgSQLRepository) error {
+		res := tx.Exec(
+			`UPDATE refunds
+			 SET status = ?, provider_refund_id = COALESCE(NULLIF(?, ''), provider_refund_id), error = ?, updated_at = ?
+			 WHERE id = ? AND status = ?`,
+			status,
+			providerRefundID,
+			errMsg,
+			time.Now(),
+			refundID,
+			constant.REFUND_PENDING,
+		)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 || status == constant.REFUND_PENDING {
+			return nil
+		}
+
+		var refund model.Refund
+		if err := tx.FindById(&refund, refundID); err != nil {
+			return err
+		}
+
+		reason := "Refund completed"
+		if status == constant.FAILED {
+			reason = "Refund failed"
+		}
+		return syncRefundStatus(tx, refund.PaymentID, refund.OrderID, OrderActor{Role: constant.ACTOR_SYSTEM}, reason)
+	})
+}
+
+// applyRefundEvent settles a refund from a provider notification
+func (s *PaymentService) applyRefundEvent(
+	ctx context.Context,
+	parsed *gateway.WebhookEvent,
+) (status string, paymentID string, note string, err error) {
+
+	db := s.repo.WithContext(ctx)
+
+	// The webhook can beat the synchronous answer that stores the provider's
+	// refund ID, so also match on the receipt we sent: our refund ID
+	var match []string
+	var args []interface{}
+	if parsed.Refund.ID != "" {
+		match = append(match, "provider_refund_id = ?")
+		args = append(args, parsed.Refund.ID)
+	}
+	if refundID, err := uuid.Parse(parsed.Refund.Reference); err == nil {
+		match = append(match, "id = ?")
+		args = append(args, refundID)
+	}
+	if len(match) == 0 {
+		return constant.IGNORED, "", "event names no refund", nil
+	}
+
+	var refund model.Refund
+	if err := db.FindOneWhere(&refund, strings.Join(match, " OR "), args...); err != nil {
+		return constant.IGNORED, "", "no matching refund", nil
+	}
+
+	newStatus := refundStatusFromGateway(parsed.Refund.Status)
+	if newStatus == constant.REFUND_PENDING {
+		return constant.IGNORED, refund.PaymentID, "no status change", nil
+	}
+
+	errMsg := ""
+	if newStatus == constant.FAILED {
+		errMsg = "refund failed at provider"
+	}
+	if err := s.finishRefund(ctx, refund.ID, newStatus, parsed.Refund.ID, errMsg); err != nil {
+		return "", refund.PaymentID, "", err
+	}
+
+	return constant.PROCESSED, refund.PaymentID, "", nil
+}
+
+// syncRefundStatus derives the payment status from its refunds and moves a
+// cancelled or returned order through REFUND_PENDING to REFUNDED:
+//
+//   - any refund in flight: payment and order REFUND_PENDING
+//   - everything refunded: payment REFUNDED, order REFUNDED once none of its
+//     payments hold captured money
+//   - some refunded: payment PARTIALLY_REFUNDED
+func syncRefundStatus(tx repo.IPgSQLRepository, paymentID string, orderID uuid.UUID, actor OrderActor, reason string) error {
+	var totals struct {
+		Amount   int64
+		Pending  int64
+		Refunded int64
+	}
+	if err := tx.Raw(`
+		SELECT
+			p.amount_minor AS amount,
+			COALESCE(SUM(r.amount_minor) FILTER (WHERE r.status = ?), 0) AS pending,
+			COALESCE(SUM(r.amount_minor) FILTER (WHERE r.status = ?), 0) AS refunded
+		FROM payments p
+		LEFT JOIN refunds r ON r.payment_id = p.id
+		WHERE p.id = ?
+		GROUP BY p.id
+	`,
+		constant.REFUND_PENDING,
+		constant.REFUNDED,
+		paymentID,
+	).Scan(&totals).Error; err != nil {
+		return err
+	}
+
+	status := constant.PAID
+	switch {
+	case totals.Pending > 0:
+		status = constant.REFUND_PENDING
+	case totals.Refunded >= totals.Amount:
+		status = constant.REFUNDED
+	case totals.Refunded > 0:
+		status = constant.PARTIALLY_REFUNDED
+	}
+
+	if err := tx.Exec(
+		"UPDATE payments SET status = ?, updated_at = ? WHERE id = ? AND status IN ?",
+		status,
+		time.Now(),
+		paymentID,
+		[]string{constant.PAID, constant.PARTIALLY_REFUNDED, constant.REFUND_PENDING, constant.REFUNDED},
+	).Error; err != nil {
+		return err
+	}
+
+	if orderID == uuid.Nil {
+		return nil
+	}
+
+	var order model.Order
+	if err := tx.FindById(&order, orderID); err != nil {
+		return nil
+	}
+
+	switch order.Status {
+	case constant.CANCELLED, constant.RETURNED:
+		if status == constant.REFUND_PENDING {
+			return transitionOrder(tx, &order, constant.REFUND_PENDING, actor, reason)
+		}
+	case constant.REFUND_PENDING:
+		var outstanding int64
+		if err := tx.Raw(
+			"SELECT COUNT(*) FROM payments WHERE order_id = ? AND status IN ?",
+			orderID,
+			refundablePaymentStatuses,
+		).Scan(&outstanding).Error; err != nil {
+			return err
+		}
+		if outstanding == 0 {
+			return transitionOrder(tx, &order, constant.REFUNDED, actor, reason)
+		}
+	}
+
+	return nil
+}
+
+// refundableBalance is what's left of a payment after completed and
+// in-flight refunds
+func refundableBalance(db repo.IPgSQLRepository, payment *model.Payment) (money.Money, error) {
+	var committed int64
+	if err := db.Raw(
+		"SELECT COALESCE(SUM(amount_minor), 0) FROM refunds WHERE payment_id = ? AND status IN ?",
+		payment.ID,
+		[]string{constant.REFUND_PENDING, constant.REFUNDED},
+	).Scan(&committed).Error; err != nil {
+		return money.Money{}, apperror.ErrInternal
+	}
+
+	remaining, err := payment.Amount.Sub(money.New(committed, payment.Amount.Currency))
+	if err != nil {
+		return money.Money{}, apperror.ErrInternal
+	}
+	return remaining, nil
+}
+
+func isRefundablePayment(status string) bool {
+	for _, s := range refundablePaymentStatuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// refundStatusFromGateway maps a provider refund status to ours
+func refundStatusFromGateway(status gateway.RefundStatus) string {
+	switch status {
+	case gateway.RefundProcessed:
+		return constant.REFUNDED
+	case gateway.RefundFailed:
+		return constant.FAILED
+	default:
+		return constant.REFUND_PENDING
+	}
+}
+
+// refundCancelledOrder returns the money of a paid order after it was
+// cancelled. Failures are logged rather than returned: the cancellation
+// itself has already been committed and the refund stays visible to admins
+// as FAILED or the order as REFUND_PENDING.
+func (s *PaymentService) refundCancelledOrder(ctx context.Context, orderID uuid.UUID, reason string) {
+	if reason == "" {
+		reason = "Order cancelled"
+	}
+	if _, err := s.RefundOrder(ctx, OrderActor{Role: constant.ACTOR_SYSTEM}, orderID.String(), reason); err != nil {
+		log.Printf("refund for cancelled order %s failed: %v", orderID, err)
+	}
+}
@@ -0,0 +1,475 @@
+package services
+
+import (
+	"context"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"vestra-ecommerce/src/model"
+	"vestra-ecommerce/src/repo"
+	constant "vestra-ecommerce/utils/constants"
+	"vestra-ecommerce/utils/utils/apperror"
+)
+
+var roleNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_-]{1,49}$`)
+
+type RoleService struct {
+	repo     repo.IPgSQLRepository
+	statuses *UserStatusCache
+}
+
+func NewRoleService(repo repo.IPgSQLRepository, statuses *UserStatusCache) *RoleService {
+	return &RoleService{repo: repo, statuses: statuses}
+}
+
+// RoleInput creates a role or replaces an existing one's description and
+// permissions (by name, e.g. "orders:update")
+type RoleInput struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+// GetPermissions lists every permission a role can be given
+func (s *RoleService) GetPermissions(ctx context.Context) ([]model.Permission, error) {
+	var permissions []model.Permission
+	if err := s.repo.WithContext(ctx).Raw(
+		"SELECT * FROM permissions ORDER BY name",
+	).Scan(&permissions).Error; err != nil {
+		return nil, apperror.ErrInternal
+	}
+	return permissions, nil
+}
+
+// GetRoles lists roles with their permissions
+func (s *RoleService) GetRoles(ctx context.Context) ([]model.Role, error) {
+	var roles []model.Role
+	if err := s.repo.WithContext(ctx).FindWhereWithPreload(
+		&roles, "1 = 1", nil, "Permissions",
+	); err != nil {
+		return nil, apperror.ErrInternal
+	}
+	return roles, nil
+}
+
+func (s *RoleService) CreateRole(ctx context.Context, input RoleInput) (*model.Role, error) {
+	name := strings.ToLower(strings.TrimSpace(input.Name))
+	if !roleNamePattern.MatchString(name) {
+		return nil, apperror.New(
+			constant.BADREQUEST,
+			constant.INVALID_REQUEST,
+			"Role name must be 2-50 lowercase letters, digits, '-' or '_'",
+		)
+	}
+
+	role := model.Role{
+		Name:        name,
+		Description: strings.TrimSpace(input.Description),
+	}
+
+	err := s.repo.WithTransaction(ctx, func(tx repo.IPgSQLRepository) error {
+		var existing model.Role
+		if err := tx.FindOneWhere(&existing, "name = ?", name); err == nil {
+			return apperror.New(
+				constant.CONFLICT,
+				"",
+				"Role already exists",
+			)
+		}
+
+		if err := tx.Insert(&role); err != nil {
+			return err
+		}
+		if err := setRolePermissions(tx, role.ID, input.Permissions); err != nil {
+			return err
+		}
+		return recordAudit(ctx, tx, AuditEntry{
+			Action:     constant.AUDIT_ROLE_CREATE,
+			EntityType: constant.ENTITY_ROLE,
+			EntityID:   role.ID.String(),
+			After:      roleSnapshot(role.Name, role.Description, input.Permissions),
+		})
+	})
+	if err != nil {
+		if appErr, ok := err.(*apperror.AppError); ok {
+			return nil, appErr
+		}
+		return nil, apperror.ErrInternal
+	}
+
+	return s.getRole(ctx, role.ID.String())
+}
+
+// UpdateRole replaces a role's description and permissions. Everyone holding
+// the role gets the new permissions on their next request.
+func (s *RoleService) UpdateRole(ctx context.Context, roleID string, input RoleInput) (*model.Role, error) {
+	role, err := s.getRole(ctx, roleID)
+	if err != nil {
+		return nil, err
+	}
+	if role.IsSystem {
+		return nil, apperror.New(
+			constant.BADREQUEST,
+			"",
+			"Built-in roles can't be changed",
+		)
+	}
+
+	err = s.repo.WithTransaction(ctx, func(tx repo.IPgSQLRepository) error {
+		if err := tx.UpdateByFields(&model.Role{}, role.ID, map[string]interface{}{
+			"description": strings.TrimSpace(input.Description),
+		}); err != nil {
+			return err
+		}
+		if err := tx.Exec("DELETE FROM role_permissions WHERE role_id = ?", role.ID).Error; err != nil {
+			return err
+		}
+		if err := setRolePermissions(tx, role.ID, input.Permissions); err != nil {
+			return err
+		}
+		if err := ensureRoleManager(tx); err != nil {
+			return err
+		}
+		return recordAudit(ctx, tx, AuditEntry{
+			Action:     constant.AUDIT_ROLE_UPDATE,
+			EntityType: constant.ENTITY_ROLE,
+			EntityID:   role.ID.String(),
+			Before:     roleSnapshot(role.Name, role.Description, permissionNames(role.Permissions)),
+			After:      roleSnapshot(role.Name, strings.TrimSpace(input.Description), input.Permissions),
+		})
+	})
+	if err != nil {
+		if appErr, ok := err.(*apperror.AppError); ok {
+			return nil, appErr
+		}
+		return nil, apperror.ErrInternal
+	}
+
+	s.statuses.InvalidateAll()
+	return s.getRole(ctx, roleID)
+}
+
+// DeleteRole removes a role and takes it away from every user holding it
+func (s *RoleService) DeleteRole(ctx context.Context, roleID string) error {
+	role, err := s.getRole(ctx, roleID)
+	if err != nil {
+		return err
+	}
+	if role.IsSystem {
+		return apperror.New(
+			constant.BADREQUEST,
+			"",
+			"Built-in roles can't be deleted",
+		)
+	}
+
+	err = s.repo.WithTransaction(ctx, func(tx repo.IPgSQLRepository) error {
+		var holders []uuid.UUID
+		if err := tx.Raw(
+			"SELECT user_id FROM user_roles WHERE role_id = ?", role.ID,
+		).Scan(&holders).Error; err != nil {
+			return err
+		}
+
+		for _, stmt := range []string{
+			"DELETE FROM role_permissions WHERE role_id = ?",
+			"DELETE FROM user_roles WHERE role_id = ?",
+			"DELETE FROM roles WHERE id = ?",
+		} {
+			if err := tx.Exec(stmt, role.ID).Error; err != nil {
+				return err
+			}
+		}
+
+		for _, userID := range holders {
+			if err := syncUserRoleColumn(tx, userID); err != nil {
+				return err
+			}
+		}
+
+		if err := ensureRoleManager(tx); err != nil {
+			return err
+		}
+
+		before := roleSnapshot(role.Name, role.Description, permissionNames(role.Permissions))
+		before["holders"] = len(holders)
+		return recordAudit(ctx, tx, AuditEntry{
+			Action:     constant.AUDIT_ROLE_DELETE,
+			EntityType: constant.ENTITY_ROLE,
+			EntityID:   role.ID.String(),
+			Before:     before,
+		})
+	})
+	if err != nil {
+		if appErr, ok := err.(*apperror.AppError); ok {
+			return appErr
+		}
+		return apperror.ErrInternal
+	}
+
+	s.statuses.InvalidateAll()
+	return nil
+}
+
+// GetUserRoles returns the roles assigned to a user
+func (s *RoleService) GetUserRoles(ctx context.Context, userID string) ([]model.Role, error) {
+	var user model.User
+	if err := s.repo.WithContext(ctx).FindByIdWithPreload(&user, userID, "Roles.Permissions"); err != nil {
+		return nil, apperror.New(
+			constant.NOTFOUND,
+			"",
+			"User not found",
+		)
+	}
+	return user.Roles, nil
+}
+
+// SetUserRoles replaces the user's roles with roleIDs. An empty list takes
+// away all admin access.
+func (s *RoleService) SetUserRoles(ctx context.Context, actorID, userID string, roleIDs []string) ([]model.Role, error) {
+	var user model.User
+	if err := s.repo.WithContext(ctx).FindById(&user, userID); err != nil {
+		return nil, apperror.New(
+			constant.NOTFOUND,
+			"",
+			"User not found",
+		)
+	}
+
+	ids := make([]uuid.UUID, 0, len(roleIDs))
+	for _, raw := range roleIDs {
+		id, err := uuid.Parse(raw)
+		if err != nil {
+			return nil, apperror.New(
+				constant.BADREQUEST,
+				constant.INVALID_REQUEST,
+				"Invalid role ID",
+			).WithDetails(raw)
+		}
+		ids = append(ids, id)
+	}
+	ids = uniqueUUIDs(ids)
+
+	err := s.repo.WithTransaction(ctx, func(tx repo.IPgSQLRepository) error {
+		before, err := userRoleNames(tx, user.ID)
+		if err != nil {
+			return err
+		}
+
+		if len(ids) > 0 {
+			var found int64
+			if err := tx.Raw("SELECT COUNT(*) FROM roles WHERE id IN ?", ids).Scan(&found).Error; err != nil {
+				return err
+			}
+			if found != int64(len(ids)) {
+				return apperror.New(
+					constant.BADREQUEST,
+					"",
+					"Unknown role",
+				)
+			}
+		}
+
+		if err := tx.Exec("DELETE FROM user_roles WHERE user_id = ?", user.ID).Error; err != nil {
+			return err
+		}
+		for _, id := range ids {
+			if err := tx.Exec(
+				"INSERT INTO user_roles (user_id, role_id) VALUES (?, ?)", user.ID, id,
+			).Error; err != nil {
+				return err
+			}
+		}
+
+		// Admins can't lock themselves out of role management
+		if actorID == user.ID.String() {
+			var keeps int64
+			if err := tx.Raw(`
+				SELECT COUNT(*) FROM user_roles ur
+				JOIN role_permissions rp ON rp.role_id = ur.role_id
+				JOIN permissions p ON p.id = rp.permission_id
+				WHERE ur.user_id = ? AND p.name = ?
+			`, user.ID, constant.PERM_ROLES_MANAGE).Scan(&keeps).Error; err != nil {
+				return err
+			}
+			if keeps == 0 {
+				return apperror.New(
+					constant.BADREQUEST,
+					"",
+					"You can't remove your own role management access",
+				)
+			}
+		}
+
+		if err := syncUserRoleColumn(tx, user.ID); err != nil {
+			return err
+		}
+
+		after, err := userRoleNames(tx, user.ID)
+		if err != nil {
+			return err
+		}
+		return recordAudit(ctx, tx, AuditEntry{
+			Action:     constant.AUDIT_USER_ROLES,
+			EntityType: constant.ENTITY_USER,
+			EntityID:   user.ID.String(),
+			Before:     map[string]interface{}{"roles": before},
+			After:      map[string]interface{}{"roles": after},
+		})
+	})
+	if err != nil {
+		if appErr, ok := err.(*apperror.AppError); ok {
+			return nil, appErr
+		}
+		return nil, apperror.ErrInternal
+	}
+
+	s.statuses.Invalidate(user.ID.String())
+	return s.GetUserRoles(ctx, userID)
+}
+
+func (s *RoleService) getRole(ctx context.Context, roleID string) (*model.Role, error) {
+	var role model.Role
+	if err := s.repo.WithContext(ctx).FindByIdWithPreload(&role, roleID, "Permissions"); err != nil {
+		return nil, apperror.New(
+			constant.NOTFOUND,
+			"",
+			"Role not found",
+		)
+	}
+	return &role, nil
+}
+
+// setRolePermissions grants the named permissions to a role that currently
+// has none, rejecting names that aren't in the catalog
+func setRolePermissions(tx repo.IPgSQLRepository, roleID uuid.UUID, names []string) error {
+	if len(names) == 0 {
+		return nil
+	}
+
+	var known []string
+	if err := tx.Raw("SELECT name FROM permissions WHERE name IN ?", names).Scan(&known).Error; err != nil {
+		return err
+	}
+
+	if len(known) != len(uniqueStrings(names)) {
+		knownSet := make(map[string]bool, len(known))
+		for _, name := range known {
+			knownSet[name] = true
+		}
+		var unknown []string
+		for _, name := range names {
+			if !knownSet[name] {
+				unknown = append(unknown, name)
+			}
+		}
+		return apperror.New(
+			constant.BADREQUEST,
+			constant.INVALID_REQUEST,
+			"Unknown permission",
+		).WithDetails(unknown)
+	}
+
+	return tx.Exec(`
+		INSERT INTO role_permissions (role_id, permission_id)
+		SELECT ?, id FROM permissions WHERE name IN ?
+	`, roleID, names).Error
+}
+
+// syncUserRoleColumn keeps the legacy users.role column in step with
+// user_roles: "admin" while the user holds any role
+func syncUserRoleColumn(tx repo.IPgSQLRepository, userID uuid.UUID) error {
+	return tx.Exec(`
+		UPDATE users SET role = CASE
+			WHEN EXISTS (SELECT 1 FROM user_roles WHERE user_id = users.id) THEN ?
+			ELSE 'user'
+		END
+		WHERE id = ?
+	`, constant.ROLE_ADMIN, userID).Error
+}
+
+// userRoleNames lists the names of the user's roles, for the audit log
+func userRoleNames(tx repo.IPgSQLRepository, userID uuid.UUID) ([]string, error) {
+	names := []string{}
+	err := tx.Raw(`
+		SELECT r.name FROM user_roles ur JOIN roles r ON r.id = ur.role_id
+		WHERE ur.user_id = ? ORDER BY r.name
+	`, userID).Scan(&names).Error
+	return names, err
+}
+
+// ensureRoleManager fails unless some active user can still manage roles,
+// so changing or deleting a role can't lock everyone out. The permission
+// row is locked first, making concurrent role changes take turns.
+func ensureRoleManager(tx repo.IPgSQLRepository) error {
+	if err := tx.Exec(
+		"SELECT id FROM permissions WHERE name = ? FOR UPDATE", constant.PERM_ROLES_MANAGE,
+	).Error; err != nil {
+		return err
+	}
+
+	var managers int64
+	if err := tx.Raw(`
+		SELECT COUNT(DISTINCT ur.user_id) FROM user_roles ur
+		JOIN users u ON u.id = ur.user_id
+		JOIN role_permissions rp ON rp.role_id = ur.role_id
+		JOIN permissions p ON p.id = rp.permission_id
+		WHERE p.name = ? AND NOT u.is_blocked
+	`, constant.PERM_ROLES_MANAGE).Scan(&managers).Error; err != nil {
+		return err
+	}
+	if managers == 0 {
+		return apperror.New(
+			constant.BADREQUEST,
+			"",
+			"No active user would be left who can manage roles",
+		)
+	}
+	return nil
+}
+
+// roleSnapshot is a role as recorded in the audit log
+func roleSnapshot(name, description string, permissions []string) map[string]interface{} {
+	perms := uniqueStrings(permissions)
+	sort.Strings(perms)
+	return map[string]interface{}{
+		"name":        name,
+		"description": description,
+		"permissions": perms,
+	}
+}
+
+func permissionNames(permissions []model.Permission) []string {
+	names := make([]string, 0, len(permissions))
+	for _, p := range permissions {
+		names = append(names, p.Name)
+	}
+	return names
+}
+
+func uniqueStrings(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	out := make([]string, 0, len(values))
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func uniqueUUIDs(values []uuid.UUID) []uuid.UUID {
+	seen := make(map[uuid.UUID]bool, len(values))
+	out := make([]uuid.UUID, 0, len(values))
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			out = append(out, v)
+		}
+	}
+	return out
+}
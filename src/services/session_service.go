@@ -0,0 +1,518 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"github.com/google/uuid"
+
+	"vestra-ecommerce/src/model"
+	"vestra-ecommerce/src/repo"
+	constant "vestra-ecommerce/utils/constants"
+	"vestra-ecommerce/utils/jwt"
+	"vestra-ecommerce/utils/utils/apperror"
+)
+
+// Reasons recorded on revoked refresh tokens
+const (
+	revokeLogout         = "logout"
+	revokeLogoutAll      = "logout_all"
+	revokeByUser         = "revoked_by_user"
+	revokeReuseDetected  = "reuse_detected"
+	revokeUserBlocked    = "user_blocked"
+	revokePasswordReset  = "password_reset"
+	revokePasswordChange = "password_change"
+	revokeAccountDeleted = "account_deleted"
+	revokeByAdmin        = "revoked_by_admin"
+	revokeAccountLinked  = "account_linked"
+)
+
+// SessionService issues and rotates refresh tokens. Each login starts a
+// token family (a session); every /refresh swaps the presented token for a
+// new one in the same family. Presenting an already rotated token means it
+// leaked, so the whole family is revoked.
+//
+// Revoking a session takes effect at its next refresh; blocking a user or
+// resetting their password also bumps User.TokenVersion, which cuts off
+// outstanding access tokens immediately (see AuthMiddleware).
+type SessionService struct {
+	repo       repo.IPgSQLRepository
+	jwtManager *jwt.JWTManager
+}
+
+func NewSessionService(repo repo.IPgSQLRepository, jwtManager *jwt.JWTManager) *SessionService {
+	return &SessionService{repo: repo, jwtManager: jwtManager}
+}
+
+// DeviceInfo describes the client a session was started from
+type DeviceInfo struct {
+	UserAgent string
+	IPAddress string
+}
+
+// TokenPair is what login and refresh hand back to the client
+type TokenPair struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	SessionID    string `json:"session_id"`
+}
+
+// Session is a token family as shown to its owner
+type Session struct {
+	ID         uuid.UUID `json:"id"`
+	UserAgent  string    `json:"user_agent"`
+	IPAddress  string    `json:"ip_address"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Current    bool      `json:"current"`
+}
+
+/* =======================
+   ISSUE / ROTATE
+   ======================= */
+
+// StartSession starts a new token family for a freshly authenticated user.
+// mfa records that the login passed a second factor; it carries over to
+// every token of the session.
+func (s *SessionService) StartSession(ctx context.Context, user *model.User, device DeviceInfo, mfa bool) (*TokenPair, error) {
+	var pair *TokenPair
+
+	err := s.repo.WithTransaction(ctx, func(tx repo.IPgSQLRepository) error {
+		var err error
+		pair, err = s.issue(tx, user, uuid.New(), nil, device, mfa)
+		return err
+	})
+	if err != nil {
+		return nil, apperror.New(
+			constant.INTERNALSERVERERROR,
+			"",
+			"Failed to start session",
+		)
+	}
+
+	return pair, nil
+}
+
+// Rotate exchanges a refresh token for a new pair in the same session
+func (s *SessionService) Rotate(ctx context.Context, refreshToken string, device DeviceInfo) (*TokenPair, error) {
+	claims, err := s.jwtManager.ValidateRefreshToken(refreshToken)
+	if err != nil {
+		return nil, invalidRefreshToken()
+	}
+
+	tokenID, err := uuid.Parse(claims.ID)
+	if err != nil {
+		return nil, invalidRefreshToken()
+	}
+
+	var pair *TokenPair
+	reused := false
+
+	err = s.repo.WithTransaction(ctx, func(tx repo.IPgSQLRepository) error {
+		var token model.RefreshToken
+		res := tx.Raw("SELECT * FROM refresh_tokens WHERE id = ? FOR UPDATE", tokenID).Scan(&token)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 || token.TokenHash != hashToken(refreshToken) {
+			return invalidRefreshToken()
+		}
+
+		if token.RevokedAt != nil {
+			return apperror.New(
+				constant.UNAUTHORIZED,
+				constant.SESSION_REVOKED,
+				"Session has been revoked",
+			)
+		}
+
+		if token.UsedAt != nil {
+			// Someone replayed a rotated token: kill the whole session.
+			// Committed below, outside this transaction's rollback.
+			reused = true
+			return nil
+		}
+
+		if time.Now().After(token.ExpiresAt) {
+			return invalidRefreshToken()
+		}
+
+		var user model.User
+		if err := tx.FindById(&user, token.UserID); err != nil {
+			return invalidRefreshToken()
+		}
+		if user.IsBlocked {
+			return apperror.New(
+				constant.FORBIDDEN,
+				constant.USER_BLOCKED,
+				"Account is blocked",
+			)
+		}
+
+		now := time.Now()
+		res = tx.Exec(
+			"UPDATE refresh_tokens SET used_at = ? WHERE id = ? AND used_at IS NULL",
+			now,
+			token.ID,
+		)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			reused = true
+			return nil
+		}
+
+		if device.UserAgent == "" {
+			device.UserAgent = token.UserAgent
+		}
+		pair, err = s.issue(tx, &user, token.FamilyID, &token.ID, device, token.MFA)
+		return err
+	})
+
+	if reused {
+		if err := s.revokeFamilyOf(ctx, tokenID, revokeReuseDetected); err != nil {
+			return nil, apperror.ErrInternal
+		}
+		return nil, apperror.New(
+			constant.UNAUTHORIZED,
+			constant.TOKEN_REUSED,
+			"Refresh token reuse detected, please log in again",
+		)
+	}
+
+	if err != nil {
+		if appErr, ok := err.(*apperror.AppError); ok {
+			return nil, appErr
+		}
+		return nil, apperror.ErrInternal
+	}
+
+	return pair, nil
+}
+
+// Reissue swaps a session's live refresh token for a new pair, picking up
+// the user's current token version. Used to keep the caller logged in after
+// a change that cut off every outstanding access token.
+func (s *SessionService) Reissue(ctx context.Context, userID, sessionID string, device DeviceInfo) (*TokenPair, error) {
+	uID, err := uuid.Parse(userID)
+	if err != nil {
+		return nil, apperror.New(
+			constant.BADREQUEST,
+			"",
+			"Invalid user ID",
+		)
+	}
+	sID, err := uuid.Parse(sessionID)
+	if err != nil {
+		return nil, apperror.New(
+			constant.BADREQUEST,
+			"",
+			"Invalid session ID",
+		)
+	}
+
+	var pair *TokenPair
+
+	err = s.repo.WithTransaction(ctx, func(tx repo.IPgSQLRepository) error {
+		now := time.Now()
+
+		var token model.RefreshToken
+		res := tx.Raw(
+			`SELECT * FROM refresh_tokens
+			 WHERE user_id = ? AND family_id = ?
+			   AND used_at IS NULL AND revoked_at IS NULL AND expires_at > ?
+			 FOR UPDATE`,
+			uID, sID, now,
+		).Scan(&token)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return apperror.New(
+				constant.UNAUTHORIZED,
+				constant.SESSION_REVOKED,
+				"Session has been revoked",
+			)
+		}
+
+		if err := tx.Exec("UPDATE refresh_tokens SET used_at = ? WHERE id = ?", now, token.ID).Error; err != nil {
+			return err
+		}
+
+		var user model.User
+		if err := tx.FindById(&user, uID); err != nil {
+			return err
+		}
+
+		if device.UserAgent == "" {
+			device.UserAgent = token.UserAgent
+		}
+		pair, err = s.issue(tx, &user, token.FamilyID, &token.ID, device, token.MFA)
+		return err
+	})
+	if err != nil {
+		if appErr, ok := err.(*apperror.AppError); ok {
+			return nil, appErr
+		}
+		return nil, apperror.ErrInternal
+	}
+
+	return pair, nil
+}
+
+// issue signs a new token pair and stores the refresh token's hash
+func (s *SessionService) issue(
+	tx repo.IPgSQLRepository,
+	user *model.User,
+	familyID uuid.UUID,
+	parentID *uuid.UUID,
+	device DeviceInfo,
+	mfa bool,
+) (*TokenPair, error) {
+
+	token := model.RefreshToken{
+		ID:        uuid.New(),
+		UserID:    user.ID,
+		FamilyID:  familyID,
+		ParentID:  parentID,
+		UserAgent: device.UserAgent,
+		IPAddress: device.IPAddress,
+		MFA:       mfa,
+		ExpiresAt: time.Now().Add(s.jwtManager.RefreshTTL),
+	}
+
+	refreshToken, err := s.jwtManager.GenerateRefreshToken(user.ID.String(), familyID.String(), token.ID.String())
+	if err != nil {
+		return nil, err
+	}
+
+	accessToken, err := s.jwtManager.GenerateAccessToken(jwt.Subject{
+		UserID:       user.ID.String(),
+		SessionID:    familyID.String(),
+		Role:         user.Role,
+		TokenVersion: user.TokenVersion,
+		MFA:          mfa,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	token.TokenHash = hashToken(refreshToken)
+	if err := tx.Insert(&token); err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		SessionID:    familyID.String(),
+	}, nil
+}
+
+/* =======================
+   LOGOUT / REVOKE
+   ======================= */
+
+// Logout ends the session the refresh token belongs to. Unknown or already
+// revoked tokens are not an error: the client is logged out either way.
+func (s *SessionService) Logout(ctx context.Context, refreshToken string) error {
+	claims, err := s.jwtManager.ValidateRefreshToken(refreshToken)
+	if err != nil {
+		return invalidRefreshToken()
+	}
+
+	tokenID, err := uuid.Parse(claims.ID)
+	if err != nil {
+		return invalidRefreshToken()
+	}
+
+	var token model.RefreshToken
+	if err := s.repo.WithContext(ctx).FindOneWhere(
+		&token,
+		"id = ? AND token_hash = ?",
+		tokenID,
+		hashToken(refreshToken),
+	); err != nil {
+		return nil
+	}
+
+	if err := s.revokeFamily(ctx, token.UserID, token.FamilyID, revokeLogout); err != nil {
+		return apperror.ErrInternal
+	}
+	return nil
+}
+
+// LogoutAll ends every session of the user
+func (s *SessionService) LogoutAll(ctx context.Context, userID string) error {
+	uID, err := uuid.Parse(userID)
+	if err != nil {
+		return apperror.New(
+			constant.BADREQUEST,
+			"",
+			"Invalid user ID",
+		)
+	}
+
+	return s.RevokeAllSessions(ctx, uID, revokeLogoutAll)
+}
+
+// RevokeAllSessions revokes every live refresh token of a user, e.g. after
+// logout-all or a password change
+func (s *SessionService) RevokeAllSessions(ctx context.Context, userID uuid.UUID, reason string) error {
+	if err := revokeUserSessions(s.repo.WithContext(ctx), userID, reason); err != nil {
+		return apperror.ErrInternal
+	}
+	return nil
+}
+
+// revokeUserSessions revokes every live refresh token of a user
+func revokeUserSessions(db repo.IPgSQLRepository, userID uuid.UUID, reason string) error {
+	return db.Exec(
+		"UPDATE refresh_tokens SET revoked_at = ?, revoked_reason = ? WHERE user_id = ? AND revoked_at IS NULL",
+		time.Now(),
+		reason,
+		userID,
+	).Error
+}
+
+// invalidateUserTokens cuts a user off everywhere: outstanding access tokens
+// stop matching the bumped token version and refresh tokens are revoked.
+func invalidateUserTokens(ctx context.Context, db repo.IPgSQLRepository, statuses *UserStatusCache, userID uuid.UUID, reason string) error {
+	err := db.WithTransaction(ctx, func(tx repo.IPgSQLRepository) error {
+		if err := tx.Exec(
+			"UPDATE users SET token_version = token_version + 1 WHERE id = ?",
+			userID,
+		).Error; err != nil {
+			return err
+		}
+		return revokeUserSessions(tx, userID, reason)
+	})
+	if err != nil {
+		return apperror.ErrInternal
+	}
+
+	statuses.Invalidate(userID.String())
+	return nil
+}
+
+// RevokeSession lets a user end one of their sessions
+func (s *SessionService) RevokeSession(ctx context.Context, userID, sessionID string) error {
+	uID, err := uuid.Parse(userID)
+	if err != nil {
+		return apperror.New(
+			constant.BADREQUEST,
+			"",
+			"Invalid user ID",
+		)
+	}
+
+	sID, err := uuid.Parse(sessionID)
+	if err != nil {
+		return apperror.New(
+			constant.BADREQUEST,
+			"",
+			"Invalid session ID",
+		)
+	}
+
+	var count int64
+	if err := s.repo.WithContext(ctx).Raw(
+		"SELECT COUNT(*) FROM refresh_tokens WHERE user_id = ? AND family_id = ?",
+		uID,
+		sID,
+	).Scan(&count).Error; err != nil {
+		return apperror.ErrInternal
+	}
+	if count == 0 {
+		return apperror.New(
+			constant.NOTFOUND,
+			"",
+			"Session not found",
+		)
+	}
+
+	if err := s.revokeFamily(ctx, uID, sID, revokeByUser); err != nil {
+		return apperror.ErrInternal
+	}
+	return nil
+}
+
+// revokeFamilyOf revokes the session a token belongs to
+func (s *SessionService) revokeFamilyOf(ctx context.Context, tokenID uuid.UUID, reason string) error {
+	var token model.RefreshToken
+	if err := s.repo.WithContext(ctx).FindById(&token, tokenID); err != nil {
+		return err
+	}
+	return s.revokeFamily(ctx, token.UserID, token.FamilyID, reason)
+}
+
+func (s *SessionService) revokeFamily(ctx context.Context, userID, familyID uuid.UUID, reason string) error {
+	return s.repo.WithContext(ctx).Exec(
+		"UPDATE refresh_tokens SET revoked_at = ?, revoked_reason = ? WHERE user_id = ? AND family_id = ? AND revoked_at IS NULL",
+		time.Now(),
+		reason,
+		userID,
+		familyID,
+	).Error
+}
+
+/* =======================
+   LIST
+   ======================= */
+
+// GetSessions lists the user's live sessions, most recently used first.
+// currentSessionID marks the session making the request.
+func (s *SessionService) GetSessions(ctx context.Context, userID, currentSessionID string) ([]Session, error) {
+	uID, err := uuid.Parse(userID)
+	if err != nil {
+		return nil, apperror.New(
+			constant.BADREQUEST,
+			"",
+			"Invalid user ID",
+		)
+	}
+
+	// The live token of a family is the one not yet rotated; its row has
+	// the latest device info, the family's first row the login time.
+	sessions := []Session{}
+	if err := s.repo.WithContext(ctx).Raw(`
+		SELECT
+			t.family_id AS id,
+			t.user_agent,
+			t.ip_address,
+			(SELECT MIN(f.created_at) FROM refresh_tokens f WHERE f.family_id = t.family_id) AS created_at,
+			t.created_at AS last_used_at,
+			t.expires_at
+		FROM refresh_tokens t
+		WHERE t.user_id = ?
+		  AND t.used_at IS NULL
+		  AND t.revoked_at IS NULL
+		  AND t.expires_at > ?
+		ORDER BY t.created_at DESC
+	`, uID, time.Now()).Scan(&sessions).Error; err != nil {
+		return nil, apperror.ErrInternal
+	}
+
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID.String() == currentSessionID
+	}
+
+	return sessions, nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func invalidRefreshToken() *apperror.AppError {
+	return apperror.New(
+		constant.UNAUTHORIZED,
+		constant.TOKEN_INVALID,
+		"Invalid or expired refresh token",
+	)
+}
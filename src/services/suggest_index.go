@@ -0,0 +1,274 @@
+package services
+
+import (
+	"context"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"vestra-ecommerce/src/repo"
+	constant "vestra-ecommerce/utils/constants"
+)
+
+// Suggestion kinds
+const (
+	SuggestProduct = "product"
+	SuggestClub    = "club"
+	SuggestLeague  = "league"
+	SuggestSeason  = "season"
+)
+
+// topSellingBoost is the popularity a product flagged top-selling gets on
+// top of its units sold, so a new best seller isn't buried
+const topSellingBoost = 100
+
+// Suggestion is one autocomplete entry. Value is what to search or filter
+// by: a product ID, a team slug (the name for leagues without a team) or a
+// year.
+type Suggestion struct {
+	Kind  string `json:"kind"`
+	Text  string `json:"text"`
+	Value string `json:"value"`
+}
+
+type suggestEntry struct {
+	Suggestion
+	popularity int64
+}
+
+// suggestTerm points a normalised suffix of an entry's text, starting at a
+// word boundary, back to the entry
+type suggestTerm struct {
+	text  string
+	entry int
+	whole bool // the suffix is the full text
+}
+
+// suggestSnapshot is an immutable index; a rebuild swaps in a new one
+type suggestSnapshot struct {
+	entries []suggestEntry
+	terms   []suggestTerm // sorted by text
+}
+
+var suggestSeparator = regexp.MustCompile(`[^\p{L}\p{N}]+`)
+
+// SuggestIndex answers search-box autocomplete from memory. It is rebuilt
+// from the database in the background: on start, when Refresh is called
+// after a catalog change and periodically to pick up sales and changes made
+// by other instances.
+type SuggestIndex struct {
+	repo    repo.IPgSQLRepository
+	mu      sync.RWMutex
+	current *suggestSnapshot
+	refresh chan struct{}
+}
+
+func NewSuggestIndex(repo repo.IPgSQLRepository) *SuggestIndex {
+	return &SuggestIndex{
+		repo:    repo,
+		current: &suggestSnapshot{},
+		refresh: make(chan struct{}, 1),
+	}
+}
+
+// Refresh asks for a rebuild without waiting for it. Calls made while one
+// is pending are folded into it.
+func (idx *SuggestIndex) Refresh() {
+	select {
+	case idx.refresh <- struct{}{}:
+	default:
+	}
+}
+
+// Run builds the index and keeps it fresh until ctx is cancelled
+func (idx *SuggestIndex) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	idx.rebuild(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-idx.refresh:
+		}
+		idx.rebuild(ctx)
+	}
+}
+
+func (idx *SuggestIndex) rebuild(ctx context.Context) {
+	snapshot, err := idx.load(ctx)
+	if err != nil {
+		log.Printf("suggest: rebuild failed: %v", err)
+		return
+	}
+
+	idx.mu.Lock()
+	idx.current = snapshot
+	idx.mu.Unlock()
+}
+
+// Suggest returns up to limit entries whose text, or a word in it, starts
+// with q. Matches from the start of the text come first, then the more
+// popular, then the shorter.
+func (idx *SuggestIndex) Suggest(q string, limit int) []Suggestion {
+	suggestions := []Suggestion{}
+
+	prefix := normalizeSuggest(q)
+	if prefix == "" || limit < 1 {
+		return suggestions
+	}
+
+	idx.mu.RLock()
+	snapshot := idx.current
+	idx.mu.RUnlock()
+
+	// best match per entry: whole-text beats a later word
+	matched := map[int]bool{}
+	start := sort.Search(len(snapshot.terms), func(i int) bool {
+		return snapshot.terms[i].text >= prefix
+	})
+	for i := start; i < len(snapshot.terms) && strings.HasPrefix(snapshot.terms[i].text, prefix); i++ {
+		term := snapshot.terms[i]
+		matched[term.entry] = matched[term.entry] || term.whole
+	}
+
+	ranked := make([]int, 0, len(matched))
+	for entry := range matched {
+		ranked = append(ranked, entry)
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		a, b := ranked[i], ranked[j]
+		if matched[a] != matched[b] {
+			return matched[a]
+		}
+		ea, eb := snapshot.entries[a], snapshot.entries[b]
+		if ea.popularity != eb.popularity {
+			return ea.popularity > eb.popularity
+		}
+		if len(ea.Text) != len(eb.Text) {
+			return len(ea.Text) < len(eb.Text)
+		}
+		return ea.Text < eb.Text
+	})
+
+	if len(ranked) > limit {
+		ranked = ranked[:limit]
+	}
+	for _, entry := range ranked {
+		suggestions = append(suggestions, snapshot.entries[entry].Suggestion)
+	}
+	return suggestions
+}
+
+// load reads the catalog and sales into a new snapshot. Only active
+// products count; teams, leagues and seasons without one are left out so
+// every suggestion leads somewhere.
+func (idx *SuggestIndex) load(ctx context.Context) (*suggestSnapshot, error) {
+	var products []struct {
+		ID           uuid.UUID
+		Name         string
+		League       string
+		Year         int
+		IsTopSelling bool
+		TeamName     string
+		TeamSlug     string
+		TeamKind     string
+		LeagueName   string
+		LeagueSlug   string
+		Sold         int64
+	}
+	if err := idx.repo.WithContext(ctx).Raw(`
+		SELECT p.id, p.name, p.league, p.year, p.is_top_selling,
+			t.name AS team_name, t.slug AS team_slug, t.kind AS team_kind,
+			l.name AS league_name, l.slug AS league_slug,
+			COALESCE(s.sold, 0) AS sold
+		FROM products p
+		LEFT JOIN teams t ON t.id = p.team_id
+		LEFT JOIN teams l ON l.id = COALESCE(t.parent_id, t.id)
+		LEFT JOIN (
+			SELECT oi.product_id, SUM(oi.quantity) AS sold
+			FROM order_items oi JOIN orders o ON o.id = oi.order_id
+			WHERE o.status <> ?
+			GROUP BY oi.product_id
+		) s ON s.product_id = p.id
+		WHERE p.deleted_at IS NULL AND p.is_active
+	`, constant.CANCELLED).Scan(&products).Error; err != nil {
+		return nil, err
+	}
+
+	snapshot := &suggestSnapshot{}
+	byKey := map[string]int{}
+
+	// add counts popularity towards an entry, creating it on first sight.
+	// Products are told apart by ID, everything else by name.
+	add := func(kind, text, value string, popularity int64) {
+		text = strings.TrimSpace(text)
+		if text == "" {
+			return
+		}
+		key := kind + "\x00" + strings.ToLower(text)
+		if kind == SuggestProduct {
+			key = kind + "\x00" + value
+		}
+		if i, ok := byKey[key]; ok {
+			snapshot.entries[i].popularity += popularity
+			return
+		}
+		byKey[key] = len(snapshot.entries)
+		snapshot.entries = append(snapshot.entries, suggestEntry{
+			Suggestion: Suggestion{Kind: kind, Text: text, Value: value},
+			popularity: popularity,
+		})
+	}
+
+	for _, p := range products {
+		popularity := p.Sold
+		if p.IsTopSelling {
+			popularity += topSellingBoost
+		}
+
+		add(SuggestProduct, p.Name, p.ID.String(), popularity)
+		if p.TeamKind == constant.TEAM_CLUB {
+			add(SuggestClub, p.TeamName, p.TeamSlug, popularity)
+		}
+		if p.LeagueName != "" {
+			add(SuggestLeague, p.LeagueName, p.LeagueSlug, popularity)
+		} else {
+			add(SuggestLeague, p.League, p.League, popularity)
+		}
+		if p.Year > 0 {
+			year := strconv.Itoa(p.Year)
+			add(SuggestSeason, year, year, popularity)
+		}
+	}
+
+	for i, e := range snapshot.entries {
+		words := strings.Fields(normalizeSuggest(e.Text))
+		for w := range words {
+			snapshot.terms = append(snapshot.terms, suggestTerm{
+				text:  strings.Join(words[w:], " "),
+				entry: i,
+				whole: w == 0,
+			})
+		}
+	}
+	sort.Slice(snapshot.terms, func(i, j int) bool {
+		return snapshot.terms[i].text < snapshot.terms[j].text
+	})
+
+	return snapshot, nil
+}
+
+// normalizeSuggest lowercases text and collapses punctuation and spacing,
+// so "Real-Madrid " and "real madrid" compare equal
+func normalizeSuggest(text string) string {
+	return strings.TrimSpace(suggestSeparator.ReplaceAllString(strings.ToLower(text), " "))
+}
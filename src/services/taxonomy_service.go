@@ -0,0 +1,599 @@
+package services
+
+import (
+	"context"
+	"regexp"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"vestra-ecommerce/src/model"
+	"vestra-ecommerce/src/repo"
+	constant "vestra-ecommerce/utils/constants"
+	"vestra-ecommerce/utils/utils/apperror"
+)
+
+// TaxonomyService manages what products are filed under: categories and
+// teams (leagues and their clubs)
+type TaxonomyService struct {
+	repo repo.IPgSQLRepository
+}
+
+func NewTaxonomyService(repo repo.IPgSQLRepository) *TaxonomyService {
+	return &TaxonomyService{repo: repo}
+}
+
+// CategoryInput creates a category or replaces an existing one. The slug
+// is derived from the name when empty; no parent makes it top-level.
+type CategoryInput struct {
+	Name        string     `json:"name"`
+	Slug        string     `json:"slug"`
+	Description string     `json:"description"`
+	ParentID    *uuid.UUID `json:"parent_id"`
+}
+
+// TeamInput creates a team or replaces an existing one. Clubs need a
+// league as parent; leagues can't have one.
+type TeamInput struct {
+	Name     string     `json:"name"`
+	Slug     string     `json:"slug"`
+	Kind     string     `json:"kind"`
+	Country  string     `json:"country"`
+	ParentID *uuid.UUID `json:"parent_id"`
+}
+
+var (
+	slugPattern   = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+	slugSeparator = regexp.MustCompile(`[^a-z0-9]+`)
+)
+
+/* =======================
+   CATEGORIES
+   ======================= */
+
+// ListCategories returns the category tree, top-level categories first
+func (s *TaxonomyService) ListCategories(ctx context.Context) ([]model.Category, error) {
+	var categories []model.Category
+	if err := s.repo.WithContext(ctx).Raw(
+		"SELECT * FROM categories ORDER BY name",
+	).Scan(&categories).Error; err != nil {
+		return nil, apperror.ErrInternal
+	}
+
+	children := map[uuid.UUID][]model.Category{}
+	for _, c := range categories {
+		if c.ParentID != nil {
+			children[*c.ParentID] = append(children[*c.ParentID], c)
+		}
+	}
+
+	var build func(c model.Category) model.Category
+	build = func(c model.Category) model.Category {
+		for _, child := range children[c.ID] {
+			c.Children = append(c.Children, build(child))
+		}
+		return c
+	}
+
+	tree := []model.Category{}
+	for _, c := range categories {
+		if c.ParentID == nil {
+			tree = append(tree, build(c))
+		}
+	}
+	return tree, nil
+}
+
+func (s *TaxonomyService) CreateCategory(ctx context.Context, input CategoryInput) (*model.Category, error) {
+	category := model.Category{}
+	if err := applyCategoryInput(&category, input); err != nil {
+		return nil, err
+	}
+
+	err := s.repo.WithTransaction(ctx, func(tx repo.IPgSQLRepository) error {
+		if err := checkCategoryParent(tx, category.ID, category.ParentID); err != nil {
+			return err
+		}
+		if err := ensureSlugFree(tx, "categories", category.Slug, category.ID); err != nil {
+			return err
+		}
+		if err := tx.Insert(&category); err != nil {
+			return err
+		}
+		return recordAudit(ctx, tx, AuditEntry{
+			Action:     constant.AUDIT_CATEGORY_CREATE,
+			EntityType: constant.ENTITY_CATEGORY,
+			EntityID:   category.ID.String(),
+			After:      category,
+		})
+	})
+	if err != nil {
+		if appErr, ok := err.(*apperror.AppError); ok {
+			return nil, appErr
+		}
+		return nil, apperror.ErrInternal
+	}
+
+	return &category, nil
+}
+
+func (s *TaxonomyService) UpdateCategory(ctx context.Context, id string, input CategoryInput) (*model.Category, error) {
+	var category model.Category
+
+	err := s.repo.WithTransaction(ctx, func(tx repo.IPgSQLRepository) error {
+		if err := tx.FindById(&category, id); err != nil {
+			return apperror.New(
+				constant.NOTFOUND,
+				"",
+				"Category not found",
+			)
+		}
+		before := category
+
+		if err := applyCategoryInput(&category, input); err != nil {
+			return err
+		}
+		if err := checkCategoryParent(tx, category.ID, category.ParentID); err != nil {
+			return err
+		}
+		if err := ensureSlugFree(tx, "categories", category.Slug, category.ID); err != nil {
+			return err
+		}
+
+		if err := tx.UpdateByFields(&model.Category{}, category.ID, map[string]interface{}{
+			"name":        category.Name,
+			"slug":        category.Slug,
+			"description": category.Description,
+			"parent_id":   category.ParentID,
+		}); err != nil {
+			return err
+		}
+		return recordAudit(ctx, tx, AuditEntry{
+			Action:     constant.AUDIT_CATEGORY_UPDATE,
+			EntityType: constant.ENTITY_CATEGORY,
+			EntityID:   category.ID.String(),
+			Before:     before,
+			After:      category,
+		})
+	})
+	if err != nil {
+		if appErr, ok := err.(*apperror.AppError); ok {
+			return nil, appErr
+		}
+		return nil, apperror.ErrInternal
+	}
+
+	return &category, nil
+}
+
+// DeleteCategory removes an empty category. Ones with subcategories or
+// products are refused so nothing is silently unfiled.
+func (s *TaxonomyService) DeleteCategory(ctx context.Context, id string) error {
+	err := s.repo.WithTransaction(ctx, func(tx repo.IPgSQLRepository) error {
+		var category model.Category
+		if err := tx.FindById(&category, id); err != nil {
+			return apperror.New(
+				constant.NOTFOUND,
+				"",
+				"Category not found",
+			)
+		}
+
+		var used int64
+		if err := tx.Raw(`
+			SELECT (SELECT COUNT(*) FROM categories WHERE parent_id = ?)
+			     + (SELECT COUNT(*) FROM products WHERE category_id = ? AND deleted_at IS NULL)
+		`, category.ID, category.ID).Scan(&used).Error; err != nil {
+			return err
+		}
+		if used > 0 {
+			return apperror.New(
+				constant.CONFLICT,
+				constant.TAXONOMY_IN_USE,
+				"Category still has subcategories or products",
+			)
+		}
+
+		if err := tx.Exec("DELETE FROM categories WHERE id = ?", category.ID).Error; err != nil {
+			return err
+		}
+		return recordAudit(ctx, tx, AuditEntry{
+			Action:     constant.AUDIT_CATEGORY_DELETE,
+			EntityType: constant.ENTITY_CATEGORY,
+			EntityID:   category.ID.String(),
+			Before:     category,
+		})
+	})
+	if err != nil {
+		if appErr, ok := err.(*apperror.AppError); ok {
+			return appErr
+		}
+		return apperror.ErrInternal
+	}
+	return nil
+}
+
+/* =======================
+   TEAMS
+   ======================= */
+
+// ListTeams returns the leagues with their clubs, or only the clubs when
+// kind is "club"
+func (s *TaxonomyService) ListTeams(ctx context.Context, kind string) ([]model.Team, error) {
+	if kind != "" && kind != constant.TEAM_LEAGUE && kind != constant.TEAM_CLUB {
+		return nil, apperror.New(
+			constant.BADREQUEST,
+			constant.INVALID_REQUEST,
+			"kind must be league or club",
+		)
+	}
+
+	var teams []model.Team
+	if err := s.repo.WithContext(ctx).Raw(
+		"SELECT * FROM teams ORDER BY name",
+	).Scan(&teams).Error; err != nil {
+		return nil, apperror.ErrInternal
+	}
+
+	if kind == constant.TEAM_CLUB {
+		clubs := []model.Team{}
+		for _, t := range teams {
+			if t.Kind == constant.TEAM_CLUB {
+				clubs = append(clubs, t)
+			}
+		}
+		return clubs, nil
+	}
+
+	clubs := map[uuid.UUID][]model.Team{}
+	for _, t := range teams {
+		if t.Kind == constant.TEAM_CLUB && t.ParentID != nil {
+			clubs[*t.ParentID] = append(clubs[*t.ParentID], t)
+		}
+	}
+
+	leagues := []model.Team{}
+	for _, t := range teams {
+		if t.Kind == constant.TEAM_LEAGUE {
+			t.Clubs = clubs[t.ID]
+			leagues = append(leagues, t)
+		}
+	}
+	return leagues, nil
+}
+
+func (s *TaxonomyService) CreateTeam(ctx context.Context, input TeamInput) (*model.Team, error) {
+	team := model.Team{}
+	if err := applyTeamInput(&team, input); err != nil {
+		return nil, err
+	}
+
+	err := s.repo.WithTransaction(ctx, func(tx repo.IPgSQLRepository) error {
+		if err := checkTeamParent(tx, &team); err != nil {
+			return err
+		}
+		if err := ensureSlugFree(tx, "teams", team.Slug, team.ID); err != nil {
+			return err
+		}
+		if err := tx.Insert(&team); err != nil {
+			return err
+		}
+		return recordAudit(ctx, tx, AuditEntry{
+			Action:     constant.AUDIT_TEAM_CREATE,
+			EntityType: constant.ENTITY_TEAM,
+			EntityID:   team.ID.String(),
+			After:      team,
+		})
+	})
+	if err != nil {
+		if appErr, ok := err.(*apperror.AppError); ok {
+			return nil, appErr
+		}
+		return nil, apperror.ErrInternal
+	}
+
+	return &team, nil
+}
+
+// UpdateTeam replaces a team. Products filed under it (or, for a league,
+// under its clubs) get the new league name.
+func (s *TaxonomyService) UpdateTeam(ctx context.Context, id string, input TeamInput) (*model.Team, error) {
+	var team model.Team
+
+	err := s.repo.WithTransaction(ctx, func(tx repo.IPgSQLRepository) error {
+		if err := tx.FindById(&team, id); err != nil {
+			return apperror.New(
+				constant.NOTFOUND,
+				"",
+				"Team not found",
+			)
+		}
+		before := team
+
+		if err := applyTeamInput(&team, input); err != nil {
+			return err
+		}
+
+		if before.Kind == constant.TEAM_LEAGUE && team.Kind != constant.TEAM_LEAGUE {
+			var clubs int64
+			if err := tx.Raw("SELECT COUNT(*) FROM teams WHERE parent_id = ?", team.ID).Scan(&clubs).Error; err != nil {
+				return err
+			}
+			if clubs > 0 {
+				return apperror.New(
+					constant.CONFLICT,
+					constant.TAXONOMY_IN_USE,
+					"League still has clubs",
+				)
+			}
+		}
+		if err := checkTeamParent(tx, &team); err != nil {
+			return err
+		}
+		if err := ensureSlugFree(tx, "teams", team.Slug, team.ID); err != nil {
+			return err
+		}
+
+		if err := tx.UpdateByFields(&model.Team{}, team.ID, map[string]interface{}{
+			"name":      team.Name,
+			"slug":      team.Slug,
+			"kind":      team.Kind,
+			"country":   team.Country,
+			"parent_id": team.ParentID,
+		}); err != nil {
+			return err
+		}
+		if err := syncProductLeagues(tx, team.ID); err != nil {
+			return err
+		}
+		return recordAudit(ctx, tx, AuditEntry{
+			Action:     constant.AUDIT_TEAM_UPDATE,
+			EntityType: constant.ENTITY_TEAM,
+			EntityID:   team.ID.String(),
+			Before:     before,
+			After:      team,
+		})
+	})
+	if err != nil {
+		if appErr, ok := err.(*apperror.AppError); ok {
+			return nil, appErr
+		}
+		return nil, apperror.ErrInternal
+	}
+
+	return &team, nil
+}
+
+// DeleteTeam removes a team no product or club refers to
+func (s *TaxonomyService) DeleteTeam(ctx context.Context, id string) error {
+	err := s.repo.WithTransaction(ctx, func(tx repo.IPgSQLRepository) error {
+		var team model.Team
+		if err := tx.FindById(&team, id); err != nil {
+			return apperror.New(
+				constant.NOTFOUND,
+				"",
+				"Team not found",
+			)
+		}
+
+		var used int64
+		if err := tx.Raw(`
+			SELECT (SELECT COUNT(*) FROM teams WHERE parent_id = ?)
+			     + (SELECT COUNT(*) FROM products WHERE team_id = ? AND deleted_at IS NULL)
+		`, team.ID, team.ID).Scan(&used).Error; err != nil {
+			return err
+		}
+		if used > 0 {
+			return apperror.New(
+				constant.CONFLICT,
+				constant.TAXONOMY_IN_USE,
+				"Team still has clubs or products",
+			)
+		}
+
+		if err := tx.Exec("DELETE FROM teams WHERE id = ?", team.ID).Error; err != nil {
+			return err
+		}
+		return recordAudit(ctx, tx, AuditEntry{
+			Action:     constant.AUDIT_TEAM_DELETE,
+			EntityType: constant.ENTITY_TEAM,
+			EntityID:   team.ID.String(),
+			Before:     team,
+		})
+	})
+	if err != nil {
+		if appErr, ok := err.(*apperror.AppError); ok {
+			return appErr
+		}
+		return apperror.ErrInternal
+	}
+	return nil
+}
+
+/* =======================
+   HELPERS
+   ======================= */
+
+func applyCategoryInput(category *model.Category, input CategoryInput) error {
+	name := strings.TrimSpace(input.Name)
+	if name == "" {
+		return apperror.New(
+			constant.BADREQUEST,
+			constant.INVALID_REQUEST,
+			"Category name is required",
+		)
+	}
+	slug, err := normalizeSlug(input.Slug, name)
+	if err != nil {
+		return err
+	}
+
+	category.Name = name
+	category.Slug = slug
+	category.Description = strings.TrimSpace(input.Description)
+	category.ParentID = input.ParentID
+	return nil
+}
+
+func applyTeamInput(team *model.Team, input TeamInput) error {
+	name := strings.TrimSpace(input.Name)
+	if name == "" {
+		return apperror.New(
+			constant.BADREQUEST,
+			constant.INVALID_REQUEST,
+			"Team name is required",
+		)
+	}
+	if input.Kind != constant.TEAM_LEAGUE && input.Kind != constant.TEAM_CLUB {
+		return apperror.New(
+			constant.BADREQUEST,
+			constant.INVALID_REQUEST,
+			"kind must be league or club",
+		)
+	}
+	slug, err := normalizeSlug(input.Slug, name)
+	if err != nil {
+		return err
+	}
+
+	team.Name = name
+	team.Slug = slug
+	team.Kind = input.Kind
+	team.Country = strings.TrimSpace(input.Country)
+	team.ParentID = input.ParentID
+	return nil
+}
+
+// normalizeSlug validates slug, or derives one from name when it's empty
+func normalizeSlug(slug, name string) (string, error) {
+	slug = strings.ToLower(strings.TrimSpace(slug))
+	if slug == "" {
+		slug = strings.Trim(slugSeparator.ReplaceAllString(strings.ToLower(name), "-"), "-")
+	}
+	if len(slug) > 120 || !slugPattern.MatchString(slug) {
+		return "", apperror.New(
+			constant.BADREQUEST,
+			constant.INVALID_REQUEST,
+			"Slug must be lowercase letters and digits separated by '-'",
+		)
+	}
+	return slug, nil
+}
+
+// ensureSlugFree refuses a slug another row of table already uses
+func ensureSlugFree(tx repo.IPgSQLRepository, table, slug string, id uuid.UUID) error {
+	var taken int64
+	if err := tx.Raw(
+		"SELECT COUNT(*) FROM "+table+" WHERE slug = ? AND id <> ?", slug, id,
+	).Scan(&taken).Error; err != nil {
+		return err
+	}
+	if taken > 0 {
+		return apperror.New(
+			constant.CONFLICT,
+			"",
+			"Slug is already in use",
+		)
+	}
+	return nil
+}
+
+// checkCategoryParent makes sure the parent exists and isn't the category
+// itself or one of its descendants
+func checkCategoryParent(tx repo.IPgSQLRepository, id uuid.UUID, parentID *uuid.UUID) error {
+	if parentID == nil {
+		return nil
+	}
+
+	var ancestors []uuid.UUID
+	if err := tx.Raw(`
+		WITH RECURSIVE up AS (
+			SELECT id, parent_id FROM categories WHERE id = ?
+			UNION ALL
+			SELECT c.id, c.parent_id FROM categories c JOIN up ON c.id = up.parent_id
+		)
+		SELECT id FROM up
+	`, *parentID).Scan(&ancestors).Error; err != nil {
+		return err
+	}
+	if len(ancestors) == 0 {
+		return apperror.New(
+			constant.BADREQUEST,
+			constant.INVALID_REQUEST,
+			"Parent category not found",
+		)
+	}
+	for _, ancestor := range ancestors {
+		if ancestor == id {
+			return apperror.New(
+				constant.BADREQUEST,
+				constant.INVALID_REQUEST,
+				"A category can't be moved under itself",
+			)
+		}
+	}
+	return nil
+}
+
+// checkTeamParent enforces league -> club: leagues are top-level and every
+// club belongs to an existing league
+func checkTeamParent(tx repo.IPgSQLRepository, team *model.Team) error {
+	if team.Kind == constant.TEAM_LEAGUE {
+		if team.ParentID != nil {
+			return apperror.New(
+				constant.BADREQUEST,
+				constant.INVALID_REQUEST,
+				"A league can't have a parent",
+			)
+		}
+		return nil
+	}
+
+	if team.ParentID == nil {
+		return apperror.New(
+			constant.BADREQUEST,
+			constant.INVALID_REQUEST,
+			"A club needs its league as parent_id",
+		)
+	}
+	var league model.Team
+	if err := tx.FindOneWhere(&league, "id = ? AND kind = ?", *team.ParentID, constant.TEAM_LEAGUE); err != nil {
+		return apperror.New(
+			constant.BADREQUEST,
+			constant.INVALID_REQUEST,
+			"Parent league not found",
+		)
+	}
+	return nil
+}
+
+// teamLeague returns the name of the league a team is, or belongs to
+func teamLeague(tx repo.IPgSQLRepository, teamID uuid.UUID) (string, error) {
+	var team model.Team
+	if err := tx.FindById(&team, teamID); err != nil {
+		return "", apperror.New(
+			constant.BADREQUEST,
+			constant.INVALID_REQUEST,
+			"Team not found",
+		)
+	}
+	if team.ParentID == nil {
+		return team.Name, nil
+	}
+
+	var league model.Team
+	if err := tx.FindById(&league, *team.ParentID); err != nil {
+		return "", err
+	}
+	return league.Name, nil
+}
+
+// syncProductLeagues copies the league name onto products filed under the
+// team or, for a league, under any of its clubs
+func syncProductLeagues(tx repo.IPgSQLRepository, teamID uuid.UUID) error {
+	return tx.Exec(`
+		UPDATE products p SET league = l.name
+		FROM teams t JOIN teams l ON l.id = COALESCE(t.parent_id, t.id)
+		WHERE p.team_id = t.id AND (t.id = ? OR t.parent_id = ?)
+	`, teamID, teamID).Error
+}
@@ -0,0 +1,285 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"vestra-ecommerce/src/model"
+	"vestra-ecommerce/src/repo"
+	constant "vestra-ecommerce/utils/constants"
+	"vestra-ecommerce/utils/pagination"
+	"vestra-ecommerce/utils/utils/apperror"
+)
+
+// UserAdminService is the admin side of user accounts: finding users,
+// looking at a customer as a whole and fixing up their account. Blocking
+// lives in UserAuthService, role assignment in RoleService.
+type UserAdminService struct {
+	repo     repo.IPgSQLRepository
+	statuses *UserStatusCache
+}
+
+func NewUserAdminService(repo repo.IPgSQLRepository, statuses *UserStatusCache) *UserAdminService {
+	return &UserAdminService{repo: repo, statuses: statuses}
+}
+
+// UserFilter narrows the user list. Nil and zero fields don't filter.
+type UserFilter struct {
+	Search       string // part of the email or name
+	Role         string // an RBAC role name; "user" for accounts without roles
+	Verified     *bool
+	Blocked      *bool
+	SignedUpFrom *time.Time
+	SignedUpTo   *time.Time
+}
+
+// userSortColumns whitelists what the list can be ordered by
+var userSortColumns = map[string]string{
+	"created_at": "created_at",
+	"email":      "email",
+	"name":       "name",
+}
+
+// CustomerSpend is what a customer paid in one currency, in minor units
+type CustomerSpend struct {
+	Currency string `json:"currency"`
+	Paid     int64  `json:"paid"`
+	Refunded int64  `json:"refunded"`
+	Net      int64  `json:"net"`
+}
+
+// CustomerDetail is the admin view of one customer
+type CustomerDetail struct {
+	User          model.User          `json:"user"`
+	Orders        []model.Order       `json:"orders"`
+	Payments      []model.Payment     `json:"payments"`
+	Addresses     []model.UserAddress `json:"addresses"`
+	OrderCount    int                 `json:"order_count"`
+	LifetimeSpend []CustomerSpend     `json:"lifetime_spend"`
+}
+
+/* =======================
+   LIST / DETAIL
+   ======================= */
+
+// ListUsers returns a numbered page of users matching the filter, newest
+// first by default. Anonymised (deleted) accounts are left out.
+func (s *UserAdminService) ListUsers(ctx context.Context, f UserFilter, page pagination.Params) ([]model.User, *pagination.Meta, error) {
+	sortBy, err := pageSort(page, userSortColumns, "-created_at")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	where := []string{"anonymized_at IS NULL"}
+	args := []interface{}{}
+
+	if search := strings.TrimSpace(f.Search); search != "" {
+		where = append(where, "(email ILIKE ? OR name ILIKE ?)")
+		pattern := "%" + escapeLike(search) + "%"
+		args = append(args, pattern, pattern)
+	}
+	switch f.Role {
+	case "":
+	case "user":
+		where = append(where, "NOT EXISTS (SELECT 1 FROM user_roles ur WHERE ur.user_id = users.id)")
+	default:
+		where = append(where, `EXISTS (
+			SELECT 1 FROM user_roles ur JOIN roles r ON r.id = ur.role_id
+			WHERE ur.user_id = users.id AND r.name = ?)`)
+		args = append(args, f.Role)
+	}
+	if f.Verified != nil {
+		where = append(where, "is_verified = ?")
+		args = append(args, *f.Verified)
+	}
+	if f.Blocked != nil {
+		where = append(where, "is_blocked = ?")
+		args = append(args, *f.Blocked)
+	}
+	if f.SignedUpFrom != nil {
+		where = append(where, "created_at >= ?")
+		args = append(args, *f.SignedUpFrom)
+	}
+	if f.SignedUpTo != nil {
+		where = append(where, "created_at < ?")
+		args = append(args, *f.SignedUpTo)
+	}
+
+	db := s.repo.WithContext(ctx)
+	cond := strings.Join(where, " AND ")
+
+	var total int64
+	if err := db.Raw("SELECT COUNT(*) FROM users WHERE "+cond, args...).Scan(&total).Error; err != nil {
+		return nil, nil, apperror.ErrInternal
+	}
+
+	users := []model.User{}
+	if err := db.Raw(
+		"SELECT * FROM users WHERE "+cond+" ORDER BY "+sortBy.OrderBy("id")+" LIMIT ? OFFSET ?",
+		append(args, page.Limit, page.Offset())...,
+	).Scan(&users).Error; err != nil {
+		return nil, nil, apperror.ErrInternal
+	}
+
+	return users, pagination.OffsetMeta(page, sortBy, total), nil
+}
+
+// GetCustomer gathers a user with their roles, orders, payments, addresses
+// and lifetime spend (captured payments net of refunds, per currency)
+func (s *UserAdminService) GetCustomer(ctx context.Context, userID string) (*CustomerDetail, error) {
+	uID, err := uuid.Parse(userID)
+	if err != nil {
+		return nil, apperror.New(
+			constant.BADREQUEST,
+			"",
+			"Invalid user ID",
+		)
+	}
+
+	db := s.repo.WithContext(ctx)
+	detail := &CustomerDetail{
+		Orders:        []model.Order{},
+		Payments:      []model.Payment{},
+		Addresses:     []model.UserAddress{},
+		LifetimeSpend: []CustomerSpend{},
+	}
+
+	if err := db.FindByIdWithPreload(&detail.User, uID, "Roles"); err != nil {
+		return nil, apperror.New(
+			constant.NOTFOUND,
+			"",
+			"User not found",
+		)
+	}
+
+	if err := db.FindWhereWithPreload(&detail.Orders, "user_id = ?", []interface{}{uID}, "Items.Product", "StatusHistory"); err != nil {
+		return nil, apperror.ErrInternal
+	}
+	if err := db.FindWhereWithPreload(&detail.Payments, "user_id = ?", []interface{}{uID}, "Refunds"); err != nil {
+		return nil, apperror.ErrInternal
+	}
+	if err := db.FindAllWhere(&detail.Addresses, "user_id = ?", uID.String()); err != nil {
+		return nil, apperror.ErrInternal
+	}
+	detail.OrderCount = len(detail.Orders)
+
+	if err := db.Raw(`
+		SELECT currency, SUM(paid) AS paid, SUM(refunded) AS refunded, SUM(paid) - SUM(refunded) AS net
+		FROM (
+			SELECT amount_currency AS currency, amount_minor AS paid, 0 AS refunded
+			FROM payments
+			WHERE user_id = ? AND status IN ?
+			UNION ALL
+			SELECT r.amount_currency, 0, r.amount_minor
+			FROM refunds r JOIN payments p ON p.id = r.payment_id
+			WHERE p.user_id = ? AND r.status = ?
+		) t
+		GROUP BY currency
+		ORDER BY currency
+	`,
+		uID,
+		[]string{constant.PAID, constant.PARTIALLY_REFUNDED, constant.REFUND_PENDING, constant.REFUNDED},
+		uID,
+		constant.REFUNDED,
+	).Scan(&detail.LifetimeSpend).Error; err != nil {
+		return nil, apperror.ErrInternal
+	}
+
+	return detail, nil
+}
+
+/* =======================
+   ACCOUNT FIXES
+   ======================= */
+
+// ForceVerify marks an account verified without the signup OTP
+func (s *UserAdminService) ForceVerify(ctx context.Context, userID string) (*model.User, error) {
+	var user model.User
+
+	err := s.repo.WithTransaction(ctx, func(tx repo.IPgSQLRepository) error {
+		if err := tx.FindById(&user, userID); err != nil {
+			return apperror.New(
+				constant.NOTFOUND,
+				"",
+				"User not found",
+			)
+		}
+
+		if user.IsVerified {
+			return nil
+		}
+
+		if err := tx.UpdateByFields(&model.User{}, user.ID, map[string]interface{}{
+			"is_verified": true,
+		}); err != nil {
+			return err
+		}
+		user.IsVerified = true
+
+		// The pending code has nothing left to verify
+		if err := tx.Exec(
+			"DELETE FROM otp_codes WHERE user_id = ? AND purpose = ?",
+			user.ID, constant.OTP_SIGNUP,
+		).Error; err != nil {
+			return err
+		}
+
+		return recordAudit(ctx, tx, AuditEntry{
+			Action:     constant.AUDIT_USER_VERIFY,
+			EntityType: constant.ENTITY_USER,
+			EntityID:   user.ID.String(),
+			Before:     map[string]interface{}{"is_verified": false},
+			After:      map[string]interface{}{"is_verified": true},
+		})
+	})
+	if err != nil {
+		if appErr, ok := err.(*apperror.AppError); ok {
+			return nil, appErr
+		}
+		return nil, apperror.ErrInternal
+	}
+
+	s.statuses.Invalidate(user.ID.String())
+	return &user, nil
+}
+
+// ForceLogout ends every session of the user and invalidates their
+// outstanding access tokens
+func (s *UserAdminService) ForceLogout(ctx context.Context, userID string) error {
+	uID, err := uuid.Parse(userID)
+	if err != nil {
+		return apperror.New(
+			constant.BADREQUEST,
+			"",
+			"Invalid user ID",
+		)
+	}
+
+	var user model.User
+	if err := s.repo.WithContext(ctx).FindById(&user, uID); err != nil {
+		return apperror.New(
+			constant.NOTFOUND,
+			"",
+			"User not found",
+		)
+	}
+
+	if err := invalidateUserTokens(ctx, s.repo, s.statuses, user.ID, revokeByAdmin); err != nil {
+		return err
+	}
+
+	recordAuditAfter(ctx, s.repo, AuditEntry{
+		Action:     constant.AUDIT_USER_LOGOUT,
+		EntityType: constant.ENTITY_USER,
+		EntityID:   user.ID.String(),
+	})
+	return nil
+}
+
+// escapeLike makes user input match literally inside a LIKE pattern
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -1,8 +1,9 @@
 package services
 
 import (
-	"fmt"
-	"math/rand"
+	"context"
+	"log"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -15,21 +16,18 @@ import (
 	"vestra-ecommerce/utils/utils/apperror"
 )
 
-// Seed OTP generator once
-func init() {
-	rand.Seed(time.Now().UnixNano())
-}
-
 type UserAuthService struct {
-	userRepo  repo.IPgSQLRepository
-	otpExpiry time.Duration
+	userRepo repo.IPgSQLRepository
+	otps     *OTPService
+	statuses *UserStatusCache
 }
 
 // ✅ FIXED: use injected repository (NO globals)
-func NewUserAuthService(userRepo repo.IPgSQLRepository, otpExpiryMinutes int) *UserAuthService {
+func NewUserAuthService(userRepo repo.IPgSQLRepository, otps *OTPService, statuses *UserStatusCache) *UserAuthService {
 	return &UserAuthService{
-		userRepo:  userRepo,
-		otpExpiry: time.Duration(otpExpiryMinutes) * time.Minute,
+		userRepo: userRepo,
+		otps:     otps,
+		statuses: statuses,
 	}
 }
 
@@ -46,10 +44,6 @@ func (s *UserAuthService) Signup(name, userEmail, password string) error {
 		)
 	}
 
-	// Generate OTP
-	otp := generateOTP()
-	otpHash, _ := bcrypt.GenerateFromPassword([]byte(otp), bcrypt.DefaultCost)
-
 	// Create user (password will be hashed by GORM hook)
 	user := model.User{
 		ID:         uuid.New(),
@@ -57,8 +51,6 @@ func (s *UserAuthService) Signup(name, userEmail, password string) error {
 		Email:      userEmail,
 		Password:   password, // plain text → hashed in model hook
 		Role:       "user",
-		OTP:        string(otpHash),
-		OTPExpiry:  time.Now().Add(5 * time.Minute),
 		IsVerified: false,
 	}
 
@@ -66,6 +58,12 @@ func (s *UserAuthService) Signup(name, userEmail, password string) error {
 		return err
 	}
 
+	// Generate OTP
+	otp, err := s.otps.Issue(context.Background(), user.ID, constant.OTP_SIGNUP)
+	if err != nil {
+		return err
+	}
+
 	// Send OTP email
 	if err := email.SendOTP(userEmail, otp); err != nil {
 		return apperror.New(
@@ -98,33 +96,60 @@ func (s *UserAuthService) VerifyOTP(userEmail, otp string) error {
 		)
 	}
 
-	if time.Now().After(user.OTPExpiry) {
+	if err := s.otps.Verify(context.Background(), user.ID, constant.OTP_SIGNUP, otp); err != nil {
+		return err
+	}
+
+	updates := map[string]interface{}{
+		"is_verified": true,
+	}
+
+	if err := s.userRepo.UpdateByFields(&model.User{}, user.ID, updates); err != nil {
+		return err
+	}
+
+	s.statuses.Invalidate(user.ID.String())
+	return nil
+}
+
+// ResendOTP sends a new code for a pending signup or password reset.
+// Unknown emails get the same answer as known ones.
+func (s *UserAuthService) ResendOTP(userEmail, purpose string) error {
+	if purpose != constant.OTP_SIGNUP && purpose != constant.OTP_PASSWORD_RESET {
 		return apperror.New(
 			constant.BADREQUEST,
-			"",
-			"OTP expired",
+			constant.INVALID_REQUEST,
+			"Invalid OTP purpose",
 		)
 	}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(user.OTP), []byte(otp)); err != nil {
+	var user model.User
+	if err := s.userRepo.FindOneWhere(&user, "email = ?", userEmail); err != nil {
+		return nil
+	}
+
+	if purpose == constant.OTP_SIGNUP && user.IsVerified {
 		return apperror.New(
-			constant.UNAUTHORIZED,
+			constant.BADREQUEST,
 			"",
-			"Invalid OTP",
+			"User already verified",
 		)
 	}
 
-	updates := map[string]interface{}{
-		"is_verified": true,
-		"otp":         "",
-		"otp_expiry":  time.Time{},
+	otp, err := s.otps.Issue(context.Background(), user.ID, purpose)
+	if err != nil {
+		return err
 	}
 
-	return s.userRepo.UpdateByFields(&model.User{}, user.ID, updates)
-}
+	if err := email.SendOTP(user.Email, otp); err != nil {
+		return apperror.New(
+			constant.INTERNALSERVERERROR,
+			"",
+			"Failed to send OTP email",
+		)
+	}
 
-func generateOTP() string {
-	return fmt.Sprintf("%06d", rand.Intn(1000000))
+	return nil
 }
 
 func (s *UserAuthService) Login(email, password string) (*model.User, error) {
@@ -157,7 +182,16 @@ func (s *UserAuthService) Login(email, password string) (*model.User, error) {
 		)
 	}
 
-	// 4. Return user (tokens generated in controller)
+	// 4. Blocked accounts can't log in
+	if user.IsBlocked {
+		return nil, apperror.New(
+			constant.FORBIDDEN,
+			constant.USER_BLOCKED,
+			"Account is blocked",
+		)
+	}
+
+	// 5. Return user (tokens generated in controller)
 	return &user, nil
 }
 
@@ -168,15 +202,11 @@ func (s *UserAuthService) ForgotPassword(userEmail string) error {
 		return nil // always return nil for security
 	}
 
-	otp := fmt.Sprintf("%06d", rand.Intn(1000000))
-	otpHash, _ := bcrypt.GenerateFromPassword([]byte(otp), bcrypt.DefaultCost)
-
-	updates := map[string]interface{}{
-		"otp":        string(otpHash),
-		"otp_expiry": time.Now().Add(15 * time.Minute),
-	}
-	if err := s.userRepo.UpdateByFields(&model.User{}, user.ID, updates); err != nil {
-		return err
+	otp, err := s.otps.Issue(context.Background(), user.ID, constant.OTP_PASSWORD_RESET)
+	if err != nil {
+		// Cooldowns and lockouts would tell the caller the email exists
+		log.Printf("forgot password: no OTP issued for user %s: %v", user.ID, err)
+		return nil
 	}
 
 	// Call package function
@@ -207,28 +237,12 @@ func (s *UserAuthService) ResetPassword(
 		)
 	}
 
-	// 2️⃣ Check OTP expiry
-	if time.Now().After(user.OTPExpiry) {
-		return apperror.New(
-			constant.BADREQUEST,
-			"",
-			"OTP expired",
-		)
-	}
-
-	// 3️⃣ Compare OTP
-	if err := bcrypt.CompareHashAndPassword(
-		[]byte(user.OTP),
-		[]byte(otp),
-	); err != nil {
-		return apperror.New(
-			constant.BADREQUEST,
-			"",
-			"Invalid OTP",
-		)
+	// 2️⃣ Check OTP (expiry, attempts and lockout handled by the OTP service)
+	if err := s.otps.Verify(context.Background(), user.ID, constant.OTP_PASSWORD_RESET, otp); err != nil {
+		return err
 	}
 
-	// 4️⃣ Hash new password
+	// 3️⃣ Hash new password
 	hashedPassword, err := bcrypt.GenerateFromPassword(
 		[]byte(newPassword),
 		bcrypt.DefaultCost,
@@ -241,18 +255,17 @@ func (s *UserAuthService) ResetPassword(
 		)
 	}
 
-	// 5️⃣ Update password + clear OTP
+	// 4️⃣ Update password
 	updates := map[string]interface{}{
-		"password":   string(hashedPassword),
-		"otp":        "",
-		"otp_expiry": time.Time{},
+		"password": string(hashedPassword),
 	}
 
 	if err := s.userRepo.UpdateByFields(&model.User{}, user.ID, updates); err != nil {
 		return err
 	}
 
-	return nil
+	// 5️⃣ Log out everywhere: whoever knew the old password may hold tokens
+	return s.invalidateTokens(user.ID, revokePasswordReset)
 }
 
 func (s *UserAuthService) GetProfile(userID string) (*model.User, error) {
@@ -296,7 +309,231 @@ func (s *UserAuthService) UpdateProfile(userID string, name string) (*model.User
 	return &user, nil
 }
 
-func (s *UserAuthService) ToggleUserBlock(userID string) (*model.User, error) {
+// ChangePassword sets a new password for a logged in user who knows the
+// current one. Every other session is logged out; the caller's session
+// (sessionID) survives its refresh token but needs new access tokens, see
+// SessionService.Reissue.
+func (s *UserAuthService) ChangePassword(ctx context.Context, userID, sessionID, currentPassword, newPassword string) error {
+	db := s.userRepo.WithContext(ctx)
+
+	var user model.User
+
+	if err := db.FindById(&user, userID); err != nil {
+		return apperror.New(
+			constant.NOTFOUND,
+			"",
+			"User not found",
+		)
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(currentPassword)); err != nil {
+		return apperror.New(
+			constant.BADREQUEST,
+			constant.WRONG_PASSWORD,
+			"Current password is incorrect",
+		)
+	}
+
+	if len(newPassword) < 8 {
+		return apperror.New(
+			constant.BADREQUEST,
+			constant.INVALID_REQUEST,
+			"Password must be at least 8 characters",
+		)
+	}
+	if newPassword == currentPassword {
+		return apperror.New(
+			constant.BADREQUEST,
+			constant.INVALID_REQUEST,
+			"New password must be different from the current one",
+		)
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword(
+		[]byte(newPassword),
+		bcrypt.DefaultCost,
+	)
+	if err != nil {
+		return apperror.New(
+			constant.INTERNALSERVERERROR,
+			"",
+			"Failed to hash password",
+		)
+	}
+
+	// A session ID that doesn't parse keeps nothing alive
+	keep, _ := uuid.Parse(sessionID)
+
+	err = s.userRepo.WithTransaction(ctx, func(tx repo.IPgSQLRepository) error {
+		if err := tx.Exec(
+			"UPDATE users SET password = ?, token_version = token_version + 1 WHERE id = ?",
+			string(hashedPassword),
+			user.ID,
+		).Error; err != nil {
+			return err
+		}
+		return tx.Exec(
+			"UPDATE refresh_tokens SET revoked_at = ?, revoked_reason = ? WHERE user_id = ? AND family_id <> ? AND revoked_at IS NULL",
+			time.Now(),
+			revokePasswordChange,
+			user.ID,
+			keep,
+		).Error
+	})
+	if err != nil {
+		return apperror.ErrInternal
+	}
+
+	s.statuses.Invalidate(user.ID.String())
+	return nil
+}
+
+// RequestEmailChange sends an OTP to the new address. The account keeps its
+// current email until ConfirmEmailChange.
+func (s *UserAuthService) RequestEmailChange(ctx context.Context, userID, password, newEmail string) error {
+	db := s.userRepo.WithContext(ctx)
+
+	var user model.User
+
+	if err := db.FindById(&user, userID); err != nil {
+		return apperror.New(
+			constant.NOTFOUND,
+			"",
+			"User not found",
+		)
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
+		return apperror.New(
+			constant.BADREQUEST,
+			constant.WRONG_PASSWORD,
+			"Password is incorrect",
+		)
+	}
+
+	newEmail = strings.TrimSpace(newEmail)
+	if !strings.Contains(newEmail, "@") {
+		return apperror.New(
+			constant.BADREQUEST,
+			constant.INVALID_REQUEST,
+			"Invalid email address",
+		)
+	}
+	if strings.EqualFold(newEmail, user.Email) {
+		return apperror.New(
+			constant.BADREQUEST,
+			constant.INVALID_REQUEST,
+			"This is already your email address",
+		)
+	}
+
+	if err := ensureEmailFree(db, newEmail); err != nil {
+		return err
+	}
+
+	otp, err := s.otps.Issue(ctx, user.ID, constant.OTP_EMAIL_CHANGE)
+	if err != nil {
+		return err
+	}
+
+	updates := map[string]interface{}{
+		"pending_email": newEmail,
+	}
+
+	if err := db.UpdateByFields(&model.User{}, user.ID, updates); err != nil {
+		return err
+	}
+
+	if err := email.SendOTP(newEmail, otp); err != nil {
+		return apperror.New(
+			constant.INTERNALSERVERERROR,
+			"",
+			"Failed to send OTP email",
+		)
+	}
+
+	return nil
+}
+
+// ConfirmEmailChange checks the OTP sent to the pending address, swaps it
+// in and lets the old address know
+func (s *UserAuthService) ConfirmEmailChange(ctx context.Context, userID, otp string) (*model.User, error) {
+	db := s.userRepo.WithContext(ctx)
+
+	var user model.User
+
+	if err := db.FindById(&user, userID); err != nil {
+		return nil, apperror.New(
+			constant.NOTFOUND,
+			"",
+			"User not found",
+		)
+	}
+
+	if user.PendingEmail == nil {
+		return nil, apperror.New(
+			constant.BADREQUEST,
+			"",
+			"No email change in progress",
+		)
+	}
+
+	if err := s.otps.Verify(ctx, user.ID, constant.OTP_EMAIL_CHANGE, otp); err != nil {
+		return nil, err
+	}
+
+	oldEmail, newEmail := user.Email, *user.PendingEmail
+
+	err := s.userRepo.WithTransaction(ctx, func(tx repo.IPgSQLRepository) error {
+		// The address may have been taken since the code was sent
+		if err := ensureEmailFree(tx, newEmail); err != nil {
+			return err
+		}
+		return tx.UpdateByFields(&model.User{}, user.ID, map[string]interface{}{
+			"email":         newEmail,
+			"pending_email": nil,
+		})
+	})
+	if err != nil {
+		if appErr, ok := err.(*apperror.AppError); ok {
+			return nil, appErr
+		}
+		return nil, apperror.ErrInternal
+	}
+
+	if err := email.SendEmailChanged(oldEmail, newEmail); err != nil {
+		// The change is done; a lost notice shouldn't undo it
+		log.Printf("email change: no notice sent for user %s: %v", user.ID, err)
+	}
+
+	// Reload updated user
+	if err := db.FindById(&user, userID); err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// ensureEmailFree fails if another account uses the address
+func ensureEmailFree(db repo.IPgSQLRepository, address string) error {
+	var count int64
+	if err := db.Raw(
+		"SELECT COUNT(*) FROM users WHERE LOWER(email) = LOWER(?)",
+		address,
+	).Scan(&count).Error; err != nil {
+		return apperror.ErrInternal
+	}
+	if count > 0 {
+		return apperror.New(
+			constant.CONFLICT,
+			constant.EMAIL_TAKEN,
+			"Email already in use",
+		)
+	}
+	return nil
+}
+
+func (s *UserAuthService) ToggleUserBlock(ctx context.Context, userID string) (*model.User, error) {
 	var user model.User
 
 	// 1️⃣ Find user by ID
@@ -314,10 +551,36 @@ func (s *UserAuthService) ToggleUserBlock(userID string) (*model.User, error) {
 		"is_blocked": newStatus,
 	}
 
-	if err := s.userRepo.UpdateByFields(&model.User{}, user.ID, updates); err != nil {
+	action := constant.AUDIT_USER_UNBLOCK
+	if newStatus {
+		action = constant.AUDIT_USER_BLOCK
+	}
+
+	err := s.userRepo.WithTransaction(ctx, func(tx repo.IPgSQLRepository) error {
+		if err := tx.UpdateByFields(&model.User{}, user.ID, updates); err != nil {
+			return err
+		}
+		return recordAudit(ctx, tx, AuditEntry{
+			Action:     action,
+			EntityType: constant.ENTITY_USER,
+			EntityID:   user.ID.String(),
+			Before:     map[string]interface{}{"is_blocked": user.IsBlocked},
+			After:      updates,
+		})
+	})
+	if err != nil {
 		return nil, err
 	}
 
+	// Blocking takes effect on the next request, not at token expiry
+	if newStatus {
+		if err := invalidateUserTokens(ctx, s.userRepo, s.statuses, user.ID, revokeUserBlocked); err != nil {
+			return nil, err
+		}
+	} else {
+		s.statuses.Invalidate(user.ID.String())
+	}
+
 	// 3️⃣ Reload updated user
 	if err := s.userRepo.FindById(&user, userID); err != nil {
 		return nil, err
@@ -340,3 +603,8 @@ func (s *UserAuthService) GetByID(userID string) (*model.User, error) {
 
 	return &user, nil
 }
+
+// invalidateTokens cuts a user off everywhere, see invalidateUserTokens
+func (s *UserAuthService) invalidateTokens(userID uuid.UUID, reason string) error {
+	return invalidateUserTokens(context.Background(), s.userRepo, s.statuses, userID, reason)
+}
@@ -0,0 +1,182 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"vestra-ecommerce/src/model"
+	"vestra-ecommerce/src/repo"
+)
+
+// UserStatus is the part of a user checked on every authenticated request
+type UserStatus struct {
+	IsBlocked    bool
+	IsVerified   bool
+	TokenVersion int
+	Role         string
+	Permissions  []string // union of the user's roles' permissions
+}
+
+// Can reports whether the user holds the permission
+func (s *UserStatus) Can(permission string) bool {
+	for _, p := range s.Permissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// maxCachedStatuses bounds the cache; past it, entries are dropped even if
+// they are still fresh
+const maxCachedStatuses = 10000
+
+type userStatusEntry struct {
+	status    UserStatus
+	expiresAt time.Time
+}
+
+// invalidation records when a user's status last changed, as a value of
+// UserStatusCache.gen and as a time for pruning
+type invalidation struct {
+	gen uint64
+	at  time.Time
+}
+
+// UserStatusCache keeps recently seen user statuses in memory so
+// AuthMiddleware doesn't hit the users table on every request. Changes made
+// through this process invalidate their entry at once; other instances pick
+// them up within the TTL.
+type UserStatusCache struct {
+	repo      repo.IPgSQLRepository
+	ttl       time.Duration
+	mu        sync.RWMutex
+	entries   map[string]userStatusEntry
+	lastSweep time.Time
+
+	// A load that overlaps an invalidation may have read the old row and
+	// must not be cached. gen counts invalidations; a load remembers it on
+	// start and checks for later ones in invalidated and flushedGen.
+	gen         uint64
+	invalidated map[string]invalidation
+	flushedGen  uint64
+}
+
+func NewUserStatusCache(repo repo.IPgSQLRepository, ttl time.Duration) *UserStatusCache {
+	if ttl <= 0 {
+		ttl = 30 * time.Second
+	}
+	return &UserStatusCache{
+		repo:        repo,
+		ttl:         ttl,
+		entries:     map[string]userStatusEntry{},
+		invalidated: map[string]invalidation{},
+	}
+}
+
+// Get returns the user's status, loading it from the database on a miss
+func (c *UserStatusCache) Get(ctx context.Context, userID string) (*UserStatus, error) {
+	c.mu.RLock()
+	entry, ok := c.entries[userID]
+	startGen := c.gen
+	c.mu.RUnlock()
+	started := time.Now()
+
+	if ok && time.Now().Before(entry.expiresAt) {
+		status := entry.status
+		return &status, nil
+	}
+
+	var user model.User
+	if err := c.repo.WithContext(ctx).FindById(&user, userID); err != nil {
+		return nil, err
+	}
+
+	status := UserStatus{
+		IsBlocked:    user.IsBlocked,
+		IsVerified:   user.IsVerified,
+		TokenVersion: user.TokenVersion,
+		Role:         user.Role,
+	}
+	if err := c.repo.WithContext(ctx).Raw(`
+		SELECT DISTINCT p.name
+		FROM permissions p
+		JOIN role_permissions rp ON rp.permission_id = p.id
+		JOIN user_roles ur ON ur.role_id = rp.role_id
+		WHERE ur.user_id = ?
+		ORDER BY p.name
+	`, user.ID).Scan(&status.Permissions).Error; err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	if c.fresh(userID, startGen, started) {
+		c.evict()
+		c.entries[userID] = userStatusEntry{status: status, expiresAt: time.Now().Add(c.ttl)}
+	}
+	c.mu.Unlock()
+
+	return &status, nil
+}
+
+// fresh reports whether a load that started at gen and time started can
+// be cached: nothing invalidated the user since. Invalidations are pruned
+// after a TTL, so loads slower than that are never cached. Callers hold c.mu.
+func (c *UserStatusCache) fresh(userID string, gen uint64, started time.Time) bool {
+	if time.Since(started) >= c.ttl || c.flushedGen > gen {
+		return false
+	}
+	inv, ok := c.invalidated[userID]
+	return !ok || inv.gen <= gen
+}
+
+// Invalidate drops a user's cached status after it changed
+func (c *UserStatusCache) Invalidate(userID string) {
+	c.mu.Lock()
+	c.gen++
+	c.invalidated[userID] = invalidation{gen: c.gen, at: time.Now()}
+	delete(c.entries, userID)
+	c.mu.Unlock()
+}
+
+// InvalidateAll drops every cached status, e.g. after a role's permissions
+// changed and any number of users are affected
+func (c *UserStatusCache) InvalidateAll() {
+	c.mu.Lock()
+	c.gen++
+	c.flushedGen = c.gen
+	c.invalidated = map[string]invalidation{} // all older than flushedGen
+	c.entries = map[string]userStatusEntry{}
+	c.mu.Unlock()
+}
+
+// evict makes room for one more entry: expired entries and invalidations
+// are swept once per TTL, and if the cache is still full, arbitrary entries
+// go. Callers hold c.mu.
+func (c *UserStatusCache) evict() {
+	now := time.Now()
+
+	if len(c.entries) >= maxCachedStatuses || now.Sub(c.lastSweep) >= c.ttl {
+		for id, entry := range c.entries {
+			if now.After(entry.expiresAt) {
+				delete(c.entries, id)
+			}
+		}
+		for id, inv := range c.invalidated {
+			if now.Sub(inv.at) >= c.ttl {
+				delete(c.invalidated, id)
+			}
+		}
+		c.lastSweep = now
+	}
+
+	// Map iteration order is random, so this drops random users, who are
+	// simply loaded again on their next request
+	for id := range c.entries {
+		if len(c.entries) < maxCachedStatuses {
+			break
+		}
+		delete(c.entries, id)
+	}
+}
@@ -0,0 +1,79 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"vestra-ecommerce/src/model"
+	"vestra-ecommerce/src/repo"
+)
+
+// loadHookRepo runs during after each user row is read, standing in for a
+// change committed while the cache is loading
+type loadHookRepo struct {
+	*fakeRepo
+	loads  int
+	during func()
+}
+
+func (r *loadHookRepo) WithContext(context.Context) repo.IPgSQLRepository { return r }
+
+func (r *loadHookRepo) FindById(obj interface{}, id interface{}) error {
+	err := r.fakeRepo.FindById(obj, id)
+	r.loads++
+	if r.during != nil {
+		during := r.during
+		r.during = nil
+		during()
+	}
+	return err
+}
+
+func TestUserStatusCache(t *testing.T) {
+	tests := []struct {
+		name       string
+		invalidate func(c *UserStatusCache, userID string)
+	}{
+		{"user invalidated", func(c *UserStatusCache, userID string) { c.Invalidate(userID) }},
+		{"all invalidated", func(c *UserStatusCache, _ string) { c.InvalidateAll() }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &loadHookRepo{fakeRepo: newFakeRepo(t)}
+			user := seedUser(t, db.fakeRepo, model.User{Name: "Victim", Email: testEmail, IsVerified: true})
+			id := user.ID.String()
+			cache := NewUserStatusCache(db, time.Minute)
+
+			// The user is blocked after their row was read but before the
+			// load finished; that load must not be cached
+			db.during = func() {
+				u := db.data.users[user.ID]
+				u.IsBlocked = true
+				u.TokenVersion++
+				db.data.users[user.ID] = u
+				tt.invalidate(cache, id)
+			}
+			if _, err := cache.Get(context.Background(), id); err != nil {
+				t.Fatalf("Get: %v", err)
+			}
+
+			status, err := cache.Get(context.Background(), id)
+			if err != nil {
+				t.Fatalf("Get: %v", err)
+			}
+			if !status.IsBlocked || status.TokenVersion != 1 {
+				t.Errorf("status = %+v, want the blocked user with token version 1", status)
+			}
+
+			// With nothing in flight the reload is cached as usual
+			if _, err := cache.Get(context.Background(), id); err != nil {
+				t.Fatalf("Get: %v", err)
+			}
+			if db.loads != 2 {
+				t.Errorf("loads = %d, want 2", db.loads)
+			}
+		})
+	}
+}
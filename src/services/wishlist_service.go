@@ -4,6 +4,7 @@ import (
 	"vestra-ecommerce/src/model"
 	"vestra-ecommerce/src/repo"
 	constant "vestra-ecommerce/utils/constants"
+	"vestra-ecommerce/utils/pagination"
 	"vestra-ecommerce/utils/utils/apperror"
 
 	"github.com/google/uuid"
@@ -64,30 +65,54 @@ func (s *WishlistService) AddToWishlist(userID, productID string) error {
 	return nil
 }
 
-// GetWishlist retrieves all wishlist items for a user with product details
-func (s *WishlistService) GetWishlist(userID string) ([]model.Wishlist, error) {
+// wishlistSorts are the fields a wishlist can be sorted by; price and name
+// are the product's
+var wishlistSorts = map[string]string{
+	"created_at": "wishlists.created_at",
+	"price":      "(SELECT price_minor FROM products WHERE products.id = wishlists.product_id)",
+	"name":       "(SELECT name FROM products WHERE products.id = wishlists.product_id)",
+}
+
+// GetWishlist retrieves a page of the user's wishlist items with product
+// details, latest added first by default. Pages continue from a cursor.
+func (s *WishlistService) GetWishlist(userID string, page pagination.Params) ([]model.Wishlist, *pagination.Meta, error) {
 	uID, err := uuid.Parse(userID)
 	if err != nil {
-		return nil, apperror.New(
+		return nil, nil, apperror.New(
 			constant.BADREQUEST,
 			"",
 			"Invalid user ID",
 		)
 	}
 
-	var wishlist []model.Wishlist
+	sortBy, err := pageSort(page, wishlistSorts, "-created_at")
+	if err != nil {
+		return nil, nil, err
+	}
+	query, args, err := afterCursor(s.repo, page, sortBy, "wishlists", "user_id = ?", []interface{}{uID})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	wishlist := []model.Wishlist{}
 
 	// Use repository method with preload to fetch product details
-	err = s.repo.FindWhereWithPreload(&wishlist, "user_id = ?", []interface{}{uID}, "Product")
+	err = s.repo.FindPage(&wishlist, query, args, sortBy.OrderBy("id"), page.Limit+1, 0, "Product")
 	if err != nil {
-		return nil, apperror.New(
+		return nil, nil, apperror.New(
 			constant.INTERNALSERVERERROR,
 			"",
 			"Failed to fetch wishlist",
 		)
 	}
 
-	return wishlist, nil
+	meta := pagination.CursorMeta(page, sortBy, len(wishlist), func() string {
+		return wishlist[page.Limit-1].ID.String()
+	})
+	if meta.HasMore {
+		wishlist = wishlist[:page.Limit]
+	}
+	return wishlist, meta, nil
 }
 
 // RemoveFromWishlist removes a product from the user's wishlist
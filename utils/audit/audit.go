@@ -0,0 +1,104 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+)
+
+// Metadata describes the request an audited change came from. It travels
+// in the request context (see middleware.AuditContext) so services can
+// record it without every signature growing an actor parameter.
+type Metadata struct {
+	ActorID   string
+	ActorRole string
+	SessionID string
+	IPAddress string
+	UserAgent string
+	Method    string
+	Path      string
+}
+
+type ctxKey struct{}
+
+// WithMetadata returns a copy of ctx carrying m
+func WithMetadata(ctx context.Context, m Metadata) context.Context {
+	return context.WithValue(ctx, ctxKey{}, m)
+}
+
+// FromContext returns the metadata in ctx; changes made outside a request
+// (background jobs, webhooks) get the zero value
+func FromContext(ctx context.Context) Metadata {
+	m, _ := ctx.Value(ctxKey{}).(Metadata)
+	return m
+}
+
+// ignoredFields change on every write and would only add noise to a diff
+var ignoredFields = map[string]bool{
+	"updated_at": true,
+	"UpdatedAt":  true,
+}
+
+// Diff compares two snapshots by their JSON form and returns only the
+// fields that differ, as they were and as they are. A nil before (create)
+// or after (delete) yields the other snapshot in full.
+func Diff(before, after interface{}) (json.RawMessage, json.RawMessage, error) {
+	b, err := toMap(before)
+	if err != nil {
+		return nil, nil, err
+	}
+	a, err := toMap(after)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if b != nil && a != nil {
+		changedBefore := map[string]interface{}{}
+		changedAfter := map[string]interface{}{}
+		for k, v := range b {
+			if !ignoredFields[k] && !reflect.DeepEqual(v, a[k]) {
+				changedBefore[k] = v
+				changedAfter[k] = a[k]
+			}
+		}
+		for k, v := range a {
+			if _, seen := b[k]; !seen && !ignoredFields[k] {
+				changedBefore[k] = nil
+				changedAfter[k] = v
+			}
+		}
+		b, a = changedBefore, changedAfter
+	}
+
+	rawBefore, err := marshal(b)
+	if err != nil {
+		return nil, nil, err
+	}
+	rawAfter, err := marshal(a)
+	if err != nil {
+		return nil, nil, err
+	}
+	return rawBefore, rawAfter, nil
+}
+
+func toMap(v interface{}) (map[string]interface{}, error) {
+	if v == nil {
+		return nil, nil
+	}
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func marshal(m map[string]interface{}) (json.RawMessage, error) {
+	if m == nil {
+		return nil, nil
+	}
+	return json.Marshal(m)
+}
@@ -0,0 +1,116 @@
+package audit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type product struct {
+	Name      string    `json:"name"`
+	Price     int64     `json:"price"`
+	Tags      []string  `json:"tags,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func TestDiff(t *testing.T) {
+	monday := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	tuesday := monday.AddDate(0, 0, 1)
+
+	shirt := &product{Name: "Shirt", Price: 49900, UpdatedAt: monday}
+
+	tests := []struct {
+		name       string
+		before     interface{}
+		after      interface{}
+		wantBefore string
+		wantAfter  string
+	}{
+		{
+			name:      "create",
+			after:     shirt,
+			wantAfter: `{"name":"Shirt","price":49900,"updated_at":"2026-03-02T09:00:00Z"}`,
+		},
+		{
+			name:       "delete",
+			before:     shirt,
+			wantBefore: `{"name":"Shirt","price":49900,"updated_at":"2026-03-02T09:00:00Z"}`,
+		},
+		{
+			name:       "typed nil is a delete",
+			before:     shirt,
+			after:      (*product)(nil),
+			wantBefore: `{"name":"Shirt","price":49900,"updated_at":"2026-03-02T09:00:00Z"}`,
+		},
+		{
+			name:       "changed fields only",
+			before:     shirt,
+			after:      &product{Name: "Shirt", Price: 39900, UpdatedAt: tuesday},
+			wantBefore: `{"price":49900}`,
+			wantAfter:  `{"price":39900}`,
+		},
+		{
+			name:       "field added",
+			before:     shirt,
+			after:      &product{Name: "Shirt", Price: 49900, Tags: []string{"summer"}, UpdatedAt: tuesday},
+			wantBefore: `{"tags":null}`,
+			wantAfter:  `{"tags":["summer"]}`,
+		},
+		{
+			name:       "field removed",
+			before:     &product{Name: "Shirt", Price: 49900, Tags: []string{"summer"}, UpdatedAt: monday},
+			after:      shirt,
+			wantBefore: `{"tags":["summer"]}`,
+			wantAfter:  `{"tags":null}`,
+		},
+		{
+			name:       "only updated_at changed",
+			before:     shirt,
+			after:      &product{Name: "Shirt", Price: 49900, UpdatedAt: tuesday},
+			wantBefore: `{}`,
+			wantAfter:  `{}`,
+		},
+		{
+			name:       "maps and untagged fields",
+			before:     map[string]interface{}{"status": "PENDING", "UpdatedAt": monday},
+			after:      map[string]interface{}{"status": "SHIPPED", "UpdatedAt": tuesday},
+			wantBefore: `{"status":"PENDING"}`,
+			wantAfter:  `{"status":"SHIPPED"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before, after, err := Diff(tt.before, tt.after)
+			if err != nil {
+				t.Fatalf("Diff: %v", err)
+			}
+			if string(before) != tt.wantBefore {
+				t.Errorf("before = %s, want %s", before, tt.wantBefore)
+			}
+			if string(after) != tt.wantAfter {
+				t.Errorf("after = %s, want %s", after, tt.wantAfter)
+			}
+		})
+	}
+}
+
+func TestDiffUnmarshalable(t *testing.T) {
+	if _, _, err := Diff(nil, map[string]interface{}{"ch": make(chan int)}); err == nil {
+		t.Errorf("Diff of a channel succeeded")
+	}
+	if _, _, err := Diff(nil, []string{"not", "an", "object"}); err == nil {
+		t.Errorf("Diff of a slice succeeded")
+	}
+}
+
+func TestMetadataContext(t *testing.T) {
+	if got := FromContext(context.Background()); got != (Metadata{}) {
+		t.Errorf("FromContext without metadata = %+v, want the zero value", got)
+	}
+
+	m := Metadata{ActorID: "admin-1", ActorRole: "admin", Method: "PATCH", Path: "/admin/products/1"}
+	if got := FromContext(WithMetadata(context.Background(), m)); got != m {
+		t.Errorf("FromContext = %+v, want %+v", got, m)
+	}
+}
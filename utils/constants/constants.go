@@ -13,11 +13,13 @@ var (
 	// METHODNOTALLOWED     = 405
 	CONFLICT             = 409
 	// PRECONDITIONFAILED   = 412
-	// UNSUPPORTEDMEDIATYPE = 415
+	PAYLOADTOOLARGE      = 413
+	UNSUPPORTEDMEDIATYPE = 415
 	// UNPROCESSABLEENTITY  = 422
+	TOOMANYREQUESTS      = 429
 	INTERNALSERVERERROR  = 500
 	// NOTIMPLEMENTED       = 501
-	// BADGATEWAY           = 502
+	BADGATEWAY           = 502
 	// SERVICEUNAVAILABLE   = 503
 	// GATEWAYTIMEOUT       = 504
 
@@ -33,6 +35,94 @@ var (
 	PAID            = "PAID"
 	FAILED          = "FAILED"
 
+	// Business Error Codes
+	INSUFFICIENT_STOCK        = "INSUFFICIENT_STOCK"
+	INVALID_STATUS_TRANSITION = "INVALID_STATUS_TRANSITION"
+	INVALID_AMOUNT            = "INVALID_AMOUNT"
+	TAXONOMY_IN_USE           = "TAXONOMY_IN_USE"
+	IMAGE_TOO_LARGE           = "IMAGE_TOO_LARGE"
+	IMAGE_UNSUPPORTED         = "IMAGE_UNSUPPORTED"
+	PAYMENT_IN_PROGRESS       = "PAYMENT_IN_PROGRESS"
+
+	// Auth Error Codes
+	TOKEN_INVALID     = "TOKEN_INVALID"
+	TOKEN_REUSED      = "TOKEN_REUSED"
+	TOKEN_REVOKED     = "TOKEN_REVOKED"
+	SESSION_REVOKED   = "SESSION_REVOKED"
+	USER_BLOCKED      = "USER_BLOCKED"
+	USER_NOT_VERIFIED = "USER_NOT_VERIFIED"
+	PERMISSION_DENIED = "PERMISSION_DENIED"
+	OTP_INVALID       = "OTP_INVALID"
+	OTP_EXPIRED       = "OTP_EXPIRED"
+	OTP_LOCKED        = "OTP_LOCKED"
+	OTP_COOLDOWN      = "OTP_COOLDOWN"
+	RATE_LIMITED      = "RATE_LIMITED"
+	MFA_REQUIRED      = "MFA_REQUIRED"
+	OIDC_FAILED       = "OIDC_FAILED"
+	EMAIL_UNVERIFIED  = "EMAIL_UNVERIFIED"
+	EMAIL_TAKEN       = "EMAIL_TAKEN"
+	DELETION_PENDING  = "DELETION_PENDING"
+	WRONG_PASSWORD    = "WRONG_PASSWORD"
+
+	// OTP purposes; each has its own code per user
+	OTP_SIGNUP         = "signup"
+	OTP_PASSWORD_RESET = "password_reset"
+	OTP_EMAIL_CHANGE   = "email_change"
+
+	// Permissions (seeded by migration, checked by middleware.RequirePermission)
+	PERM_CATALOG_WRITE   = "catalog:write"
+	PERM_ORDERS_READ     = "orders:read"
+	PERM_ORDERS_UPDATE   = "orders:update"
+	PERM_PAYMENTS_READ   = "payments:read"
+	PERM_PAYMENTS_UPDATE = "payments:update"
+	PERM_PAYMENTS_REFUND = "payments:refund"
+	PERM_USERS_READ      = "users:read"
+	PERM_USERS_UPDATE    = "users:update"
+	PERM_USERS_BLOCK     = "users:block"
+	PERM_AUDIT_READ      = "audit:read"
+	PERM_ROLES_MANAGE    = "roles:manage"
+
+	// Built-in role holding every permission
+	ROLE_ADMIN = "admin"
+
+	// Audit log actions ("<entity>.<verb>") and entity types
+	AUDIT_PRODUCT_CREATE  = "product.create"
+	AUDIT_PRODUCT_UPDATE  = "product.update"
+	AUDIT_PRODUCT_DELETE  = "product.delete"
+	AUDIT_CATEGORY_CREATE = "category.create"
+	AUDIT_CATEGORY_UPDATE = "category.update"
+	AUDIT_CATEGORY_DELETE = "category.delete"
+	AUDIT_TEAM_CREATE     = "team.create"
+	AUDIT_TEAM_UPDATE     = "team.update"
+	AUDIT_TEAM_DELETE     = "team.delete"
+	AUDIT_IMAGE_CREATE    = "product_image.create"
+	AUDIT_IMAGE_UPDATE    = "product_image.update"
+	AUDIT_IMAGE_DELETE    = "product_image.delete"
+	AUDIT_IMAGE_REORDER   = "product_image.reorder"
+	AUDIT_ORDER_STATUS    = "order.status"
+	AUDIT_PAYMENT_STATUS  = "payment.status"
+	AUDIT_USER_BLOCK      = "user.block"
+	AUDIT_USER_UNBLOCK    = "user.unblock"
+	AUDIT_USER_VERIFY     = "user.verify"
+	AUDIT_USER_LOGOUT     = "user.logout"
+	AUDIT_USER_ROLES      = "user.roles"
+	AUDIT_ROLE_CREATE     = "role.create"
+	AUDIT_ROLE_UPDATE     = "role.update"
+	AUDIT_ROLE_DELETE     = "role.delete"
+
+	ENTITY_PRODUCT  = "product"
+	ENTITY_IMAGE    = "product_image"
+	ENTITY_CATEGORY = "category"
+	ENTITY_TEAM     = "team"
+	ENTITY_ORDER    = "order"
+	ENTITY_PAYMENT  = "payment"
+	ENTITY_USER     = "user"
+	ENTITY_ROLE     = "role"
+
+	// Team kinds; a club belongs to a league
+	TEAM_LEAGUE = "league"
+	TEAM_CLUB   = "club"
+
 	// Transaction Types
 	// DEPOSIT  = "DEPOSIT"
 	// SPEND    = "SPEND"
@@ -44,4 +134,25 @@ var (
 	PLACED     = "PLACED"
 	SHIPPED    = "SHIPPED"
 	DELIVERED  = "DELIVERED"
+
+	// Order lifecycle (see services/order_state.go for allowed transitions)
+	PENDING_PAYMENT  = "PENDING_PAYMENT"
+	PACKED           = "PACKED"
+	OUT_FOR_DELIVERY = "OUT_FOR_DELIVERY"
+	RETURNED         = "RETURNED"
+
+	// Refund states, used by refunds, payments and orders alike
+	REFUND_PENDING     = "REFUND_PENDING"
+	REFUNDED           = "REFUNDED"
+	PARTIALLY_REFUNDED = "PARTIALLY_REFUNDED" // payments only
+
+	// Webhook event processing states
+	RECEIVED  = "RECEIVED"
+	PROCESSED = "PROCESSED"
+	IGNORED   = "IGNORED"
+
+	// Who changed something
+	ACTOR_USER   = "user"
+	ACTOR_ADMIN  = "admin"
+	ACTOR_SYSTEM = "system"
 )
@@ -18,6 +18,42 @@ func Init(cfg config.SMTPConfig) {
 
 // SendOTP sends an OTP email to the recipient
 func SendOTP(to string, otp string) error {
+	err := send(
+		to,
+		"Your OTP for Vestra Ecommerce",
+		fmt.Sprintf("Hello!\n\nYour OTP is: %s\nIt will expire in 5 minutes.\n\nThanks,\nVestra Ecommerce Team", otp),
+	)
+	if err != nil {
+		log.Printf("[email] Failed to send OTP to %s: %v\n", to, err)
+		return err
+	}
+
+	log.Printf("[email] OTP sent successfully to %s\n", to)
+	return nil
+}
+
+// SendEmailChanged tells the old address that the account's email changed
+func SendEmailChanged(to string, newEmail string) error {
+	err := send(
+		to,
+		"Your Vestra Ecommerce email was changed",
+		fmt.Sprintf(
+			"Hello!\n\nThe email address of your account was changed to %s.\n"+
+				"If you didn't do this, contact support right away.\n\nThanks,\nVestra Ecommerce Team",
+			newEmail,
+		),
+	)
+	if err != nil {
+		log.Printf("[email] Failed to send email change notice to %s: %v\n", to, err)
+		return err
+	}
+
+	log.Printf("[email] Email change notice sent to %s\n", to)
+	return nil
+}
+
+// send delivers a plain text message through the configured SMTP server
+func send(to, subject, body string) error {
 	// Envelope sender (must match authenticated username)
 	from := smtpCfg.Username
 
@@ -31,11 +67,11 @@ func SendOTP(to string, otp string) error {
 	msg := fmt.Sprintf(
 		"From: %s\r\n"+
 			"To: %s\r\n"+
-			"Subject: Your OTP for Vestra Ecommerce\r\n"+
+			"Subject: %s\r\n"+
 			"MIME-Version: 1.0\r\n"+
 			"Content-Type: text/plain; charset=\"UTF-8\"\r\n\r\n"+
-			"Hello!\n\nYour OTP is: %s\nIt will expire in 5 minutes.\n\nThanks,\nVestra Ecommerce Team",
-		fromHeader, to, otp,
+			"%s",
+		fromHeader, to, subject, body,
 	)
 
 	// SMTP server address
@@ -44,13 +80,5 @@ func SendOTP(to string, otp string) error {
 	// Authentication
 	auth := smtp.PlainAuth("", smtpCfg.Username, smtpCfg.Password, smtpCfg.Host)
 
-	// Send email
-	err := smtp.SendMail(addr, auth, from, []string{to}, []byte(msg))
-	if err != nil {
-		log.Printf("[email] Failed to send OTP to %s: %v\n", to, err)
-		return err
-	}
-
-	log.Printf("[email] OTP sent successfully to %s\n", to)
-	return nil
+	return smtp.SendMail(addr, auth, from, []string{to}, []byte(msg))
 }
@@ -0,0 +1,227 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// FailPaymentPrefix makes the fake gateway decline a payment, e.g.
+// "fakefail_123", so failure paths can be exercised locally.
+const FailPaymentPrefix = "fakefail_"
+
+// FakeSignatureHeader carries the hex HMAC-SHA256 of a fake webhook body
+const FakeSignatureHeader = "X-Fake-Signature"
+
+// FakeGateway is an in-process provider for local development and tests.
+// It mimics Razorpay's checkout: CreateIntent returns a ready-made payment ID
+// and signature in ClientData which the client posts back to /verify.
+type FakeGateway struct {
+	secret        string
+	webhookSecret string
+
+	mu       sync.Mutex
+	intents  map[string]*Intent
+	payments map[string]*PaymentResult
+	refunded map[string]int64
+}
+
+// NewFakeGateway needs both secrets; anyone who knows them can mark
+// payments as paid or forge webhooks, so there are no defaults
+func NewFakeGateway(secret, webhookSecret string) (*FakeGateway, error) {
+	if secret == "" {
+		return nil, fmt.Errorf("%w: payment.fake.secret", ErrMissingSecret)
+	}
+	if webhookSecret == "" {
+		return nil, fmt.Errorf("%w: payment.fake.webhook_secret", ErrMissingSecret)
+	}
+	return &FakeGateway{
+		secret:        secret,
+		webhookSecret: webhookSecret,
+		intents:       map[string]*Intent{},
+		payments:      map[string]*PaymentResult{},
+		refunded:      map[string]int64{},
+	}, nil
+}
+
+func (g *FakeGateway) Name() string {
+	return "fake"
+}
+
+// Sign returns the signature the fake checkout would produce
+func (g *FakeGateway) Sign(intentID, providerPaymentID string) string {
+	return hmacSHA256Hex(g.secret, intentID+"|"+providerPaymentID)
+}
+
+func (g *FakeGateway) CreateIntent(ctx context.Context, req IntentRequest) (*Intent, error) {
+	intent := &Intent{
+		ID:       "fake_order_" + uuid.NewString(),
+		Amount:   req.Amount,
+		Currency: req.Currency,
+		Status:   StatusCreated,
+	}
+	paymentID := "fake_pay_" + uuid.NewString()
+	intent.ClientData = map[string]string{
+		"provider":   g.Name(),
+		"intent_id":  intent.ID,
+		"payment_id": paymentID,
+		"signature":  g.Sign(intent.ID, paymentID),
+	}
+
+	g.mu.Lock()
+	g.intents[intent.ID] = intent
+	g.mu.Unlock()
+
+	return intent, nil
+}
+
+func (g *FakeGateway) Verify(ctx context.Context, req VerifyRequest) (*PaymentResult, error) {
+	if !validHMAC(g.secret, req.IntentID+"|"+req.ProviderPaymentID, req.Signature) {
+		return nil, ErrInvalidSignature
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if existing, ok := g.payments[req.ProviderPaymentID]; ok {
+		if existing.IntentID != req.IntentID {
+			return nil, ErrIntentMismatch
+		}
+		result := *existing
+		return &result, nil
+	}
+
+	intent, ok := g.intents[req.IntentID]
+	if !ok {
+		return nil, fmt.Errorf("gateway: unknown intent %s", req.IntentID)
+	}
+
+	status := StatusAuthorized
+	if strings.HasPrefix(req.ProviderPaymentID, FailPaymentPrefix) {
+		status = StatusFailed
+	}
+
+	result := &PaymentResult{
+		IntentID:          intent.ID,
+		ProviderPaymentID: req.ProviderPaymentID,
+		Status:            status,
+		Amount:            intent.Amount,
+		Currency:          intent.Currency,
+	}
+	g.payments[req.ProviderPaymentID] = result
+
+	copied := *result
+	return &copied, nil
+}
+
+func (g *FakeGateway) Capture(ctx context.Context, providerPaymentID string, amount int64, currency string) (*PaymentResult, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	p, ok := g.payments[providerPaymentID]
+	if !ok {
+		return nil, fmt.Errorf("gateway: unknown payment %s", providerPaymentID)
+	}
+	if p.Status != StatusAuthorized && p.Status != StatusCaptured {
+		return nil, fmt.Errorf("gateway: cannot capture payment in status %s", p.Status)
+	}
+	if amount != p.Amount {
+		return nil, fmt.Errorf("gateway: capture amount %d does not match %d", amount, p.Amount)
+	}
+
+	p.Status = StatusCaptured
+	result := *p
+	return &result, nil
+}
+
+func (g *FakeGateway) Refund(ctx context.Context, req RefundRequest) (*RefundResult, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	p, ok := g.payments[req.ProviderPaymentID]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown payment %s", ErrRejected, req.ProviderPaymentID)
+	}
+	if p.Status != StatusCaptured {
+		return nil, fmt.Errorf("%w: cannot refund payment in status %s", ErrRejected, p.Status)
+	}
+	if req.Amount <= 0 || g.refunded[p.ProviderPaymentID]+req.Amount > p.Amount {
+		return nil, fmt.Errorf("%w: invalid refund amount %d", ErrRejected, req.Amount)
+	}
+	g.refunded[p.ProviderPaymentID] += req.Amount
+
+	return &RefundResult{
+		ID:        "fake_rfnd_" + uuid.NewString(),
+		Reference: req.Reference,
+		Status:    RefundProcessed,
+		Amount:    req.Amount,
+	}, nil
+}
+
+// fakeWebhook is the body format of fake provider notifications:
+//
+//	{"id":"evt_1","type":"payment.captured","intent_id":"fake_order_…",
+//	 "payment_id":"fake_pay_…","status":"captured","amount":49900,"currency":"INR"}
+//
+// Refund events add "refund_id", "refund_reference" (our refund ID) and
+// "refund_status".
+type fakeWebhook struct {
+	ID              string       `json:"id"`
+	Type            string       `json:"type"`
+	IntentID        string       `json:"intent_id"`
+	PaymentID       string       `json:"payment_id"`
+	Status          Status       `json:"status"`
+	Amount          int64        `json:"amount"`
+	Currency        string       `json:"currency"`
+	RefundID        string       `json:"refund_id,omitempty"`
+	RefundReference string       `json:"refund_reference,omitempty"`
+	RefundStatus    RefundStatus `json:"refund_status,omitempty"`
+}
+
+// SignWebhook returns the signature header value for payload
+func (g *FakeGateway) SignWebhook(payload []byte) string {
+	return hmacSHA256Hex(g.webhookSecret, string(payload))
+}
+
+func (g *FakeGateway) VerifyWebhook(payload []byte, headers http.Header) (string, error) {
+	if !validHMAC(g.webhookSecret, string(payload), headers.Get(FakeSignatureHeader)) {
+		return "", ErrInvalidSignature
+	}
+
+	var body fakeWebhook
+	if err := json.Unmarshal(payload, &body); err != nil {
+		return "", err
+	}
+	if body.ID == "" {
+		return payloadDigest(payload), nil
+	}
+	return body.ID, nil
+}
+
+func (g *FakeGateway) ParseWebhook(payload []byte) (*WebhookEvent, error) {
+	var body fakeWebhook
+	if err := json.Unmarshal(payload, &body); err != nil {
+		return nil, err
+	}
+	if body.IntentID == "" && body.PaymentID == "" {
+		return nil, ErrUnsupportedEvent
+	}
+
+	event := &WebhookEvent{
+		Type:              body.Type,
+		IntentID:          body.IntentID,
+		ProviderPaymentID: body.PaymentID,
+		Status:            body.Status,
+		Amount:            body.Amount,
+		Currency:          body.Currency,
+	}
+	if body.RefundID != "" {
+		event.Refund = &RefundResult{ID: body.RefundID, Reference: body.RefundReference, Status: body.RefundStatus, Amount: body.Amount}
+	}
+	return event, nil
+}
@@ -0,0 +1,170 @@
+package gateway
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"vestra-ecommerce/config"
+)
+
+// Status is the provider-neutral state of a payment
+type Status string
+
+const (
+	StatusCreated    Status = "created"
+	StatusAuthorized Status = "authorized" // funds held, capture pending
+	StatusCaptured   Status = "captured"   // money received
+	StatusFailed     Status = "failed"
+	StatusRefunded   Status = "refunded"
+)
+
+// RefundStatus is the provider-neutral state of a refund
+type RefundStatus string
+
+const (
+	RefundPending   RefundStatus = "pending"
+	RefundProcessed RefundStatus = "processed"
+	RefundFailed    RefundStatus = "failed"
+)
+
+var (
+	ErrNoProvider       = errors.New("gateway: payment.provider is not set")
+	ErrFakeNotAllowed   = errors.New("gateway: the fake provider needs payment.allow_fake (dev/test only)")
+	ErrMissingSecret    = errors.New("gateway: provider secret is not set")
+	ErrInvalidSignature = errors.New("gateway: invalid signature")
+	ErrIntentMismatch   = errors.New("gateway: provider payment does not belong to intent")
+	ErrUnknownProvider  = errors.New("gateway: unknown provider")
+	ErrUnsupportedEvent = errors.New("gateway: unsupported webhook event")
+
+	// ErrRejected wraps a definitive refusal by the provider. Any other
+	// error (timeout, transport failure, 5xx) leaves it unknown whether the
+	// request took effect.
+	ErrRejected = errors.New("gateway: rejected by provider")
+)
+
+// IntentRequest asks the provider to prepare a checkout. Amounts are always
+// in minor units (paise for INR).
+type IntentRequest struct {
+	Reference string // our payment ID, echoed back by the provider
+	Amount    int64
+	Currency  string
+	Notes     map[string]string
+}
+
+// Intent is a provider-side checkout the client completes
+type Intent struct {
+	ID       string
+	Amount   int64
+	Currency string
+	Status   Status
+
+	// ClientData is handed to the frontend to open the provider's checkout
+	ClientData map[string]string
+}
+
+// VerifyRequest carries what the client got back from the provider checkout
+type VerifyRequest struct {
+	IntentID          string
+	ProviderPaymentID string
+	Signature         string
+}
+
+// PaymentResult is the provider's verified view of a payment
+type PaymentResult struct {
+	IntentID          string
+	ProviderPaymentID string
+	Status            Status
+	Amount            int64
+	Currency          string
+}
+
+// RefundRequest returns (part of) a captured payment
+type RefundRequest struct {
+	ProviderPaymentID string
+	Amount            int64
+	Currency          string
+	Reference         string // our refund ID
+	Reason            string
+}
+
+// RefundResult is the provider's view of a refund
+type RefundResult struct {
+	ID        string
+	Reference string // our refund ID, echoed back by the provider
+	Status    RefundStatus
+	Amount    int64
+}
+
+// WebhookEvent is a provider notification reduced to what we act on
+type WebhookEvent struct {
+	Type              string
+	IntentID          string
+	ProviderPaymentID string
+	Status            Status
+	Amount            int64
+	Currency          string
+
+	// Refund is set for refund events only
+	Refund *RefundResult
+}
+
+// PaymentGateway is implemented by every payment provider. PaymentService only
+// changes payment state based on what a PaymentGateway reports, never on what the
+// client claims.
+type PaymentGateway interface {
+	Name() string
+	CreateIntent(ctx context.Context, req IntentRequest) (*Intent, error)
+	Capture(ctx context.Context, providerPaymentID string, amount int64, currency string) (*PaymentResult, error)
+	Verify(ctx context.Context, req VerifyRequest) (*PaymentResult, error)
+	Refund(ctx context.Context, req RefundRequest) (*RefundResult, error)
+
+	// VerifyWebhook checks the signature over the raw body and returns the
+	// provider's event ID, used to drop duplicate deliveries.
+	VerifyWebhook(payload []byte, headers http.Header) (eventID string, err error)
+	// ParseWebhook decodes an already verified body. Events we don't act on
+	// return ErrUnsupportedEvent.
+	ParseWebhook(payload []byte) (*WebhookEvent, error)
+}
+
+// New builds the provider selected in app.yaml. There is no default: a
+// missing provider is a startup error rather than silently free orders.
+func New(cfg config.PaymentConfig) (PaymentGateway, error) {
+	switch strings.ToLower(cfg.Provider) {
+	case "":
+		return nil, ErrNoProvider
+	case "fake":
+		if !cfg.AllowFake {
+			return nil, ErrFakeNotAllowed
+		}
+		return NewFakeGateway(cfg.Fake.Secret, cfg.Fake.WebhookSecret)
+	case "razorpay":
+		return NewRazorpayGateway(cfg.Razorpay)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownProvider, cfg.Provider)
+	}
+}
+
+// hmacSHA256Hex signs message with secret and hex-encodes the digest
+func hmacSHA256Hex(secret, message string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(message))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// payloadDigest identifies a delivery when the provider sends no event ID
+func payloadDigest(payload []byte) string {
+	sum := sha256.Sum256(payload)
+	return hex.EncodeToString(sum[:])
+}
+
+// validHMAC compares signatures in constant time
+func validHMAC(secret, message, signature string) bool {
+	expected := hmacSHA256Hex(secret, message)
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
@@ -0,0 +1,258 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"vestra-ecommerce/config"
+)
+
+func TestNew(t *testing.T) {
+	fake := config.FakeGatewayConfig{Secret: "s3cret", WebhookSecret: "wh-s3cret"}
+	razorpay := config.RazorpayConfig{KeyID: "rzp_test", KeySecret: "key-s3cret", WebhookSecret: "wh-s3cret"}
+
+	tests := []struct {
+		name     string
+		cfg      config.PaymentConfig
+		wantName string
+		wantErr  error
+	}{
+		{"no provider", config.PaymentConfig{Fake: fake, AllowFake: true}, "", ErrNoProvider},
+		{"unknown provider", config.PaymentConfig{Provider: "paypal"}, "", ErrUnknownProvider},
+		{"fake not allowed", config.PaymentConfig{Provider: "fake", Fake: fake}, "", ErrFakeNotAllowed},
+		{"fake", config.PaymentConfig{Provider: "FAKE", AllowFake: true, Fake: fake}, "fake", nil},
+		{"fake without secret", config.PaymentConfig{Provider: "fake", AllowFake: true, Fake: config.FakeGatewayConfig{WebhookSecret: "wh"}}, "", ErrMissingSecret},
+		{"fake without webhook secret", config.PaymentConfig{Provider: "fake", AllowFake: true, Fake: config.FakeGatewayConfig{Secret: "s"}}, "", ErrMissingSecret},
+		{"razorpay", config.PaymentConfig{Provider: "razorpay", Razorpay: razorpay}, "razorpay", nil},
+		{"razorpay without keys", config.PaymentConfig{Provider: "razorpay", Razorpay: config.RazorpayConfig{WebhookSecret: "wh"}}, "", ErrMissingSecret},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gw, err := New(tt.cfg)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && gw.Name() != tt.wantName {
+				t.Errorf("provider = %s, want %s", gw.Name(), tt.wantName)
+			}
+		})
+	}
+}
+
+func TestHMAC(t *testing.T) {
+	// RFC 4231 test case 2
+	const want = "5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843"
+	if got := hmacSHA256Hex("Jefe", "what do ya want for nothing?"); got != want {
+		t.Fatalf("hmacSHA256Hex = %s, want %s", got, want)
+	}
+
+	tests := []struct {
+		name      string
+		secret    string
+		message   string
+		signature string
+		want      bool
+	}{
+		{"valid", "Jefe", "what do ya want for nothing?", want, true},
+		{"other message", "Jefe", "what do ya want for nothing!", want, false},
+		{"other secret", "jefe", "what do ya want for nothing?", want, false},
+		{"upper case hex", "Jefe", "what do ya want for nothing?", "5BDCC146BF60754E6A042426089575C75A003F089D2739839DEC58B964EC3843", false},
+		{"truncated", "Jefe", "what do ya want for nothing?", want[:32], false},
+		{"empty", "Jefe", "what do ya want for nothing?", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := validHMAC(tt.secret, tt.message, tt.signature); got != tt.want {
+				t.Errorf("validHMAC = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFakeVerify(t *testing.T) {
+	ctx := context.Background()
+
+	g, err := NewFakeGateway("s3cret", "wh-s3cret")
+	if err != nil {
+		t.Fatalf("NewFakeGateway: %v", err)
+	}
+	intent, err := g.CreateIntent(ctx, IntentRequest{Reference: "pay_1", Amount: 49900, Currency: "INR"})
+	if err != nil {
+		t.Fatalf("CreateIntent: %v", err)
+	}
+	other, err := g.CreateIntent(ctx, IntentRequest{Reference: "pay_2", Amount: 100, Currency: "INR"})
+	if err != nil {
+		t.Fatalf("CreateIntent: %v", err)
+	}
+
+	paymentID := intent.ClientData["payment_id"]
+	forged, err := NewFakeGateway("guessed", "wh-s3cret")
+	if err != nil {
+		t.Fatalf("NewFakeGateway: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		req        VerifyRequest
+		wantStatus Status
+		wantErr    error
+	}{
+		{
+			name:       "checkout signature",
+			req:        VerifyRequest{IntentID: intent.ID, ProviderPaymentID: paymentID, Signature: intent.ClientData["signature"]},
+			wantStatus: StatusAuthorized,
+		},
+		{
+			name:    "signature for another payment",
+			req:     VerifyRequest{IntentID: intent.ID, ProviderPaymentID: "fake_pay_other", Signature: intent.ClientData["signature"]},
+			wantErr: ErrInvalidSignature,
+		},
+		{
+			name:    "signed with another secret",
+			req:     VerifyRequest{IntentID: intent.ID, ProviderPaymentID: paymentID, Signature: forged.Sign(intent.ID, paymentID)},
+			wantErr: ErrInvalidSignature,
+		},
+		{
+			name:    "no signature",
+			req:     VerifyRequest{IntentID: intent.ID, ProviderPaymentID: paymentID},
+			wantErr: ErrInvalidSignature,
+		},
+		{
+			name:    "payment moved to another intent",
+			req:     VerifyRequest{IntentID: other.ID, ProviderPaymentID: paymentID, Signature: g.Sign(other.ID, paymentID)},
+			wantErr: ErrIntentMismatch,
+		},
+		{
+			name:       "declined payment",
+			req:        VerifyRequest{IntentID: other.ID, ProviderPaymentID: FailPaymentPrefix + "1", Signature: g.Sign(other.ID, FailPaymentPrefix+"1")},
+			wantStatus: StatusFailed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := g.Verify(ctx, tt.req)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && result.Status != tt.wantStatus {
+				t.Errorf("status = %s, want %s", result.Status, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestVerifyWebhook(t *testing.T) {
+	fake, err := NewFakeGateway("s3cret", "wh-s3cret")
+	if err != nil {
+		t.Fatalf("NewFakeGateway: %v", err)
+	}
+	razorpay, err := NewRazorpayGateway(config.RazorpayConfig{KeyID: "rzp_test", KeySecret: "key-s3cret", WebhookSecret: "wh-s3cret"})
+	if err != nil {
+		t.Fatalf("NewRazorpayGateway: %v", err)
+	}
+
+	withID := []byte(`{"id":"evt_1","type":"payment.captured","payment_id":"fake_pay_1"}`)
+	withoutID := []byte(`{"type":"payment.captured","payment_id":"fake_pay_1"}`)
+	razorpayBody := []byte(`{"event":"payment.captured"}`)
+
+	header := func(name, value string) http.Header {
+		h := http.Header{}
+		if value != "" {
+			h.Set(name, value)
+		}
+		return h
+	}
+	razorpayHeader := func(signature, eventID string) http.Header {
+		h := header(razorpaySignatureHeader, signature)
+		if eventID != "" {
+			h.Set(razorpayEventIDHeader, eventID)
+		}
+		return h
+	}
+
+	tests := []struct {
+		name        string
+		gw          PaymentGateway
+		payload     []byte
+		headers     http.Header
+		wantEventID string
+		wantErr     error
+	}{
+		{"fake with event id", fake, withID, header(FakeSignatureHeader, fake.SignWebhook(withID)), "evt_1", nil},
+		{"fake without event id", fake, withoutID, header(FakeSignatureHeader, fake.SignWebhook(withoutID)), payloadDigest(withoutID), nil},
+		{"fake tampered body", fake, withoutID, header(FakeSignatureHeader, fake.SignWebhook(withID)), "", ErrInvalidSignature},
+		{"fake signed with api secret", fake, withID, header(FakeSignatureHeader, hmacSHA256Hex("s3cret", string(withID))), "", ErrInvalidSignature},
+		{"fake missing signature", fake, withID, header(FakeSignatureHeader, ""), "", ErrInvalidSignature},
+		{"fake signature in another header", fake, withID, header(razorpaySignatureHeader, fake.SignWebhook(withID)), "", ErrInvalidSignature},
+		{"razorpay with event id", razorpay, razorpayBody, razorpayHeader(hmacSHA256Hex("wh-s3cret", string(razorpayBody)), "evt_rzp_1"), "evt_rzp_1", nil},
+		{"razorpay without event id", razorpay, razorpayBody, razorpayHeader(hmacSHA256Hex("wh-s3cret", string(razorpayBody)), ""), payloadDigest(razorpayBody), nil},
+		{"razorpay signed with key secret", razorpay, razorpayBody, razorpayHeader(hmacSHA256Hex("key-s3cret", string(razorpayBody)), "evt_rzp_1"), "", ErrInvalidSignature},
+		{"razorpay missing signature", razorpay, razorpayBody, razorpayHeader("", "evt_rzp_1"), "", ErrInvalidSignature},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			eventID, err := tt.gw.VerifyWebhook(tt.payload, tt.headers)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if eventID != tt.wantEventID {
+				t.Errorf("event id = %q, want %q", eventID, tt.wantEventID)
+			}
+		})
+	}
+}
+
+func TestRazorpayRefund(t *testing.T) {
+	tests := []struct {
+		name         string
+		status       int
+		body         string
+		wantRejected bool
+		wantErr      bool
+	}{
+		{"processed", http.StatusOK, `{"id":"rfnd_1","receipt":"ref-1","amount":100,"status":"processed"}`, false, false},
+		{"bad request", http.StatusBadRequest, `{"error":{"code":"BAD_REQUEST_ERROR","description":"The amount is invalid"}}`, true, true},
+		{"not found", http.StatusNotFound, ``, true, true},
+		{"rate limited", http.StatusTooManyRequests, ``, false, true},
+		{"server error", http.StatusBadGateway, ``, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer srv.Close()
+
+			g, err := NewRazorpayGateway(config.RazorpayConfig{KeyID: "rzp_test", KeySecret: "key-s3cret", WebhookSecret: "wh-s3cret", BaseURL: srv.URL})
+			if err != nil {
+				t.Fatalf("NewRazorpayGateway: %v", err)
+			}
+
+			result, err := g.Refund(context.Background(), RefundRequest{ProviderPaymentID: "pay_1", Amount: 100, Currency: "INR", Reference: "ref-1"})
+			if (err != nil) != tt.wantErr || errors.Is(err, ErrRejected) != tt.wantRejected {
+				t.Fatalf("err = %v, want error %v, rejected %v", err, tt.wantErr, tt.wantRejected)
+			}
+			if err == nil && (result.Status != RefundProcessed || result.Reference != "ref-1") {
+				t.Errorf("result = %+v", result)
+			}
+		})
+	}
+
+	// A transport failure is never a rejection: the refund may exist
+	g, err := NewRazorpayGateway(config.RazorpayConfig{KeyID: "rzp_test", KeySecret: "key-s3cret", WebhookSecret: "wh-s3cret", BaseURL: "http://127.0.0.1:1"})
+	if err != nil {
+		t.Fatalf("NewRazorpayGateway: %v", err)
+	}
+	if _, err := g.Refund(context.Background(), RefundRequest{ProviderPaymentID: "pay_1", Amount: 100}); err == nil || errors.Is(err, ErrRejected) {
+		t.Errorf("unreachable provider: err = %v, want a non-rejection error", err)
+	}
+}
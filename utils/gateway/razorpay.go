@@ -0,0 +1,300 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"vestra-ecommerce/config"
+)
+
+const razorpayDefaultBaseURL = "https://api.razorpay.com/v1"
+
+const (
+	razorpaySignatureHeader = "X-Razorpay-Signature"
+	razorpayEventIDHeader   = "X-Razorpay-Event-Id"
+)
+
+// RazorpayGateway talks to the Razorpay Orders/Payments API
+type RazorpayGateway struct {
+	keyID         string
+	keySecret     string
+	webhookSecret string
+	baseURL       string
+	client        *http.Client
+}
+
+// NewRazorpayGateway needs the API keys and the webhook secret: webhooks
+// arrive on a public endpoint and are only trusted by their signature
+func NewRazorpayGateway(cfg config.RazorpayConfig) (*RazorpayGateway, error) {
+	switch {
+	case cfg.KeyID == "" || cfg.KeySecret == "":
+		return nil, fmt.Errorf("%w: payment.razorpay.key_id and key_secret", ErrMissingSecret)
+	case cfg.WebhookSecret == "":
+		return nil, fmt.Errorf("%w: payment.razorpay.webhook_secret", ErrMissingSecret)
+	}
+
+	baseURL := cfg.BaseURL
+	if baseURL == "" {
+		baseURL = razorpayDefaultBaseURL
+	}
+	return &RazorpayGateway{
+		keyID:         cfg.KeyID,
+		keySecret:     cfg.KeySecret,
+		webhookSecret: cfg.WebhookSecret,
+		baseURL:       strings.TrimRight(baseURL, "/"),
+		client:        &http.Client{Timeout: 15 * time.Second},
+	}, nil
+}
+
+func (g *RazorpayGateway) Name() string {
+	return "razorpay"
+}
+
+type razorpayOrder struct {
+	ID       string `json:"id"`
+	Amount   int64  `json:"amount"`
+	Currency string `json:"currency"`
+	Status   string `json:"status"`
+}
+
+type razorpayPayment struct {
+	ID       string `json:"id"`
+	OrderID  string `json:"order_id"`
+	Amount   int64  `json:"amount"`
+	Currency string `json:"currency"`
+	Status   string `json:"status"` // created, authorized, captured, refunded, failed
+}
+
+type razorpayRefund struct {
+	ID        string `json:"id"`
+	PaymentID string `json:"payment_id"`
+	Amount    int64  `json:"amount"`
+	Currency  string `json:"currency"`
+	Receipt   string `json:"receipt"`
+	Status    string `json:"status"` // pending, processed, failed
+}
+
+type razorpayError struct {
+	Error struct {
+		Code        string `json:"code"`
+		Description string `json:"description"`
+	} `json:"error"`
+}
+
+func (g *RazorpayGateway) CreateIntent(ctx context.Context, req IntentRequest) (*Intent, error) {
+	body := map[string]interface{}{
+		"amount":   req.Amount,
+		"currency": req.Currency,
+		"receipt":  req.Reference,
+		"notes":    req.Notes,
+	}
+
+	var order razorpayOrder
+	if err := g.do(ctx, http.MethodPost, "/orders", body, &order); err != nil {
+		return nil, err
+	}
+
+	return &Intent{
+		ID:       order.ID,
+		Amount:   order.Amount,
+		Currency: order.Currency,
+		Status:   StatusCreated,
+		ClientData: map[string]string{
+			"provider": g.Name(),
+			"key_id":   g.keyID,
+			"order_id": order.ID,
+		},
+	}, nil
+}
+
+// Verify checks the checkout signature and then asks Razorpay for the
+// payment itself, so the status never comes from the client.
+func (g *RazorpayGateway) Verify(ctx context.Context, req VerifyRequest) (*PaymentResult, error) {
+	if !validHMAC(g.keySecret, req.IntentID+"|"+req.ProviderPaymentID, req.Signature) {
+		return nil, ErrInvalidSignature
+	}
+
+	var p razorpayPayment
+	if err := g.do(ctx, http.MethodGet, "/payments/"+req.ProviderPaymentID, nil, &p); err != nil {
+		return nil, err
+	}
+	if p.OrderID != req.IntentID {
+		return nil, ErrIntentMismatch
+	}
+
+	return p.result(), nil
+}
+
+func (g *RazorpayGateway) Capture(ctx context.Context, providerPaymentID string, amount int64, currency string) (*PaymentResult, error) {
+	body := map[string]interface{}{
+		"amount":   amount,
+		"currency": currency,
+	}
+
+	var p razorpayPayment
+	if err := g.do(ctx, http.MethodPost, "/payments/"+providerPaymentID+"/capture", body, &p); err != nil {
+		return nil, err
+	}
+
+	return p.result(), nil
+}
+
+func (g *RazorpayGateway) Refund(ctx context.Context, req RefundRequest) (*RefundResult, error) {
+	body := map[string]interface{}{
+		"amount":  req.Amount,
+		"receipt": req.Reference,
+		"notes":   map[string]string{"reason": req.Reason},
+	}
+
+	var r razorpayRefund
+	if err := g.do(ctx, http.MethodPost, "/payments/"+req.ProviderPaymentID+"/refund", body, &r); err != nil {
+		return nil, err
+	}
+
+	return r.result(), nil
+}
+
+func (r razorpayRefund) result() *RefundResult {
+	status := RefundPending
+	switch r.Status {
+	case "processed":
+		status = RefundProcessed
+	case "failed":
+		status = RefundFailed
+	}
+
+	return &RefundResult{ID: r.ID, Reference: r.Receipt, Status: status, Amount: r.Amount}
+}
+
+type razorpayWebhook struct {
+	Event   string `json:"event"`
+	Payload struct {
+		Payment struct {
+			Entity razorpayPayment `json:"entity"`
+		} `json:"payment"`
+		Refund struct {
+			Entity razorpayRefund `json:"entity"`
+		} `json:"refund"`
+	} `json:"payload"`
+}
+
+// VerifyWebhook checks X-Razorpay-Signature, an HMAC-SHA256 of the raw body
+// keyed with the webhook secret configured in the Razorpay dashboard.
+func (g *RazorpayGateway) VerifyWebhook(payload []byte, headers http.Header) (string, error) {
+	if !validHMAC(g.webhookSecret, string(payload), headers.Get(razorpaySignatureHeader)) {
+		return "", ErrInvalidSignature
+	}
+
+	if eventID := headers.Get(razorpayEventIDHeader); eventID != "" {
+		return eventID, nil
+	}
+	return payloadDigest(payload), nil
+}
+
+func (g *RazorpayGateway) ParseWebhook(payload []byte) (*WebhookEvent, error) {
+	var body razorpayWebhook
+	if err := json.Unmarshal(payload, &body); err != nil {
+		return nil, err
+	}
+
+	switch body.Event {
+	case "payment.authorized", "payment.captured", "payment.failed":
+	case "refund.processed", "refund.failed":
+		r := body.Payload.Refund.Entity
+		return &WebhookEvent{
+			Type:              body.Event,
+			ProviderPaymentID: r.PaymentID,
+			Amount:            r.Amount,
+			Currency:          r.Currency,
+			Refund:            r.result(),
+		}, nil
+	default:
+		return nil, ErrUnsupportedEvent
+	}
+
+	p := body.Payload.Payment.Entity.result()
+	return &WebhookEvent{
+		Type:              body.Event,
+		IntentID:          p.IntentID,
+		ProviderPaymentID: p.ProviderPaymentID,
+		Status:            p.Status,
+		Amount:            p.Amount,
+		Currency:          p.Currency,
+	}, nil
+}
+
+func (p razorpayPayment) result() *PaymentResult {
+	status := StatusCreated
+	switch p.Status {
+	case "authorized":
+		status = StatusAuthorized
+	case "captured":
+		status = StatusCaptured
+	case "refunded":
+		status = StatusRefunded
+	case "failed":
+		status = StatusFailed
+	}
+
+	return &PaymentResult{
+		IntentID:          p.OrderID,
+		ProviderPaymentID: p.ID,
+		Status:            status,
+		Amount:            p.Amount,
+		Currency:          p.Currency,
+	}
+}
+
+// do sends an authenticated JSON request and decodes the response into out
+func (g *RazorpayGateway) do(ctx context.Context, method, path string, body interface{}, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, g.baseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(g.keyID, g.keySecret)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("razorpay: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("razorpay: %w", err)
+	}
+
+	if resp.StatusCode >= 300 {
+		err := fmt.Errorf("razorpay: unexpected status %d", resp.StatusCode)
+		var apiErr razorpayError
+		if json.Unmarshal(data, &apiErr) == nil && apiErr.Error.Description != "" {
+			err = fmt.Errorf("razorpay: %s: %s", apiErr.Error.Code, apiErr.Error.Description)
+		}
+		// A 4xx is Razorpay refusing the request; timeouts, rate limits
+		// and 5xx may or may not have been acted on
+		if resp.StatusCode < 500 && resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests {
+			return fmt.Errorf("%w: %v", ErrRejected, err)
+		}
+		return err
+	}
+
+	return json.Unmarshal(data, out)
+}
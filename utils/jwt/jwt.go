@@ -5,91 +5,248 @@ import (
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 )
 
-// JWTManager holds the secret keys and token durations
-type JWTManager struct {
+// Token kinds other than access tokens carry a typ claim, so neither can be
+// passed off as an access token
+const (
+	refreshType   = "refresh"
+	challengeType = "mfa_challenge"
+)
+
+// Config describes how tokens are signed. With Keys set, tokens are signed
+// with SigningKeyID (RS256 or EdDSA, kid in the header) and verified with any
+// listed key, which is how keys are rotated. Without keys everything is
+// signed HS256 with the secrets. The secrets also keep verifying tokens
+// issued before keys were configured until those expire.
+type Config struct {
 	AccessSecret  string
 	RefreshSecret string
 	AccessTTL     time.Duration
 	RefreshTTL    time.Duration
+	Issuer        string // iss of every token, default "vestra"
+	Audience      string // aud of access tokens, default "vestra-api"
+	Keys          []KeyConfig
+	SigningKeyID  string // default: the first key with a private key
 }
 
-// NewJWTManager initializes a JWTManager
-func NewJWTManager(accessSecret, refreshSecret string, accessTTL, refreshTTL time.Duration) *JWTManager {
-	return &JWTManager{
-		AccessSecret:  accessSecret,
-		RefreshSecret: refreshSecret,
-		AccessTTL:     accessTTL,
-		RefreshTTL:    refreshTTL,
-	}
+// JWTManager signs and verifies access, refresh and two-factor challenge
+// tokens
+type JWTManager struct {
+	Issuer     string
+	Audience   string
+	AccessTTL  time.Duration
+	RefreshTTL time.Duration
+
+	accessSecret  []byte
+	refreshSecret []byte
+	keys          map[string]*key
+	signing       *key // nil: HS256 with the secrets
 }
 
-// GenerateAccessToken generates a JWT access token
-func (j *JWTManager) GenerateAccessToken(userID string) (string, error) {
-	claims := jwt.MapClaims{
-		"user_id": userID,
-		"exp":     time.Now().Add(j.AccessTTL).Unix(),
-		"iat":     time.Now().Unix(),
-	}
+// Claims are the claims of every token this service issues. Subject is the
+// user ID.
+type Claims struct {
+	jwt.RegisteredClaims
+	SessionID    string `json:"sid,omitempty"`
+	Role         string `json:"role,omitempty"`
+	TokenVersion int    `json:"ver"`
+	MFA          bool   `json:"mfa,omitempty"`
+	Type         string `json:"typ,omitempty"` // empty for access tokens
+
+	// UserID is where tokens issued before standard claims kept the subject
+	UserID string `json:"user_id,omitempty"`
+}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(j.AccessSecret))
+// Subject describes who an access token is issued to
+type Subject struct {
+	UserID       string
+	SessionID    string
+	Role         string
+	TokenVersion int  // the user's current token version, checked on every request
+	MFA          bool // the session was started with a second factor
 }
 
-// GenerateRefreshToken generates a JWT refresh token
-func (j *JWTManager) GenerateRefreshToken(userID string) (string, error) {
-	claims := jwt.MapClaims{
-		"user_id": userID,
-		"exp":     time.Now().Add(j.RefreshTTL).Unix(),
-		"iat":     time.Now().Unix(),
+// NewJWTManager loads the configured keys
+func NewJWTManager(cfg Config) (*JWTManager, error) {
+	if cfg.Issuer == "" {
+		cfg.Issuer = "vestra"
+	}
+	if cfg.Audience == "" {
+		cfg.Audience = "vestra-api"
+	}
+
+	j := &JWTManager{
+		Issuer:        cfg.Issuer,
+		Audience:      cfg.Audience,
+		AccessTTL:     cfg.AccessTTL,
+		RefreshTTL:    cfg.RefreshTTL,
+		accessSecret:  []byte(cfg.AccessSecret),
+		refreshSecret: []byte(cfg.RefreshSecret),
+		keys:          map[string]*key{},
+	}
+
+	if err := j.loadKeys(cfg.Keys, cfg.SigningKeyID); err != nil {
+		return nil, err
+	}
+
+	if j.signing == nil && (cfg.AccessSecret == "" || cfg.RefreshSecret == "") {
+		return nil, errors.New("jwt: either signing keys or both secrets must be configured")
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(j.RefreshSecret))
+	return j, nil
 }
 
+// GenerateAccessToken generates a JWT access token for a login session
+func (j *JWTManager) GenerateAccessToken(s Subject) (string, error) {
+	claims := j.newClaims(s.UserID, j.Audience, j.AccessTTL)
+	claims.SessionID = s.SessionID
+	claims.Role = s.Role
+	claims.TokenVersion = s.TokenVersion
+	claims.MFA = s.MFA
 
-func (j *JWTManager) ValidateRefreshToken(tokenStr string) (map[string]interface{}, error) {
-	token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
-		// Ensure signing method is HMAC
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, errors.New("invalid signing method")
-		}
-		return []byte(j.RefreshSecret), nil
-	})
+	return j.sign(claims, j.accessSecret)
+}
+
+// GenerateRefreshToken generates a JWT refresh token. jti identifies the
+// stored token row and sid the session (token family) it belongs to.
+func (j *JWTManager) GenerateRefreshToken(userID, sessionID, jti string) (string, error) {
+	claims := j.newClaims(userID, j.Issuer, j.RefreshTTL)
+	claims.ID = jti
+	claims.SessionID = sessionID
+	claims.Type = refreshType
+
+	return j.sign(claims, j.refreshSecret)
+}
+
+// GenerateChallengeToken is handed out after a correct password when the
+// user has two-factor enabled; it only buys a try at the second step.
+func (j *JWTManager) GenerateChallengeToken(userID string, ttl time.Duration) (string, error) {
+	claims := j.newClaims(userID, j.Issuer, ttl)
+	claims.Type = challengeType
+
+	return j.sign(claims, j.accessSecret)
+}
+
+func (j *JWTManager) ValidateAccessToken(token string) (*Claims, error) {
+	claims, err := j.parse(token, j.accessSecret, j.Audience)
 	if err != nil {
 		return nil, err
 	}
 
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok || !token.Valid {
-		return nil, errors.New("invalid token")
+	if claims.Type != "" {
+		return nil, errors.New("not an access token")
 	}
 
 	return claims, nil
 }
 
-func (j *JWTManager) ValidateAccessToken(token string) (map[string]interface{}, error) {
-	parsedToken, err := jwt.Parse(token, func(t *jwt.Token) (interface{}, error) {
+func (j *JWTManager) ValidateRefreshToken(token string) (*Claims, error) {
+	claims, err := j.parse(token, j.refreshSecret, j.Issuer)
+	if err != nil {
+		return nil, err
+	}
 
-		// Validate signing method
-		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, errors.New("unexpected signing method")
-		}
+	// Refresh tokens from before standard claims had no typ
+	if claims.Type != refreshType && !(claims.Type == "" && claims.Issuer == "") {
+		return nil, errors.New("not a refresh token")
+	}
+
+	return claims, nil
+}
+
+// ValidateChallengeToken returns the user a challenge token was issued to
+func (j *JWTManager) ValidateChallengeToken(token string) (string, error) {
+	claims, err := j.parse(token, j.accessSecret, j.Issuer)
+	if err != nil {
+		return "", err
+	}
+
+	if claims.Type != challengeType {
+		return "", errors.New("not a challenge token")
+	}
+
+	return claims.Subject, nil
+}
+
+func (j *JWTManager) newClaims(subject, audience string, ttl time.Duration) *Claims {
+	now := time.Now()
+	return &Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    j.Issuer,
+			Subject:   subject,
+			Audience:  jwt.ClaimStrings{audience},
+			ID:        uuid.NewString(),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		},
+	}
+}
+
+// sign uses the active key, or HS256 with secret when no keys are configured
+func (j *JWTManager) sign(claims *Claims, secret []byte) (string, error) {
+	if j.signing == nil {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(secret)
+	}
+
+	token := jwt.NewWithClaims(j.signing.method, claims)
+	token.Header["kid"] = j.signing.id
+	return token.SignedString(j.signing.private)
+}
 
-		// Use exported field names (capitalized)
-		return []byte(j.AccessSecret), nil
-	})
+// parse verifies the signature by kid, or with secret for HS256 tokens
+// without one, and checks expiry, issuer and audience
+func (j *JWTManager) parse(tokenStr string, secret []byte, audience string) (*Claims, error) {
+	claims := &Claims{}
+
+	token, err := jwt.ParseWithClaims(tokenStr, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		if kid == "" {
+			if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok || len(secret) == 0 {
+				return nil, errors.New("unexpected signing method")
+			}
+			return secret, nil
+		}
 
-	if err != nil || !parsedToken.Valid {
+		k, ok := j.keys[kid]
+		if !ok {
+			return nil, errors.New("unknown key id")
+		}
+		if t.Method.Alg() != k.method.Alg() {
+			return nil, errors.New("unexpected signing method")
+		}
+		return k.public, nil
+	}, jwt.WithExpirationRequired())
+	if err != nil || !token.Valid {
 		return nil, errors.New("invalid token")
 	}
 
-	claims, ok := parsedToken.Claims.(jwt.MapClaims)
-	if !ok {
+	// Tokens from before standard claims: no iss/aud, user in user_id
+	if claims.Issuer == "" && token.Header["kid"] == nil {
+		claims.Subject = claims.UserID
+	} else {
+		if claims.Issuer != j.Issuer {
+			return nil, errors.New("invalid token issuer")
+		}
+		if !audienceContains(claims.Audience, audience) {
+			return nil, errors.New("invalid token audience")
+		}
+	}
+
+	if claims.Subject == "" {
 		return nil, errors.New("invalid token claims")
 	}
 
 	return claims, nil
 }
+
+func audienceContains(audience jwt.ClaimStrings, want string) bool {
+	for _, aud := range audience {
+		if aud == want {
+			return true
+		}
+	}
+	return false
+}
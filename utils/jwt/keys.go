@@ -0,0 +1,179 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// KeyConfig is one signing key. A key with a private key can sign; keys
+// listed with only a public key still verify tokens, which is how a retired
+// key is kept around until the tokens it signed have expired.
+type KeyConfig struct {
+	ID             string // kid
+	PrivateKeyFile string // PEM, PKCS#8 or PKCS#1 RSA
+	PublicKeyFile  string // PEM, PKIX; derived from the private key if empty
+}
+
+type key struct {
+	id      string
+	method  jwt.SigningMethod
+	private crypto.Signer
+	public  crypto.PublicKey
+}
+
+// loadKeys reads every configured key and picks the signing one
+func (j *JWTManager) loadKeys(configs []KeyConfig, signingID string) error {
+	for _, cfg := range configs {
+		if cfg.ID == "" {
+			return errors.New("jwt: key without id")
+		}
+		if _, dup := j.keys[cfg.ID]; dup {
+			return fmt.Errorf("jwt: duplicate key id %q", cfg.ID)
+		}
+
+		k, err := loadKey(cfg)
+		if err != nil {
+			return fmt.Errorf("jwt: key %q: %w", cfg.ID, err)
+		}
+		j.keys[cfg.ID] = k
+
+		if j.signing == nil && signingID == "" && k.private != nil {
+			j.signing = k
+		}
+	}
+
+	if signingID != "" {
+		k, ok := j.keys[signingID]
+		if !ok || k.private == nil {
+			return fmt.Errorf("jwt: signing key %q has no private key", signingID)
+		}
+		j.signing = k
+	}
+
+	return nil
+}
+
+func loadKey(cfg KeyConfig) (*key, error) {
+	k := &key{id: cfg.ID}
+
+	if cfg.PrivateKeyFile != "" {
+		block, err := readPEM(cfg.PrivateKeyFile)
+		if err != nil {
+			return nil, err
+		}
+
+		var parsed interface{}
+		if block.Type == "RSA PRIVATE KEY" {
+			parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+		} else {
+			parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		signer, ok := parsed.(crypto.Signer)
+		if !ok {
+			return nil, errors.New("unsupported private key")
+		}
+		k.private = signer
+		k.public = signer.Public()
+	}
+
+	if cfg.PublicKeyFile != "" {
+		block, err := readPEM(cfg.PublicKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		public, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		k.public = public
+	}
+
+	switch k.public.(type) {
+	case *rsa.PublicKey:
+		k.method = jwt.SigningMethodRS256
+	case ed25519.PublicKey:
+		k.method = jwt.SigningMethodEdDSA
+	case nil:
+		return nil, errors.New("no key file given")
+	default:
+		return nil, errors.New("only RSA and Ed25519 keys are supported")
+	}
+
+	return k, nil
+}
+
+func readPEM(path string) (*pem.Block, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM data", path)
+	}
+	return block, nil
+}
+
+// JWK is a public key in JSON Web Key form (RFC 7517)
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`   // RSA modulus
+	E   string `json:"e,omitempty"`   // RSA exponent
+	Crv string `json:"crv,omitempty"` // OKP curve
+	X   string `json:"x,omitempty"`   // OKP public key
+}
+
+// JWKS is the document served at /.well-known/jwks.json
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS lists the public half of every configured key so other services can
+// verify access tokens without sharing a secret. They should check aud and
+// reject tokens carrying a typ claim, which are not access tokens.
+func (j *JWTManager) JWKS() JWKS {
+	ids := make([]string, 0, len(j.keys))
+	for id := range j.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	set := JWKS{Keys: []JWK{}}
+	for _, id := range ids {
+		k := j.keys[id]
+		jwk := JWK{Kid: id, Use: "sig", Alg: k.method.Alg()}
+
+		switch public := k.public.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		}
+
+		set.Keys = append(set.Keys, jwk)
+	}
+
+	return set
+}
@@ -0,0 +1,194 @@
+package money
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Money is an amount in the currency's minor unit (paise for INR) plus its
+// ISO 4217 code. Amounts never pass through floats.
+//
+// Embedded in models with a prefix, e.g.
+//
+//	Price money.Money `gorm:"embedded;embeddedPrefix:price_" json:"price"`
+//
+// which maps to the columns price_minor and price_currency.
+type Money struct {
+	Amount   int64  `gorm:"column:minor;not null;default:0" json:"amount"`
+	Currency string `gorm:"column:currency;size:3;not null;default:INR" json:"currency"`
+}
+
+var (
+	ErrCurrencyMismatch = errors.New("money: currency mismatch")
+	ErrOverflow         = errors.New("money: amount overflow")
+	ErrInvalidCurrency  = errors.New("money: invalid currency code")
+)
+
+var defaultCurrency = "INR"
+
+// minorDigits lists currencies whose minor unit isn't 1/100
+var minorDigits = map[string]int{
+	"JPY": 0,
+	"KRW": 0,
+	"BHD": 3,
+	"KWD": 3,
+	"OMR": 3,
+}
+
+// SetDefaultCurrency sets the store currency used when none is given
+func SetDefaultCurrency(code string) {
+	if code = strings.ToUpper(strings.TrimSpace(code)); code != "" {
+		defaultCurrency = code
+	}
+}
+
+// DefaultCurrency returns the store currency
+func DefaultCurrency() string {
+	return defaultCurrency
+}
+
+// New builds Money from minor units; an empty currency means the default
+func New(amount int64, currency string) Money {
+	return Money{Amount: amount, Currency: normalize(currency)}
+}
+
+// Zero returns nothing in the given currency
+func Zero(currency string) Money {
+	return New(0, currency)
+}
+
+// FromMajor converts whole units (rupees) to Money
+func FromMajor(major int64, currency string) (Money, error) {
+	currency = normalize(currency)
+	factor := int64(math.Pow10(Digits(currency)))
+	if major > math.MaxInt64/factor || major < math.MinInt64/factor {
+		return Money{}, ErrOverflow
+	}
+	return Money{Amount: major * factor, Currency: currency}, nil
+}
+
+// Digits returns how many decimal places the currency's minor unit has
+func Digits(currency string) int {
+	if d, ok := minorDigits[normalize(currency)]; ok {
+		return d
+	}
+	return 2
+}
+
+// Validate checks the currency code is a three letter ISO code
+func (m Money) Validate() error {
+	if len(m.Currency) != 3 {
+		return ErrInvalidCurrency
+	}
+	for _, r := range m.Currency {
+		if r < 'A' || r > 'Z' {
+			return ErrInvalidCurrency
+		}
+	}
+	return nil
+}
+
+// Add returns m + o; both must share a currency
+func (m Money) Add(o Money) (Money, error) {
+	if err := m.sameCurrency(o); err != nil {
+		return Money{}, err
+	}
+	sum := m.Amount + o.Amount
+	if (o.Amount > 0 && sum < m.Amount) || (o.Amount < 0 && sum > m.Amount) {
+		return Money{}, ErrOverflow
+	}
+	return Money{Amount: sum, Currency: m.Currency}, nil
+}
+
+// Sub returns m - o; both must share a currency
+func (m Money) Sub(o Money) (Money, error) {
+	if o.Amount == math.MinInt64 {
+		return Money{}, ErrOverflow
+	}
+	return m.Add(Money{Amount: -o.Amount, Currency: o.Currency})
+}
+
+// Mul returns m * qty, e.g. a line total
+func (m Money) Mul(qty int64) (Money, error) {
+	if qty == 0 || m.Amount == 0 {
+		return Money{Amount: 0, Currency: m.Currency}, nil
+	}
+	product := m.Amount * qty
+	if product/qty != m.Amount {
+		return Money{}, ErrOverflow
+	}
+	return Money{Amount: product, Currency: m.Currency}, nil
+}
+
+// Sum adds amounts that must all be in currency
+func Sum(currency string, amounts ...Money) (Money, error) {
+	total := Zero(currency)
+	for _, a := range amounts {
+		var err error
+		if total, err = total.Add(a); err != nil {
+			return Money{}, err
+		}
+	}
+	return total, nil
+}
+
+// Cmp returns -1, 0 or 1; both must share a currency
+func (m Money) Cmp(o Money) (int, error) {
+	if err := m.sameCurrency(o); err != nil {
+		return 0, err
+	}
+	switch {
+	case m.Amount < o.Amount:
+		return -1, nil
+	case m.Amount > o.Amount:
+		return 1, nil
+	default:
+		return 0, nil
+	}
+}
+
+// Equal reports whether amount and currency both match
+func (m Money) Equal(o Money) bool {
+	return m.Amount == o.Amount && normalize(m.Currency) == normalize(o.Currency)
+}
+
+func (m Money) IsZero() bool {
+	return m.Amount == 0
+}
+
+func (m Money) IsPositive() bool {
+	return m.Amount > 0
+}
+
+// String formats as "INR 499.00"
+func (m Money) String() string {
+	digits := Digits(m.Currency)
+	sign := ""
+	amount := m.Amount
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+	if digits == 0 {
+		return fmt.Sprintf("%s %s%d", m.Currency, sign, amount)
+	}
+	factor := int64(math.Pow10(digits))
+	return fmt.Sprintf("%s %s%d.%0*d", m.Currency, sign, amount/factor, digits, amount%factor)
+}
+
+func (m Money) sameCurrency(o Money) error {
+	if normalize(m.Currency) != normalize(o.Currency) {
+		return fmt.Errorf("%w: %s vs %s", ErrCurrencyMismatch, m.Currency, o.Currency)
+	}
+	return nil
+}
+
+func normalize(currency string) string {
+	currency = strings.ToUpper(strings.TrimSpace(currency))
+	if currency == "" {
+		return defaultCurrency
+	}
+	return currency
+}
@@ -0,0 +1,132 @@
+package money
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestArithmetic(t *testing.T) {
+	inr := func(amount int64) Money { return New(amount, "INR") }
+
+	tests := []struct {
+		name    string
+		op      func() (Money, error)
+		want    Money
+		wantErr error
+	}{
+		{"add", func() (Money, error) { return inr(49900).Add(inr(101)) }, inr(50001), nil},
+		{"add negative", func() (Money, error) { return inr(100).Add(inr(-250)) }, inr(-150), nil},
+		{"add normalizes currency", func() (Money, error) { return inr(100).Add(New(1, " inr ")) }, inr(101), nil},
+		{"add currency mismatch", func() (Money, error) { return inr(100).Add(New(100, "USD")) }, Money{}, ErrCurrencyMismatch},
+		{"add overflow", func() (Money, error) { return inr(math.MaxInt64).Add(inr(1)) }, Money{}, ErrOverflow},
+		{"add underflow", func() (Money, error) { return inr(math.MinInt64).Add(inr(-1)) }, Money{}, ErrOverflow},
+		{"sub", func() (Money, error) { return inr(50000).Sub(inr(1)) }, inr(49999), nil},
+		{"sub currency mismatch", func() (Money, error) { return inr(100).Sub(New(1, "EUR")) }, Money{}, ErrCurrencyMismatch},
+		{"sub min int", func() (Money, error) { return inr(0).Sub(inr(math.MinInt64)) }, Money{}, ErrOverflow},
+		{"mul", func() (Money, error) { return inr(49900).Mul(3) }, inr(149700), nil},
+		{"mul zero", func() (Money, error) { return inr(49900).Mul(0) }, inr(0), nil},
+		{"mul overflow", func() (Money, error) { return inr(math.MaxInt64 / 2).Mul(3) }, Money{}, ErrOverflow},
+		{"sum", func() (Money, error) { return Sum("INR", inr(100), inr(250), inr(-50)) }, inr(300), nil},
+		{"sum empty", func() (Money, error) { return Sum("INR") }, inr(0), nil},
+		{"sum currency mismatch", func() (Money, error) { return Sum("INR", inr(100), New(1, "USD")) }, Money{}, ErrCurrencyMismatch},
+		{"from major", func() (Money, error) { return FromMajor(499, "INR") }, inr(49900), nil},
+		{"from major zero digits", func() (Money, error) { return FromMajor(500, "JPY") }, New(500, "JPY"), nil},
+		{"from major three digits", func() (Money, error) { return FromMajor(2, "KWD") }, New(2000, "KWD"), nil},
+		{"from major overflow", func() (Money, error) { return FromMajor(math.MaxInt64/10, "INR") }, Money{}, ErrOverflow},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.op()
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCmp(t *testing.T) {
+	tests := []struct {
+		name    string
+		a, b    Money
+		want    int
+		wantErr error
+	}{
+		{"less", New(1, "INR"), New(2, "INR"), -1, nil},
+		{"equal", New(2, "INR"), New(2, "inr"), 0, nil},
+		{"greater", New(3, "INR"), New(2, "INR"), 1, nil},
+		{"currency mismatch", New(1, "INR"), New(1, "USD"), 0, ErrCurrencyMismatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.a.Cmp(tt.b)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Cmp = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		currency string
+		wantErr  error
+	}{
+		{"INR", nil},
+		{"USD", nil},
+		{"", ErrInvalidCurrency},
+		{"IN", ErrInvalidCurrency},
+		{"INRS", ErrInvalidCurrency},
+		{"inr", ErrInvalidCurrency},
+		{"IN1", ErrInvalidCurrency},
+		{"₹", ErrInvalidCurrency},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.currency, func(t *testing.T) {
+			err := Money{Amount: 100, Currency: tt.currency}.Validate()
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Validate(%q) = %v, want %v", tt.currency, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewDefaultCurrency(t *testing.T) {
+	defer SetDefaultCurrency(DefaultCurrency())
+
+	SetDefaultCurrency(" usd ")
+	if got := New(100, ""); got.Currency != "USD" {
+		t.Errorf("New without currency = %s, want USD", got.Currency)
+	}
+	if got := New(100, "eur"); got.Currency != "EUR" {
+		t.Errorf("New(eur) = %s, want EUR", got.Currency)
+	}
+}
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		m    Money
+		want string
+	}{
+		{New(49900, "INR"), "INR 499.00"},
+		{New(5, "INR"), "INR 0.05"},
+		{New(-1234, "INR"), "INR -12.34"},
+		{New(500, "JPY"), "JPY 500"},
+		{New(12345, "KWD"), "KWD 12.345"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.m.String(); got != tt.want {
+			t.Errorf("String() = %q, want %q", got, tt.want)
+		}
+	}
+}
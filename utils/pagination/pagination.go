@@ -0,0 +1,189 @@
+package pagination
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// DefaultLimit and MaxLimit bound the page size a client can ask for
+const (
+	DefaultLimit = 20
+	MaxLimit     = 100
+)
+
+var (
+	ErrInvalidSort   = errors.New("invalid sort")
+	ErrInvalidCursor = errors.New("invalid cursor")
+)
+
+// Params is a page request. Admin grids page by number (Page); feeds over
+// large tables continue from the Cursor in the previous page's meta, which
+// stays correct while rows are being added.
+type Params struct {
+	Limit  int
+	Page   int
+	Cursor string
+	Sort   string // a field name, "-" prefix for descending
+}
+
+// FromQuery reads ?limit, page, cursor and sort. An out-of-range limit
+// falls back to defaultLimit.
+func FromQuery(c *fiber.Ctx, defaultLimit int) Params {
+	p := Params{
+		Limit:  c.QueryInt("limit", defaultLimit),
+		Page:   c.QueryInt("page", 1),
+		Cursor: c.Query("cursor"),
+		Sort:   c.Query("sort"),
+	}
+	if p.Limit < 1 || p.Limit > MaxLimit {
+		p.Limit = defaultLimit
+	}
+	if p.Page < 1 {
+		p.Page = 1
+	}
+	return p
+}
+
+// Offset is how many rows the page skips
+func (p Params) Offset() int {
+	return (p.Page - 1) * p.Limit
+}
+
+// Sort is a requested sort resolved against a list's allowed fields
+type Sort struct {
+	Field string
+	Expr  string // SQL expression behind Field
+	Desc  bool
+}
+
+// ParseSort resolves raw ("price", "-created_at") against allowed, which
+// maps field names to SQL expressions; an empty raw means def
+func ParseSort(raw string, allowed map[string]string, def string) (Sort, error) {
+	if raw == "" {
+		raw = def
+	}
+	field := strings.TrimPrefix(raw, "-")
+	expr, ok := allowed[field]
+	if !ok {
+		return Sort{}, ErrInvalidSort
+	}
+	return Sort{Field: field, Expr: expr, Desc: strings.HasPrefix(raw, "-")}, nil
+}
+
+// String is the sort as a client passes it
+func (s Sort) String() string {
+	if s.Desc {
+		return "-" + s.Field
+	}
+	return s.Field
+}
+
+// OrderBy orders by the sort, then by key so rows with equal values keep
+// a stable order across pages
+func (s Sort) OrderBy(key string) string {
+	dir := "ASC"
+	if s.Desc {
+		dir = "DESC"
+	}
+	return fmt.Sprintf("%s %s, %s %s", s.Expr, dir, key, dir)
+}
+
+// CursorKey is the key of the row the page's cursor continues after, or
+// empty without a cursor. A cursor made for another sort, or one whose key
+// isn't a UUID, is ErrInvalidCursor.
+func (s Sort) CursorKey(p Params) (string, error) {
+	if p.Cursor == "" {
+		return "", nil
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(p.Cursor)
+	if err != nil {
+		return "", ErrInvalidCursor
+	}
+	sort, id, ok := strings.Cut(string(raw), "|")
+	if !ok || sort != s.String() {
+		return "", ErrInvalidCursor
+	}
+	key, err := uuid.Parse(id)
+	if err != nil {
+		return "", ErrInvalidCursor
+	}
+	return key.String(), nil
+}
+
+// After narrows where to the rows following the cursor's row of table.
+// The cursor only carries that row's key; its sort value is read back in
+// a subquery, so any sort expression works, but the row must still exist
+// for the page to continue. Without a cursor where is returned as is.
+func (s Sort) After(p Params, table, key, where string, args []interface{}) (string, []interface{}, error) {
+	id, err := s.CursorKey(p)
+	if err != nil {
+		return "", nil, err
+	}
+	if id == "" {
+		return where, args, nil
+	}
+
+	op := ">"
+	if s.Desc {
+		op = "<"
+	}
+	where += fmt.Sprintf(
+		" AND (%s, %s) %s ((SELECT %s FROM %s WHERE %s = ?), ?)",
+		s.Expr, key, op, s.Expr, table, key,
+	)
+	return where, append(args, id, id), nil
+}
+
+// Meta describes a page for the client. Numbered pages carry Page and the
+// totals; cursor pages carry NextCursor while HasMore.
+type Meta struct {
+	Limit      int    `json:"limit"`
+	Sort       string `json:"sort,omitempty"`
+	Page       int    `json:"page,omitempty"`
+	Total      *int64 `json:"total,omitempty"`
+	TotalPages int    `json:"total_pages,omitempty"`
+	HasMore    bool   `json:"has_more"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// OffsetMeta describes page p out of total rows
+func OffsetMeta(p Params, sort Sort, total int64) *Meta {
+	pages := int((total + int64(p.Limit) - 1) / int64(p.Limit))
+	return &Meta{
+		Limit:      p.Limit,
+		Sort:       sort.String(),
+		Page:       p.Page,
+		Total:      &total,
+		TotalPages: pages,
+		HasMore:    p.Page < pages,
+	}
+}
+
+// PageMeta describes numbered page p fetched with Limit+1 rows, for lists
+// that are too costly to count
+func PageMeta(p Params, sort Sort, fetched int) *Meta {
+	return &Meta{
+		Limit:   p.Limit,
+		Sort:    sort.String(),
+		Page:    p.Page,
+		HasMore: fetched > p.Limit,
+	}
+}
+
+// CursorMeta describes a page fetched with Limit+1 rows: fetched is how
+// many came back and lastKey the key of the last row kept. Callers drop
+// the extra row themselves.
+func CursorMeta(p Params, sort Sort, fetched int, lastKey func() string) *Meta {
+	meta := &Meta{Limit: p.Limit, Sort: sort.String()}
+	if fetched > p.Limit {
+		meta.HasMore = true
+		meta.NextCursor = base64.RawURLEncoding.EncodeToString([]byte(sort.String() + "|" + lastKey()))
+	}
+	return meta
+}
@@ -0,0 +1,143 @@
+package pagination
+
+import (
+	"encoding/base64"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+var productSorts = map[string]string{
+	"price":      "p.price",
+	"created_at": "p.created_at",
+}
+
+func TestParseSort(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    Sort
+		wantErr error
+	}{
+		{"", Sort{Field: "created_at", Expr: "p.created_at", Desc: true}, nil},
+		{"price", Sort{Field: "price", Expr: "p.price"}, nil},
+		{"-price", Sort{Field: "price", Expr: "p.price", Desc: true}, nil},
+		{"name", Sort{}, ErrInvalidSort},
+		{"p.price", Sort{}, ErrInvalidSort},
+		{"price; DROP TABLE products", Sort{}, ErrInvalidSort},
+		{"--price", Sort{}, ErrInvalidSort},
+		{"-", Sort{}, ErrInvalidSort},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			got, err := ParseSort(tt.raw, productSorts, "-created_at")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseSort(%q) = %+v, want %+v", tt.raw, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOrderBy(t *testing.T) {
+	asc := Sort{Field: "price", Expr: "p.price"}
+	if got, want := asc.OrderBy("p.id"), "p.price ASC, p.id ASC"; got != want {
+		t.Errorf("OrderBy = %q, want %q", got, want)
+	}
+	desc := Sort{Field: "price", Expr: "p.price", Desc: true}
+	if got, want := desc.OrderBy("p.id"), "p.price DESC, p.id DESC"; got != want {
+		t.Errorf("OrderBy = %q, want %q", got, want)
+	}
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	sort := Sort{Field: "price", Expr: "p.price", Desc: true}
+	p := Params{Limit: 2}
+
+	const key = "5b1f6d2e-8a3c-4f4e-9d7a-2c6b1e0f3a91"
+	meta := CursorMeta(p, sort, 3, func() string { return key })
+	if !meta.HasMore || meta.NextCursor == "" {
+		t.Fatalf("meta = %+v, want a next cursor", meta)
+	}
+
+	p.Cursor = meta.NextCursor
+	where, args, err := sort.After(p, "products p", "p.id", "p.deleted_at IS NULL", []interface{}{})
+	if err != nil {
+		t.Fatalf("After: %v", err)
+	}
+	wantWhere := "p.deleted_at IS NULL AND (p.price, p.id) < ((SELECT p.price FROM products p WHERE p.id = ?), ?)"
+	if where != wantWhere {
+		t.Errorf("where = %q, want %q", where, wantWhere)
+	}
+	if want := []interface{}{key, key}; !reflect.DeepEqual(args, want) {
+		t.Errorf("args = %v, want %v", args, want)
+	}
+
+	last := CursorMeta(p, sort, 2, func() string { return key })
+	if last.HasMore || last.NextCursor != "" {
+		t.Errorf("last page meta = %+v, want no next cursor", last)
+	}
+}
+
+func TestCursorInvalid(t *testing.T) {
+	sort := Sort{Field: "price", Expr: "p.price"}
+	const key = "5b1f6d2e-8a3c-4f4e-9d7a-2c6b1e0f3a91"
+	encode := func(s string) string { return base64.RawURLEncoding.EncodeToString([]byte(s)) }
+
+	tests := []struct {
+		name   string
+		cursor string
+	}{
+		{"not base64", key + "!"},
+		{"padded base64", base64.URLEncoding.EncodeToString([]byte("price|{" + key + "}"))},
+		{"no separator", encode(key)},
+		{"other sort field", encode("created_at|" + key)},
+		{"other sort direction", encode("-price|" + key)},
+		{"no key", encode("price|")},
+		{"key not a uuid", encode("price|row-2")},
+		{"key with sql", encode("price|" + key + "' OR '1'='1")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := sort.After(Params{Limit: 20, Cursor: tt.cursor}, "products p", "p.id", "TRUE", nil)
+			if !errors.Is(err, ErrInvalidCursor) {
+				t.Errorf("err = %v, want %v", err, ErrInvalidCursor)
+			}
+		})
+	}
+
+	where, args, err := sort.After(Params{Limit: 20}, "products p", "p.id", "TRUE", nil)
+	if err != nil || where != "TRUE" || args != nil {
+		t.Errorf("without a cursor After = (%q, %v, %v), want the filter unchanged", where, args, err)
+	}
+}
+
+func TestOffsetMeta(t *testing.T) {
+	sort := Sort{Field: "price", Expr: "p.price"}
+
+	tests := []struct {
+		page      int
+		total     int64
+		wantPages int
+		wantMore  bool
+	}{
+		{1, 0, 0, false},
+		{1, 20, 1, false},
+		{1, 21, 2, true},
+		{2, 21, 2, false},
+	}
+
+	for _, tt := range tests {
+		p := Params{Limit: 20, Page: tt.page}
+		meta := OffsetMeta(p, sort, tt.total)
+		if meta.TotalPages != tt.wantPages || meta.HasMore != tt.wantMore || *meta.Total != tt.total {
+			t.Errorf("OffsetMeta(page %d, total %d) = %+v", tt.page, tt.total, meta)
+		}
+	}
+	if got := (Params{Limit: 20, Page: 3}).Offset(); got != 40 {
+		t.Errorf("Offset = %d, want 40", got)
+	}
+}
@@ -1,10 +1,11 @@
 package response
 
 type APIResponse struct {
-	StatusCode int         `json:"status"`           // HTTP status code
+	StatusCode int `json:"status"` // HTTP status code
 	// Success    bool        `json:"success"`          // success/failure
-	Message    string      `json:"message"`          // human-readable message
-	Data       interface{} `json:"data,omitempty"`   // optional data
-	Error      interface{} `json:"error,omitempty"`  // optional error
-	Code       string      `json:"code,omitempty"`   // only included if set
+	Message string      `json:"message"`         // human-readable message
+	Data    interface{} `json:"data,omitempty"`  // optional data
+	Error   interface{} `json:"error,omitempty"` // optional error
+	Code    string      `json:"code,omitempty"`  // only included if set
+	Meta    interface{} `json:"meta,omitempty"`  // pagination.Meta on list endpoints
 }
@@ -1,6 +1,10 @@
 package response
 
-import "github.com/gofiber/fiber/v2"
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"vestra-ecommerce/utils/pagination"
+)
 
 // Success response
 func Success(ctx *fiber.Ctx, status int, message string, code string, data interface{}) error {
@@ -20,6 +24,26 @@ func Success(ctx *fiber.Ctx, status int, message string, code string, data inter
 	return ctx.Status(status).JSON(resp)
 }
 
+// SuccessWithMeta is Success for a page of a list
+func SuccessWithMeta(ctx *fiber.Ctx, status int, message string, code string, data interface{}, meta *pagination.Meta) error {
+	resp := APIResponse{
+		StatusCode: status,
+		Message:    message,
+	}
+
+	if code != "" {
+		resp.Code = code
+	}
+	if data != nil {
+		resp.Data = data
+	}
+	if meta != nil {
+		resp.Meta = meta
+	}
+
+	return ctx.Status(status).JSON(resp)
+}
+
 // Error response
 func Error(ctx *fiber.Ctx, status int, message string, code string, err interface{}) error {
 	resp := APIResponse{
@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"vestra-ecommerce/config"
+)
+
+// LocalMount is the path LocalStore files are served under
+const LocalMount = "/media"
+
+const localDefaultDir = "uploads"
+
+// LocalStore keeps files in a directory on this server. Fine for a single
+// instance; with several behind a load balancer use S3Store.
+type LocalStore struct {
+	root    string
+	baseURL string
+}
+
+func NewLocalStore(cfg config.LocalStorageConfig) *LocalStore {
+	root := cfg.Dir
+	if root == "" {
+		root = localDefaultDir
+	}
+	return &LocalStore{
+		root:    root,
+		baseURL: strings.TrimRight(cfg.BaseURL, "/"),
+	}
+}
+
+func (s *LocalStore) Name() string {
+	return "local"
+}
+
+// Root is the directory to serve under LocalMount
+func (s *LocalStore) Root() string {
+	return s.root
+}
+
+// Put writes to a temporary file first, so a reader never sees half a file
+func (s *LocalStore) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	if !validKey(key) {
+		return ErrInvalidKey
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	path := filepath.Join(s.root, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (s *LocalStore) Delete(ctx context.Context, key string) error {
+	if !validKey(key) {
+		return ErrInvalidKey
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	err := os.Remove(filepath.Join(s.root, filepath.FromSlash(key)))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (s *LocalStore) URL(key string) string {
+	return s.baseURL + LocalMount + "/" + key
+}
@@ -0,0 +1,220 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"vestra-ecommerce/config"
+)
+
+const s3DefaultRegion = "us-east-1"
+
+// Uploaded objects never change under the same key, so clients and CDNs
+// may keep them
+const s3CacheControl = "public, max-age=31536000, immutable"
+
+var ErrS3Config = errors.New("storage: s3 bucket, access_key_id and secret_access_key are required")
+
+// S3Store keeps files in an S3 bucket or any service speaking the S3 API.
+// Requests are signed with AWS Signature Version 4.
+type S3Store struct {
+	endpoint      *url.URL
+	region        string
+	bucket        string
+	accessKeyID   string
+	secretKey     string
+	pathStyle     bool
+	publicBaseURL string
+	client        *http.Client
+}
+
+func NewS3Store(cfg config.S3StorageConfig) (*S3Store, error) {
+	if cfg.Bucket == "" || cfg.AccessKeyID == "" || cfg.SecretAccessKey == "" {
+		return nil, ErrS3Config
+	}
+
+	region := cfg.Region
+	if region == "" {
+		region = s3DefaultRegion
+	}
+	rawEndpoint := cfg.Endpoint
+	if rawEndpoint == "" {
+		rawEndpoint = "https://s3." + region + ".amazonaws.com"
+	}
+	endpoint, err := url.Parse(strings.TrimRight(rawEndpoint, "/"))
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("storage: invalid s3 endpoint %q", cfg.Endpoint)
+	}
+
+	return &S3Store{
+		endpoint:      endpoint,
+		region:        region,
+		bucket:        cfg.Bucket,
+		accessKeyID:   cfg.AccessKeyID,
+		secretKey:     cfg.SecretAccessKey,
+		pathStyle:     cfg.PathStyle,
+		publicBaseURL: strings.TrimRight(cfg.PublicBaseURL, "/"),
+		client:        &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+func (s *S3Store) Name() string {
+	return "s3"
+}
+
+func (s *S3Store) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	if !validKey(key) {
+		return ErrInvalidKey
+	}
+
+	headers := http.Header{}
+	headers.Set("Content-Type", contentType)
+	headers.Set("Cache-Control", s3CacheControl)
+	return s.do(ctx, http.MethodPut, key, data, headers)
+}
+
+func (s *S3Store) Delete(ctx context.Context, key string) error {
+	if !validKey(key) {
+		return ErrInvalidKey
+	}
+	// S3 answers 204 whether or not the key existed
+	return s.do(ctx, http.MethodDelete, key, nil, http.Header{})
+}
+
+func (s *S3Store) URL(key string) string {
+	if s.publicBaseURL != "" {
+		return s.publicBaseURL + "/" + key
+	}
+	return s.objectURL(key).String()
+}
+
+// objectURL addresses key virtual-host style (bucket.endpoint/key) or,
+// with path_style, as endpoint/bucket/key
+func (s *S3Store) objectURL(key string) *url.URL {
+	u := *s.endpoint
+	if s.pathStyle {
+		u.Path = u.Path + "/" + s.bucket + "/" + key
+	} else {
+		u.Host = s.bucket + "." + u.Host
+		u.Path = u.Path + "/" + key
+	}
+	return &u
+}
+
+func (s *S3Store) do(ctx context.Context, method, key string, body []byte, headers http.Header) error {
+	req, err := http.NewRequestWithContext(ctx, method, s.objectURL(key).String(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header = headers
+	req.ContentLength = int64(len(body))
+	signV4(req, body, s.accessKeyID, s.secretKey, s.region, time.Now().UTC())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		raw, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("storage: s3 %s %s: %s: %s", method, key, resp.Status, strings.TrimSpace(string(raw)))
+	}
+	return nil
+}
+
+// signV4 adds an AWS Signature Version 4 Authorization header covering the
+// host, every header already on req and the payload hash
+func signV4(req *http.Request, body []byte, accessKeyID, secretKey, region string, now time.Time) {
+	const service = "s3"
+
+	payloadHash := sha256Hex(body)
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	canonical := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		canonical[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(canonical))
+	for name := range canonical {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + canonical[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		awsURIEscape(req.URL.Path),
+		req.URL.Query().Encode(),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := day + "/" + region + "/" + service + "/aws4_request"
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), day)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKeyID, scope, signedHeaders, signature,
+	))
+}
+
+// awsURIEscape percent-encodes everything but unreserved characters and
+// the path's slashes, as SigV4 expects
+func awsURIEscape(path string) string {
+	var b strings.Builder
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		switch {
+		case c >= 'A' && c <= 'Z', c >= 'a' && c <= 'z', c >= '0' && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/':
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func hmacSHA256(key []byte, message string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(message))
+	return mac.Sum(nil)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
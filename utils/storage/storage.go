@@ -0,0 +1,62 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"vestra-ecommerce/config"
+)
+
+var (
+	ErrInvalidKey      = errors.New("storage: invalid key")
+	ErrUnknownProvider = errors.New("storage: unknown provider")
+)
+
+// BlobStore keeps uploaded files under slash-separated keys such as
+// "products/<id>/<image>/original.jpg" and hands out their public URLs.
+// Keys are chosen by us, never by the uploader.
+type BlobStore interface {
+	Name() string
+	// Put stores data under key, replacing what was there
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	// Delete removes key; a key that isn't there is not an error
+	Delete(ctx context.Context, key string) error
+	// URL is where clients fetch key from
+	URL(key string) string
+}
+
+// New builds the backend selected in app.yaml
+func New(cfg config.StorageConfig) (BlobStore, error) {
+	switch strings.ToLower(cfg.Provider) {
+	case "", "local":
+		return NewLocalStore(cfg.Local), nil
+	case "s3":
+		return NewS3Store(cfg.S3)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownProvider, cfg.Provider)
+	}
+}
+
+// validKey accepts relative keys of lowercase letters, digits, "-", "_"
+// and "." without empty, "." or ".." segments, so a key maps to the same
+// path on disk and in a bucket and can't climb out of either
+func validKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return false
+		}
+		for _, r := range segment {
+			switch {
+			case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+			default:
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -9,6 +9,7 @@ type AppError struct {
 	Status  int
 	Message string
 	Code    string
+	Details interface{}
 }
 
 func (e *AppError) Error() string {
@@ -23,6 +24,17 @@ func New(status int, code, message string) *AppError {
 	}
 }
 
+// WithDetails attaches structured data (returned to the client in the
+// response "error" field) to a copy of the error
+func (e *AppError) WithDetails(details interface{}) *AppError {
+	return &AppError{
+		Status:  e.Status,
+		Message: e.Message,
+		Code:    e.Code,
+		Details: details,
+	}
+}
+
 // Common errors
 var (
 	ErrInvalidRequest = New(http.StatusBadRequest, constant.INVALID_REQUEST, "Invalid request body")